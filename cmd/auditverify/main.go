@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/lib/go/gojunkyard.git/conn"
+	"git.sstv.io/lib/go/gojunkyard.git/env"
+)
+
+const appName = "MOLANOBAR"
+
+// config is the part of the serv configuration auditverify needs
+type config struct {
+	Database  conn.DBConfig `envconfig:"DATABASE"`
+	ProjectID int64         `envconfig:"PROJECT_ID"`
+}
+
+// auditverify walks the hash chain of the audit logs of a project and reports
+// the first broken link. It reads the same MOLANOBAR_ environment as serv and
+// exits with status 1 when the chain is broken
+//
+//	go run ./cmd/auditverify -project 10
+func main() {
+	var cfg config
+	err := env.LoadAndParse(appName, &cfg)
+	if err != nil {
+		log.Fatalf("Failed to load environment configuration. err: %s", err)
+	}
+
+	pid := flag.Int64("project", cfg.ProjectID, "Project whose audit logs are verified, defaults to MOLANOBAR_PROJECT_ID")
+	flag.Parse()
+
+	db, err := conn.InitDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database. err: %s", err)
+	}
+
+	checked, broken, err := auditTrail.Init(db, *pid).Verify(*pid)
+	if err != nil {
+		log.Fatalf("Failed to verify audit logs after %d records. err: %s", checked, err)
+	}
+	if broken != nil {
+		log.Printf("Audit log chain of project %d is broken at record %d: %s", *pid, broken.ID, broken.Reason)
+		os.Exit(1)
+	}
+	log.Printf("Audit log chain of project %d is intact, %d records verified", *pid, checked)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	payment "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment"
+)
+
+// fakegateway runs payment.FakeGateway locally. Point MOLANOBAR_PAYMENT_BASE_URL
+// at it, pay an order, then send the callback with the total price and payment
+// fee of the order
+//
+//	curl -X POST "http://127.0.0.1:4000/notify?reference=<order id>&status=paid&amount=<amount>"
+//
+// Add &silent=1 to only change the status at the gateway, leaving the order
+// to be picked up by the payment reconciler
+func main() {
+	var (
+		listen      = flag.String("listen", ":4000", "Address to listen on")
+		secret      = flag.String("secret", "", "Secret used to sign callbacks, same as MOLANOBAR_PAYMENT_CALLBACK_SECRET")
+		callbackURL = flag.String("callback", "http://127.0.0.1:3000/payments/callback", "URL callbacks are sent to")
+	)
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatalf("Failed to start fake gateway. secret cannot be empty")
+	}
+
+	gateway := payment.NewFakeGateway(*secret, *callbackURL)
+	log.Printf("Fake payment gateway listening on %s, sending callbacks to %s", *listen, *callbackURL)
+	log.Fatal(http.ListenAndServe(*listen, gateway))
+}
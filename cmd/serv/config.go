@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	token_generator "git.sstv.io/lib/go/go-auth-api.git/gettoken"
 	"git.sstv.io/lib/go/gojunkyard.git/conn"
@@ -10,20 +12,117 @@ import (
 )
 
 type config struct {
-	Database            conn.DBConfig          `envconfig:"DATABASE"`
-	Redis               conn.RedisConfig       `envconfig:"REDIS"`
-	Sentry              sentry.Option          `envconfig:"SENTRY"`
-	SlackHookURL        string                 `envconfig:"SLACK_HOOK_URL"`
-	Webserver           webserver.Options      `envconfig:"WEBSERVER"`
-	Auth                authpassport.Config    `envconfig:"AUTH_PASSPORT"`
-	TokenGenerator      token_generator.Option `envconfig:"TOKEN_GENERATOR"`
-	TokenGeneratorEmail token_generator.Option `envconfig:"TOKEN_EMAIL_GENERATOR"`
-	PaymentBaseURL      string                 `envconfig:"PAYMENT_BASE_URL"`
-	PaymentMethodID     int64                  `envconfig:"PAYMENT_METHOD_ID"`
-	EmailBaseURL        string                 `envconfig:"EMAIL_BASE_URL"`
-	TemplatePaths       []string               `envconfig:"TEMPLATE_PATHS"`
-	UrlQrCode           string                 `envconfig:"URL_QRCODE"`
-	ProjectID           int64                  `envconfig:"PROJECT_ID"`
+	Database              conn.DBConfig          `envconfig:"DATABASE"`
+	Redis                 conn.RedisConfig       `envconfig:"REDIS"`
+	Sentry                sentry.Option          `envconfig:"SENTRY"`
+	SlackHookURL          string                 `envconfig:"SLACK_HOOK_URL"`
+	Webserver             webserver.Options      `envconfig:"WEBSERVER"`
+	Auth                  authpassport.Config    `envconfig:"AUTH_PASSPORT"`
+	TokenGenerator        token_generator.Option `envconfig:"TOKEN_GENERATOR"`
+	TokenGeneratorEmail   token_generator.Option `envconfig:"TOKEN_EMAIL_GENERATOR"`
+	PaymentBaseURL        string                 `envconfig:"PAYMENT_BASE_URL"`
+	PaymentCallbackSecret string                 `envconfig:"PAYMENT_CALLBACK_SECRET"`
+	PaymentMethodID       int64                  `envconfig:"PAYMENT_METHOD_ID"`
+	PaymentReconcile      reconcilerConfig       `envconfig:"PAYMENT_RECONCILE"`
+	LicenseJob            licenseJobConfig       `envconfig:"LICENSE_JOB"`
+	LicenseToken          licenseTokenConfig     `envconfig:"LICENSE_TOKEN"`
+	EmailOutbox           emailOutboxConfig      `envconfig:"EMAIL_OUTBOX"`
+	OrderJob              orderJobConfig         `envconfig:"ORDER_JOB"`
+	OrderNumber           sequenceConfig         `envconfig:"ORDER_NUMBER"`
+	Quotation             quotationConfig        `envconfig:"QUOTATION"`
+	Email                 emailConfig            `envconfig:"EMAIL"`
+	TemplatePaths         []string               `envconfig:"TEMPLATE_PATHS"`
+	DocumentRenderer      string                 `envconfig:"DOCUMENT_RENDERER" default:"wkhtmltopdf"`
+	UrlQrCode             string                 `envconfig:"URL_QRCODE"`
+	ProjectID             int64                  `envconfig:"PROJECT_ID"`
+}
+
+// reconcilerConfig configures the payment reconciler, it is disabled when Interval is 0.
+// Pending orders are never expired when ExpireAge is 0
+type reconcilerConfig struct {
+	Interval   time.Duration `envconfig:"INTERVAL"`
+	PendingAge time.Duration `envconfig:"PENDING_AGE"`
+	ExpireAge  time.Duration `envconfig:"EXPIRE_AGE" default:"24h"`
+}
+
+// licenseJobConfig configures the license expiry and reminder job, it is disabled when Interval is 0
+type licenseJobConfig struct {
+	Interval     time.Duration `envconfig:"INTERVAL"`
+	ReminderDays []int64       `envconfig:"REMINDER_DAYS"`
+}
+
+// emailConfig selects the email transport: http posts to the email service at
+// BaseURL, smtp sends directly to the SMTP server and file writes .eml files
+// into FileDir for local development
+type emailConfig struct {
+	Transport string     `envconfig:"TRANSPORT" default:"http"`
+	BaseURL   string     `envconfig:"BASE_URL"`
+	SMTP      smtpConfig `envconfig:"SMTP"`
+	FileDir   string     `envconfig:"FILE_DIR" default:"tmp/email"`
+}
+
+// smtpConfig configures the smtp email transport, the connection uses TLS
+// from the start when ImplicitTLS is set or STARTTLS otherwise
+type smtpConfig struct {
+	Host        string        `envconfig:"HOST"`
+	Port        int           `envconfig:"PORT" default:"587"`
+	Username    string        `envconfig:"USERNAME"`
+	Password    string        `envconfig:"PASSWORD"`
+	ImplicitTLS bool          `envconfig:"IMPLICIT_TLS"`
+	Timeout     time.Duration `envconfig:"TIMEOUT" default:"10s"`
+}
+
+// emailOutboxConfig configures the email outbox worker, it is disabled when
+// Interval is 0. Failed emails are retried after BaseDelay doubled on every
+// attempt up to MaxDelay, until MaxAttempts
+type emailOutboxConfig struct {
+	Interval    time.Duration `envconfig:"INTERVAL" default:"30s"`
+	Lease       time.Duration `envconfig:"LEASE" default:"10m"`
+	BatchSize   int           `envconfig:"BATCH_SIZE" default:"20"`
+	MaxAttempts int64         `envconfig:"MAX_ATTEMPTS" default:"8"`
+	BaseDelay   time.Duration `envconfig:"BASE_DELAY" default:"1m"`
+	MaxDelay    time.Duration `envconfig:"MAX_DELAY" default:"6h"`
+}
+
+// orderJobConfig configures the worker activating the licenses and recording
+// the commissions of paid orders, it is disabled when Interval is 0. Failed
+// jobs are retried after BaseDelay doubled on every attempt up to MaxDelay,
+// until MaxAttempts
+type orderJobConfig struct {
+	Interval    time.Duration `envconfig:"INTERVAL" default:"30s"`
+	Lease       time.Duration `envconfig:"LEASE" default:"10m"`
+	BatchSize   int           `envconfig:"BATCH_SIZE" default:"20"`
+	MaxAttempts int64         `envconfig:"MAX_ATTEMPTS" default:"8"`
+	BaseDelay   time.Duration `envconfig:"BASE_DELAY" default:"1m"`
+	MaxDelay    time.Duration `envconfig:"MAX_DELAY" default:"6h"`
+}
+
+// licenseTokenConfig configures the keys signing license QR codes, Keys maps
+// key id to base64 encoded ed25519 seed. Old keys are kept to verify the QR
+// codes they signed after ActiveKeyID is rotated
+type licenseTokenConfig struct {
+	Keys        map[string]string `envconfig:"KEYS"`
+	ActiveKeyID string            `envconfig:"ACTIVE_KEY_ID"`
+}
+
+// sequenceConfig configures the format of a number sequence, the defaults give
+// MN<yymmdd><7 digits> restarting every day in Jakarta time. ProjectPrefixes
+// maps project id to its own prefix, e.g. 10:MN,11:MX
+type sequenceConfig struct {
+	Prefix          string           `envconfig:"PREFIX" default:"MN"`
+	ProjectPrefixes map[int64]string `envconfig:"PROJECT_PREFIXES"`
+	Reset           string           `envconfig:"RESET" default:"daily"`
+	Padding         int              `envconfig:"PADDING" default:"7"`
+	Timezone        string           `envconfig:"TIMEZONE" default:"Asia/Jakarta"`
+}
+
+// quotationConfig configures quotations, they expire after Validity and are
+// numbered like orders with their own NumberPrefix, by project id in
+// NumberProjectPrefixes
+type quotationConfig struct {
+	Validity              time.Duration    `envconfig:"VALIDITY" default:"336h"`
+	NumberPrefix          string           `envconfig:"NUMBER_PREFIX" default:"QN"`
+	NumberProjectPrefixes map[int64]string `envconfig:"NUMBER_PROJECT_PREFIXES"`
 }
 
 var loadAndParse = env.LoadAndParse
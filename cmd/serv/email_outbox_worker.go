@@ -0,0 +1,129 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	email_log "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_log"
+	email_outbox "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_outbox"
+	"git.sstv.io/lib/go/gojunkyard.git/reporter"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// emailOutboxWorker periodically sends the due emails of the outbox. Every
+// attempt is recorded in the email log, failed emails are retried by the
+// outbox policy
+type emailOutboxWorker struct {
+	emailOutbox email_outbox.ICore
+	emailLog    email_log.ICore
+	reporter    reporter.Reporter
+	projectID   int64
+	interval    time.Duration
+	lease       time.Duration
+	batchSize   int
+	deliver     func(message email_outbox.Message) (email_log.EmailLog, error)
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newEmailOutboxWorker(
+	emailOutbox email_outbox.ICore,
+	emailLog email_log.ICore,
+	reporter reporter.Reporter,
+	projectID int64,
+	interval time.Duration,
+	lease time.Duration,
+	batchSize int,
+	deliver func(message email_outbox.Message) (email_log.EmailLog, error),
+) *emailOutboxWorker {
+	return &emailOutboxWorker{
+		emailOutbox: emailOutbox,
+		emailLog:    emailLog,
+		reporter:    reporter,
+		projectID:   projectID,
+		interval:    interval,
+		lease:       lease,
+		batchSize:   batchSize,
+		deliver:     deliver,
+		stop:        make(chan struct{}),
+	}
+}
+
+// Run starts the worker every interval in background
+func (w *emailOutboxWorker) Run() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.send()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the running worker to finish
+func (w *emailOutboxWorker) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+func (w *emailOutboxWorker) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *emailOutboxWorker) send() {
+	messages, err := w.emailOutbox.Claim(w.projectID, w.lease, w.batchSize)
+	if err != nil {
+		w.reporter.Errorf("[emailOutboxWorker] Failed claim emails, err: %s", err.Error())
+		return
+	}
+
+	for i := range messages {
+		if w.stopped() {
+			return
+		}
+		w.sendMessage(&messages[i])
+	}
+}
+
+func (w *emailOutboxWorker) sendMessage(message *email_outbox.Message) {
+	emailLog, errSend := w.deliver(*message)
+	if errSend != nil {
+		err := w.emailOutbox.MarkFailed(message, errSend)
+		if err != nil {
+			w.reporter.Errorf("[emailOutboxWorker] Failed mark email %d failed, err: %s", message.ID, err.Error())
+		}
+		w.reporter.Warningf("[emailOutboxWorker] Failed send %s email %d of order %d, attempt %d, status %s, err: %s",
+			message.Type, message.ID, message.OrderID, message.Attempts, message.Status, errSend.Error())
+
+		emailLog.DeliveryStatus = email_log.DeliveryFailed
+		emailLog.LastError = null.StringFrom(errSend.Error())
+	} else {
+		err := w.emailOutbox.MarkSent(message)
+		if err != nil {
+			w.reporter.Errorf("[emailOutboxWorker] Failed mark email %d sent, err: %s", message.ID, err.Error())
+		}
+
+		emailLog.DeliveryStatus = email_log.DeliverySent
+	}
+
+	emailLog.Attempts = message.Attempts
+	err := w.emailLog.RecordAttempt(&emailLog)
+	if err != nil {
+		w.reporter.Errorf("[emailOutboxWorker] Failed record email log of email %d, err: %s", message.ID, err.Error())
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	email "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email"
+	email_log "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_log"
+	license "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license"
+	order "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/lib/go/gojunkyard.git/reporter"
+)
+
+const (
+	licenseJobUser        = "license-job"
+	licenseReminderFrom   = "no-reply@molalivearena.com"
+	licenseReminderPrefix = "license_reminder_"
+)
+
+// licenseJob periodically expires active licenses past their expired date and
+// reminds venues of licenses about to expire, once for each of reminderDays
+type licenseJob struct {
+	license      license.ICore
+	order        order.ICore
+	email        email.ICore
+	emailLog     email_log.ICore
+	reporter     reporter.Reporter
+	projectID    int64
+	interval     time.Duration
+	reminderDays []int64
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newLicenseJob(
+	license license.ICore,
+	order order.ICore,
+	email email.ICore,
+	emailLog email_log.ICore,
+	reporter reporter.Reporter,
+	projectID int64,
+	interval time.Duration,
+	reminderDays []int64,
+) *licenseJob {
+	days := make([]int64, 0, len(reminderDays))
+	for _, day := range reminderDays {
+		if day > 0 {
+			days = append(days, day)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+
+	return &licenseJob{
+		license:      license,
+		order:        order,
+		email:        email,
+		emailLog:     emailLog,
+		reporter:     reporter,
+		projectID:    projectID,
+		interval:     interval,
+		reminderDays: days,
+		stop:         make(chan struct{}),
+	}
+}
+
+// Run starts the job every interval in background
+func (j *licenseJob) Run() {
+	j.wg.Add(1)
+	go func() {
+		defer j.wg.Done()
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				j.expire()
+				j.remind()
+			case <-j.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the running job to finish
+func (j *licenseJob) Stop() {
+	close(j.stop)
+	j.wg.Wait()
+}
+
+func (j *licenseJob) stopped() bool {
+	select {
+	case <-j.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (j *licenseJob) expire() {
+	licenses, err := j.license.SelectExpiringBefore(j.projectID, time.Now())
+	if err != nil {
+		j.reporter.Errorf("[licenseJob] Failed select expired licenses, err: %s", err.Error())
+		return
+	}
+
+	for _, expired := range licenses {
+		if j.stopped() {
+			return
+		}
+
+		expired.LicenseStatus = license.LicenseStatusExpired
+		expired.LastUpdateBy = licenseJobUser
+		err = j.license.Update(&expired, expired.BuyerID, "")
+		if err != nil {
+			j.reporter.Errorf("[licenseJob] Failed expire license %s, err: %s", expired.LicenseNumber, err.Error())
+			continue
+		}
+		j.reporter.Infof("[licenseJob] license %s of venue %d expired", expired.LicenseNumber, expired.OrderID)
+	}
+}
+
+func (j *licenseJob) remind() {
+	if len(j.reminderDays) == 0 {
+		return
+	}
+
+	var (
+		now     = time.Now()
+		maxDays = j.reminderDays[len(j.reminderDays)-1]
+	)
+
+	licenses, err := j.license.SelectExpiringBefore(j.projectID, now.AddDate(0, 0, int(maxDays)))
+	if err != nil {
+		j.reporter.Errorf("[licenseJob] Failed select expiring licenses, err: %s", err.Error())
+		return
+	}
+
+	for _, expiring := range licenses {
+		if j.stopped() {
+			return
+		}
+		if !expiring.ExpiredDate.After(now) {
+			continue
+		}
+
+		daysLeft := int64(expiring.ExpiredDate.Sub(now).Hours() / 24)
+		j.remindLicense(expiring, j.reminderDay(daysLeft), daysLeft)
+	}
+}
+
+// reminderDay returns the smallest reminder day not less than daysLeft, so a
+// venue missing a reminder, e.g. while the job was down, gets the next one
+func (j *licenseJob) reminderDay(daysLeft int64) int64 {
+	for _, day := range j.reminderDays {
+		if day >= daysLeft {
+			return day
+		}
+	}
+	return j.reminderDays[len(j.reminderDays)-1]
+}
+
+func (j *licenseJob) remindLicense(expiring license.License, reminderDay, daysLeft int64) {
+	emailType := fmt.Sprintf("%s%d", licenseReminderPrefix, reminderDay)
+
+	// OrderID of license holds its venue id. A renewed license gets a new
+	// active date, so its reminders are sent again
+	sent, err := j.emailLog.IsSent(expiring.OrderID, emailType, expiring.ActiveDate)
+	if err != nil {
+		j.reporter.Errorf("[licenseJob] Failed check reminder of license %s, err: %s", expiring.LicenseNumber, err.Error())
+		return
+	}
+	if sent {
+		return
+	}
+
+	venue, err := j.order.GetSummaryVenueByVenueID(expiring.OrderID, j.projectID, "")
+	if err != nil {
+		j.reporter.Errorf("[licenseJob] Failed get venue %d, err: %s", expiring.OrderID, err.Error())
+		return
+	}
+	if venue.CompanyEmail == "" {
+		j.reporter.Warningf("[licenseJob] venue %d has no company email, skip reminder of license %s", expiring.OrderID, expiring.LicenseNumber)
+		return
+	}
+
+	err = j.email.Send(email.EmailRequest{
+		Subject: "Lisensi Mola Live Arena Anda Akan Berakhir",
+		To:      venue.CompanyEmail,
+		From:    licenseReminderFrom,
+		HTML:    licenseReminderHTML(venue.VenueName, expiring, daysLeft),
+	})
+	if err != nil {
+		j.reporter.Errorf("[licenseJob] Failed send reminder of license %s, err: %s", expiring.LicenseNumber, err.Error())
+		return
+	}
+
+	err = j.emailLog.Insert(&email_log.EmailLog{
+		SenderUID: licenseJobUser,
+		VenueID:   expiring.OrderID,
+		CompanyID: venue.CompanyID.Int64,
+		To:        venue.CompanyEmail,
+		EmailType: emailType,
+		CreatedBy: licenseJobUser,
+	})
+	if err != nil {
+		j.reporter.Errorf("[licenseJob] Failed log reminder of license %s, err: %s", expiring.LicenseNumber, err.Error())
+		return
+	}
+	j.reporter.Infof("[licenseJob] reminder %s of license %s sent to %s", emailType, expiring.LicenseNumber, venue.CompanyEmail)
+}
+
+func licenseReminderHTML(venueName string, expiring license.License, daysLeft int64) string {
+	return fmt.Sprintf(`<html>
+<body>
+	<p>Halo %s,</p>
+	<p>Lisensi Mola Live Arena Anda dengan nomor <b>%s</b> akan berakhir dalam %d hari, pada tanggal <b>%s</b>.</p>
+	<p>Silakan lakukan perpanjangan lisensi agar venue Anda tetap dapat menayangkan siaran Mola.</p>
+	<p>Terima kasih,<br>Mola Live Arena</p>
+</body>
+</html>`, venueName, expiring.LicenseNumber, daysLeft, expiring.ExpiredDate.Format("02 January 2006"))
+}
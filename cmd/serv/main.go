@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,24 +11,37 @@ import (
 	agent "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/agent"
 	aging "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/aging"
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	cache "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	city "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/city"
 	commercialType "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/commercial_type"
+	commission "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/commission"
 	company "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/company"
 	device "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/device"
+	document "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/document"
 	email "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email"
 	emailLog "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_log"
+	emailOutbox "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_outbox"
 	_history "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/history"
 	installation "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/installation"
 	license "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license"
+	license_token "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license_token"
 	order "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
 	orderDetail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_detail"
+	orderJob "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
 	orderMatrix "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_matrix"
 	payment "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment"
+	paymentMethod "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment_method"
+	pricing "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
 	_products "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/product"
+	promotion "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/promotion"
 	province "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/province"
+	quotation "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/quotation"
+	refund "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/refund"
 	regional_agent "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/regional_agent"
 	room "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/room"
+	sequence "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/sequence"
 	subscription "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/subscription"
+	tax "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/tax"
 	template "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/template"
 	venue "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/venue"
 	venueType "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/venue_type"
@@ -100,81 +114,153 @@ func main() {
 	}
 	reporter.Infoln("Token Generator Email successfully initialized")
 
+	coreCache := cache.Init(redis)
+	reporter.Infoln("/pkg/cache successfully initialized")
+
 	coreAuditTrail := auditTrail.Init(db, cfg.ProjectID)
 	reporter.Infoln("/pkg/audit_trail successfully initialized")
 
-	coreHistory := _history.Init(db, redis)
+	coreEmailOutbox := emailOutbox.Init(db, emailOutbox.Policy{
+		MaxAttempts: cfg.EmailOutbox.MaxAttempts,
+		BaseDelay:   cfg.EmailOutbox.BaseDelay,
+		MaxDelay:    cfg.EmailOutbox.MaxDelay,
+	})
+	reporter.Infoln("/pkg/email_outbox successfully initialized")
+
+	coreOrderJob := orderJob.Init(db, orderJob.Policy{
+		MaxAttempts: cfg.OrderJob.MaxAttempts,
+		BaseDelay:   cfg.OrderJob.BaseDelay,
+		MaxDelay:    cfg.OrderJob.MaxDelay,
+	})
+	reporter.Infoln("/pkg/order_job successfully initialized")
+
+	coreHistory := _history.Init(db, coreCache)
 	reporter.Infoln("/pkg/history successfully initialized")
 
-	coreProduct := _products.Init(db, redis, coreAuditTrail)
+	coreProduct := _products.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/products successfully initialized")
 
-	coreOrder := order.Init(db, redis, cfg.PaymentMethodID, coreAuditTrail)
+	coreOrder := order.Init(db, coreCache, coreAuditTrail, coreEmailOutbox, coreOrderJob)
 	reporter.Infoln("/pkg/order successfully initialized")
 
-	coreVenue := venue.Init(db, redis, coreAuditTrail)
+	coreVenue := venue.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/venue successfully initialized")
 
-	coreInstallation := installation.Init(db, redis, coreAuditTrail)
+	coreInstallation := installation.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/installation successfully initialized")
 
-	coreDevice := device.Init(db, redis, coreAuditTrail)
+	coreDevice := device.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/device successfully initialized")
 
-	coreCommercialType := commercialType.Init(db, redis, coreAuditTrail)
+	coreCommercialType := commercialType.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/commercialType successfully initialized")
 
-	coreRoom := room.Init(db, redis, coreAuditTrail)
+	coreRoom := room.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/room successfully initialized")
 
-	coreAging := aging.Init(db, redis, coreAuditTrail)
+	coreAging := aging.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/aging successfully initialized")
 
-	coreVenueType := venueType.Init(db, redis, coreAuditTrail)
+	coreVenueType := venueType.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/venue_type successfully initialized")
 
-	coreLicense := license.Init(db, redis, coreAuditTrail)
+	coreLicense := license.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/license successfully initialized")
 
-	corePayment := payment.Init(cfg.PaymentBaseURL, tokenGenerator)
+	corePayment := payment.Init(cfg.PaymentBaseURL, cfg.PaymentCallbackSecret, tokenGenerator)
 	reporter.Infoln("/pkg/payment successfully initialized")
 
-	coreEmail := email.Init(cfg.EmailBaseURL, cfg.UrlQrCode, tokenGeneratorEmail)
+	emailTransport, err := newEmailTransport(cfg.Email, tokenGeneratorEmail)
+	if err != nil {
+		panic(err)
+	}
+	coreEmail := email.Init(emailTransport, cfg.UrlQrCode)
 	reporter.Infoln("/pkg/email successfully initialized")
 
-	coreTemplate := template.New("./file/template")
+	coreTemplate := template.Init(db, coreCache, cfg.ProjectID, "./file/template")
 	reporter.Infoln("/pkg/template successfully initialized")
 
-	coreOrderDetail := orderDetail.Init(db, redis, coreAuditTrail)
+	documentRenderer, err := newDocumentRenderer(cfg.DocumentRenderer, coreTemplate)
+	if err != nil {
+		panic(err)
+	}
+	coreDocument := document.Init(documentRenderer, coreCache, cfg.ProjectID)
+	reporter.Infoln("/pkg/document successfully initialized")
+
+	coreOrderDetail := orderDetail.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/order_detail successfully initialized")
 
-	coreAdmin := admin.Init(db, redis)
+	coreAdmin := admin.Init(db, coreCache)
 	reporter.Infoln("/pkg/admin successfully initialized")
 
-	coreCompany := company.Init(db, redis)
+	coreCompany := company.Init(db, coreCache)
 	reporter.Infoln("/pkg/company successfully initialized")
 
-	coreProvince := province.Init(db, redis)
+	coreProvince := province.Init(db, coreCache)
 	reporter.Infoln("/pkg/province successfully initialized")
 
-	coreCity := city.Init(db, redis)
+	coreCity := city.Init(db, coreCache)
 	reporter.Infoln("/pkg/city successfully initialized")
 
-	coreEmailLog := emailLog.Init(db, redis)
+	coreEmailLog := emailLog.Init(db, coreCache)
 	reporter.Infoln("/pkg/email_log successfully initialized")
 
-	coreAgent := agent.Init(db, redis)
+	coreAgent := agent.Init(db, coreCache)
 	reporter.Infoln("/pkg/agent successfully initialized")
 
-	coreSubscription := subscription.Init(db, redis, coreAuditTrail)
+	coreSubscription := subscription.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/subscription successfully initialized")
 
-	coreRegionalAgent := regional_agent.Init(db, redis, coreAuditTrail)
+	coreRegionalAgent := regional_agent.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/regional_agents successfully initialized")
 
-	coreOrderMatrix := orderMatrix.Init(db, redis, coreAuditTrail)
+	coreOrderMatrix := orderMatrix.Init(db, coreCache, coreAuditTrail)
 	reporter.Infoln("/pkg/order_matrix successfully initialized")
 
+	corePricing := pricing.Init(db, coreCache, coreAuditTrail)
+	reporter.Infoln("/pkg/pricing successfully initialized")
+
+	corePaymentMethod := paymentMethod.Init(db, coreCache, cfg.PaymentMethodID, coreAuditTrail)
+	reporter.Infoln("/pkg/payment_method successfully initialized")
+
+	coreRefund := refund.Init(db, coreCache, coreAuditTrail, coreOrderJob)
+	reporter.Infoln("/pkg/refund successfully initialized")
+
+	coreLicenseToken := license_token.Init(cfg.LicenseToken.Keys, cfg.LicenseToken.ActiveKeyID)
+	reporter.Infoln("/pkg/license_token successfully initialized")
+	if !coreLicenseToken.Enabled() {
+		reporter.Warningf("License token key is not configured, license QR codes hold the bare license number")
+	}
+
+	coreSequence := sequence.Init(db, sequence.Sequence{
+		Name:            sequence.OrderNumber,
+		Prefix:          cfg.OrderNumber.Prefix,
+		ProjectPrefixes: cfg.OrderNumber.ProjectPrefixes,
+		Reset:           cfg.OrderNumber.Reset,
+		Padding:         cfg.OrderNumber.Padding,
+		Timezone:        cfg.OrderNumber.Timezone,
+	}, sequence.Sequence{
+		Name:            sequence.QuotationNumber,
+		Prefix:          cfg.Quotation.NumberPrefix,
+		ProjectPrefixes: cfg.Quotation.NumberProjectPrefixes,
+		Reset:           cfg.OrderNumber.Reset,
+		Padding:         cfg.OrderNumber.Padding,
+		Timezone:        cfg.OrderNumber.Timezone,
+	})
+	reporter.Infoln("/pkg/sequence successfully initialized")
+
+	coreTax := tax.Init(db, coreCache, coreAuditTrail)
+	reporter.Infoln("/pkg/tax successfully initialized")
+
+	coreQuotation := quotation.Init(db, coreCache, coreAuditTrail, cfg.Quotation.Validity)
+	reporter.Infoln("/pkg/quotation successfully initialized")
+
+	corePromotion := promotion.Init(db, coreCache, coreAuditTrail)
+	reporter.Infoln("/pkg/Promotion successfully initialized")
+
+	coreCommission := commission.Init(db, coreCache, coreAuditTrail)
+	reporter.Infoln("/pkg/Commission successfully initialized")
+
 	var (
 		server = webserver.New(&cfg.Webserver)
 		rest   = rest.New(
@@ -205,10 +291,83 @@ func main() {
 			coreSubscription,
 			coreRegionalAgent,
 			coreOrderMatrix,
+			corePricing,
+			corePaymentMethod,
+			coreRefund,
+			coreLicenseToken,
+			coreSequence,
+			coreAuditTrail,
+			coreCache,
+			coreEmailOutbox,
+			coreOrderJob,
+			coreDocument,
+			coreTax,
+			coreQuotation,
+			corePromotion,
+			coreCommission,
 		)
 	)
 	rest.Register(server.Router())
 
+	reconciler := newReconciler(
+		coreOrder,
+		corePayment,
+		coreRefund,
+		reporter,
+		cfg.ProjectID,
+		cfg.PaymentReconcile.Interval,
+		cfg.PaymentReconcile.PendingAge,
+		cfg.PaymentReconcile.ExpireAge,
+	)
+	if cfg.PaymentReconcile.Interval > 0 {
+		reconciler.Run()
+		reporter.Infoln("Payment reconciler successfully started")
+	}
+
+	licenseJob := newLicenseJob(
+		coreLicense,
+		coreOrder,
+		coreEmail,
+		coreEmailLog,
+		reporter,
+		cfg.ProjectID,
+		cfg.LicenseJob.Interval,
+		cfg.LicenseJob.ReminderDays,
+	)
+	if cfg.LicenseJob.Interval > 0 {
+		licenseJob.Run()
+		reporter.Infoln("License job successfully started")
+	}
+
+	emailOutboxWorker := newEmailOutboxWorker(
+		coreEmailOutbox,
+		coreEmailLog,
+		reporter,
+		cfg.ProjectID,
+		cfg.EmailOutbox.Interval,
+		cfg.EmailOutbox.Lease,
+		cfg.EmailOutbox.BatchSize,
+		rest.DeliverOutboxMessage,
+	)
+	if cfg.EmailOutbox.Interval > 0 {
+		emailOutboxWorker.Run()
+		reporter.Infoln("Email outbox worker successfully started")
+	}
+
+	orderJobWorker := newOrderJobWorker(
+		coreOrderJob,
+		reporter,
+		cfg.ProjectID,
+		cfg.OrderJob.Interval,
+		cfg.OrderJob.Lease,
+		cfg.OrderJob.BatchSize,
+		rest.RunOrderJob,
+	)
+	if cfg.OrderJob.Interval > 0 {
+		orderJobWorker.Run()
+		reporter.Infoln("Order job worker successfully started")
+	}
+
 	serverChan := server.Run()
 	reporter.Infoln("Webserver succesfully started")
 
@@ -243,6 +402,26 @@ func main() {
 	server.Stop()
 	reporter.Infoln("Webserver succesfully stopped")
 
+	if cfg.PaymentReconcile.Interval > 0 {
+		reconciler.Stop()
+		reporter.Infoln("Payment reconciler succesfully stopped")
+	}
+
+	if cfg.LicenseJob.Interval > 0 {
+		licenseJob.Stop()
+		reporter.Infoln("License job succesfully stopped")
+	}
+
+	if cfg.EmailOutbox.Interval > 0 {
+		emailOutboxWorker.Stop()
+		reporter.Infoln("Email outbox worker succesfully stopped")
+	}
+
+	if cfg.OrderJob.Interval > 0 {
+		orderJobWorker.Stop()
+		reporter.Infoln("Order job worker succesfully stopped")
+	}
+
 	redis.Close()
 	reporter.Infoln("Redis succesfully closed")
 
@@ -252,3 +431,34 @@ func main() {
 	health.Stop()
 	reporter.Infoln("Health checker succesfully stopped")
 }
+
+// newEmailTransport returns the email transport selected in cfg
+func newEmailTransport(cfg emailConfig, tokenGeneratorEmail email.TokenGeneratorEmail) (email.Transport, error) {
+	switch cfg.Transport {
+	case email.TransportHTTP:
+		return email.NewHTTPTransport(cfg.BaseURL, tokenGeneratorEmail), nil
+	case email.TransportSMTP:
+		return email.NewSMTPTransport(email.SMTPOption{
+			Host:        cfg.SMTP.Host,
+			Port:        cfg.SMTP.Port,
+			Username:    cfg.SMTP.Username,
+			Password:    cfg.SMTP.Password,
+			ImplicitTLS: cfg.SMTP.ImplicitTLS,
+			Timeout:     cfg.SMTP.Timeout,
+		}), nil
+	case email.TransportFile:
+		return email.NewFileTransport(cfg.FileDir)
+	}
+	return nil, fmt.Errorf("unknown email transport %q", cfg.Transport)
+}
+
+// newDocumentRenderer returns the pdf renderer selected by name
+func newDocumentRenderer(name string, coreTemplate template.ICore) (document.Renderer, error) {
+	switch name {
+	case document.RendererWkhtmltopdf:
+		return document.NewWkhtmltopdfRenderer(coreTemplate), nil
+	case document.RendererNative:
+		return document.NewNativeRenderer(), nil
+	}
+	return nil, fmt.Errorf("unknown document renderer %q", name)
+}
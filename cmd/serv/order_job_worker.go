@@ -0,0 +1,113 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	order_job "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
+	"git.sstv.io/lib/go/gojunkyard.git/reporter"
+)
+
+// orderJobWorker periodically runs the due jobs of paid orders, license
+// activations and commissions. Failed jobs are retried by the job policy
+type orderJobWorker struct {
+	orderJob  order_job.ICore
+	reporter  reporter.Reporter
+	projectID int64
+	interval  time.Duration
+	lease     time.Duration
+	batchSize int
+	run       func(job order_job.Job) error
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newOrderJobWorker(
+	orderJob order_job.ICore,
+	reporter reporter.Reporter,
+	projectID int64,
+	interval time.Duration,
+	lease time.Duration,
+	batchSize int,
+	run func(job order_job.Job) error,
+) *orderJobWorker {
+	return &orderJobWorker{
+		orderJob:  orderJob,
+		reporter:  reporter,
+		projectID: projectID,
+		interval:  interval,
+		lease:     lease,
+		batchSize: batchSize,
+		run:       run,
+		stop:      make(chan struct{}),
+	}
+}
+
+// Run starts the worker every interval in background
+func (w *orderJobWorker) Run() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.runJobs()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the running worker to finish
+func (w *orderJobWorker) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+func (w *orderJobWorker) stopped() bool {
+	select {
+	case <-w.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w *orderJobWorker) runJobs() {
+	jobs, err := w.orderJob.Claim(w.projectID, w.lease, w.batchSize)
+	if err != nil {
+		w.reporter.Errorf("[orderJobWorker] Failed claim jobs, err: %s", err.Error())
+		return
+	}
+
+	for i := range jobs {
+		if w.stopped() {
+			return
+		}
+		w.runJob(&jobs[i])
+	}
+}
+
+func (w *orderJobWorker) runJob(job *order_job.Job) {
+	errRun := w.run(*job)
+	if errRun != nil {
+		err := w.orderJob.MarkFailed(job, errRun)
+		if err != nil {
+			w.reporter.Errorf("[orderJobWorker] Failed mark job %d failed, err: %s", job.ID, err.Error())
+		}
+		w.reporter.Warningf("[orderJobWorker] Failed run %s job %d of order %d, attempt %d, status %s, err: %s",
+			job.Type, job.ID, job.OrderID, job.Attempts, job.Status, errRun.Error())
+		return
+	}
+
+	err := w.orderJob.MarkDone(job)
+	if err != nil {
+		w.reporter.Errorf("[orderJobWorker] Failed mark job %d done, err: %s", job.ID, err.Error())
+	}
+}
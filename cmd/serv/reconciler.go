@@ -0,0 +1,228 @@
+package main
+
+import (
+	"database/sql"
+	"strconv"
+	"sync"
+	"time"
+
+	order "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	payment "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment"
+	refund "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/refund"
+	"git.sstv.io/lib/go/gojunkyard.git/reporter"
+)
+
+const reconcilerUser = "payment-reconciler"
+
+// reconciler periodically checks orders pending for longer than pendingAge
+// against the payment gateway, in case the callback was never received.
+// Orders still unpaid after expireAge are cancelled at the gateway and expired,
+// unless expireAge is 0.
+// Refunds pending for longer than pendingAge are checked the same way, since
+// the gateway does not call back when it completes them. Completing a refund
+// queues the order job applying it
+type reconciler struct {
+	order      order.ICore
+	payment    payment.ICore
+	refund     refund.ICore
+	reporter   reporter.Reporter
+	projectID  int64
+	interval   time.Duration
+	pendingAge time.Duration
+	expireAge  time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newReconciler(
+	order order.ICore,
+	payment payment.ICore,
+	refund refund.ICore,
+	reporter reporter.Reporter,
+	projectID int64,
+	interval time.Duration,
+	pendingAge time.Duration,
+	expireAge time.Duration,
+) *reconciler {
+	return &reconciler{
+		order:      order,
+		payment:    payment,
+		refund:     refund,
+		reporter:   reporter,
+		projectID:  projectID,
+		interval:   interval,
+		pendingAge: pendingAge,
+		expireAge:  expireAge,
+		stop:       make(chan struct{}),
+	}
+}
+
+// Run starts reconciling every interval in background
+func (r *reconciler) Run() {
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.reconcile()
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop waits for the running reconciliation to finish
+func (r *reconciler) Stop() {
+	close(r.stop)
+	r.wg.Wait()
+}
+
+func (r *reconciler) reconcile() {
+	orders, err := r.order.SelectPendingBefore(r.projectID, time.Now().Add(-r.pendingAge))
+	if err != nil {
+		r.reporter.Errorf("[reconciler] Failed select pending orders, err: %s", err.Error())
+		return
+	}
+
+	for _, pending := range orders {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		r.reconcileOrder(pending)
+	}
+
+	r.reconcileRefunds()
+}
+
+func (r *reconciler) reconcileOrder(pending order.Order) {
+	var (
+		reference = strconv.FormatInt(pending.OrderID, 10)
+		expired   = r.expireAge > 0 && pending.PendingAt.Valid && time.Since(pending.PendingAt.Time) > r.expireAge
+	)
+
+	status, err := r.payment.GetStatus(reference)
+	if err == payment.ErrPaymentNotFound {
+		r.reporter.Warningf("[reconciler] order %s is pending but unknown to payment gateway", pending.OrderNumber)
+		if expired {
+			r.updateStatus(pending, order.StatusExpired, "payment not found at gateway")
+		}
+		return
+	}
+	if err != nil {
+		r.reporter.Errorf("[reconciler] Failed get payment status of order %s, err: %s", pending.OrderNumber, err.Error())
+		return
+	}
+
+	switch status.Status {
+	case payment.StatusPending:
+		if !expired {
+			return
+		}
+		err = r.payment.Cancel(reference)
+		if err != nil {
+			r.reporter.Errorf("[reconciler] Failed cancel payment of order %s, err: %s", pending.OrderNumber, err.Error())
+			return
+		}
+		r.updateStatus(pending, order.StatusExpired, "payment expired")
+	case payment.StatusPaid:
+		if !payment.AmountMatches(status.Amount, pending.TotalPrice+pending.PaymentFee) {
+			r.reporter.Errorf("[reconciler] order %s is paid at gateway, transaction: %s, but amount %f does not match total price %f and payment fee %f",
+				pending.OrderNumber, status.TransactionID, status.Amount, pending.TotalPrice, pending.PaymentFee)
+			return
+		}
+		r.reporter.Warningf("[reconciler] order %s is paid at gateway, transaction: %s, but pending in order", pending.OrderNumber, status.TransactionID)
+		r.updateStatus(pending, order.StatusPaid, "payment reconciled "+status.TransactionID)
+	case payment.StatusFailed:
+		r.reporter.Warningf("[reconciler] order %s is failed at gateway, transaction: %s, but pending in order", pending.OrderNumber, status.TransactionID)
+		r.updateStatus(pending, order.StatusFailed, "payment reconciled "+status.TransactionID)
+	case payment.StatusExpired, payment.StatusCancelled:
+		r.reporter.Warningf("[reconciler] order %s is %s at gateway, but pending in order", pending.OrderNumber, status.Status)
+		r.updateStatus(pending, order.StatusExpired, "payment "+status.Status+" at gateway")
+	default:
+		r.reporter.Warningf("[reconciler] order %s has unknown payment status %s at gateway", pending.OrderNumber, status.Status)
+	}
+}
+
+// updateStatus moves pending order to status, it reports false when the order
+// was not updated, e.g. the callback changed it in the meantime
+func (r *reconciler) updateStatus(pending order.Order, status int16, reason string) bool {
+	updateStatus := order.Order{
+		OrderID:      pending.OrderID,
+		ProjectID:    pending.ProjectID,
+		Status:       status,
+		CreatedBy:    pending.CreatedBy,
+		LastUpdateBy: reconcilerUser,
+		PendingAt:    pending.PendingAt,
+		PaidAt:       pending.PaidAt,
+		FailedAt:     pending.FailedAt,
+		VenueID:      pending.VenueID,
+		BuyerID:      pending.BuyerID,
+	}
+
+	err := r.order.UpdateOrderStatus(&updateStatus, reason, true, "")
+	if err == order.ErrInvalidTransition || err == sql.ErrNoRows {
+		r.reporter.Infof("[reconciler] order %s status has changed, skip moving to %s", pending.OrderNumber, order.StatusName(status))
+		return false
+	}
+	if err != nil {
+		r.reporter.Errorf("[reconciler] Failed update status of order %s to %s, err: %s", pending.OrderNumber, order.StatusName(status), err.Error())
+		return false
+	}
+
+	r.reporter.Infof("[reconciler] order %s moved to %s", pending.OrderNumber, order.StatusName(status))
+	return true
+}
+
+func (r *reconciler) reconcileRefunds() {
+	refunds, err := r.refund.SelectPendingBefore(r.projectID, time.Now().Add(-r.pendingAge))
+	if err != nil {
+		r.reporter.Errorf("[reconciler] Failed select pending refunds, err: %s", err.Error())
+		return
+	}
+
+	for _, pending := range refunds {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		r.reconcileRefund(pending)
+	}
+}
+
+func (r *reconciler) reconcileRefund(pending refund.Refund) {
+	status, err := r.payment.GetRefundStatus(pending.GatewayRefundID)
+	if err != nil {
+		r.reporter.Errorf("[reconciler] Failed get status of refund %d, err: %s", pending.ID, err.Error())
+		return
+	}
+
+	switch status.Status {
+	case payment.RefundStatusPending:
+		return
+	case payment.RefundStatusCompleted:
+		pending.Status = refund.StatusCompleted
+	case payment.RefundStatusFailed:
+		pending.Status = refund.StatusFailed
+	default:
+		r.reporter.Warningf("[reconciler] refund %d has unknown status %s at gateway", pending.ID, status.Status)
+		return
+	}
+
+	pending.LastUpdateBy = reconcilerUser
+	err = r.refund.UpdateStatus(&pending, "")
+	if err != nil {
+		r.reporter.Errorf("[reconciler] Failed update status of refund %d to %s, err: %s", pending.ID, pending.Status, err.Error())
+		return
+	}
+	r.reporter.Infof("[reconciler] refund %d of order %d moved to %s", pending.ID, pending.OrderID, pending.Status)
+}
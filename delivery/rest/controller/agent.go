@@ -11,6 +11,7 @@ import (
 	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	"git.sstv.io/lib/go/gojunkyard.git/form"
 	"git.sstv.io/lib/go/gojunkyard.git/router"
+	"gopkg.in/guregu/null.v3"
 )
 
 func (c *Controller) handleGetAllAgents(w http.ResponseWriter, r *http.Request) {
@@ -27,13 +28,14 @@ func (c *Controller) handleGetAllAgents(w http.ResponseWriter, r *http.Request)
 			Type: "agents",
 			ID:   agent.ID,
 			Attributes: view.AgentAttributes{
-				UserID:       agent.UserID,
-				Status:       agent.Status,
-				ProjectID:    agent.ProjectID,
-				CreatedAt:    agent.CreatedAt,
-				UpdatedAt:    agent.UpdatedAt,
-				CreatedBy:    agent.CreatedBy,
-				LastUpdateBy: agent.LastUpdateBy,
+				UserID:          agent.UserID,
+				RegionalAgentID: agent.RegionalAgentID,
+				Status:          agent.Status,
+				ProjectID:       agent.ProjectID,
+				CreatedAt:       agent.CreatedAt,
+				UpdatedAt:       agent.UpdatedAt,
+				CreatedBy:       agent.CreatedBy,
+				LastUpdateBy:    agent.LastUpdateBy,
 			},
 		})
 	}
@@ -98,10 +100,25 @@ func (c *Controller) handlePostAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if params.RegionalAgentID != nil {
+		_, err = c.regionalAgent.Get(c.projectID, *params.RegionalAgentID)
+		if err == sql.ErrNoRows {
+			c.reporter.Infof("[handlePostAgent] regional agent not found, err: %s", err.Error())
+			view.RenderJSONError(w, "Regional agent not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			c.reporter.Errorf("[handlePostAgent] error get regional agent, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed get regional agent", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	agent := agent.Agent{
-		UserID:    params.UserID,
-		ProjectID: c.projectID,
-		CreatedBy: params.CreatedBy,
+		UserID:          params.UserID,
+		RegionalAgentID: null.IntFromPtr(params.RegionalAgentID),
+		ProjectID:       c.projectID,
+		CreatedBy:       params.CreatedBy,
 	}
 
 	err = c.agent.Insert(&agent)
@@ -143,11 +160,26 @@ func (c *Controller) handlePatchAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if params.RegionalAgentID != nil {
+		_, err = c.regionalAgent.Get(c.projectID, *params.RegionalAgentID)
+		if err == sql.ErrNoRows {
+			c.reporter.Infof("[handlePatchAgent] regional agent not found, err: %s", err.Error())
+			view.RenderJSONError(w, "Regional agent not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			c.reporter.Errorf("[handlePatchAgent] error get regional agent, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed get regional agent", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	agent := agent.Agent{
-		ID:           id,
-		UserID:       params.UserID,
-		ProjectID:    c.projectID,
-		LastUpdateBy: params.LastUpdateBy,
+		ID:              id,
+		UserID:          params.UserID,
+		RegionalAgentID: null.IntFromPtr(params.RegionalAgentID),
+		ProjectID:       c.projectID,
+		LastUpdateBy:    params.LastUpdateBy,
 	}
 	err = c.agent.Update(&agent, agentParam.UserID)
 	if err != nil {
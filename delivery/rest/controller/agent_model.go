@@ -4,12 +4,13 @@ import "time"
 import "gopkg.in/guregu/null.v3"
 
 type reqAgent struct {
-	UserID       string    `json:"userId"`
-	Status       int8      `json:"status"`
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
-	DeletedAt    null.Time `json:"deletedAt"`
-	ProjectID    int64     `json:"projectId"`
-	CreatedBy    string    `json:"created_by"`
-	LastUpdateBy string    `json:"last_update_by"`
+	UserID          string    `json:"userId"`
+	RegionalAgentID *int64    `json:"regionalAgentId"`
+	Status          int8      `json:"status"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+	DeletedAt       null.Time `json:"deletedAt"`
+	ProjectID       int64     `json:"projectId"`
+	CreatedBy       string    `json:"created_by"`
+	LastUpdateBy    string    `json:"last_update_by"`
 }
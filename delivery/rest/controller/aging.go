@@ -41,15 +41,16 @@ func (c *Controller) handlePostAging(w http.ResponseWriter, r *http.Request) {
 	}
 
 	aging := aging.Aging{
-		Name:         params.Name,
-		Description:  params.Description,
-		Price:        params.Price,
-		ProjectID:    c.projectID,
-		CreatedBy:    userID.(string),
-		LastUpdateBy: userID.(string),
+		Name:           params.Name,
+		Description:    params.Description,
+		Price:          params.Price,
+		DurationMonths: params.DurationMonths,
+		ProjectID:      c.projectID,
+		CreatedBy:      userID.(string),
+		LastUpdateBy:   userID.(string),
 	}
 
-	err = c.aging.Insert(&aging)
+	err = c.aging.Insert(&aging, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePostAging] failed post aging, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post aging", http.StatusInternalServerError)
@@ -60,16 +61,17 @@ func (c *Controller) handlePostAging(w http.ResponseWriter, r *http.Request) {
 		ID:   aging.ID,
 		Type: "aging",
 		Attributes: view.AgingAttributes{
-			Name:         aging.Name,
-			Description:  aging.Description,
-			Price:        aging.Price,
-			Status:       aging.Status,
-			CreatedAt:    aging.CreatedAt,
-			CreatedBy:    aging.CreatedBy,
-			UpdatedAt:    aging.UpdatedAt,
-			LastUpdateBy: aging.LastUpdateBy,
-			DeletedAt:    aging.DeletedAt,
-			ProjectID:    aging.ProjectID,
+			Name:           aging.Name,
+			Description:    aging.Description,
+			Price:          aging.Price,
+			DurationMonths: aging.DurationMonths,
+			Status:         aging.Status,
+			CreatedAt:      aging.CreatedAt,
+			CreatedBy:      aging.CreatedBy,
+			UpdatedAt:      aging.UpdatedAt,
+			LastUpdateBy:   aging.LastUpdateBy,
+			DeletedAt:      aging.DeletedAt,
+			ProjectID:      aging.ProjectID,
 		},
 	}
 
@@ -126,16 +128,17 @@ func (c *Controller) handlePatchAging(w http.ResponseWriter, r *http.Request) {
 	}
 
 	aging := aging.Aging{
-		ID:           id,
-		Name:         params.Name,
-		Description:  params.Description,
-		Price:        params.Price,
-		ProjectID:    c.projectID,
-		CreatedBy:    getAging.CreatedBy,
-		LastUpdateBy: userID.(string),
+		ID:             id,
+		Name:           params.Name,
+		Description:    params.Description,
+		Price:          params.Price,
+		DurationMonths: params.DurationMonths,
+		ProjectID:      c.projectID,
+		CreatedBy:      getAging.CreatedBy,
+		LastUpdateBy:   userID.(string),
 	}
 
-	err = c.aging.Update(&aging, isAdmin)
+	err = c.aging.Update(&aging, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchAging] failed update aging, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update aging", http.StatusInternalServerError)
@@ -146,16 +149,17 @@ func (c *Controller) handlePatchAging(w http.ResponseWriter, r *http.Request) {
 		ID:   aging.ID,
 		Type: "aging",
 		Attributes: view.AgingAttributes{
-			Name:         aging.Name,
-			Description:  aging.Description,
-			Price:        aging.Price,
-			Status:       getAging.Status,
-			CreatedAt:    getAging.CreatedAt,
-			CreatedBy:    aging.CreatedBy,
-			UpdatedAt:    aging.UpdatedAt,
-			LastUpdateBy: aging.LastUpdateBy,
-			DeletedAt:    getAging.DeletedAt,
-			ProjectID:    aging.ProjectID,
+			Name:           aging.Name,
+			Description:    aging.Description,
+			Price:          aging.Price,
+			DurationMonths: aging.DurationMonths,
+			Status:         getAging.Status,
+			CreatedAt:      getAging.CreatedAt,
+			CreatedBy:      aging.CreatedBy,
+			UpdatedAt:      aging.UpdatedAt,
+			LastUpdateBy:   aging.LastUpdateBy,
+			DeletedAt:      getAging.DeletedAt,
+			ProjectID:      aging.ProjectID,
 		},
 	}
 
@@ -205,7 +209,7 @@ func (c *Controller) handleDeleteAging(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = c.aging.Delete(id, c.projectID, userID.(string), isAdmin)
+	err = c.aging.Delete(id, c.projectID, userID.(string), isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteAging] failed delete aging, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete aging", http.StatusInternalServerError)
@@ -239,16 +243,17 @@ func (c *Controller) handleGetAllAgings(w http.ResponseWriter, r *http.Request)
 			ID:   aging.ID,
 			Type: "aging",
 			Attributes: view.AgingAttributes{
-				Name:         aging.Name,
-				Description:  aging.Description,
-				Price:        aging.Price,
-				Status:       aging.Status,
-				CreatedAt:    aging.CreatedAt,
-				CreatedBy:    aging.CreatedBy,
-				UpdatedAt:    aging.UpdatedAt,
-				LastUpdateBy: aging.LastUpdateBy,
-				DeletedAt:    aging.DeletedAt,
-				ProjectID:    aging.ProjectID,
+				Name:           aging.Name,
+				Description:    aging.Description,
+				Price:          aging.Price,
+				DurationMonths: aging.DurationMonths,
+				Status:         aging.Status,
+				CreatedAt:      aging.CreatedAt,
+				CreatedBy:      aging.CreatedBy,
+				UpdatedAt:      aging.UpdatedAt,
+				LastUpdateBy:   aging.LastUpdateBy,
+				DeletedAt:      aging.DeletedAt,
+				ProjectID:      aging.ProjectID,
 			},
 		})
 	}
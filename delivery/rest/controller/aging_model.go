@@ -1,17 +1,19 @@
 package controller
 
 type reqInsertAging struct {
-	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description"`
-	Price       float64 `json:"price"`
-	CreatedBy   string  `json:"createdBy"`
+	Name           string  `json:"name" validate:"required"`
+	Description    string  `json:"description"`
+	Price          float64 `json:"price"`
+	DurationMonths int64   `json:"durationMonths"`
+	CreatedBy      string  `json:"createdBy"`
 }
 
 type reqUpdateAging struct {
-	Name         string  `json:"name" validate:"required"`
-	Description  string  `json:"description"`
-	Price        float64 `json:"price"`
-	LastUpdateBy string  `json:"lastUpdateBy"`
+	Name           string  `json:"name" validate:"required"`
+	Description    string  `json:"description"`
+	Price          float64 `json:"price"`
+	DurationMonths int64   `json:"durationMonths"`
+	LastUpdateBy   string  `json:"lastUpdateBy"`
 }
 
 type reqDeleteAging struct {
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/lib/go/gojunkyard.git/util"
+	"gopkg.in/guregu/null.v3"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// getRequestID returns the id of the request recorded in audit logs, taken
+// from X-Request-ID header or generated once when the client sent none
+func getRequestID(r *http.Request) string {
+	requestID := r.Header.Get(requestIDHeader)
+	if requestID == "" {
+		requestID = util.GenerateUUID()
+		r.Header.Set(requestIDHeader, requestID)
+	}
+	return requestID
+}
+
+func (c *Controller) handleGetAuditLogs(w http.ResponseWriter, r *http.Request) {
+	var err error
+	getParam := r.URL.Query()
+
+	filter := auditTrail.Filter{
+		EntityType: getParam.Get("entityType"),
+		ActorID:    getParam.Get("actorId"),
+	}
+	if entityID := getParam.Get("entityId"); entityID != "" {
+		filter.EntityID, err = strconv.ParseInt(entityID, 10, 64)
+		if err != nil {
+			c.reporter.Warningf("[handleGetAuditLogs] entityId must be integer, err: %s", err.Error())
+			view.RenderJSONError(w, "Invalid parameter entityId", http.StatusBadRequest)
+			return
+		}
+	}
+	if from := getParam.Get("from"); from != "" {
+		fromDate, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			c.reporter.Warningf("[handleGetAuditLogs] invalid from date, err: %s", err.Error())
+			view.RenderJSONError(w, "Invalid parameter from", http.StatusBadRequest)
+			return
+		}
+		filter.From = null.TimeFrom(fromDate)
+	}
+	if to := getParam.Get("to"); to != "" {
+		toDate, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			c.reporter.Warningf("[handleGetAuditLogs] invalid to date, err: %s", err.Error())
+			view.RenderJSONError(w, "Invalid parameter to", http.StatusBadRequest)
+			return
+		}
+		// to is inclusive, logs of the whole day are returned
+		filter.To = null.TimeFrom(toDate.AddDate(0, 0, 1))
+	}
+
+	page := 1
+	limit := 15
+	if limitVal := getParam.Get("limit"); limitVal != "" {
+		limit, err = strconv.Atoi(limitVal)
+		if err != nil || limit < 1 {
+			c.reporter.Warningf("[handleGetAuditLogs] invalid limit %s", limitVal)
+			view.RenderJSONError(w, "Invalid parameter limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if pageVal := getParam.Get("page"); pageVal != "" {
+		page, err = strconv.Atoi(pageVal)
+		if err != nil || page < 1 {
+			c.reporter.Warningf("[handleGetAuditLogs] invalid page %s", pageVal)
+			view.RenderJSONError(w, "Invalid parameter page", http.StatusBadRequest)
+			return
+		}
+	}
+	// one more log is selected to know whether there is a next page
+	filter.Offset = limit * (page - 1)
+	filter.Limit = limit + 1
+
+	audits, err := c.auditTrail.Select(c.projectID, filter)
+	if err != nil {
+		c.reporter.Errorf("[handleGetAuditLogs] failed get audit logs, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get audit logs", http.StatusInternalServerError)
+		return
+	}
+
+	hasNext := len(audits) > limit
+	if hasNext {
+		audits = audits[:limit]
+	}
+
+	res := make([]view.DataResponseAuditLog, 0, len(audits))
+	for _, audit := range audits {
+		res = append(res, view.DataResponseAuditLog{
+			ID:   audit.ID,
+			Type: "auditLog",
+			Attributes: view.AuditLogAttributes{
+				EntityType: audit.EntityType,
+				EntityID:   audit.EntityID,
+				Action:     audit.Action,
+				ActorID:    audit.ActorID,
+				RequestID:  audit.RequestID,
+				Changes:    audit.Changes,
+				CreatedAt:  audit.CreatedAt,
+			},
+		})
+	}
+
+	view.RenderJSONDataPage(w, res, hasNext, http.StatusOK)
+}
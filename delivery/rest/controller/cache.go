@@ -0,0 +1,13 @@
+package controller
+
+import (
+	"net/http"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+)
+
+// handleGetCacheStats returns the hit, miss and load counters of every cache
+// namespace since the service started
+func (c *Controller) handleGetCacheStats(w http.ResponseWriter, r *http.Request) {
+	view.RenderJSONData(w, c.cache.Stats(), http.StatusOK)
+}
@@ -10,7 +10,7 @@ import (
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/commercial_type"
 	"git.sstv.io/lib/go/gojunkyard.git/form"
 	"git.sstv.io/lib/go/gojunkyard.git/router"
-	//auth "git.sstv.io/lib/go/go-auth-api.git/authpassport"
+	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
 )
 
 func (c *Controller) handleGetAllcommercialTypes(w http.ResponseWriter, r *http.Request) {
@@ -64,7 +64,15 @@ func (c *Controller) handleDeletecommercialType(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = c.commercialType.Delete(id, c.projectID)
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handleDeletecommercialType] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, _ := user["sub"].(string)
+
+	err = c.commercialType.Delete(id, c.projectID, userID, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeletecommercialType] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete commercialType", http.StatusInternalServerError)
@@ -94,7 +102,7 @@ func (c *Controller) handlePostcommercialType(w http.ResponseWriter, r *http.Req
 		ProjectID		:  c.projectID,
 	}
 
-	err = c.commercialType.Insert(&commercialType)
+	err = c.commercialType.Insert(&commercialType, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostcommercialType] error insert Commercial_type repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post commercialType", http.StatusInternalServerError)
@@ -140,7 +148,7 @@ func (c *Controller) handlePatchcommercialType(w http.ResponseWriter, r *http.Re
 		ProjectID		:  c.projectID,
 		UpdatedAt 		:  time.Now(),
 	}
-	err = c.commercialType.Update(&commercialType)
+	err = c.commercialType.Update(&commercialType, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchcommercialType] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update commercialType", http.StatusInternalServerError)
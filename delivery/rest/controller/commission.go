@@ -0,0 +1,607 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/commission"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/refund"
+	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
+	"git.sstv.io/lib/go/gojunkyard.git/form"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+	"gopkg.in/guregu/null.v3"
+)
+
+func (c *Controller) handlePostCommissionScheme(w http.ResponseWriter, r *http.Request) {
+	var params reqCommissionScheme
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostCommissionScheme] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	scheme := commission.Scheme{
+		Name:            params.Name,
+		BeneficiaryType: params.BeneficiaryType,
+		BeneficiaryID:   params.BeneficiaryID,
+		ProductID:       null.IntFromPtr(params.ProductID),
+		VenueTypeID:     null.IntFromPtr(params.VenueTypeID),
+		Rate:            params.Rate,
+		Tiers:           params.Tiers,
+		CreatedBy:       params.UserID,
+		LastUpdateBy:    params.UserID,
+		ProjectID:       c.projectID,
+	}
+
+	err = scheme.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePostCommissionScheme] invalid commission scheme, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.checkBeneficiary(scheme)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostCommissionScheme] Beneficiary Not Found, %s %d", scheme.BeneficiaryType, scheme.BeneficiaryID)
+		view.RenderJSONError(w, "Beneficiary Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostCommissionScheme] Failed get beneficiary, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get beneficiary", http.StatusInternalServerError)
+		return
+	}
+
+	err = c.commission.InsertScheme(&scheme, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostCommissionScheme] failed post commission scheme, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post commission scheme", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseCommission{
+		ID:         scheme.ID,
+		Type:       "commissionScheme",
+		Attributes: mappingCommissionSchemeAttributes(scheme),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handlePatchCommissionScheme(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqCommissionScheme
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchCommissionScheme] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchCommissionScheme] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	getScheme, err := c.commission.GetScheme(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchCommissionScheme] Commission Scheme Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Commission Scheme Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchCommissionScheme] Failed get commission scheme, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get commission scheme", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := commission.Scheme{
+		ID:              id,
+		Name:            params.Name,
+		BeneficiaryType: params.BeneficiaryType,
+		BeneficiaryID:   params.BeneficiaryID,
+		ProductID:       null.IntFromPtr(params.ProductID),
+		VenueTypeID:     null.IntFromPtr(params.VenueTypeID),
+		Rate:            params.Rate,
+		Tiers:           params.Tiers,
+		Status:          getScheme.Status,
+		CreatedAt:       getScheme.CreatedAt,
+		CreatedBy:       getScheme.CreatedBy,
+		LastUpdateBy:    params.UserID,
+		DeletedAt:       getScheme.DeletedAt,
+		ProjectID:       c.projectID,
+	}
+
+	err = scheme.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePatchCommissionScheme] invalid commission scheme, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.checkBeneficiary(scheme)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchCommissionScheme] Beneficiary Not Found, %s %d", scheme.BeneficiaryType, scheme.BeneficiaryID)
+		view.RenderJSONError(w, "Beneficiary Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchCommissionScheme] Failed get beneficiary, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get beneficiary", http.StatusInternalServerError)
+		return
+	}
+
+	err = c.commission.UpdateScheme(&scheme, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePatchCommissionScheme] failed update commission scheme, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed update commission scheme", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseCommission{
+		ID:         scheme.ID,
+		Type:       "commissionScheme",
+		Attributes: mappingCommissionSchemeAttributes(scheme),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleDeleteCommissionScheme(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqDeleteCommissionScheme
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleDeleteCommissionScheme] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handleDeleteCommissionScheme] user id not found, err: %s", err.Error())
+		view.RenderJSONError(w, "User ID not found", http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.commission.GetScheme(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleDeleteCommissionScheme] Commission Scheme Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Commission Scheme Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleDeleteCommissionScheme] Failed get commission scheme, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get commission scheme", http.StatusInternalServerError)
+		return
+	}
+
+	scheme := commission.Scheme{
+		ID:           id,
+		LastUpdateBy: params.UserID,
+		ProjectID:    c.projectID,
+	}
+
+	err = c.commission.DeleteScheme(&scheme, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handleDeleteCommissionScheme] failed delete commission scheme, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed delete commission scheme", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseCommission{
+		ID: id,
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetAllCommissionSchemes(w http.ResponseWriter, r *http.Request) {
+	schemes, err := c.commission.SelectSchemes(c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetAllCommissionSchemes] failed get all commission schemes, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get all commission schemes", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponseCommission, 0, len(schemes))
+	for _, scheme := range schemes {
+		res = append(res, view.DataResponseCommission{
+			ID:         scheme.ID,
+			Type:       "commissionScheme",
+			Attributes: mappingCommissionSchemeAttributes(scheme),
+		})
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetCommissionSchemeByID(w http.ResponseWriter, r *http.Request) {
+	var (
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleGetCommissionSchemeByID] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	scheme, err := c.commission.GetScheme(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetCommissionSchemeByID] Commission Scheme Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Commission Scheme Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleGetCommissionSchemeByID] Failed get commission scheme, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get commission scheme", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseCommission{
+		ID:         scheme.ID,
+		Type:       "commissionScheme",
+		Attributes: mappingCommissionSchemeAttributes(scheme),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// handleGetAgentCommissions returns the commission statement of an agent for
+// the period param, the current month by default. The route shares its
+// wildcard with GET /agents/:userId but takes the agent id. Agents only see
+// their own statement
+func (c *Controller) handleGetAgentCommissions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.GetParam(r, "userId"), 10, 64)
+	if err != nil {
+		c.reporter.Warningf("[handleGetAgentCommissions] id must be integer, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	period, ok := commissionPeriod(r)
+	if !ok {
+		c.reporter.Warningf("[handleGetAgentCommissions] invalid period %s", r.URL.Query().Get("period"))
+		view.RenderJSONError(w, "Invalid parameter period", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handleGetAgentCommissions] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+
+	getAgent, err := c.agent.Get(c.projectID, id)
+	if err == nil {
+		if userID, ok := user["sub"].(string); ok && userID != getAgent.UserID {
+			_, err = c.admin.Check(userID)
+		}
+	}
+	if err == sql.ErrNoRows {
+		c.reporter.Infof("[handleGetAgentCommissions] agent not found, id: %d", id)
+		view.RenderJSONError(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleGetAgentCommissions] Failed get agent, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get agent", http.StatusInternalServerError)
+		return
+	}
+
+	c.renderCommissionStatement(w, "handleGetAgentCommissions", commission.BeneficiaryAgent, id, period)
+}
+
+// handleGetRegionalAgentCommissions returns the commission statement of a
+// regional agent for the period param, the current month by default
+func (c *Controller) handleGetRegionalAgentCommissions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.GetParam(r, "id"), 10, 64)
+	if err != nil {
+		c.reporter.Warningf("[handleGetRegionalAgentCommissions] id must be integer, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	period, ok := commissionPeriod(r)
+	if !ok {
+		c.reporter.Warningf("[handleGetRegionalAgentCommissions] invalid period %s", r.URL.Query().Get("period"))
+		view.RenderJSONError(w, "Invalid parameter period", http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.regionalAgent.Get(c.projectID, id)
+	if err == sql.ErrNoRows {
+		c.reporter.Infof("[handleGetRegionalAgentCommissions] regional agent not found, id: %d", id)
+		view.RenderJSONError(w, "Regional agent not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleGetRegionalAgentCommissions] Failed get regional agent, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get regional agent", http.StatusInternalServerError)
+		return
+	}
+
+	c.renderCommissionStatement(w, "handleGetRegionalAgentCommissions", commission.BeneficiaryRegionalAgent, id, period)
+}
+
+func (c *Controller) renderCommissionStatement(w http.ResponseWriter, handler, beneficiaryType string, beneficiaryID int64, period string) {
+	entries, err := c.commission.SelectEntries(c.projectID, beneficiaryType, beneficiaryID, period)
+	if err != nil {
+		c.reporter.Errorf("[%s] failed get commission entries, err: %s", handler, err.Error())
+		view.RenderJSONError(w, "Failed get commissions", http.StatusInternalServerError)
+		return
+	}
+
+	statement := commission.NewStatement(beneficiaryType, beneficiaryID, period, entries)
+	attributes := view.CommissionStatementAttributes{
+		BeneficiaryType: statement.BeneficiaryType,
+		BeneficiaryID:   statement.BeneficiaryID,
+		Period:          statement.Period,
+		Earned:          statement.Earned,
+		Reversed:        statement.Reversed,
+		Net:             statement.Net,
+		Entries:         make([]view.CommissionEntryAttributes, 0, len(statement.Entries)),
+	}
+	for _, entry := range statement.Entries {
+		attributes.Entries = append(attributes.Entries, view.CommissionEntryAttributes{
+			ID:          entry.ID,
+			SchemeID:    entry.SchemeID,
+			OrderID:     entry.OrderID,
+			OrderNumber: entry.OrderNumber,
+			VenueID:     entry.VenueID,
+			EntryType:   entry.EntryType,
+			BaseAmount:  entry.BaseAmount,
+			Rate:        entry.Rate,
+			Amount:      entry.Amount,
+			RefundID:    entry.RefundID,
+			CreatedAt:   entry.CreatedAt,
+		})
+	}
+
+	res := view.DataResponseCommission{
+		ID:         period,
+		Type:       "commissionStatement",
+		Attributes: attributes,
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// handleGetCommissionPayoutsExport downloads the net commission of every
+// agent and regional agent in the period param as csv
+func (c *Controller) handleGetCommissionPayoutsExport(w http.ResponseWriter, r *http.Request) {
+	period, ok := commissionPeriod(r)
+	if !ok {
+		c.reporter.Warningf("[handleGetCommissionPayoutsExport] invalid period %s", r.URL.Query().Get("period"))
+		view.RenderJSONError(w, "Invalid parameter period", http.StatusBadRequest)
+		return
+	}
+
+	payouts, err := c.commission.SelectPayouts(c.projectID, period)
+	if err != nil {
+		c.reporter.Errorf("[handleGetCommissionPayoutsExport] failed get payouts, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get payouts", http.StatusInternalServerError)
+		return
+	}
+
+	for i := range payouts {
+		payout := &payouts[i]
+		switch payout.BeneficiaryType {
+		case commission.BeneficiaryAgent:
+			getAgent, err := c.agent.Get(c.projectID, payout.BeneficiaryID)
+			if err == nil {
+				payout.Name = getAgent.UserID
+			}
+		case commission.BeneficiaryRegionalAgent:
+			getRegionalAgent, err := c.regionalAgent.Get(c.projectID, payout.BeneficiaryID)
+			if err == nil {
+				payout.Name = getRegionalAgent.Name
+				payout.Email = getRegionalAgent.Email
+			}
+		}
+	}
+
+	buff := bytes.NewBuffer([]byte{})
+	err = commission.WritePayouts(buff, period, payouts)
+	if err != nil {
+		c.reporter.Errorf("[handleGetCommissionPayoutsExport] failed write payouts, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed export payouts", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderCSV(w, buff.Bytes(), "commission-payouts-"+period+".csv", http.StatusOK)
+}
+
+// commissionPeriod returns the period param as YYYY-MM, the current month
+// when it is not given
+func commissionPeriod(r *http.Request) (string, bool) {
+	period := r.URL.Query().Get("period")
+	if period == "" {
+		return time.Now().Format(commission.PeriodLayout), true
+	}
+	_, err := time.Parse(commission.PeriodLayout, period)
+	return period, err == nil
+}
+
+// checkBeneficiary returns sql.ErrNoRows when the beneficiary of the scheme
+// does not exist
+func (c *Controller) checkBeneficiary(scheme commission.Scheme) (err error) {
+	if scheme.BeneficiaryType == commission.BeneficiaryRegionalAgent {
+		_, err = c.regionalAgent.Get(c.projectID, scheme.BeneficiaryID)
+		return
+	}
+	_, err = c.agent.Get(c.projectID, scheme.BeneficiaryID)
+	return
+}
+
+// commissionVenue is what a venue of an order earns commission on
+type commissionVenue struct {
+	ProductID   int64
+	VenueTypeID int64
+	Base        float64
+	Amount      float64
+}
+
+// commissionVenues returns the venues of the order by id with the amount of
+// their details before tax as commission base, and the amount paid for them
+// which refunds are a share of
+func (c *Controller) commissionVenues(o order.Order) (map[int64]*commissionVenue, map[int64]int64, error) {
+	details, err := c.orderDetail.GetFromDBByOrderID(o.OrderID, c.projectID, "")
+	if err != nil && err != sql.ErrNoRows {
+		return nil, nil, err
+	}
+
+	var (
+		venues       = make(map[int64]*commissionVenue)
+		detailVenues = make(map[int64]int64, len(details))
+	)
+	for _, detail := range details {
+		venueID := detail.VenueID
+		if venueID == 0 {
+			venueID = o.VenueID
+		}
+		detailVenues[detail.ID] = venueID
+
+		v, ok := venues[venueID]
+		if !ok {
+			v = &commissionVenue{ProductID: o.ProductID}
+			venues[venueID] = v
+		}
+		if detail.ItemType == "product" {
+			v.ProductID = detail.ItemID
+		}
+		if detail.TaxRateID.Valid {
+			v.Base += detail.TaxBase
+		} else {
+			v.Base += detail.Amount
+		}
+		v.Amount += detail.PaidAmount()
+	}
+	return venues, detailVenues, nil
+}
+
+// earnCommissions records the commission of the agent who placed the paid
+// order and of its regional agent, by the scheme of each matching the product
+// and venue type of every venue
+func (c *Controller) earnCommissions(paidOrder order.Order) error {
+	orderAgent, err := c.agent.Check(paidOrder.CreatedBy)
+	if err == sql.ErrNoRows || orderAgent.ID == 0 {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	schemes, err := c.commission.SelectSchemes(c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if len(schemes) == 0 {
+		return nil
+	}
+
+	venues, _, err := c.commissionVenues(paidOrder)
+	if err != nil {
+		return err
+	}
+
+	paidAt := time.Now()
+	if paidOrder.PaidAt.Valid {
+		paidAt = paidOrder.PaidAt.Time
+	}
+
+	for venueID, v := range venues {
+		getVenue, err := c.venue.Get(c.projectID, venueID, "")
+		if err != nil {
+			return err
+		}
+
+		beneficiaries := map[string]int64{commission.BeneficiaryAgent: orderAgent.ID}
+		if orderAgent.RegionalAgentID.Valid {
+			beneficiaries[commission.BeneficiaryRegionalAgent] = orderAgent.RegionalAgentID.Int64
+		}
+		for beneficiaryType, beneficiaryID := range beneficiaries {
+			scheme, ok := schemes.Match(beneficiaryType, beneficiaryID, v.ProductID, getVenue.VenueType)
+			if !ok {
+				continue
+			}
+
+			entry := commission.Entry{
+				OrderID:     paidOrder.OrderID,
+				OrderNumber: paidOrder.OrderNumber,
+				VenueID:     venueID,
+				BaseAmount:  v.Base,
+				Period:      paidAt.Format(commission.PeriodLayout),
+			}
+			err = c.commission.Earn(scheme, &entry)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reverseCommissions takes back the commissions of the refunded order in the
+// share of each venue refunded, all of them on a full refund
+func (c *Controller) reverseCommissions(refundedOrder order.Order, completed refund.Refund, isFullRefund bool) error {
+	venues, detailVenues, err := c.commissionVenues(refundedOrder)
+	if err != nil {
+		return err
+	}
+
+	shares := make(map[int64]float64, len(venues))
+	if isFullRefund {
+		for venueID := range venues {
+			shares[venueID] = 1
+		}
+	} else {
+		for _, detail := range completed.Details {
+			venueID, ok := detailVenues[detail.OrderDetailID]
+			if !ok || venues[venueID].Amount <= 0 {
+				continue
+			}
+			shares[venueID] += detail.Amount / venues[venueID].Amount
+		}
+	}
+
+	at := time.Now()
+	if completed.CompletedAt.Valid {
+		at = completed.CompletedAt.Time
+	}
+	return c.commission.Reverse(c.projectID, refundedOrder.OrderID, completed.ID, shares, at)
+}
+
+func mappingCommissionSchemeAttributes(scheme commission.Scheme) view.CommissionSchemeAttributes {
+	return view.CommissionSchemeAttributes{
+		Name:            scheme.Name,
+		BeneficiaryType: scheme.BeneficiaryType,
+		BeneficiaryID:   scheme.BeneficiaryID,
+		ProductID:       scheme.ProductID,
+		VenueTypeID:     scheme.VenueTypeID,
+		Rate:            scheme.Rate,
+		Tiers:           scheme.Tiers,
+		Status:          scheme.Status,
+		CreatedAt:       scheme.CreatedAt,
+		CreatedBy:       scheme.CreatedBy,
+		UpdatedAt:       scheme.UpdatedAt,
+		LastUpdateBy:    scheme.LastUpdateBy,
+		DeletedAt:       scheme.DeletedAt,
+		ProjectID:       scheme.ProjectID,
+	}
+}
@@ -0,0 +1,18 @@
+package controller
+
+import "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/commission"
+
+type reqCommissionScheme struct {
+	Name            string           `json:"name" validate:"required"`
+	BeneficiaryType string           `json:"beneficiaryType" validate:"required"`
+	BeneficiaryID   int64            `json:"beneficiaryID" validate:"required"`
+	ProductID       *int64           `json:"productID"`
+	VenueTypeID     *int64           `json:"venueTypeID"`
+	Rate            float64          `json:"rate"`
+	Tiers           commission.Tiers `json:"tiers"`
+	UserID          string           `json:"userID" validate:"required"`
+}
+
+type reqDeleteCommissionScheme struct {
+	UserID string `json:"userID"`
+}
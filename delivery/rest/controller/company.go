@@ -9,6 +9,7 @@ import (
 
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/company"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/template"
 	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	"git.sstv.io/lib/go/gojunkyard.git/form"
 	"git.sstv.io/lib/go/gojunkyard.git/router"
@@ -51,6 +52,7 @@ func (c *Controller) handleGetAllCompanies(w http.ResponseWriter, r *http.Reques
 				Zip:          company.Zip,
 				Email:        company.Email,
 				Npwp:         company.Npwp,
+				Locale:       company.Locale,
 				CreatedAt:    company.CreatedAt,
 				UpdatedAt:    company.UpdatedAt,
 				DeletedAt:    company.DeletedAt,
@@ -114,6 +116,7 @@ func (c *Controller) handleGetCompanyByID(w http.ResponseWriter, r *http.Request
 			Zip:          company.Zip,
 			Email:        company.Email,
 			Npwp:         company.Npwp,
+			Locale:       company.Locale,
 			CreatedAt:    company.CreatedAt,
 			UpdatedAt:    company.UpdatedAt,
 			DeletedAt:    company.DeletedAt,
@@ -204,6 +207,15 @@ func (c *Controller) handlePostCompany(w http.ResponseWriter, r *http.Request) {
 		userid = fmt.Sprintf("%v", userID)
 	}
 
+	if params.Locale == "" {
+		params.Locale = template.DefaultLocale
+	}
+	if !template.IsValidLocale(params.Locale) {
+		c.reporter.Warningf("[handlePostCompany] invalid locale %s", params.Locale)
+		view.RenderJSONError(w, template.ErrInvalidLocale.Error(), http.StatusBadRequest)
+		return
+	}
+
 	company := company.Company{
 		ID:        params.ID,
 		Name:      params.Name,
@@ -213,6 +225,7 @@ func (c *Controller) handlePostCompany(w http.ResponseWriter, r *http.Request) {
 		Zip:       params.Zip,
 		Email:     params.Email,
 		Npwp:      params.Npwp,
+		Locale:    params.Locale,
 		CreatedBy: userid,
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -276,6 +289,14 @@ func (c *Controller) handlePatchCompany(w http.ResponseWriter, r *http.Request)
 		view.RenderJSONError(w, "Failed get Company", http.StatusInternalServerError)
 		return
 	}
+	if params.Locale == "" {
+		params.Locale = comp.Locale
+	}
+	if !template.IsValidLocale(params.Locale) {
+		c.reporter.Warningf("[handlePatchCompany] invalid locale %s", params.Locale)
+		view.RenderJSONError(w, template.ErrInvalidLocale.Error(), http.StatusBadRequest)
+		return
+	}
 	company := company.Company{
 		ID:           id,
 		Name:         params.Name,
@@ -285,6 +306,7 @@ func (c *Controller) handlePatchCompany(w http.ResponseWriter, r *http.Request)
 		Zip:          params.Zip,
 		Email:        params.Email,
 		Npwp:         params.Npwp,
+		Locale:       params.Locale,
 		CreatedBy:    comp.CreatedBy,
 		LastUpdateBy: userid,
 		UpdatedAt:	  time.Now(),
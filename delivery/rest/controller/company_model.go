@@ -9,6 +9,7 @@ type reqCompany struct {
 	Zip  			string    `json:"zip"`
 	Email		  	string    `json:"email"`
 	Npwp  			string    `json:"npwp"`
+	Locale			string    `json:"locale"`
 	CreatedBy  		string    `json:"createdBy"`
 	LastUpdateBy	string    `json:"lastUpdateBy"`
 }
@@ -95,7 +95,7 @@ func (c *Controller) handleDeleteDevice(w http.ResponseWriter, r *http.Request)
 		isAdmin = true
 	}
 
-	err = c.device.Delete(c.projectID, id, isAdmin, userID.(string))
+	err = c.device.Delete(c.projectID, id, isAdmin, userID.(string), getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteDevice] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete device", http.StatusInternalServerError)
@@ -140,7 +140,7 @@ func (c *Controller) handlePostDevice(w http.ResponseWriter, r *http.Request) {
 		CreatedBy: uid,
 	}
 
-	err = c.device.Insert(&device)
+	err = c.device.Insert(&device, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostDevice] error insert device repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post device", http.StatusInternalServerError)
@@ -208,7 +208,7 @@ func (c *Controller) handlePatchDevice(w http.ResponseWriter, r *http.Request) {
 		ProjectID:    c.projectID,
 		LastUpdateBy: userID.(string),
 	}
-	err = c.device.Update(&device, isAdmin)
+	err = c.device.Update(&device, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchDevice] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update device", http.StatusInternalServerError)
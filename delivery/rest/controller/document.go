@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+)
+
+func (c *Controller) handleGetOrderInvoicePDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.GetParam(r, "id"), 10, 64)
+	if err != nil {
+		c.reporter.Errorf("[handleGetOrderInvoicePDF] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handleGetOrderInvoicePDF] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, _ := user["sub"].(string)
+
+	// same ownership as order.Get, admins have no sub and get any order
+	order, err := c.order.Get(id, c.projectID, userID)
+	if err != nil {
+		c.reporter.Errorf("[handleGetOrderInvoicePDF] order not found, err: %s", err.Error())
+		view.RenderJSONError(w, "Orders not found", http.StatusNotFound)
+		return
+	}
+
+	invoice, _, err := c.invoiceDocument(order.OrderID, "")
+	if err != nil {
+		c.reporter.Warningf("[handleGetOrderInvoicePDF] %s", err.Error())
+		view.RenderJSONError(w, "Order details not found", http.StatusNotFound)
+		return
+	}
+
+	pdf, err := c.document.Invoice(invoice)
+	if err != nil {
+		c.reporter.Errorf("[handleGetOrderInvoicePDF] failed generate invoice, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate invoice", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderPDF(w, pdf, "invoice-"+order.OrderNumber+".pdf", "attachment", http.StatusOK)
+}
+
+func (c *Controller) handleGetVenueCertificatePDF(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.GetParam(r, "id"), 10, 64)
+	if err != nil {
+		c.reporter.Errorf("[handleGetVenueCertificatePDF] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handleGetVenueCertificatePDF] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, _ := user["sub"].(string)
+
+	// same ownership as venue.Get, admins have no sub and get any venue
+	venue, err := c.venue.Get(c.projectID, id, userID)
+	if err != nil {
+		c.reporter.Errorf("[handleGetVenueCertificatePDF] venue not found, err: %s", err.Error())
+		view.RenderJSONError(w, "Venue not found", http.StatusNotFound)
+		return
+	}
+
+	certificate, sumvenue, err := c.certificateDocument(venue.Id, "")
+	if err != nil {
+		c.reporter.Warningf("[handleGetVenueCertificatePDF] %s", err.Error())
+		view.RenderJSONError(w, "Venue has no license", http.StatusNotFound)
+		return
+	}
+
+	pdf, err := c.document.Certificate(certificate)
+	if err != nil {
+		c.reporter.Errorf("[handleGetVenueCertificatePDF] failed generate certificate, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate certificate", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderPDF(w, pdf, "certificate-"+sumvenue.LicenseNumber+".pdf", "attachment", http.StatusOK)
+}
@@ -2,13 +2,21 @@ package controller
 
 import (
 	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_log"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_outbox"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_detail"
 	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	"git.sstv.io/lib/go/gojunkyard.git/form"
+	null "gopkg.in/guregu/null.v3"
 )
 
 func (c *Controller) handlePostEmailECert(w http.ResponseWriter, r *http.Request) {
@@ -56,14 +64,42 @@ func (c *Controller) handlePostEmailECert(w http.ResponseWriter, r *http.Request
 }
 
 func (c *Controller) handleEmailECert(venueID int64, userID string) bool {
-	content, sumvenue, qrcodecontent := c.handleGetDataSertificate(venueID, userID)
+	emailReq, sumvenue, err := c.buildEmailECert(venueID, userID)
+	if err != nil {
+		c.reporter.Errorf("[handleEmailECert] %s", err.Error())
+		return false
+	}
+
+	errEmail := c.email.Send(emailReq)
+	msg := c.handlePostEmailEcertLog(userID, sumvenue.LastOrderID.Int64, venueID, emailReq.To, "ecert", sumvenue.CompanyID.Int64, errEmail)
 
-	if content == "0" {
-		c.reporter.Errorf("[handleEmailECert] content get data invoice null")
+	if msg == "0" {
+		c.reporter.Errorf("[handleEmailInvoice] Email Invoice Error")
+		return false
+	}
+	if errEmail != nil {
+		c.reporter.Errorf("[handleEmailInvoice] Error send Email Invoice ")
 		return false
 	}
+	return true
+}
 
-	htmlEmail := c.handleGetHtmlBodyCert(sumvenue.VenueName, sumvenue.VenueAddress)
+// buildEmailECert renders the e-certificate email of the venue
+func (c *Controller) buildEmailECert(venueID int64, userID string) (email.EmailRequest, order.SummaryVenue, error) {
+	certificate, sumvenue, err := c.certificateDocument(venueID, userID)
+	if err != nil {
+		return email.EmailRequest{}, sumvenue, err
+	}
+
+	pdf, err := c.document.Certificate(certificate)
+	if err != nil {
+		return email.EmailRequest{}, sumvenue, fmt.Errorf("failed render certificate: %s", err.Error())
+	}
+
+	htmlEmail, err := c.handleGetHtmlBodyCert(sumvenue.VenueName, sumvenue.VenueAddress, certificate.Locale)
+	if err != nil {
+		return email.EmailRequest{}, sumvenue, err
+	}
 
 	emailReq := email.EmailRequest{
 		Subject: "Selamat! Keanggotaan Mola Live Arena sudah aktif.",
@@ -73,14 +109,14 @@ func (c *Controller) handleEmailECert(venueID int64, userID string) bool {
 		Text:    " ",
 		Attachments: []email.Attachment{
 			{
-				Content:     content,
+				Content:     base64.StdEncoding.EncodeToString(pdf),
 				Filename:    "membership.pdf",
 				Type:        "plain/text",
 				Disposition: "attachment",
 				ContentID:   "contentid-test",
 			},
 			{
-				Content:     qrcodecontent,
+				Content:     certificate.QRCode,
 				Filename:    "MolaLiveArena.png",
 				Type:        "image/png",
 				Disposition: "attachment",
@@ -88,18 +124,7 @@ func (c *Controller) handleEmailECert(venueID int64, userID string) bool {
 			},
 		},
 	}
-	errEmail := c.email.Send(emailReq)
-	msg := c.handlePostEmailEcertLog(userID, sumvenue.LastOrderID.Int64, venueID, emailReq.To, "ecert", sumvenue.CompanyID.Int64)
-
-	if msg == "0" {
-		c.reporter.Errorf("[handleEmailInvoice] Email Invoice Error")
-		return false
-	}
-	if errEmail != nil {
-		c.reporter.Errorf("[handleEmailInvoice] Error send Email Invoice ")
-		return false
-	}
-	return true
+	return emailReq, sumvenue, nil
 }
 
 func (c *Controller) handlePostEmailInvoice(w http.ResponseWriter, r *http.Request) {
@@ -144,38 +169,52 @@ func (c *Controller) handlePostEmailInvoice(w http.ResponseWriter, r *http.Reque
 }
 
 func (c *Controller) handleEmailInvoice(orderID int64, userID string) bool {
-	var (
-		em, name, address = "", "", ""
-		venueID, compID   = int64(0), int64(0)
-	)
-	content, orderDetail := c.handleGetDataInvoice(orderID, userID)
-
-	if content == "0" {
-		c.reporter.Errorf("[handleEmailInvoice] content get data invoice null")
+	emailReq, detail, err := c.buildEmailInvoice(orderID, userID)
+	if err != nil {
+		c.reporter.Errorf("[handleEmailInvoice] %s", err.Error())
 		return false
 	}
 
-	if len(orderDetail) > 0 {
-		em = orderDetail[0].CompanyEmail
-		venueID = orderDetail[0].VenueID
-		compID = orderDetail[0].CompanyID
-		name = orderDetail[0].VenueName
-		address = orderDetail[0].Address
-	} else {
-		c.reporter.Errorf("[handleEmailInvoice] content get data invoice = 0")
+	errEmail := c.email.Send(emailReq)
+	msg := c.handlePostEmailEcertLog(userID, orderID, detail.VenueID, emailReq.To, "invoice", detail.CompanyID, errEmail)
+	if msg == "0" {
+		c.reporter.Errorf("[handleEmailInvoice] Email Invoice Error")
 		return false
 	}
+	if errEmail != nil {
+		c.reporter.Errorf("[handleEmailInvoice] Error send Email Invoice ")
+		return false
+	}
+	return true
+}
+
+// buildEmailInvoice renders the invoice email of the order, it also returns
+// the first order detail which holds the venue and company of the order
+func (c *Controller) buildEmailInvoice(orderID int64, userID string) (email.EmailRequest, order_detail.DataDetail, error) {
+	invoice, orderDetail, err := c.invoiceDocument(orderID, userID)
+	if err != nil {
+		return email.EmailRequest{}, order_detail.DataDetail{}, err
+	}
+	detail := orderDetail[0]
 
-	htmlEmail := c.handleGetHtmlBodyInvoice(name, address)
+	pdf, err := c.document.Invoice(invoice)
+	if err != nil {
+		return email.EmailRequest{}, detail, fmt.Errorf("failed render invoice: %s", err.Error())
+	}
+
+	htmlEmail, err := c.handleGetHtmlBodyInvoice(detail.VenueName, detail.Address, invoice.Locale)
+	if err != nil {
+		return email.EmailRequest{}, detail, err
+	}
 	emailReq := email.EmailRequest{
 		Subject: "Invoice",
-		To:      em,
+		To:      detail.CompanyEmail,
 		HTML:    htmlEmail,
 		From:    "no-reply@molalivearena.com",
 		Text:    " ",
 		Attachments: []email.Attachment{
 			{
-				Content:     content,
+				Content:     base64.StdEncoding.EncodeToString(pdf),
 				Filename:    "invoice.pdf",
 				Type:        "plain/text",
 				Disposition: "attachment",
@@ -183,15 +222,51 @@ func (c *Controller) handleEmailInvoice(orderID int64, userID string) bool {
 			},
 		},
 	}
-	errEmail := c.email.Send(emailReq)
-	msg := c.handlePostEmailEcertLog(userID, orderID, venueID, emailReq.To, "invoice", compID)
-	if msg == "0" {
-		c.reporter.Errorf("[handleEmailInvoice] Email Invoice Error")
-		return false
+	return emailReq, detail, nil
+}
+
+// DeliverOutboxMessage renders and sends the email of an outbox message, the
+// returned log describes the attempt even when sending fails. The
+// e-certificate waits until the venue license has been activated
+func (c *Controller) DeliverOutboxMessage(message email_outbox.Message) (email_log.EmailLog, error) {
+	emailLog := email_log.EmailLog{
+		SenderUID: message.CreatedBy,
+		OrderID:   message.OrderID,
+		VenueID:   message.VenueID,
+		EmailType: message.Type,
+		OutboxID:  null.IntFrom(message.ID),
+		ProjectID: message.ProjectID,
+		CreatedBy: message.CreatedBy,
 	}
-	if errEmail != nil {
-		c.reporter.Errorf("[handleEmailInvoice] Error send Email Invoice ")
-		return false
+
+	var (
+		emailReq email.EmailRequest
+		err      error
+	)
+	switch message.Type {
+	case email_outbox.TypeECert:
+		venueLicense, errLicense := c.license.GetByVenueID(message.ProjectID, message.VenueID)
+		if errLicense != nil {
+			return emailLog, fmt.Errorf("failed get license: %s", errLicense.Error())
+		}
+		if venueLicense.LicenseStatus != license.LicenseStatusActive || !venueLicense.IsActivated() {
+			return emailLog, errors.New("license is not active yet")
+		}
+
+		var sumvenue order.SummaryVenue
+		emailReq, sumvenue, err = c.buildEmailECert(message.VenueID, "")
+		emailLog.CompanyID = sumvenue.CompanyID.Int64
+	case email_outbox.TypeInvoice:
+		var detail order_detail.DataDetail
+		emailReq, detail, err = c.buildEmailInvoice(message.OrderID, "")
+		emailLog.CompanyID = detail.CompanyID
+	default:
+		err = fmt.Errorf("unknown email type %s", message.Type)
 	}
-	return true
+	if err != nil {
+		return emailLog, err
+	}
+	emailLog.To = emailReq.To
+
+	return emailLog, c.email.Send(emailReq)
 }
@@ -5,13 +5,14 @@ import (
 	// "git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
 
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_log"
+	null "gopkg.in/guregu/null.v3"
 	// "git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	// "git.sstv.io/lib/go/gojunkyard.git/form"
 	// "git.sstv.io/lib/go/gojunkyard.git/router"
 	//auth "git.sstv.io/lib/go/go-auth-api.git/authpassport"
 )
 
-func (c *Controller) handlePostEmailEcertLog(userID string, orderID int64, venueID int64, to string, emailType string,compId int64) string {
+func (c *Controller) handlePostEmailEcertLog(userID string, orderID int64, venueID int64, to string, emailType string,compId int64, errEmail error) string {
 
 	//companyEmail, err = c.company.GetByOrderID(orderID, 10)
 
@@ -24,6 +25,11 @@ func (c *Controller) handlePostEmailEcertLog(userID string, orderID int64, venue
 		CreatedBy: userID,
 		CompanyID: compId,
 	}
+	if errEmail != nil {
+		emailLog.DeliveryStatus = email_log.DeliveryFailed
+		emailLog.Attempts = 1
+		emailLog.LastError = null.StringFrom(errEmail.Error())
+	}
 
 	err := c.emailLog.Insert(&emailLog)
 	if err != nil {
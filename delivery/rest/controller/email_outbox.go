@@ -0,0 +1,126 @@
+package controller
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_outbox"
+	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+)
+
+func (c *Controller) handleGetEmailOutbox(w http.ResponseWriter, r *http.Request) {
+	var err error
+	getParam := r.URL.Query()
+
+	status := getParam.Get("status")
+	if status != "" && status != email_outbox.StatusPending && status != email_outbox.StatusSent && status != email_outbox.StatusDead {
+		c.reporter.Warningf("[handleGetEmailOutbox] invalid status %s", status)
+		view.RenderJSONError(w, "Invalid parameter status", http.StatusBadRequest)
+		return
+	}
+
+	page := 1
+	limit := 15
+	if limitVal := getParam.Get("limit"); limitVal != "" {
+		limit, err = strconv.Atoi(limitVal)
+		if err != nil || limit < 1 {
+			c.reporter.Warningf("[handleGetEmailOutbox] invalid limit %s", limitVal)
+			view.RenderJSONError(w, "Invalid parameter limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if pageVal := getParam.Get("page"); pageVal != "" {
+		page, err = strconv.Atoi(pageVal)
+		if err != nil || page < 1 {
+			c.reporter.Warningf("[handleGetEmailOutbox] invalid page %s", pageVal)
+			view.RenderJSONError(w, "Invalid parameter page", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// one more email is selected to know whether there is a next page
+	messages, err := c.emailOutbox.Select(c.projectID, status, limit+1, limit*(page-1))
+	if err != nil {
+		c.reporter.Errorf("[handleGetEmailOutbox] failed get email outbox, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get email outbox", http.StatusInternalServerError)
+		return
+	}
+
+	hasNext := len(messages) > limit
+	if hasNext {
+		messages = messages[:limit]
+	}
+
+	res := make([]view.DataResponseEmailOutbox, 0, len(messages))
+	for _, message := range messages {
+		res = append(res, toEmailOutboxResponse(message))
+	}
+
+	view.RenderJSONDataPage(w, res, hasNext, http.StatusOK)
+}
+
+func (c *Controller) handlePostEmailOutboxRetry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.GetParam(r, "id"), 10, 64)
+	if err != nil {
+		c.reporter.Warningf("[handlePostEmailOutboxRetry] id must be integer, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handlePostEmailOutboxRetry] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusBadRequest)
+		return
+	}
+	userID, _ := user["sub"].(string)
+
+	err = c.emailOutbox.Retry(id, c.projectID, userID)
+	if err == email_outbox.ErrNotDead {
+		_, errGet := c.emailOutbox.Get(id, c.projectID)
+		if errGet == sql.ErrNoRows {
+			c.reporter.Warningf("[handlePostEmailOutboxRetry] email %d not found", id)
+			view.RenderJSONError(w, "Email not found", http.StatusNotFound)
+			return
+		}
+		c.reporter.Warningf("[handlePostEmailOutboxRetry] email %d is not dead", id)
+		view.RenderJSONError(w, "Only dead email can be retried", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostEmailOutboxRetry] failed retry email, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed retry email", http.StatusInternalServerError)
+		return
+	}
+
+	message, err := c.emailOutbox.Get(id, c.projectID)
+	if err != nil {
+		c.reporter.Errorf("[handlePostEmailOutboxRetry] failed get email, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get email", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderJSONData(w, toEmailOutboxResponse(message), http.StatusOK)
+}
+
+func toEmailOutboxResponse(message email_outbox.Message) view.DataResponseEmailOutbox {
+	return view.DataResponseEmailOutbox{
+		ID:   message.ID,
+		Type: "emailOutbox",
+		Attributes: view.EmailOutboxAttributes{
+			EmailType:     message.Type,
+			OrderID:       message.OrderID,
+			VenueID:       message.VenueID,
+			Status:        message.Status,
+			Attempts:      message.Attempts,
+			NextAttemptAt: message.NextAttemptAt,
+			LastError:     message.LastError,
+			SentAt:        message.SentAt,
+			CreatedAt:     message.CreatedAt,
+			UpdatedAt:     message.UpdatedAt,
+		},
+	}
+}
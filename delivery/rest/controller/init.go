@@ -6,24 +6,38 @@ import (
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/admin"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/agent"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/aging"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/city"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/commercial_type"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/commission"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/company"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/device"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/document"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_log"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_outbox"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/history"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/installation"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license_token"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_detail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_matrix"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment_method"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/product"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/promotion"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/province"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/quotation"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/refund"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/regional_agent"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/room"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/sequence"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/subscription"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/tax"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/template"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/venue"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/venue_type"
@@ -64,6 +78,20 @@ type Controller struct {
 	subscription   subscription.ICore
 	regionalAgent  regional_agent.ICore
 	orderMatrix    order_matrix.ICore
+	pricing        pricing.ICore
+	paymentMethod  payment_method.ICore
+	refund         refund.ICore
+	licenseToken   license_token.ICore
+	sequence       sequence.ICore
+	auditTrail     audit_trail.ICore
+	cache          cache.ICore
+	emailOutbox    email_outbox.ICore
+	orderJob       order_job.ICore
+	document       document.ICore
+	tax            tax.ICore
+	quotation      quotation.ICore
+	promotion      promotion.ICore
+	commission     commission.ICore
 }
 
 // New ...
@@ -95,6 +123,20 @@ func New(
 	subscription subscription.ICore,
 	regionalAgent regional_agent.ICore,
 	orderMatrix order_matrix.ICore,
+	pricing pricing.ICore,
+	paymentMethod payment_method.ICore,
+	refund refund.ICore,
+	licenseToken license_token.ICore,
+	sequence sequence.ICore,
+	auditTrail audit_trail.ICore,
+	cache cache.ICore,
+	emailOutbox email_outbox.ICore,
+	orderJob order_job.ICore,
+	document document.ICore,
+	tax tax.ICore,
+	quotation quotation.ICore,
+	promotion promotion.ICore,
+	commission commission.ICore,
 ) *Controller {
 	return &Controller{
 		reporter:       reporter,
@@ -124,6 +166,20 @@ func New(
 		subscription:   subscription,
 		regionalAgent:  regionalAgent,
 		orderMatrix:    orderMatrix,
+		pricing:        pricing,
+		paymentMethod:  paymentMethod,
+		refund:         refund,
+		licenseToken:   licenseToken,
+		sequence:       sequence,
+		auditTrail:     auditTrail,
+		cache:          cache,
+		emailOutbox:    emailOutbox,
+		orderJob:       orderJob,
+		document:       document,
+		tax:            tax,
+		quotation:      quotation,
+		promotion:      promotion,
+		commission:     commission,
 	}
 }
 
@@ -137,13 +193,19 @@ func (c *Controller) Register(router *router.Router) {
 
 	router.POST("/orders", c.auth.MustAuthorize(c.handlePostOrder, "molanobar:orders.create"))
 	router.POST("/orders-by-agents", c.auth.MustAuthorize(c.handlePostOrderByAgent, "molanobar:orders.create"))
+	router.POST("/cart-orders", c.auth.MustAuthorize(c.handlePostCartOrder, "molanobar:orders.create"))
 	router.PATCH("/orders/:id", c.auth.MustAuthorize(c.handlePatchOrder, "molanobar:orders.update"))
 	router.PATCH("/orders-status/:id", c.auth.MustAuthorize(c.handleUpdateOrderStatusByID, "molanobar:orders.update"))
 	router.PATCH("/orders-open-payment-status/:id", c.auth.MustAuthorize(c.handleUpdateOpenPaymentStatusByID, "molanobar:orders.update"))
 	router.PATCH("/orders-do-payment/:id", c.auth.MustAuthorize(c.handlePatchOrderForPayment, "molanobar:orders.update"))
+	router.POST("/payments/callback", c.handlePaymentCallback)
 	router.DELETE("/orders/:id", c.auth.MustAuthorize(c.handleDeleteOrder, "molanobar:orders.delete"))
 	router.GET("/orders", c.auth.MustAuthorize(c.handleGetAllOrders, "molanobar:orders.read"))
 	router.GET("/orders/:id", c.auth.MustAuthorize(c.handleGetOrderByID, "molanobar:orders.read"))
+	router.GET("/orders/:id/invoice.pdf", c.auth.MustAuthorize(c.handleGetOrderInvoicePDF, "molanobar:orders.read"))
+	router.GET("/orders/:id/history", c.auth.MustAuthorize(c.handleGetOrderHistory, "molanobar:orders.read"))
+	router.POST("/orders/:id/refunds", c.auth.MustAuthorize(c.handlePostOrderRefund, "molanobar:refunds.create"))
+	router.GET("/orders/:id/refunds", c.auth.MustAuthorize(c.handleGetOrderRefunds, "molanobar:refunds.read"))
 	router.GET("/orders-by-venueid/:venue_id", c.auth.MustAuthorize(c.handleGetAllByVenueID, "molanobar:orders.read"))
 	router.GET("/orders-by-buyerid/:buyer_id", c.auth.MustAuthorize(c.handleGetAllByBuyerID, "molanobar:orders.read"))
 	router.GET("/orders-by-paiddate/:paid_date", c.auth.MustAuthorize(c.handleGetAllByPaidDate, "molanobar:orders.read"))
@@ -151,6 +213,13 @@ func (c *Controller) Register(router *router.Router) {
 	router.GET("/sumorders/:id", c.auth.MustAuthorize(c.handleGetSumOrderByID, "molanobar:orders.read"))
 	router.POST("/calculate-order", c.auth.MustAuthorize(c.handleCalculateOrderPrice, "molanobar:orders.create"))
 
+	router.POST("/quotations", c.auth.MustAuthorize(c.handlePostQuotation, "molanobar:quotations.create"))
+	router.GET("/quotations", c.auth.MustAuthorize(c.handleGetQuotations, "molanobar:quotations.read"))
+	router.GET("/quotations/:id", c.auth.MustAuthorize(c.handleGetQuotationByID, "molanobar:quotations.read"))
+	router.GET("/quotations/:id/quotation.pdf", c.auth.MustAuthorize(c.handleGetQuotationPDF, "molanobar:quotations.read"))
+	router.POST("/quotations/:id/email", c.auth.MustAuthorize(c.handlePostQuotationEmail, "molanobar:quotations.read"))
+	router.POST("/quotations/:id/convert", c.auth.MustAuthorize(c.handlePostConvertQuotation, "molanobar:orders.create"))
+
 	router.GET("/venues", c.auth.MustAuthorize(c.handleGetAllVenues, "molanobar:venues.read"))
 	router.GET("/venues/detail", c.handleGetAllVenues)
 	router.GET("/venues/available", c.handleGetAllVenuesAvailable)
@@ -158,6 +227,7 @@ func (c *Controller) Register(router *router.Router) {
 	router.POST("/venue", c.auth.MustAuthorize(c.handlePostVenue, "molanobar:venues.create"))
 	router.PATCH("/venue/:id", c.auth.MustAuthorize(c.handlePatchVenue, "molanobar:venues.update"))
 	router.GET("/venue/:id", c.auth.MustAuthorize(c.handleGetVenueByID, "molanobar:venues.read"))
+	router.GET("/venue/:id/certificate.pdf", c.auth.MustAuthorize(c.handleGetVenueCertificatePDF, "molanobar:venues.read"))
 	router.PATCH("/venues/show/:id", c.auth.MustAuthorize(c.handleShowStatusVenue, "molanobar:venues.update"))
 	router.DELETE("/venue/:id", c.auth.MustAuthorize(c.handleDeleteVenue, "molanobar:venues.delete"))
 	router.GET("/venue", c.auth.MustAuthorize(c.handleSelectAllVenues, "molanobar:venues.read"))
@@ -198,8 +268,10 @@ func (c *Controller) Register(router *router.Router) {
 	router.POST("/licenses", c.auth.MustAuthorize(c.handlePostLicense, "molanobar:licenses.create"))
 	router.PATCH("/licenses/:id", c.auth.MustAuthorize(c.handlePatchLicense, "molanobar:licenses.update"))
 	router.DELETE("/licenses/:id", c.auth.MustAuthorize(c.handleDeleteLicense, "molanobar:licenses.delete"))
+	router.POST("/licenses/:id/renew", c.auth.MustAuthorize(c.handleRenewLicense, "molanobar:licenses.renew"))
 	router.GET("/licenses_by_buyer/:buyer_id", c.auth.MustAuthorize(c.handleGetLicensesByBuyerID, "molanobar:licenses.read"))
 	router.GET("/licensechecker/:id", c.auth.MustAuthorize(c.handleGetLicenseByIDForChecker, "molanobar:licenses.read"))
+	router.GET("/license-token-keys", c.auth.MustAuthorize(c.handleGetLicenseTokenKeys, "molanobar:licenses.read"))
 
 	router.GET("/admins", c.auth.MustAuthorize(c.handleGetAllAdmins, "molanobar:admins.read"))
 	router.POST("/admins", c.auth.MustAuthorize(c.handlePostAdmin, "molanobar:admins.create"))
@@ -213,6 +285,7 @@ func (c *Controller) Register(router *router.Router) {
 	router.PATCH("/agents/:id", c.auth.MustAuthorize(c.handlePatchAgent, "molanobar:agents.update"))
 	router.DELETE("/agents/:id", c.auth.MustAuthorize(c.handleDeleteAgent, "molanobar:agents.delete"))
 	router.GET("/agents/:userId", c.auth.MustAuthorize(c.handleGetAllAgentsByUserID, "molanobar:agents.read"))
+	router.GET("/agents/:userId/commissions", c.auth.MustAuthorize(c.handleGetAgentCommissions, "molanobar:agents.read"))
 	router.GET("/agents-check", c.auth.MustAuthorize(c.handleAgentsCheck, "molanobar:agents.read"))
 
 	router.POST("/sendmailinvoice", c.auth.MustAuthorize(c.handlePostEmailInvoice, "molanobar:email.ecert"))
@@ -241,6 +314,7 @@ func (c *Controller) Register(router *router.Router) {
 	router.PATCH("/regional_agents/:id", c.auth.MustAuthorize(c.handlePatchRegionalAgent, "molanobar:regional_agents.update"))
 	router.DELETE("/regional_agents/:id", c.auth.MustAuthorize(c.handleDeleteRegionalAgent, "molanobar:regional_agents.delete"))
 	router.GET("/regional_agents/:id", c.handleGetRegionalAgents)
+	router.GET("/regional_agents/:id/commissions", c.auth.MustAuthorize(c.handleGetRegionalAgentCommissions, "molanobar:regional_agents.read"))
 
 	router.GET("/order-matrix", c.auth.MustAuthorize(c.handleGetAllOrderMatrices, "molanobar:order_matrices.read"))
 	router.GET("/order-matrix/:id", c.auth.MustAuthorize(c.handleGetOrderMatrixByID, "molanobar:order_matrices.read"))
@@ -251,4 +325,52 @@ func (c *Controller) Register(router *router.Router) {
 	router.POST("/order-matrix", c.auth.MustAuthorize(c.handlePostOrderMatrix, "molanobar:order_matrices.create"))
 	router.PATCH("/order-matrix/:id", c.auth.MustAuthorize(c.handlePatchOrderMatrix, "molanobar:order_matrices.update"))
 	router.DELETE("/order-matrix/:id", c.auth.MustAuthorize(c.handleDeleteOrderMatrix, "molanobar:order_matrices.delete"))
+
+	router.GET("/pricing-rules", c.auth.MustAuthorize(c.handleGetAllPricingRules, "molanobar:pricing_rules.read"))
+	router.GET("/pricing-rules/:id", c.auth.MustAuthorize(c.handleGetPricingRuleByID, "molanobar:pricing_rules.read"))
+	router.POST("/pricing-rules", c.auth.MustAuthorize(c.handlePostPricingRule, "molanobar:pricing_rules.create"))
+	router.PATCH("/pricing-rules/:id", c.auth.MustAuthorize(c.handlePatchPricingRule, "molanobar:pricing_rules.update"))
+	router.DELETE("/pricing-rules/:id", c.auth.MustAuthorize(c.handleDeletePricingRule, "molanobar:pricing_rules.delete"))
+
+	router.GET("/promotions", c.auth.MustAuthorize(c.handleGetAllPromotions, "molanobar:promotions.read"))
+	router.GET("/promotions/:id", c.auth.MustAuthorize(c.handleGetPromotionByID, "molanobar:promotions.read"))
+	router.POST("/promotions", c.auth.MustAuthorize(c.handlePostPromotion, "molanobar:promotions.create"))
+	router.PATCH("/promotions/:id", c.auth.MustAuthorize(c.handlePatchPromotion, "molanobar:promotions.update"))
+	router.DELETE("/promotions/:id", c.auth.MustAuthorize(c.handleDeletePromotion, "molanobar:promotions.delete"))
+	router.GET("/promotions-report", c.auth.MustAuthorize(c.handleGetPromotionsReport, "molanobar:promotions.read"))
+
+	router.GET("/commission-schemes", c.auth.MustAuthorize(c.handleGetAllCommissionSchemes, "molanobar:commission_schemes.read"))
+	router.GET("/commission-schemes/:id", c.auth.MustAuthorize(c.handleGetCommissionSchemeByID, "molanobar:commission_schemes.read"))
+	router.POST("/commission-schemes", c.auth.MustAuthorize(c.handlePostCommissionScheme, "molanobar:commission_schemes.create"))
+	router.PATCH("/commission-schemes/:id", c.auth.MustAuthorize(c.handlePatchCommissionScheme, "molanobar:commission_schemes.update"))
+	router.DELETE("/commission-schemes/:id", c.auth.MustAuthorize(c.handleDeleteCommissionScheme, "molanobar:commission_schemes.delete"))
+	router.GET("/commission-payouts.csv", c.auth.MustAuthorize(c.handleGetCommissionPayoutsExport, "molanobar:commissions.read"))
+
+	router.GET("/tax-rates", c.auth.MustAuthorize(c.handleGetAllTaxRates, "molanobar:tax_rates.read"))
+	router.GET("/tax-rates/:id", c.auth.MustAuthorize(c.handleGetTaxRateByID, "molanobar:tax_rates.read"))
+	router.POST("/tax-rates", c.auth.MustAuthorize(c.handlePostTaxRate, "molanobar:tax_rates.create"))
+	router.PATCH("/tax-rates/:id", c.auth.MustAuthorize(c.handlePatchTaxRate, "molanobar:tax_rates.update"))
+	router.DELETE("/tax-rates/:id", c.auth.MustAuthorize(c.handleDeleteTaxRate, "molanobar:tax_rates.delete"))
+	router.GET("/tax-invoices/efaktur.csv", c.auth.MustAuthorize(c.handleGetTaxInvoicesExport, "molanobar:tax_invoices.read"))
+
+	router.GET("/payment-methods", c.auth.MustAuthorize(c.handleGetAllPaymentMethods, "molanobar:payment_methods.read"))
+	router.GET("/payment-methods/:id", c.auth.MustAuthorize(c.handleGetPaymentMethodByID, "molanobar:payment_methods.read"))
+	router.POST("/payment-methods", c.auth.MustAuthorize(c.handlePostPaymentMethod, "molanobar:payment_methods.create"))
+	router.PATCH("/payment-methods/:id", c.auth.MustAuthorize(c.handlePatchPaymentMethod, "molanobar:payment_methods.update"))
+	router.DELETE("/payment-methods/:id", c.auth.MustAuthorize(c.handleDeletePaymentMethod, "molanobar:payment_methods.delete"))
+
+	router.GET("/audit-logs", c.auth.MustAuthorize(c.handleGetAuditLogs, "molanobar:audit_logs.read"))
+
+	router.GET("/cache-stats", c.auth.MustAuthorize(c.handleGetCacheStats, "molanobar:cache.read"))
+
+	router.GET("/email-outbox", c.auth.MustAuthorize(c.handleGetEmailOutbox, "molanobar:email_outbox.read"))
+	router.POST("/email-outbox/:id/retry", c.auth.MustAuthorize(c.handlePostEmailOutboxRetry, "molanobar:email_outbox.update"))
+
+	router.GET("/order-jobs", c.auth.MustAuthorize(c.handleGetOrderJobs, "molanobar:order_jobs.read"))
+	router.POST("/order-jobs/:id/retry", c.auth.MustAuthorize(c.handlePostOrderJobRetry, "molanobar:order_jobs.update"))
+
+	router.POST("/templates", c.auth.MustAuthorize(c.handlePostTemplate, "molanobar:templates.create"))
+	router.GET("/templates/:name/versions", c.auth.MustAuthorize(c.handleGetTemplateVersions, "molanobar:templates.read"))
+	router.PATCH("/templates/:name/active", c.auth.MustAuthorize(c.handlePatchTemplateActive, "molanobar:templates.update"))
+	router.POST("/templates/:name/preview", c.auth.MustAuthorize(c.handlePostTemplatePreview, "molanobar:templates.read"))
 }
@@ -90,7 +90,7 @@ func (c *Controller) handleDeleteInstallation(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = c.installation.Delete(id, c.projectID, userID.(string), isAdmin)
+	err = c.installation.Delete(id, c.projectID, userID.(string), isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteInstallation] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete Installation", http.StatusInternalServerError)
@@ -123,7 +123,7 @@ func (c *Controller) handlePostInstallation(w http.ResponseWriter, r *http.Reque
 		ProjectID:	 c.projectID,
 	}
 
-	err = c.installation.Insert(&installation)
+	err = c.installation.Insert(&installation, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostInstallation] error insert Installation repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post Installation", http.StatusInternalServerError)
@@ -190,7 +190,7 @@ func (c *Controller) handlePatchInstallation(w http.ResponseWriter, r *http.Requ
 		UpdatedAt:	  time.Now(),
 		ProjectID:	  c.projectID,
 	}
-	err = c.installation.Update(&installation, isAdmin)
+	err = c.installation.Update(&installation, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchInstallation] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update Installation", http.StatusInternalServerError)
@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment_method"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/promotion"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/room"
 	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	auth "git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	"git.sstv.io/lib/go/gojunkyard.git/form"
 	"git.sstv.io/lib/go/gojunkyard.git/router"
 	"git.sstv.io/lib/go/gojunkyard.git/util"
+	null "gopkg.in/guregu/null.v3"
 )
 
 func (c *Controller) handleGetAllLicenses(w http.ResponseWriter, r *http.Request) {
@@ -129,7 +136,7 @@ func (c *Controller) handleDeleteLicense(w http.ResponseWriter, r *http.Request)
 		userID = params.UserID
 		isAdmin = true
 	}
-	err = c.license.Delete(c.projectID, id, buyerID, licenseParam.LicenseNumber, isAdmin, userID.(string))
+	err = c.license.Delete(c.projectID, id, buyerID, licenseParam.LicenseNumber, isAdmin, userID.(string), getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteLicense] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete license", http.StatusInternalServerError)
@@ -180,7 +187,7 @@ func (c *Controller) handlePostLicense(w http.ResponseWriter, r *http.Request) {
 		BuyerID:       params.BuyerID,
 	}
 
-	err = c.license.Insert(&license)
+	err = c.license.Insert(&license, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostLicense] error insert license repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post license", http.StatusInternalServerError)
@@ -249,7 +256,7 @@ func (c *Controller) handlePatchLicense(w http.ResponseWriter, r *http.Request)
 		LastUpdateBy:  params.LastUpdateBy,
 		BuyerID:       params.BuyerID,
 	}
-	err = c.license.Update(&license, buyerID)
+	err = c.license.Update(&license, buyerID, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchLicense] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update license", http.StatusInternalServerError)
@@ -258,3 +265,346 @@ func (c *Controller) handlePatchLicense(w http.ResponseWriter, r *http.Request)
 
 	view.RenderJSONData(w, license, http.StatusOK)
 }
+
+// handleGetLicenseTokenKeys returns public keys of license tokens, so checker
+// apps can verify license QR codes offline
+func (c *Controller) handleGetLicenseTokenKeys(w http.ResponseWriter, r *http.Request) {
+	if !c.licenseToken.Enabled() {
+		c.reporter.Warningf("[handleGetLicenseTokenKeys] license token key is not configured")
+		view.RenderJSONError(w, "License token is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	keys := c.licenseToken.PublicKeys()
+
+	res := make([]view.DataResponse, 0, len(keys))
+	for id, key := range keys {
+		res = append(res, view.DataResponse{
+			Type: "license_token_keys",
+			ID:   id,
+			Attributes: view.LicenseTokenKeyAttributes{
+				Algorithm: "ed25519",
+				PublicKey: key,
+			},
+		})
+	}
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// handleRenewLicense creates a renewal order for the venue of the license,
+// pre-filled from the last order of the venue. Once paid the license is extended
+func (c *Controller) handleRenewLicense(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqRenewLicense
+		id, err = strconv.ParseInt(router.GetParam(r, "id"), 10, 64)
+		isAdmin = false
+	)
+	if err != nil {
+		c.reporter.Warningf("[handleRenewLicense] id must be integer, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Warningf("[handleRenewLicense] form binding, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handleRenewLicense] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := user["sub"]
+	if !ok {
+		if params.UserID == "" {
+			c.reporter.Errorf("[handleRenewLicense] invalid parameter, failed get userID")
+			view.RenderJSONError(w, "invalid parameter, failed get userID", http.StatusBadRequest)
+			return
+		}
+		userID = params.UserID
+		isAdmin = true
+	}
+
+	renewLicense, err := c.license.Get(c.projectID, id)
+	if err == sql.ErrNoRows || (err == nil && !isAdmin && renewLicense.BuyerID != userID.(string)) {
+		c.reporter.Infof("[handleRenewLicense] license not found, id: %d", id)
+		view.RenderJSONError(w, "license not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] error get from repository, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get license", http.StatusInternalServerError)
+		return
+	}
+	if renewLicense.LicenseStatus == license.LicenseStatusSuspended || renewLicense.LicenseStatus == license.LicenseStatusRevoked {
+		c.reporter.Errorf("[handleRenewLicense] license can not be renewed, id: %d, licenseStatus: %d", id, renewLicense.LicenseStatus)
+		view.RenderJSONError(w, "License can not be renewed", http.StatusBadRequest)
+		return
+	}
+
+	//license order id holds the venue id
+	venueID := renewLicense.OrderID
+	renewVenue, err := c.venue.Get(c.projectID, venueID, "")
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleRenewLicense] Venue Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Venue Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] Failed get venue, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get venue", http.StatusInternalServerError)
+		return
+	}
+
+	sumvenue, err := c.order.GetSummaryVenueByVenueID(venueID, c.projectID, "")
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleRenewLicense] Failed get summary venue, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get summary venue", http.StatusInternalServerError)
+		return
+	}
+	if !sumvenue.LastOrderID.Valid {
+		c.reporter.Errorf("[handleRenewLicense] venue has no previous order, venueID: %d", venueID)
+		view.RenderJSONError(w, "Venue has no previous order to renew", http.StatusBadRequest)
+		return
+	}
+	if sumvenue.LastOrderStatus == int64(order.StatusDraft) || sumvenue.LastOrderStatus == int64(order.StatusPending) {
+		c.reporter.Errorf("[handleRenewLicense] venue has unpaid order %s, venueID: %d", sumvenue.LastOrderNumber, venueID)
+		view.RenderJSONError(w, "Venue has an unpaid order", http.StatusConflict)
+		return
+	}
+
+	var (
+		deviceID       = sumvenue.LastDeviceID.Int64
+		productID      = sumvenue.LastProductID.Int64
+		installationID = sumvenue.LastInstallationID.Int64
+		agingID        = sumvenue.LastAgingID.Int64
+		roomID         = sumvenue.LastRoomID.Int64
+		roomQuantity   = sumvenue.LastRoomQuantity.Int64
+		email          = sumvenue.LastOrderEmail
+	)
+	if params.AgingID != 0 {
+		agingID = params.AgingID
+	}
+	if params.Email != "" {
+		email = params.Email
+	}
+
+	renewDevice, err := c.device.Get(c.projectID, deviceID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleRenewLicense] Device Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Device Not Found", http.StatusNotFound)
+		return
+	}
+
+	renewProduct, err := c.product.Get(c.projectID, productID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleRenewLicense] Product Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Product Not Found", http.StatusNotFound)
+		return
+	}
+
+	renewInstallation, err := c.installation.Get(installationID, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleRenewLicense] Installation Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Installation Not Found", http.StatusNotFound)
+		return
+	}
+
+	var renewRoom room.Room
+	if roomID != 0 && roomQuantity != 0 {
+		renewRoom, err = c.room.Get(c.projectID, roomID)
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handleRenewLicense] Room Not Found, err: %s", err.Error())
+			view.RenderJSONError(w, "Room Not Found", http.StatusNotFound)
+			return
+		}
+	}
+
+	renewAging, err := c.aging.Get(agingID, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleRenewLicense] Aging Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Aging Not Found", http.StatusNotFound)
+		return
+	}
+
+	validator, err := c.validateOrder(renewVenue.VenueType, renewVenue.Capacity, agingID, deviceID, productID, installationID, roomID, roomQuantity)
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] Failed validate order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed validate order", http.StatusInternalServerError)
+		return
+	}
+	if !validator.IsValid {
+		c.reporter.Errorf("[handleRenewLicense] Order not valid, %s does not match order matrix, venueID: %d, agingID: %d", validator.UnmatchedField, venueID, agingID)
+		view.RenderJSONError(w, fmt.Sprintf("Order not valid, %s does not match order matrix", validator.UnmatchedField), http.StatusBadRequest)
+		return
+	}
+
+	orderNumber, err := c.generateOrderNumber()
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] Failed generate order number, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate order number", http.StatusInternalServerError)
+		return
+	}
+
+	breakdown, err := c.calculateOrderPrice(renewVenue, roomQuantity, renewDevice, renewProduct, renewInstallation, renewRoom, renewAging, order.OrderTypeRenewal, orderPromotion{BuyerID: renewLicense.BuyerID, Code: params.VoucherCode})
+	if err == pricing.ErrRuleNotFound {
+		c.reporter.Errorf("[handleRenewLicense] Pricing rule not found, venueType: %d", renewVenue.VenueType)
+		view.RenderJSONError(w, "Pricing rule not found for venue type", http.StatusBadRequest)
+		return
+	}
+	if promotion.IsVoucherError(err) {
+		c.reporter.Warningf("[handleRenewLicense] Voucher not applied, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] Failed calculate price, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed calculate price", http.StatusInternalServerError)
+		return
+	}
+
+	paymentMethod, paymentFee, err := c.paymentMethod.Choose(c.projectID, params.PaymentMethodID, breakdown.TotalPrice)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleRenewLicense] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err == payment_method.ErrMethodNotAvailable {
+		c.reporter.Errorf("[handleRenewLicense] Payment method not available, paymentMethodID: %d, totalPrice: %f", paymentMethod.ID, breakdown.TotalPrice)
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == payment_method.ErrMethodNotConfigured {
+		c.reporter.Errorf("[handleRenewLicense] Payment method not chosen and no default is configured")
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] Failed choose payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed choose payment method", http.StatusInternalServerError)
+		return
+	}
+
+	renewOrder := order.Order{
+		OrderNumber:     orderNumber,
+		BuyerID:         renewLicense.BuyerID,
+		VenueID:         venueID,
+		DeviceID:        deviceID,
+		ProductID:       productID,
+		InstallationID:  installationID,
+		AgingID:         agingID,
+		RoomID:          roomID,
+		RoomQuantity:    roomQuantity,
+		TotalPrice:      breakdown.TotalPrice,
+		PaymentMethodID: paymentMethod.ID,
+		PaymentFee:      paymentFee,
+		Status:          order.StatusDraft,
+		CreatedBy:       userID.(string),
+		LastUpdateBy:    userID.(string),
+		ProjectID:       c.projectID,
+		Email:           email,
+		OrderType:       order.OrderTypeRenewal,
+	}
+
+	err = c.order.Insert(&renewOrder, isAdmin, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] failed post order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post order", http.StatusInternalServerError)
+		return
+	}
+
+	err = c.insertOrderDetail(renewOrder, renewOrder.VenueID, breakdown, isAdmin, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] failed post order details, dropping order %d, err: %s", renewOrder.OrderID, err.Error())
+		c.dropOrder(renewOrder, getRequestID(r))
+		view.RenderJSONError(w, "Failed post order details", http.StatusInternalServerError)
+		return
+	}
+
+	//record promotions given
+	err = c.redeemPromotions(renewOrder, breakdown.Lines)
+	if err == promotion.ErrUsageLimit {
+		c.reporter.Warningf("[handleRenewLicense] promotion used up, dropping order %d", renewOrder.OrderID)
+		c.dropOrder(renewOrder, getRequestID(r))
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleRenewLicense] failed redeem promotions, dropping order %d, err: %s", renewOrder.OrderID, err.Error())
+		c.dropOrder(renewOrder, getRequestID(r))
+		view.RenderJSONError(w, "Failed redeem promotions", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseOrder{
+		ID:   renewOrder.OrderID,
+		Type: "order",
+		Attributes: view.OrderAttributes{
+			OrderNumber:       renewOrder.OrderNumber,
+			BuyerID:           renewOrder.BuyerID,
+			VenueID:           renewOrder.VenueID,
+			DeviceID:          renewOrder.DeviceID,
+			ProductID:         renewOrder.ProductID,
+			InstallationID:    renewOrder.InstallationID,
+			Quantity:          renewOrder.Quantity,
+			AgingID:           renewOrder.AgingID,
+			RoomID:            renewOrder.RoomID,
+			RoomQuantity:      renewOrder.RoomQuantity,
+			TotalPrice:        renewOrder.TotalPrice,
+			PaymentMethodID:   renewOrder.PaymentMethodID,
+			PaymentFee:        renewOrder.PaymentFee,
+			Status:            renewOrder.Status,
+			CreatedAt:         renewOrder.CreatedAt,
+			CreatedBy:         renewOrder.CreatedBy,
+			UpdatedAt:         renewOrder.UpdatedAt,
+			LastUpdateBy:      renewOrder.LastUpdateBy,
+			ProjectID:         renewOrder.ProjectID,
+			Email:             renewOrder.Email,
+			OpenPaymentStatus: renewOrder.OpenPaymentStatus,
+			OrderType:         renewOrder.OrderType,
+			Details:           mappingPriceDetails(breakdown),
+		},
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// activateLicense activates the venue license for the duration of the aging
+// ordered for it in the paid order. A venue without license gets a new one.
+// The license keeps the order it was activated by, so a retried activation of
+// the same order does not extend it twice
+func (c *Controller) activateLicense(paidOrder order.Order, venueID, agingID int64, requestID string) error {
+	aging, err := c.aging.Get(agingID, c.projectID)
+	if err != nil {
+		return err
+	}
+	if aging.DurationMonths <= 0 {
+		return fmt.Errorf("aging %d has no duration", aging.ID)
+	}
+
+	venueLicense, err := c.license.GetByVenueID(c.projectID, venueID)
+	if err == sql.ErrNoRows {
+		err = c.InsertLicense(venueID, paidOrder.LastUpdateBy, paidOrder.BuyerID, requestID)
+		if err != nil {
+			return err
+		}
+		venueLicense, err = c.license.GetByVenueID(c.projectID, venueID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if venueLicense.ActivatedOrderID.Valid && venueLicense.ActivatedOrderID.Int64 == paidOrder.OrderID {
+		return nil
+	}
+
+	venueLicense.Activate(time.Now(), aging.DurationMonths)
+	venueLicense.ActivatedOrderID = null.IntFrom(paidOrder.OrderID)
+	venueLicense.LastUpdateBy = paidOrder.LastUpdateBy
+
+	return c.license.Update(&venueLicense, venueLicense.BuyerID, requestID)
+}
@@ -16,3 +16,11 @@ type reqLicense struct {
 type reqDeleteLicense struct {
 	UserID string `json:"userID"`
 }
+
+type reqRenewLicense struct {
+	AgingID         int64  `json:"agingID"`
+	PaymentMethodID int64  `json:"paymentMethodID"`
+	Email           string `json:"email"`
+	VoucherCode     string `json:"voucherCode"`
+	UserID          string `json:"userID"`
+}
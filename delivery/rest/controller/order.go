@@ -2,19 +2,29 @@ package controller
 
 import (
 	"database/sql"
-	"math"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/aging"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/device"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/installation"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_matrix"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment_method"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/product"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/promotion"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/room"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/sequence"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/venue"
 	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	"git.sstv.io/lib/go/gojunkyard.git/form"
 	"git.sstv.io/lib/go/gojunkyard.git/router"
+	"gopkg.in/guregu/null.v3"
 )
 
 func (c *Controller) handlePostOrder(w http.ResponseWriter, r *http.Request) {
@@ -97,47 +107,92 @@ func (c *Controller) handlePostOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	valid := isOrderValid(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
-	if !valid {
-		c.reporter.Errorf("[handlePostOrder] Order not valid, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
-			venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
-		view.RenderJSONError(w, "Order not valid", http.StatusBadRequest)
+	validator, err := c.validateOrder(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrder] Failed validate order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed validate order", http.StatusInternalServerError)
+		return
+	}
+	if !validator.IsValid {
+		c.reporter.Errorf("[handlePostOrder] Order not valid, %s does not match order matrix, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
+			validator.UnmatchedField, venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+		view.RenderJSONError(w, fmt.Sprintf("Order not valid, %s does not match order matrix", validator.UnmatchedField), http.StatusBadRequest)
 		return
 	}
 
 	//generate order number
 	orderNumber, err := c.generateOrderNumber()
-	if err != nil && err != sql.ErrNoRows {
+	if err != nil {
 		c.reporter.Errorf("[handlePostOrder] Failed generate order number, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed generate order number", http.StatusInternalServerError)
 		return
 	}
 
 	//calculate total price
-	totalPrice := c.calculateTotalPrice(venue.VenueType, product.Price, installation.Price, room.Price, float64(params.RoomQuantity))
+	breakdown, err := c.calculateOrderPrice(venue, params.RoomQuantity, device, product, installation, room, aging, order.OrderTypeNew, orderPromotion{BuyerID: userID.(string), Code: params.VoucherCode})
+	if err == pricing.ErrRuleNotFound {
+		c.reporter.Errorf("[handlePostOrder] Pricing rule not found, venueType: %d", venue.VenueType)
+		view.RenderJSONError(w, "Pricing rule not found for venue type", http.StatusBadRequest)
+		return
+	}
+	if promotion.IsVoucherError(err) {
+		c.reporter.Warningf("[handlePostOrder] Voucher not applied, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrder] Failed calculate price, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed calculate price", http.StatusInternalServerError)
+		return
+	}
+	totalPrice := breakdown.TotalPrice
 
-	//insert order
-	insertOrder := order.Order{
-		OrderNumber:    orderNumber,
-		BuyerID:        userID.(string),
-		VenueID:        params.VenueID,
-		DeviceID:       params.DeviceID,
-		ProductID:      params.ProductID,
-		InstallationID: params.InstallationID,
-		Quantity:       params.Quantity,
-		AgingID:        params.AgingID,
-		RoomID:         params.RoomID,
-		RoomQuantity:   params.RoomQuantity,
-		TotalPrice:     totalPrice,
-		PaymentFee:     params.PaymentFee,
-		Status:         0,
-		CreatedBy:      userID.(string),
-		LastUpdateBy:   userID.(string),
-		ProjectID:      c.projectID,
-		Email:          params.Email,
+	//choose payment method
+	paymentMethod, paymentFee, err := c.paymentMethod.Choose(c.projectID, params.PaymentMethodID, totalPrice)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostOrder] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err == payment_method.ErrMethodNotAvailable {
+		c.reporter.Errorf("[handlePostOrder] Payment method not available, paymentMethodID: %d, totalPrice: %f", paymentMethod.ID, totalPrice)
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == payment_method.ErrMethodNotConfigured {
+		c.reporter.Errorf("[handlePostOrder] Payment method not chosen and no default is configured")
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrder] Failed choose payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed choose payment method", http.StatusInternalServerError)
+		return
 	}
 
-	err = c.order.Insert(&insertOrder, isAdmin)
+	//insert order
+	insertOrder := order.Order{
+		OrderNumber:     orderNumber,
+		BuyerID:         userID.(string),
+		VenueID:         params.VenueID,
+		DeviceID:        params.DeviceID,
+		ProductID:       params.ProductID,
+		InstallationID:  params.InstallationID,
+		Quantity:        params.Quantity,
+		AgingID:         params.AgingID,
+		RoomID:          params.RoomID,
+		RoomQuantity:    params.RoomQuantity,
+		TotalPrice:      totalPrice,
+		PaymentMethodID: paymentMethod.ID,
+		PaymentFee:      paymentFee,
+		Status:          order.StatusDraft,
+		CreatedBy:       userID.(string),
+		LastUpdateBy:    userID.(string),
+		ProjectID:       c.projectID,
+		Email:           params.Email,
+	}
+
+	err = c.order.Insert(&insertOrder, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePostOrder] failed post order, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post order", http.StatusInternalServerError)
@@ -145,13 +200,29 @@ func (c *Controller) handlePostOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//insert order details
-	err = c.insertOrderDetail(insertOrder, device, product, installation, room, aging, isAdmin)
+	err = c.insertOrderDetail(insertOrder, insertOrder.VenueID, breakdown, isAdmin, getRequestID(r))
 	if err != nil {
-		c.reporter.Errorf("[handlePostOrder] failed post order details, err: %s", err.Error())
+		c.reporter.Errorf("[handlePostOrder] failed post order details, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
 		view.RenderJSONError(w, "Failed post order details", http.StatusInternalServerError)
 		return
 	}
 
+	//record promotions given
+	err = c.redeemPromotions(insertOrder, breakdown.Lines)
+	if err == promotion.ErrUsageLimit {
+		c.reporter.Warningf("[handlePostOrder] promotion used up, dropping order %d", insertOrder.OrderID)
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrder] failed redeem promotions, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, "Failed redeem promotions", http.StatusInternalServerError)
+		return
+	}
+
 	//set response
 	res := view.DataResponseOrder{
 		ID:   insertOrder.OrderID,
@@ -182,6 +253,8 @@ func (c *Controller) handlePostOrder(w http.ResponseWriter, r *http.Request) {
 			ProjectID:         insertOrder.ProjectID,
 			Email:             insertOrder.Email,
 			OpenPaymentStatus: insertOrder.OpenPaymentStatus,
+			OrderType:         insertOrder.OrderType,
+			Details:           mappingPriceDetails(breakdown),
 		},
 	}
 
@@ -278,57 +351,118 @@ func (c *Controller) handlePostOrderByAgent(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	valid := isOrderValid(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
-	if !valid {
-		c.reporter.Errorf("[handlePostOrderByAgent] Order not valid, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
-			venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
-		view.RenderJSONError(w, "Order not valid", http.StatusBadRequest)
+	validator, err := c.validateOrder(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderByAgent] Failed validate order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed validate order", http.StatusInternalServerError)
+		return
+	}
+	if !validator.IsValid {
+		c.reporter.Errorf("[handlePostOrderByAgent] Order not valid, %s does not match order matrix, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
+			validator.UnmatchedField, venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+		view.RenderJSONError(w, fmt.Sprintf("Order not valid, %s does not match order matrix", validator.UnmatchedField), http.StatusBadRequest)
 		return
 	}
 
 	orderNumber, err := c.generateOrderNumber()
-	if err != nil && err != sql.ErrNoRows {
+	if err != nil {
 		c.reporter.Errorf("[handlePostOrderByAgent] Failed generate order number, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed generate order number", http.StatusInternalServerError)
 		return
 	}
 
-	totalPrice := c.calculateTotalPrice(venue.VenueType, product.Price, installation.Price, room.Price, float64(params.RoomQuantity))
+	breakdown, err := c.calculateOrderPrice(venue, params.RoomQuantity, device, product, installation, room, aging, order.OrderTypeNew, orderPromotion{BuyerID: userID.(string), Code: params.VoucherCode})
+	if err == pricing.ErrRuleNotFound {
+		c.reporter.Errorf("[handlePostOrderByAgent] Pricing rule not found, venueType: %d", venue.VenueType)
+		view.RenderJSONError(w, "Pricing rule not found for venue type", http.StatusBadRequest)
+		return
+	}
+	if promotion.IsVoucherError(err) {
+		c.reporter.Warningf("[handlePostOrderByAgent] Voucher not applied, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderByAgent] Failed calculate price, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed calculate price", http.StatusInternalServerError)
+		return
+	}
+	totalPrice := breakdown.TotalPrice
 
-	insertOrder := order.Order{
-		OrderNumber:    orderNumber,
-		BuyerID:        userID.(string),
-		VenueID:        params.VenueID,
-		DeviceID:       params.DeviceID,
-		ProductID:      params.ProductID,
-		InstallationID: params.InstallationID,
-		Quantity:       params.Quantity,
-		AgingID:        params.AgingID,
-		RoomID:         params.RoomID,
-		RoomQuantity:   params.RoomQuantity,
-		TotalPrice:     totalPrice,
-		PaymentFee:     params.PaymentFee,
-		Status:         4,
-		CreatedBy:      userID.(string),
-		LastUpdateBy:   userID.(string),
-		ProjectID:      c.projectID,
-		Email:          params.Email,
+	//choose payment method
+	paymentMethod, paymentFee, err := c.paymentMethod.Choose(c.projectID, params.PaymentMethodID, totalPrice)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostOrderByAgent] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err == payment_method.ErrMethodNotAvailable {
+		c.reporter.Errorf("[handlePostOrderByAgent] Payment method not available, paymentMethodID: %d, totalPrice: %f", paymentMethod.ID, totalPrice)
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == payment_method.ErrMethodNotConfigured {
+		c.reporter.Errorf("[handlePostOrderByAgent] Payment method not chosen and no default is configured")
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderByAgent] Failed choose payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed choose payment method", http.StatusInternalServerError)
+		return
 	}
 
-	err = c.order.Insert(&insertOrder, isAdmin)
+	insertOrder := order.Order{
+		OrderNumber:     orderNumber,
+		BuyerID:         userID.(string),
+		VenueID:         params.VenueID,
+		DeviceID:        params.DeviceID,
+		ProductID:       params.ProductID,
+		InstallationID:  params.InstallationID,
+		Quantity:        params.Quantity,
+		AgingID:         params.AgingID,
+		RoomID:          params.RoomID,
+		RoomQuantity:    params.RoomQuantity,
+		TotalPrice:      totalPrice,
+		PaymentMethodID: paymentMethod.ID,
+		PaymentFee:      paymentFee,
+		Status:          order.StatusAgentDraft,
+		CreatedBy:       userID.(string),
+		LastUpdateBy:    userID.(string),
+		ProjectID:       c.projectID,
+		Email:           params.Email,
+	}
+
+	err = c.order.Insert(&insertOrder, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePostOrderByAgent] failed post order, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post order", http.StatusInternalServerError)
 		return
 	}
 
-	err = c.insertOrderDetail(insertOrder, device, product, installation, room, aging, isAdmin)
+	err = c.insertOrderDetail(insertOrder, insertOrder.VenueID, breakdown, isAdmin, getRequestID(r))
 	if err != nil {
-		c.reporter.Errorf("[handlePostOrderByAgent] failed post order details, err: %s", err.Error())
+		c.reporter.Errorf("[handlePostOrderByAgent] failed post order details, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
 		view.RenderJSONError(w, "Failed post order details", http.StatusInternalServerError)
 		return
 	}
 
+	//record promotions given
+	err = c.redeemPromotions(insertOrder, breakdown.Lines)
+	if err == promotion.ErrUsageLimit {
+		c.reporter.Warningf("[handlePostOrderByAgent] promotion used up, dropping order %d", insertOrder.OrderID)
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderByAgent] failed redeem promotions, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, "Failed redeem promotions", http.StatusInternalServerError)
+		return
+	}
+
 	res := view.DataResponseOrder{
 		ID:   insertOrder.OrderID,
 		Type: "order",
@@ -358,6 +492,277 @@ func (c *Controller) handlePostOrderByAgent(w http.ResponseWriter, r *http.Reque
 			ProjectID:         insertOrder.ProjectID,
 			Email:             insertOrder.Email,
 			OpenPaymentStatus: insertOrder.OpenPaymentStatus,
+			OrderType:         insertOrder.OrderType,
+			Details:           mappingPriceDetails(breakdown),
+		},
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// handlePostCartOrder creates one order for items of several venues of the
+// same buyer. Every item is validated against the order matrix and priced on
+// its own, the order has the sum of the items as its total and a single payment
+func (c *Controller) handlePostCartOrder(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqCartOrder
+		isAdmin = false
+	)
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostCartOrder] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+	if len(params.Items) == 0 {
+		c.reporter.Errorf("[handlePostCartOrder] invalid parameter, cart has no items")
+		view.RenderJSONError(w, "Cart has no items", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handlePostCartOrder] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := user["sub"]
+	if !ok {
+		if params.UserID == "" {
+			c.reporter.Errorf("[handlePostCartOrder] invalid parameter, failed get userID")
+			view.RenderJSONError(w, "invalid parameter, failed get userID", http.StatusBadRequest)
+			return
+		}
+		userID = params.UserID
+		isAdmin = true
+	}
+
+	var (
+		breakdowns = make([]pricing.Breakdown, 0, len(params.Items))
+		venues     = make(map[int64]bool, len(params.Items))
+		cart       cartVoucher
+		totalPrice float64
+	)
+	for i, item := range params.Items {
+		if venues[item.VenueID] {
+			c.reporter.Errorf("[handlePostCartOrder] Duplicate venue in cart, venueID: %d", item.VenueID)
+			view.RenderJSONError(w, fmt.Sprintf("Venue %d is ordered more than once", item.VenueID), http.StatusBadRequest)
+			return
+		}
+		venues[item.VenueID] = true
+
+		// every venue of the cart must belong to the buyer
+		venue, err := c.venue.Get(c.projectID, item.VenueID, userID.(string))
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handlePostCartOrder] Venue Not Found, venueID: %d", item.VenueID)
+			view.RenderJSONError(w, fmt.Sprintf("Venue %d Not Found", item.VenueID), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			c.reporter.Errorf("[handlePostCartOrder] Failed get venue, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed get venue", http.StatusInternalServerError)
+			return
+		}
+
+		device, err := c.device.Get(c.projectID, item.DeviceID)
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handlePostCartOrder] Device Not Found, deviceID: %d", item.DeviceID)
+			view.RenderJSONError(w, "Device Not Found", http.StatusNotFound)
+			return
+		}
+
+		product, err := c.product.Get(c.projectID, item.ProductID)
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handlePostCartOrder] Product Not Found, productID: %d", item.ProductID)
+			view.RenderJSONError(w, "Product Not Found", http.StatusNotFound)
+			return
+		}
+
+		installation, err := c.installation.Get(item.InstallationID, c.projectID)
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handlePostCartOrder] Installation Not Found, installationID: %d", item.InstallationID)
+			view.RenderJSONError(w, "Installation Not Found", http.StatusNotFound)
+			return
+		}
+
+		var room room.Room
+		if item.RoomID != 0 && item.RoomQuantity != 0 {
+			room, err = c.room.Get(c.projectID, item.RoomID)
+			if err == sql.ErrNoRows {
+				c.reporter.Errorf("[handlePostCartOrder] Room Not Found, roomID: %d", item.RoomID)
+				view.RenderJSONError(w, "Room Not Found", http.StatusNotFound)
+				return
+			}
+		}
+
+		aging, err := c.aging.Get(item.AgingID, c.projectID)
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handlePostCartOrder] Aging Not Found, agingID: %d", item.AgingID)
+			view.RenderJSONError(w, "Aging Not Found", http.StatusNotFound)
+			return
+		}
+
+		validator, err := c.validateOrder(venue.VenueType, venue.Capacity, item.AgingID, item.DeviceID, item.ProductID, item.InstallationID, item.RoomID, item.RoomQuantity)
+		if err != nil {
+			c.reporter.Errorf("[handlePostCartOrder] Failed validate order, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed validate order", http.StatusInternalServerError)
+			return
+		}
+		if !validator.IsValid {
+			c.reporter.Errorf("[handlePostCartOrder] Item %d not valid, %s does not match order matrix, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
+				i, validator.UnmatchedField, venue.VenueType, venue.Capacity, item.AgingID, item.DeviceID, item.ProductID, item.InstallationID, item.RoomID, item.RoomQuantity)
+			view.RenderJSONError(w, fmt.Sprintf("Order not valid, %s of venue %d does not match order matrix", validator.UnmatchedField, item.VenueID), http.StatusBadRequest)
+			return
+		}
+
+		breakdown, err := c.calculateOrderPrice(venue, item.RoomQuantity, device, product, installation, room, aging, order.OrderTypeNew, orderPromotion{BuyerID: userID.(string), Code: params.VoucherCode, Cart: &cart})
+		if err == pricing.ErrRuleNotFound {
+			c.reporter.Errorf("[handlePostCartOrder] Pricing rule not found, venueType: %d", venue.VenueType)
+			view.RenderJSONError(w, "Pricing rule not found for venue type", http.StatusBadRequest)
+			return
+		}
+		if promotion.IsVoucherError(err) {
+			c.reporter.Warningf("[handlePostCartOrder] Voucher not applied, err: %s", err.Error())
+			view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			c.reporter.Errorf("[handlePostCartOrder] Failed calculate price, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed calculate price", http.StatusInternalServerError)
+			return
+		}
+		breakdowns = append(breakdowns, breakdown)
+		totalPrice += breakdown.TotalPrice
+	}
+
+	//a voucher is valid for a cart when at least one venue is eligible
+	if params.VoucherCode != "" {
+		voucher, err := c.promotion.GetByCode(c.projectID, params.VoucherCode)
+		if err != nil {
+			c.reporter.Errorf("[handlePostCartOrder] Failed get voucher, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed calculate price", http.StatusInternalServerError)
+			return
+		}
+		if !hasPromotion(breakdowns, voucher.ID) {
+			c.reporter.Warningf("[handlePostCartOrder] Voucher not applied, code: %s", params.VoucherCode)
+			view.RenderJSONError(w, promotion.ErrVoucherNotEligible.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	//generate order number
+	orderNumber, err := c.generateOrderNumber()
+	if err != nil {
+		c.reporter.Errorf("[handlePostCartOrder] Failed generate order number, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate order number", http.StatusInternalServerError)
+		return
+	}
+
+	//choose payment method
+	paymentMethod, paymentFee, err := c.paymentMethod.Choose(c.projectID, params.PaymentMethodID, totalPrice)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostCartOrder] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err == payment_method.ErrMethodNotAvailable {
+		c.reporter.Errorf("[handlePostCartOrder] Payment method not available, paymentMethodID: %d, totalPrice: %f", paymentMethod.ID, totalPrice)
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == payment_method.ErrMethodNotConfigured {
+		c.reporter.Errorf("[handlePostCartOrder] Payment method not chosen and no default is configured")
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostCartOrder] Failed choose payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed choose payment method", http.StatusInternalServerError)
+		return
+	}
+
+	//insert order, the items are only in its details
+	insertOrder := order.Order{
+		OrderNumber:     orderNumber,
+		BuyerID:         userID.(string),
+		TotalPrice:      totalPrice,
+		PaymentMethodID: paymentMethod.ID,
+		PaymentFee:      paymentFee,
+		Status:          order.StatusDraft,
+		CreatedBy:       userID.(string),
+		LastUpdateBy:    userID.(string),
+		ProjectID:       c.projectID,
+		Email:           params.Email,
+		OrderType:       order.OrderTypeCart,
+	}
+
+	err = c.order.Insert(&insertOrder, isAdmin, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostCartOrder] failed post order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post order", http.StatusInternalServerError)
+		return
+	}
+
+	//insert order details of every venue
+	var lines pricing.Lines
+	details := make([]view.PriceDetailAttributes, 0)
+	for i, breakdown := range breakdowns {
+		venueID := params.Items[i].VenueID
+		err = c.insertOrderDetail(insertOrder, venueID, breakdown, isAdmin, getRequestID(r))
+		if err != nil {
+			c.reporter.Errorf("[handlePostCartOrder] failed post order details, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+			c.dropOrder(insertOrder, getRequestID(r))
+			view.RenderJSONError(w, "Failed post order details", http.StatusInternalServerError)
+			return
+		}
+
+		lines = append(lines, breakdown.Lines...)
+		for _, detail := range mappingPriceDetails(breakdown) {
+			detail.VenueID = venueID
+			details = append(details, detail)
+		}
+	}
+
+	//record promotions given
+	err = c.redeemPromotions(insertOrder, lines)
+	if err == promotion.ErrUsageLimit {
+		c.reporter.Warningf("[handlePostCartOrder] promotion used up, dropping order %d", insertOrder.OrderID)
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostCartOrder] failed redeem promotions, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, "Failed redeem promotions", http.StatusInternalServerError)
+		return
+	}
+
+	//set response
+	res := view.DataResponseOrder{
+		ID:   insertOrder.OrderID,
+		Type: "order",
+		Attributes: view.OrderAttributes{
+			OrderNumber:       insertOrder.OrderNumber,
+			BuyerID:           insertOrder.BuyerID,
+			TotalPrice:        insertOrder.TotalPrice,
+			PaymentMethodID:   insertOrder.PaymentMethodID,
+			PaymentFee:        insertOrder.PaymentFee,
+			Status:            insertOrder.Status,
+			CreatedAt:         insertOrder.CreatedAt,
+			CreatedBy:         insertOrder.CreatedBy,
+			UpdatedAt:         insertOrder.UpdatedAt,
+			LastUpdateBy:      insertOrder.LastUpdateBy,
+			DeletedAt:         insertOrder.DeletedAt,
+			PendingAt:         insertOrder.PendingAt,
+			PaidAt:            insertOrder.PaidAt,
+			FailedAt:          insertOrder.FailedAt,
+			ProjectID:         insertOrder.ProjectID,
+			Email:             insertOrder.Email,
+			OpenPaymentStatus: insertOrder.OpenPaymentStatus,
+			OrderType:         insertOrder.OrderType,
+			Details:           details,
 		},
 	}
 
@@ -368,7 +773,7 @@ func (c *Controller) handlePatchOrderForPayment(w http.ResponseWriter, r *http.R
 	var (
 		_id     = router.GetParam(r, "id")
 		id, err = strconv.ParseInt(_id, 10, 64)
-		params  reqUserID
+		params  reqOrderPayment
 		isAdmin = false
 	)
 	if err != nil {
@@ -377,6 +782,8 @@ func (c *Controller) handlePatchOrderForPayment(w http.ResponseWriter, r *http.R
 		return
 	}
 
+	_ = form.Bind(&params, r)
+
 	user, ok := authpassport.GetUser(r)
 	if !ok {
 		c.reporter.Errorf("[handlePatchOrderForPayment] failed get user")
@@ -385,7 +792,6 @@ func (c *Controller) handlePatchOrderForPayment(w http.ResponseWriter, r *http.R
 	}
 	userID, ok := user["sub"]
 	if !ok {
-		_ = form.Bind(&params, r)
 		if params.UserID == "" {
 			c.reporter.Errorf("[handlePatchOrderForPayment] invalid parameter, failed get userID")
 			view.RenderJSONError(w, "invalid parameter, failed get userID", http.StatusBadRequest)
@@ -417,9 +823,53 @@ func (c *Controller) handlePatchOrderForPayment(w http.ResponseWriter, r *http.R
 		view.RenderJSONError(w, "Not Approved", http.StatusBadRequest)
 		return
 	}
+	if !order.CanTransition(getOrder.Status, order.StatusPending) {
+		c.reporter.Errorf("[handlePatchOrderForPayment] Invalid status transition, from: %s, to: %s", order.StatusName(getOrder.Status), order.StatusName(order.StatusPending))
+		view.RenderJSONError(w, fmt.Sprintf("Order can not move from %s to %s", order.StatusName(getOrder.Status), order.StatusName(order.StatusPending)), http.StatusConflict)
+		return
+	}
+
+	//choose payment method
+	paymentMethodID := params.PaymentMethodID
+	if paymentMethodID == 0 {
+		paymentMethodID = getOrder.PaymentMethodID
+	}
+	paymentMethod, paymentFee, err := c.paymentMethod.Choose(c.projectID, paymentMethodID, getOrder.TotalPrice)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchOrderForPayment] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err == payment_method.ErrMethodNotAvailable {
+		c.reporter.Errorf("[handlePatchOrderForPayment] Payment method not available, paymentMethodID: %d, totalPrice: %f", paymentMethod.ID, getOrder.TotalPrice)
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == payment_method.ErrMethodNotConfigured {
+		c.reporter.Errorf("[handlePatchOrderForPayment] Payment method not chosen and no default is configured")
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchOrderForPayment] Failed choose payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed choose payment method", http.StatusInternalServerError)
+		return
+	}
+	if paymentMethod.ID != getOrder.PaymentMethodID || paymentFee != getOrder.PaymentFee {
+		getOrder.PaymentMethodID = paymentMethod.ID
+		getOrder.PaymentFee = paymentFee
+		getOrder.LastUpdateBy = userID.(string)
+
+		err = c.order.UpdatePaymentMethod(&getOrder, isAdmin, getRequestID(r))
+		if err != nil {
+			c.reporter.Errorf("[handlePatchOrderForPayment] failed update payment method, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed update order", http.StatusInternalServerError)
+			return
+		}
+	}
 
 	//do payment
-	payment, err := c.payment.Pay(strconv.FormatInt(getOrder.OrderID, 10), getOrder.PaymentMethodID)
+	payment, err := c.payment.Pay(strconv.FormatInt(getOrder.OrderID, 10), paymentMethod.GatewayMethodID)
 	if err != nil {
 		c.reporter.Errorf("[handlePatchOrderForPayment] Failed processing payment, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed processing payment", http.StatusInternalServerError)
@@ -436,11 +886,11 @@ func (c *Controller) handlePatchOrderForPayment(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	//update status = 1
+	//update status to pending
 	updateStatus := order.Order{
 		OrderID:      getOrder.OrderID,
 		ProjectID:    getOrder.ProjectID,
-		Status:       1,
+		Status:       order.StatusPending,
 		CreatedBy:    getOrder.CreatedBy,
 		LastUpdateBy: userID.(string),
 		PendingAt:    getOrder.PendingAt,
@@ -450,7 +900,12 @@ func (c *Controller) handlePatchOrderForPayment(w http.ResponseWriter, r *http.R
 		BuyerID:      getOrder.BuyerID,
 	}
 
-	err = c.order.UpdateOrderStatus(&updateStatus, isAdmin)
+	err = c.order.UpdateOrderStatus(&updateStatus, "payment initiated", isAdmin, getRequestID(r))
+	if err == order.ErrInvalidTransition {
+		c.reporter.Errorf("[handlePatchOrderForPayment] Invalid status transition, err: %s", err.Error())
+		view.RenderJSONError(w, "Order status has changed, please retry", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		c.reporter.Errorf("[handlePatchOrderForPayment] failed update status order, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update order", http.StatusInternalServerError)
@@ -487,6 +942,7 @@ func (c *Controller) handlePatchOrderForPayment(w http.ResponseWriter, r *http.R
 			ProjectID:         updateStatus.ProjectID,
 			Email:             getOrder.Email,
 			OpenPaymentStatus: getOrder.OpenPaymentStatus,
+			OrderType:         getOrder.OrderType,
 		},
 		ResponseType:    payment.ResponseType,
 		HTMLRedirection: payment.HTMLRedirection,
@@ -553,6 +1009,16 @@ func (c *Controller) handlePatchOrder(w http.ResponseWriter, r *http.Request) {
 		view.RenderJSONError(w, "Failed get order", http.StatusInternalServerError)
 		return
 	}
+	if getOrder.OrderType == order.OrderTypeCart {
+		c.reporter.Errorf("[handlePatchOrder] Cart order cannot be updated, orderID: %d", id)
+		view.RenderJSONError(w, "Cart order cannot be updated", http.StatusBadRequest)
+		return
+	}
+	if !order.IsEditable(getOrder.Status) {
+		c.reporter.Warningf("[handlePatchOrder] order %d is %s, it can not be updated", id, order.StatusName(getOrder.Status))
+		view.RenderJSONError(w, order.ErrNotEditable.Error(), http.StatusConflict)
+		return
+	}
 
 	//validasi foreign key
 	var venue venue.Venue
@@ -605,11 +1071,16 @@ func (c *Controller) handlePatchOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	valid := isOrderValid(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
-	if !valid {
-		c.reporter.Errorf("[handlePatchOrder] Order not valid, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
-			venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
-		view.RenderJSONError(w, "Order not valid", http.StatusBadRequest)
+	validator, err := c.validateOrder(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchOrder] Failed validate order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed validate order", http.StatusInternalServerError)
+		return
+	}
+	if !validator.IsValid {
+		c.reporter.Errorf("[handlePatchOrder] Order not valid, %s does not match order matrix, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
+			validator.UnmatchedField, venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+		view.RenderJSONError(w, fmt.Sprintf("Order not valid, %s does not match order matrix", validator.UnmatchedField), http.StatusBadRequest)
 		return
 	}
 
@@ -631,29 +1102,91 @@ func (c *Controller) handlePatchOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//calculate total price
-	totalPrice := c.calculateTotalPrice(venue.VenueType, product.Price, installation.Price, room.Price, float64(params.RoomQuantity))
+	breakdown, err := c.calculateOrderPrice(venue, params.RoomQuantity, device, product, installation, room, aging, getOrder.OrderType, orderPromotion{BuyerID: getOrder.BuyerID, Code: params.VoucherCode, OrderID: getOrder.OrderID})
+	if err == pricing.ErrRuleNotFound {
+		c.reporter.Errorf("[handlePatchOrder] Pricing rule not found, venueType: %d", venue.VenueType)
+		view.RenderJSONError(w, "Pricing rule not found for venue type", http.StatusBadRequest)
+		return
+	}
+	if promotion.IsVoucherError(err) {
+		c.reporter.Warningf("[handlePatchOrder] Voucher not applied, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchOrder] Failed calculate price, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed calculate price", http.StatusInternalServerError)
+		return
+	}
+	totalPrice := breakdown.TotalPrice
+
+	paymentMethodID := params.PaymentMethodID
+	if paymentMethodID == 0 {
+		paymentMethodID = getOrder.PaymentMethodID
+	}
+
+	//choose payment method
+	paymentMethod, paymentFee, err := c.paymentMethod.Choose(c.projectID, paymentMethodID, totalPrice)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchOrder] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err == payment_method.ErrMethodNotAvailable {
+		c.reporter.Errorf("[handlePatchOrder] Payment method not available, paymentMethodID: %d, totalPrice: %f", paymentMethod.ID, totalPrice)
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == payment_method.ErrMethodNotConfigured {
+		c.reporter.Errorf("[handlePatchOrder] Payment method not chosen and no default is configured")
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchOrder] Failed choose payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed choose payment method", http.StatusInternalServerError)
+		return
+	}
+
+	//record promotions given, the order is left as it was when one is used up
+	err = c.redeemPromotions(getOrder, breakdown.Lines)
+	if err == promotion.ErrUsageLimit {
+		c.reporter.Warningf("[handlePatchOrder] promotion used up, order %d", getOrder.OrderID)
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchOrder] failed redeem promotions, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed redeem promotions", http.StatusInternalServerError)
+		return
+	}
 
 	//update order
 	updateOrder := order.Order{
-		OrderID:        id,
-		VenueID:        params.VenueID,
-		DeviceID:       params.DeviceID,
-		ProductID:      params.ProductID,
-		InstallationID: params.InstallationID,
-		Quantity:       params.Quantity,
-		AgingID:        params.AgingID,
-		RoomID:         params.RoomID,
-		RoomQuantity:   params.RoomQuantity,
-		TotalPrice:     totalPrice,
-		PaymentFee:     params.PaymentFee,
-		ProjectID:      c.projectID,
-		Status:         getOrder.Status,
-		CreatedBy:      getOrder.CreatedBy,
-		LastUpdateBy:   userID.(string),
-		Email:          params.Email,
+		OrderID:         id,
+		VenueID:         params.VenueID,
+		DeviceID:        params.DeviceID,
+		ProductID:       params.ProductID,
+		InstallationID:  params.InstallationID,
+		Quantity:        params.Quantity,
+		AgingID:         params.AgingID,
+		RoomID:          params.RoomID,
+		RoomQuantity:    params.RoomQuantity,
+		TotalPrice:      totalPrice,
+		PaymentMethodID: paymentMethod.ID,
+		PaymentFee:      paymentFee,
+		ProjectID:       c.projectID,
+		CreatedBy:       getOrder.CreatedBy,
+		LastUpdateBy:    userID.(string),
+		Email:           params.Email,
+	}
+
+	err = c.order.Update(&updateOrder, isAdmin, getRequestID(r))
+	if err == order.ErrNotEditable {
+		c.reporter.Warningf("[handlePatchOrder] order %d is no longer draft", id)
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
 	}
-
-	err = c.order.Update(&updateOrder, isAdmin)
 	if err != nil {
 		c.reporter.Errorf("[handlePatchOrder] failed update order, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update order", http.StatusInternalServerError)
@@ -661,7 +1194,7 @@ func (c *Controller) handlePatchOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//update order details
-	err = c.updateOrderDetail(updateOrder, device, product, installation, room, aging, isAdmin)
+	err = c.updateOrderDetail(updateOrder, updateOrder.VenueID, breakdown, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchOrder] failed update order details, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update order details", http.StatusInternalServerError)
@@ -698,6 +1231,8 @@ func (c *Controller) handlePatchOrder(w http.ResponseWriter, r *http.Request) {
 			ProjectID:         updateOrder.ProjectID,
 			Email:             updateOrder.Email,
 			OpenPaymentStatus: getOrder.OpenPaymentStatus,
+			OrderType:         getOrder.OrderType,
+			Details:           mappingPriceDetails(breakdown),
 		},
 	}
 
@@ -758,6 +1293,21 @@ func (c *Controller) handleUpdateOrderStatusByID(w http.ResponseWriter, r *http.
 		return
 	}
 
+	// paid and failed are set by the payment callback and the reconciler, and
+	// refunded by completing a refund. Only admins may mark agent orders paid
+	// or failed
+	if params.Status == order.StatusRefunded || (!isAdmin && (params.Status == order.StatusPaid || params.Status == order.StatusFailed)) {
+		c.reporter.Warningf("[handleUpdateOrderStatus] status %s can not be set, order: %d", order.StatusName(params.Status), id)
+		view.RenderJSONError(w, fmt.Sprintf("Order can not be moved to %s", order.StatusName(params.Status)), http.StatusForbidden)
+		return
+	}
+
+	if !order.CanTransition(getOrder.Status, params.Status) {
+		c.reporter.Errorf("[handleUpdateOrderStatus] Invalid status transition, from: %s, to: %s", order.StatusName(getOrder.Status), order.StatusName(params.Status))
+		view.RenderJSONError(w, fmt.Sprintf("Order can not move from %s to %s", order.StatusName(getOrder.Status), order.StatusName(params.Status)), http.StatusConflict)
+		return
+	}
+
 	//update status order
 	updateStatus := order.Order{
 		OrderID:      id,
@@ -772,21 +1322,18 @@ func (c *Controller) handleUpdateOrderStatusByID(w http.ResponseWriter, r *http.
 		BuyerID:      getOrder.BuyerID,
 	}
 
-	err = c.order.UpdateOrderStatus(&updateStatus, isAdmin)
+	err = c.order.UpdateOrderStatus(&updateStatus, params.Reason, isAdmin, getRequestID(r))
+	if err == order.ErrInvalidTransition {
+		c.reporter.Errorf("[handleUpdateOrderStatus] Invalid status transition, err: %s", err.Error())
+		view.RenderJSONError(w, "Order status has changed, please retry", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		c.reporter.Errorf("[handleUpdateOrderStatus] failed update order status, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update order status", http.StatusInternalServerError)
 		return
 	}
 
-	if updateStatus.Status == 2 {
-		if isAdmin {
-			userID = ""
-		}
-
-		go c.sendEmail(updateStatus.OrderID, updateStatus.VenueID, userID.(string))
-	}
-
 	//set response
 	res := view.DataResponseOrder{
 		ID:   updateStatus.OrderID,
@@ -817,6 +1364,7 @@ func (c *Controller) handleUpdateOrderStatusByID(w http.ResponseWriter, r *http.
 			ProjectID:         updateStatus.ProjectID,
 			Email:             getOrder.Email,
 			OpenPaymentStatus: getOrder.OpenPaymentStatus,
+			OrderType:         getOrder.OrderType,
 		},
 	}
 
@@ -887,7 +1435,7 @@ func (c *Controller) handleUpdateOpenPaymentStatusByID(w http.ResponseWriter, r
 		BuyerID:           getOrder.BuyerID,
 	}
 
-	err = c.order.UpdateOpenPaymentStatus(&updateStatus, isAdmin)
+	err = c.order.UpdateOpenPaymentStatus(&updateStatus, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleUpdateOpenPaymentStatus] failed update open payment status, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update open payment status", http.StatusInternalServerError)
@@ -977,6 +1525,11 @@ func (c *Controller) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 		view.RenderJSONError(w, "Failed get order", http.StatusInternalServerError)
 		return
 	}
+	if !order.IsEditable(getOrder.Status) {
+		c.reporter.Warningf("[handleDeleteOrder] order %d is %s, it can not be deleted", id, order.StatusName(getOrder.Status))
+		view.RenderJSONError(w, "Order can only be deleted while draft", http.StatusConflict)
+		return
+	}
 
 	//validasi order detail
 	if isAdmin {
@@ -985,12 +1538,12 @@ func (c *Controller) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 		_, err = c.orderDetail.GetFromDBByOrderID(id, c.projectID, userID.(string))
 	}
 	if err == sql.ErrNoRows {
-		c.reporter.Errorf("[handlePatchOrder] order details not found, err: %s", err.Error())
+		c.reporter.Errorf("[handleDeleteOrder] order details not found, err: %s", err.Error())
 		view.RenderJSONError(w, "Order details not found", http.StatusNotFound)
 		return
 	}
 	if err != nil && err != sql.ErrNoRows {
-		c.reporter.Errorf("[handlePatchOrder] Failed get order details, err: %s", err.Error())
+		c.reporter.Errorf("[handleDeleteOrder] Failed get order details, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed get order detail", http.StatusInternalServerError)
 		return
 	}
@@ -1007,7 +1560,12 @@ func (c *Controller) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 		PaidAt:       getOrder.PaidAt,
 	}
 
-	err = c.order.Delete(&deleteOrder, isAdmin)
+	err = c.order.Delete(&deleteOrder, isAdmin, getRequestID(r))
+	if err == order.ErrNotEditable {
+		c.reporter.Warningf("[handleDeleteOrder] order %d is no longer draft", id)
+		view.RenderJSONError(w, "Order can only be deleted while draft", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteOrder] failed delete order, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete order", http.StatusInternalServerError)
@@ -1015,7 +1573,7 @@ func (c *Controller) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 	}
 
 	//delete order details
-	err = c.deleteOrderDetail(deleteOrder, isAdmin)
+	err = c.deleteOrderDetail(deleteOrder, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteOrder] failed delete order details, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete order details", http.StatusInternalServerError)
@@ -1029,11 +1587,28 @@ func (c *Controller) handleDeleteOrder(w http.ResponseWriter, r *http.Request) {
 	view.RenderJSONData(w, res, http.StatusOK)
 }
 
+// page sizes of the orders listing
+const (
+	defaultOrdersLimit = 50
+	maxOrdersLimit     = 200
+)
+
+// handleGetAllOrders lists the orders matching the query filters a page at a
+// time, users only see the orders they placed. Pages follow the nextCursor
+// of the previous one, sorted by the sort param
 func (c *Controller) handleGetAllOrders(w http.ResponseWriter, r *http.Request) {
+	c.listOrders(w, r, true)
+}
+
+// listOrders lists the orders matching the query filters, every matching
+// order unless paged
+func (c *Controller) listOrders(w http.ResponseWriter, r *http.Request, paged bool) {
+	var err error
+	getParam := r.URL.Query()
 
 	user, ok := authpassport.GetUser(r)
 	if !ok {
-		c.reporter.Errorf("[handleGetAllOrder] failed get user")
+		c.reporter.Errorf("[handleGetAllOrders] failed get user")
 		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
 		return
 	}
@@ -1042,53 +1617,187 @@ func (c *Controller) handleGetAllOrders(w http.ResponseWriter, r *http.Request)
 		userID = ""
 	}
 
-	orders, err := c.order.Select(c.projectID, userID.(string))
+	filter := order.Filter{
+		BuyerID:           getParam.Get("buyerId"),
+		CreatedBy:         userID.(string),
+		OrderNumberPrefix: getParam.Get("orderNumber"),
+	}
+	if paged {
+		filter.Limit = defaultOrdersLimit
+	}
+
+	if status := getParam.Get("status"); status != "" {
+		for _, s := range strings.Split(status, ",") {
+			statusVal, err := strconv.ParseInt(strings.TrimSpace(s), 10, 16)
+			if err != nil {
+				c.reporter.Warningf("[handleGetAllOrders] status must be integer, err: %s", err.Error())
+				view.RenderJSONError(w, "Invalid parameter status", http.StatusBadRequest)
+				return
+			}
+			filter.Status = append(filter.Status, int16(statusVal))
+		}
+	}
+	if venueID := getParam.Get("venueId"); venueID != "" {
+		filter.VenueID, err = strconv.ParseInt(venueID, 10, 64)
+		if err != nil {
+			c.reporter.Warningf("[handleGetAllOrders] venueId must be integer, err: %s", err.Error())
+			view.RenderJSONError(w, "Invalid parameter venueId", http.StatusBadRequest)
+			return
+		}
+	}
+	if agentID := getParam.Get("agentId"); agentID != "" {
+		id, err := strconv.ParseInt(agentID, 10, 64)
+		if err != nil {
+			c.reporter.Warningf("[handleGetAllOrders] agentId must be integer, err: %s", err.Error())
+			view.RenderJSONError(w, "Invalid parameter agentId", http.StatusBadRequest)
+			return
+		}
+
+		getAgent, err := c.agent.Get(c.projectID, id)
+		if err == sql.ErrNoRows {
+			c.reporter.Infof("[handleGetAllOrders] agent not found, id: %d", id)
+			view.RenderJSONError(w, "Agent not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			c.reporter.Errorf("[handleGetAllOrders] Failed get agent, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed get agent", http.StatusInternalServerError)
+			return
+		}
+
+		// users already only see their own orders, the agent has to be them
+		if filter.CreatedBy != "" && filter.CreatedBy != getAgent.UserID {
+			view.RenderJSONDataCursor(w, []view.DataResponseOrder{}, "", http.StatusOK)
+			return
+		}
+		filter.CreatedBy = getAgent.UserID
+	}
+
+	for _, dateRange := range []struct {
+		fromParam, toParam string
+		from, to           *null.Time
+	}{
+		{"createdFrom", "createdTo", &filter.CreatedFrom, &filter.CreatedTo},
+		{"paidFrom", "paidTo", &filter.PaidFrom, &filter.PaidTo},
+		{"failedFrom", "failedTo", &filter.FailedFrom, &filter.FailedTo},
+	} {
+		if from := getParam.Get(dateRange.fromParam); from != "" {
+			fromDate, err := time.ParseInLocation("2006-01-02", from, time.Local)
+			if err != nil {
+				c.reporter.Warningf("[handleGetAllOrders] invalid %s date, err: %s", dateRange.fromParam, err.Error())
+				view.RenderJSONError(w, "Invalid parameter "+dateRange.fromParam, http.StatusBadRequest)
+				return
+			}
+			*dateRange.from = null.TimeFrom(fromDate)
+		}
+		if to := getParam.Get(dateRange.toParam); to != "" {
+			toDate, err := time.ParseInLocation("2006-01-02", to, time.Local)
+			if err != nil {
+				c.reporter.Warningf("[handleGetAllOrders] invalid %s date, err: %s", dateRange.toParam, err.Error())
+				view.RenderJSONError(w, "Invalid parameter "+dateRange.toParam, http.StatusBadRequest)
+				return
+			}
+			// to is inclusive, orders of the whole day are returned
+			*dateRange.to = null.TimeFrom(toDate.AddDate(0, 0, 1))
+		}
+	}
+
+	if minAmount := getParam.Get("minAmount"); minAmount != "" {
+		amount, err := strconv.ParseFloat(minAmount, 64)
+		if err != nil {
+			c.reporter.Warningf("[handleGetAllOrders] minAmount must be number, err: %s", err.Error())
+			view.RenderJSONError(w, "Invalid parameter minAmount", http.StatusBadRequest)
+			return
+		}
+		filter.MinAmount = null.FloatFrom(amount)
+	}
+	if maxAmount := getParam.Get("maxAmount"); maxAmount != "" {
+		amount, err := strconv.ParseFloat(maxAmount, 64)
+		if err != nil {
+			c.reporter.Warningf("[handleGetAllOrders] maxAmount must be number, err: %s", err.Error())
+			view.RenderJSONError(w, "Invalid parameter maxAmount", http.StatusBadRequest)
+			return
+		}
+		filter.MaxAmount = null.FloatFrom(amount)
+	}
+
+	filter.Sorts, err = order.ParseSorts(getParam.Get("sort"))
 	if err != nil {
-		c.reporter.Errorf("[handleGetAllOrders] orders not found, err: %s", err.Error())
-		view.RenderJSONError(w, "Orders not found", http.StatusNotFound)
+		c.reporter.Warningf("[handleGetAllOrders] invalid sort %s", getParam.Get("sort"))
+		view.RenderJSONError(w, "Invalid parameter sort", http.StatusBadRequest)
 		return
 	}
+	filter.Cursor, err = order.DecodeCursor(getParam.Get("cursor"), filter.Sorts)
+	if err != nil {
+		c.reporter.Warningf("[handleGetAllOrders] invalid cursor %s", getParam.Get("cursor"))
+		view.RenderJSONError(w, "Invalid parameter cursor", http.StatusBadRequest)
+		return
+	}
+	if limitVal := getParam.Get("limit"); paged && limitVal != "" {
+		filter.Limit, err = strconv.Atoi(limitVal)
+		if err != nil || filter.Limit < 1 || filter.Limit > maxOrdersLimit {
+			c.reporter.Warningf("[handleGetAllOrders] invalid limit %s", limitVal)
+			view.RenderJSONError(w, "Invalid parameter limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// one more order is selected to know whether there is a next page
+	limit := filter.Limit
+	if paged {
+		filter.Limit++
+	}
+
+	orders, err := c.order.SelectPage(c.projectID, filter)
 	if err != nil && err != sql.ErrNoRows {
 		c.reporter.Errorf("[handleGetAllOrders] failed get orders, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed get orders", http.StatusInternalServerError)
 		return
 	}
 
+	var nextCursor string
+	if paged && len(orders) > limit {
+		orders = orders[:limit]
+		nextCursor = filter.Sorts.NewCursor(orders[limit-1]).Encode()
+	}
+
 	res := make([]view.DataResponseOrder, 0, len(orders))
-	for _, order := range orders {
+	for _, o := range orders {
 		res = append(res, view.DataResponseOrder{
-			ID:   order.OrderID,
+			ID:   o.OrderID,
 			Type: "order",
 			Attributes: view.OrderAttributes{
-				OrderNumber:       order.OrderNumber,
-				BuyerID:           order.BuyerID,
-				VenueID:           order.VenueID,
-				DeviceID:          order.DeviceID,
-				ProductID:         order.ProductID,
-				InstallationID:    order.InstallationID,
-				Quantity:          order.Quantity,
-				AgingID:           order.AgingID,
-				RoomID:            order.RoomID,
-				RoomQuantity:      order.RoomQuantity,
-				TotalPrice:        order.TotalPrice,
-				PaymentMethodID:   order.PaymentMethodID,
-				PaymentFee:        order.PaymentFee,
-				Status:            order.Status,
-				CreatedAt:         order.CreatedAt,
-				CreatedBy:         order.CreatedBy,
-				UpdatedAt:         order.UpdatedAt,
-				LastUpdateBy:      order.LastUpdateBy,
-				DeletedAt:         order.DeletedAt,
-				PendingAt:         order.PendingAt,
-				PaidAt:            order.PaidAt,
-				FailedAt:          order.FailedAt,
-				ProjectID:         order.ProjectID,
-				Email:             order.Email,
-				OpenPaymentStatus: order.OpenPaymentStatus,
+				OrderNumber:       o.OrderNumber,
+				BuyerID:           o.BuyerID,
+				VenueID:           o.VenueID,
+				DeviceID:          o.DeviceID,
+				ProductID:         o.ProductID,
+				InstallationID:    o.InstallationID,
+				Quantity:          o.Quantity,
+				AgingID:           o.AgingID,
+				RoomID:            o.RoomID,
+				RoomQuantity:      o.RoomQuantity,
+				TotalPrice:        o.TotalPrice,
+				PaymentMethodID:   o.PaymentMethodID,
+				PaymentFee:        o.PaymentFee,
+				Status:            o.Status,
+				CreatedAt:         o.CreatedAt,
+				CreatedBy:         o.CreatedBy,
+				UpdatedAt:         o.UpdatedAt,
+				LastUpdateBy:      o.LastUpdateBy,
+				DeletedAt:         o.DeletedAt,
+				PendingAt:         o.PendingAt,
+				PaidAt:            o.PaidAt,
+				FailedAt:          o.FailedAt,
+				ProjectID:         o.ProjectID,
+				Email:             o.Email,
+				OpenPaymentStatus: o.OpenPaymentStatus,
+				OrderType:         o.OrderType,
 			},
 		})
 	}
-	view.RenderJSONData(w, res, http.StatusOK)
+
+	view.RenderJSONDataCursor(w, res, nextCursor, http.StatusOK)
 }
 
 func (c *Controller) handleGetOrderByID(w http.ResponseWriter, r *http.Request) {
@@ -1154,25 +1863,26 @@ func (c *Controller) handleGetOrderByID(w http.ResponseWriter, r *http.Request)
 			ProjectID:         order.ProjectID,
 			Email:             order.Email,
 			OpenPaymentStatus: order.OpenPaymentStatus,
+			OrderType:         order.OrderType,
 		},
 	}
 	view.RenderJSONData(w, res, http.StatusOK)
 }
 
-func (c *Controller) handleGetAllByVenueID(w http.ResponseWriter, r *http.Request) {
+func (c *Controller) handleGetOrderHistory(w http.ResponseWriter, r *http.Request) {
 	var (
-		_venueID     = router.GetParam(r, "venue_id")
-		venueID, err = strconv.ParseInt(_venueID, 10, 64)
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
 	)
 	if err != nil {
-		c.reporter.Errorf("[handleGetAllOrdersByVenueID] invalid parameter, err: %s", err.Error())
+		c.reporter.Errorf("[handleGetOrderHistory] invalid parameter, err: %s", err.Error())
 		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
 		return
 	}
 
 	user, ok := authpassport.GetUser(r)
 	if !ok {
-		c.reporter.Errorf("[handleGetAllOrdersByVenueID] failed get user")
+		c.reporter.Errorf("[handleGetOrderHistory] failed get user")
 		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
 		return
 	}
@@ -1181,187 +1891,88 @@ func (c *Controller) handleGetAllByVenueID(w http.ResponseWriter, r *http.Reques
 		userID = ""
 	}
 
-	orders, err := c.order.SelectByVenueID(venueID, c.projectID, userID.(string))
-	if err != nil {
-		c.reporter.Errorf("[handleGetAllOrdersByVenueID] orders not found, err: %s", err.Error())
-		view.RenderJSONError(w, "Failed get orders", http.StatusInternalServerError)
+	_, err = c.order.Get(id, c.projectID, userID.(string))
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetOrderHistory] order not found, err: %s", err.Error())
+		view.RenderJSONError(w, "Order not found", http.StatusNotFound)
 		return
 	}
 	if err != nil && err != sql.ErrNoRows {
-		c.reporter.Errorf("[handleGetAllOrdersByVenueID] failed get orders, err: %s", err.Error())
-		view.RenderJSONError(w, "Failed get orders", http.StatusInternalServerError)
-		return
-	}
-
-	res := make([]view.DataResponseOrder, 0, len(orders))
-	for _, order := range orders {
-		res = append(res, view.DataResponseOrder{
-			Type: "order",
-			ID:   order.OrderID,
-			Attributes: view.OrderAttributes{
-				OrderNumber:       order.OrderNumber,
-				BuyerID:           order.BuyerID,
-				VenueID:           order.VenueID,
-				DeviceID:          order.DeviceID,
-				ProductID:         order.ProductID,
-				InstallationID:    order.InstallationID,
-				Quantity:          order.Quantity,
-				AgingID:           order.AgingID,
-				RoomID:            order.RoomID,
-				RoomQuantity:      order.RoomQuantity,
-				TotalPrice:        order.TotalPrice,
-				PaymentMethodID:   order.PaymentMethodID,
-				PaymentFee:        order.PaymentFee,
-				Status:            order.Status,
-				CreatedAt:         order.CreatedAt,
-				CreatedBy:         order.CreatedBy,
-				UpdatedAt:         order.UpdatedAt,
-				LastUpdateBy:      order.LastUpdateBy,
-				DeletedAt:         order.DeletedAt,
-				PendingAt:         order.PendingAt,
-				PaidAt:            order.PaidAt,
-				FailedAt:          order.FailedAt,
-				ProjectID:         order.ProjectID,
-				Email:             order.Email,
-				OpenPaymentStatus: order.OpenPaymentStatus,
-			},
-		})
-	}
-
-	view.RenderJSONData(w, res, http.StatusOK)
-}
-
-func (c *Controller) handleGetAllByBuyerID(w http.ResponseWriter, r *http.Request) {
-	var (
-		buyerID = router.GetParam(r, "buyer_id")
-	)
-
-	user, ok := authpassport.GetUser(r)
-	if !ok {
-		c.reporter.Errorf("[handleGetAllOrdersByBuyerID] failed get user")
-		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		c.reporter.Errorf("[handleGetOrderHistory] Failed get order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get order", http.StatusInternalServerError)
 		return
 	}
-	userID, ok := user["sub"]
-	if !ok {
-		userID = ""
-	}
 
-	orders, err := c.order.SelectByBuyerID(buyerID, c.projectID, userID.(string))
-	if err != nil {
-		c.reporter.Errorf("[handleGetAllOrdersByBuyerID] orders not found, err: %s", err.Error())
-		view.RenderJSONError(w, "Failed get orders", http.StatusInternalServerError)
-		return
-	}
+	histories, err := c.order.GetStatusHistories(id, c.projectID, userID.(string))
 	if err != nil && err != sql.ErrNoRows {
-		c.reporter.Errorf("[handleGetAllOrdersByBuyerID] failed get orders, err: %s", err.Error())
-		view.RenderJSONError(w, "Failed get orders", http.StatusInternalServerError)
+		c.reporter.Errorf("[handleGetOrderHistory] Failed get order history, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get order history", http.StatusInternalServerError)
 		return
 	}
 
-	res := make([]view.DataResponseOrder, 0, len(orders))
-	for _, order := range orders {
+	res := make([]view.DataResponseOrder, 0, len(histories))
+	for _, history := range histories {
+		attributes := view.OrderStatusHistoryAttributes{
+			OrderID:      history.OrderID,
+			FromStatus:   history.FromStatus,
+			ToStatus:     history.ToStatus,
+			ToStatusName: order.StatusName(history.ToStatus),
+			Reason:       history.Reason,
+			CreatedBy:    history.CreatedBy,
+			CreatedAt:    history.CreatedAt,
+		}
+		if history.FromStatus.Valid {
+			attributes.FromStatusName = order.StatusName(int16(history.FromStatus.Int64))
+		}
+
 		res = append(res, view.DataResponseOrder{
-			Type: "order",
-			ID:   order.OrderID,
-			Attributes: view.OrderAttributes{
-				OrderNumber:       order.OrderNumber,
-				BuyerID:           order.BuyerID,
-				VenueID:           order.VenueID,
-				DeviceID:          order.DeviceID,
-				ProductID:         order.ProductID,
-				InstallationID:    order.InstallationID,
-				Quantity:          order.Quantity,
-				AgingID:           order.AgingID,
-				RoomID:            order.RoomID,
-				RoomQuantity:      order.RoomQuantity,
-				TotalPrice:        order.TotalPrice,
-				PaymentMethodID:   order.PaymentMethodID,
-				PaymentFee:        order.PaymentFee,
-				Status:            order.Status,
-				CreatedAt:         order.CreatedAt,
-				CreatedBy:         order.CreatedBy,
-				UpdatedAt:         order.UpdatedAt,
-				LastUpdateBy:      order.LastUpdateBy,
-				DeletedAt:         order.DeletedAt,
-				PendingAt:         order.PendingAt,
-				PaidAt:            order.PaidAt,
-				FailedAt:          order.FailedAt,
-				ProjectID:         order.ProjectID,
-				Email:             order.Email,
-				OpenPaymentStatus: order.OpenPaymentStatus,
-			},
+			ID:         history.ID,
+			Type:       "orderStatusHistory",
+			Attributes: attributes,
 		})
 	}
 
 	view.RenderJSONData(w, res, http.StatusOK)
 }
 
-func (c *Controller) handleGetAllByPaidDate(w http.ResponseWriter, r *http.Request) {
-	var (
-		_paidDate = router.GetParam(r, "paid_date")
-		paidDate  = _paidDate[:10]
-	)
+// handleGetAllByVenueID is GET /orders filtered by the venue of the path
+func (c *Controller) handleGetAllByVenueID(w http.ResponseWriter, r *http.Request) {
+	c.handleGetAllOrdersWith(w, r, map[string]string{
+		"venueId": router.GetParam(r, "venue_id"),
+	})
+}
 
-	user, ok := authpassport.GetUser(r)
-	if !ok {
-		c.reporter.Errorf("[handleGetAllOrdersByPaidDate] failed get user")
-		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
-		return
-	}
-	userID, ok := user["sub"]
-	if !ok {
-		userID = ""
-	}
+// handleGetAllByBuyerID is GET /orders filtered by the buyer of the path
+func (c *Controller) handleGetAllByBuyerID(w http.ResponseWriter, r *http.Request) {
+	c.handleGetAllOrdersWith(w, r, map[string]string{
+		"buyerId": router.GetParam(r, "buyer_id"),
+	})
+}
 
-	orders, err := c.order.SelectByPaidDate(paidDate, c.projectID, userID.(string))
-	if err != nil {
-		c.reporter.Errorf("[handleGetAllOrdersByPaidDate] orders not found, err: %s", err.Error())
-		view.RenderJSONError(w, "Failed get orders", http.StatusInternalServerError)
-		return
-	}
-	if err != nil && err != sql.ErrNoRows {
-		c.reporter.Errorf("[handleGetAllOrdersByPaidDate] failed get order, err: %s", err.Error())
-		view.RenderJSONError(w, "Failed get order", http.StatusInternalServerError)
-		return
+// handleGetAllByPaidDate is GET /orders filtered by the paid date of the path,
+// any time after the date is ignored
+func (c *Controller) handleGetAllByPaidDate(w http.ResponseWriter, r *http.Request) {
+	paidDate := router.GetParam(r, "paid_date")
+	if len(paidDate) > 10 {
+		paidDate = paidDate[:10]
 	}
 
-	res := make([]view.DataResponseOrder, 0, len(orders))
-	for _, order := range orders {
-		res = append(res, view.DataResponseOrder{
-			Type: "order",
-			ID:   order.OrderID,
-			Attributes: view.OrderAttributes{
-				OrderNumber:       order.OrderNumber,
-				BuyerID:           order.BuyerID,
-				VenueID:           order.VenueID,
-				DeviceID:          order.DeviceID,
-				ProductID:         order.ProductID,
-				InstallationID:    order.InstallationID,
-				Quantity:          order.Quantity,
-				AgingID:           order.AgingID,
-				RoomID:            order.RoomID,
-				RoomQuantity:      order.RoomQuantity,
-				TotalPrice:        order.TotalPrice,
-				PaymentMethodID:   order.PaymentMethodID,
-				PaymentFee:        order.PaymentFee,
-				Status:            order.Status,
-				CreatedAt:         order.CreatedAt,
-				CreatedBy:         order.CreatedBy,
-				UpdatedAt:         order.UpdatedAt,
-				LastUpdateBy:      order.LastUpdateBy,
-				DeletedAt:         order.DeletedAt,
-				PendingAt:         order.PendingAt,
-				PaidAt:            order.PaidAt,
-				FailedAt:          order.FailedAt,
-				ProjectID:         order.ProjectID,
-				Email:             order.Email,
-				OpenPaymentStatus: order.OpenPaymentStatus,
-			},
-		})
+	c.handleGetAllOrdersWith(w, r, map[string]string{
+		"paidFrom": paidDate,
+		"paidTo":   paidDate,
+	})
+}
+
+// handleGetAllOrdersWith serves GET /orders with the params set in its query.
+// As before the filters of GET /orders, every matching order is returned
+func (c *Controller) handleGetAllOrdersWith(w http.ResponseWriter, r *http.Request, params map[string]string) {
+	getParam := r.URL.Query()
+	for key, value := range params {
+		getParam.Set(key, value)
 	}
+	r.URL.RawQuery = getParam.Encode()
 
-	view.RenderJSONData(w, res, http.StatusOK)
+	c.listOrders(w, r, false)
 }
 
 func (c *Controller) handleCalculateOrderPrice(w http.ResponseWriter, r *http.Request) {
@@ -1386,6 +1997,10 @@ func (c *Controller) handleCalculateOrderPrice(w http.ResponseWriter, r *http.Re
 	if !ok {
 		userID = ""
 	}
+	buyerID := userID.(string)
+	if buyerID == "" {
+		buyerID = params.UserID
+	}
 
 	venue, err := c.venue.Get(c.projectID, params.VenueID, userID.(string))
 	if err == sql.ErrNoRows {
@@ -1432,201 +2047,163 @@ func (c *Controller) handleCalculateOrderPrice(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	valid := isOrderValid(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
-	if !valid {
-		c.reporter.Errorf("[handleCalculateOrderPrice] Order not valid, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
-			venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
-		view.RenderJSONError(w, "Order not valid", http.StatusBadRequest)
+	validator, err := c.validateOrder(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+	if err != nil {
+		c.reporter.Errorf("[handleCalculateOrderPrice] Failed validate order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed validate order", http.StatusInternalServerError)
+		return
+	}
+	if !validator.IsValid {
+		c.reporter.Errorf("[handleCalculateOrderPrice] Order not valid, %s does not match order matrix, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
+			validator.UnmatchedField, venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+		view.RenderJSONError(w, fmt.Sprintf("Order not valid, %s does not match order matrix", validator.UnmatchedField), http.StatusBadRequest)
 		return
 	}
 
 	//calculate total price
-	totalPrice := c.calculateTotalPrice(venue.VenueType, product.Price, installation.Price, room.Price, float64(params.RoomQuantity))
+	breakdown, err := c.calculateOrderPrice(venue, params.RoomQuantity, device, product, installation, room, aging, params.OrderType, orderPromotion{BuyerID: buyerID, Code: params.VoucherCode})
+	if err == pricing.ErrRuleNotFound {
+		c.reporter.Errorf("[handleCalculateOrderPrice] Pricing rule not found, venueType: %d", venue.VenueType)
+		view.RenderJSONError(w, "Pricing rule not found for venue type", http.StatusBadRequest)
+		return
+	}
+	if promotion.IsVoucherError(err) {
+		c.reporter.Warningf("[handleCalculateOrderPrice] Voucher not applied, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleCalculateOrderPrice] Failed calculate price, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed calculate price", http.StatusInternalServerError)
+		return
+	}
+	totalPrice := breakdown.TotalPrice
 
 	//set response
-	details := c.mappingDetailOrder(params.RoomQuantity, device, product, installation, room, aging)
+	details := mappingPriceDetails(breakdown)
 
 	res := view.CalculatePriceAttributes{
 		TotalPrice: totalPrice,
+		TaxBase:    breakdown.TaxBase,
+		TaxAmount:  breakdown.TaxAmount,
 		Details:    details,
 	}
 
 	view.RenderJSONData(w, res, http.StatusOK)
 }
 
-func leftPadLen(s string, padStr string, overallLen int) string {
-	var padCountInt int
-	padCountInt = 1 + ((overallLen - len(padStr)) / len(padStr))
-	var retStr = strings.Repeat(padStr, padCountInt) + s
-	return retStr[(len(retStr) - overallLen):]
-}
+func (c *Controller) validateOrder(venueType, venueCapacity, agingID, deviceID, productID, installationID, roomID, roomQuantity int64) (order_matrix.OrderMatrixValidator, error) {
+	if (roomID == 0) != (roomQuantity == 0) {
+		return order_matrix.OrderMatrixValidator{UnmatchedField: "room"}, nil
+	}
 
-func isOrderValid(venueType, venueCapacity, agingID, deviceID, productID, installationID, roomID, roomQuantity int64) bool {
-	if roomID == 0 && roomQuantity == 0 {
-		if venueType > 0 && venueType <= 4 {
-			if venueCapacity == 1 {
-				if agingID == 1 {
-					if deviceID == 1 {
-						if productID == 1 && installationID == 1 {
-							return true
-						}
-					} else if deviceID == 2 {
-						if productID == 4 && installationID == 4 {
-							return true
-						}
-					} else if deviceID == 3 {
-						if productID == 9 && installationID == 9 {
-							return true
-						}
-					} else if deviceID == 4 {
-						if productID == 10 && installationID == 10 {
-							return true
-						}
-					}
-				} else if agingID == 2 {
-					if deviceID == 1 && productID == 2 && installationID == 2 {
-						return true
-					}
-				} else if agingID == 3 {
-					if deviceID == 1 && productID == 3 && installationID == 3 {
-						return true
-					}
-				}
-			} else if venueCapacity == 2 && agingID == 1 {
-				if deviceID == 1 {
-					if productID == 5 && installationID == 5 {
-						return true
-					}
-				} else if deviceID == 2 {
-					if productID == 6 && installationID == 6 {
-						return true
-					}
-				} else if deviceID == 3 {
-					if productID == 11 && installationID == 11 {
-						return true
-					}
-				} else if deviceID == 4 {
-					if productID == 12 && installationID == 12 {
-						return true
-					}
-				}
-			}
-		} else if venueType == 5 || venueType == 6 {
-			if venueCapacity == 1 {
-				if agingID == 1 {
-					if deviceID == 1 {
-						if productID == 1 && installationID == 1 {
-							return true
-						}
-					} else if deviceID == 2 {
-						if productID == 4 && installationID == 4 {
-							return true
-						}
-					} else if deviceID == 3 {
-						if productID == 9 && installationID == 9 {
-							return true
-						}
-					} else if deviceID == 4 {
-						if productID == 10 && installationID == 10 {
-							return true
-						}
-					}
-				} else if agingID == 2 {
-					if deviceID == 1 && productID == 2 && installationID == 2 {
-						return true
-					}
-				} else if agingID == 3 {
-					if deviceID == 1 && productID == 3 && installationID == 3 {
-						return true
-					}
-				}
-			}
-		} else if venueType >= 7 && venueType <= 11 {
-			if venueCapacity == 2 && agingID == 1 {
-				if deviceID == 1 {
-					if productID == 5 && installationID == 5 {
-						return true
-					}
-				} else if deviceID == 2 {
-					if productID == 6 && installationID == 6 {
-						return true
-					}
-				} else if deviceID == 3 {
-					if productID == 11 && installationID == 11 {
-						return true
-					}
-				} else if deviceID == 4 {
-					if productID == 12 && installationID == 12 {
-						return true
-					}
-				}
-			}
-		}
-	} else {
-		if venueCapacity == 0 && agingID == 1 {
-			if venueType >= 12 && venueType <= 14 {
-				if roomID == 1 {
-					if deviceID == 1 {
-						if productID == 7 && installationID == 7 {
-							return true
-						}
-					} else if deviceID == 3 {
-						if productID == 13 && installationID == 13 {
-							return true
-						}
-					}
-				}
-			} else if venueType >= 15 && venueType <= 18 {
-				if roomID == 2 {
-					if deviceID == 1 {
-						if productID == 8 && installationID == 8 {
-							return true
-						}
-					} else if deviceID == 3 {
-						if productID == 14 && installationID == 14 {
-							return true
-						}
-					}
-				}
-			}
-		}
+	matrix := order_matrix.OrderMatrix{
+		VenueTypeID:    venueType,
+		AgingID:        agingID,
+		DeviceID:       deviceID,
+		ProductID:      productID,
+		InstallationID: installationID,
+		ProjectID:      c.projectID,
+	}
+	if venueCapacity != 0 {
+		matrix.Capacity = &venueCapacity
+	}
+	if roomID != 0 {
+		matrix.RoomID = &roomID
 	}
-	return false
+
+	return c.orderMatrix.MatrixValidator(matrix)
 }
 
-func (c *Controller) calculateTotalPrice(venueType int64, productPrice, installationPrice, roomPrice, roomQuantity float64) float64 {
-	var totalPrice float64
-	if venueType > 0 && venueType <= 11 {
-		totalPrice = (productPrice + installationPrice)
-	} else if venueType > 11 && venueType <= 18 {
-		totalPrice = (installationPrice + (math.Ceil(roomQuantity*0.3) * roomPrice))
+// calculateOrderPrice prices the order items by the pricing rules of the venue
+// type, takes off the promotions the order gets and applies tax
+func (c *Controller) calculateOrderPrice(venue venue.Venue, roomQuantity int64, device device.Device, product product.Product, installation installation.Installation, room room.Room, aging aging.Aging, orderType string, promo orderPromotion) (pricing.Breakdown, error) {
+	if orderType == "" {
+		orderType = order.OrderTypeNew
+	}
+
+	venueType, err := c.venueType.Get(c.projectID, venue.VenueType)
+	if err != nil {
+		return pricing.Breakdown{}, err
+	}
+
+	items := pricing.Items{
+		{ItemType: "device", ItemID: device.ID, Description: device.Name, Price: device.Price, Quantity: 1},
+		{ItemType: "product", ItemID: product.ProductID, Description: product.ProductName, Price: product.Price, Quantity: 1},
+		{ItemType: "installation", ItemID: installation.ID, Description: installation.Name, Price: installation.Price, Quantity: 1},
+		{ItemType: "aging", ItemID: aging.ID, Description: aging.Name, Price: aging.Price, Quantity: 1},
+	}
+	if room.ID != 0 {
+		items = append(items, pricing.Item{ItemType: "room", ItemID: room.ID, Description: room.Name, Price: room.Price, Quantity: roomQuantity})
+	}
+
+	breakdown, err := c.pricing.Calculate(c.projectID, venueType.Id, venueType.PricingGroupID, orderType, items)
+	if err != nil {
+		return breakdown, err
 	}
 
-	return totalPrice
+	err = c.applyPromotions(&breakdown, promotion.Target{
+		VenueTypeID:      venueType.Id,
+		CommercialTypeID: venueType.CommercialTypeID,
+		City:             venue.City,
+		ProductID:        product.ProductID,
+		OrderType:        orderType,
+		At:               time.Now(),
+	}, promo)
+	if err != nil {
+		return breakdown, err
+	}
 
+	err = c.applyTax(&breakdown, time.Now())
+	return breakdown, err
 }
 
 func (c *Controller) generateOrderNumber() (string, error) {
-	lastOrderNumber, err := c.order.GetLastOrderNumber()
-	if err != nil && err != sql.ErrNoRows {
-		return "", err
-	}
+	return c.sequence.Next(c.projectID, sequence.OrderNumber)
+}
 
-	dateNow := time.Now().Format("060102")
-	if strings.Compare(dateNow, lastOrderNumber.Date) == 1 {
-		lastOrderNumber.Number = 0
+// dropOrder deletes an order with its details that was created by a request
+// which then failed
+func (c *Controller) dropOrder(o order.Order, requestID string) {
+	err := c.order.Delete(&o, true, requestID)
+	if err == nil {
+		err = c.deleteOrderDetail(o, true, requestID)
+	}
+	if err != nil {
+		c.reporter.Errorf("[dropOrder] failed delete order %d, err: %s", o.OrderID, err.Error())
 	}
-	return "MN" + dateNow + leftPadLen(strconv.FormatInt((lastOrderNumber.Number+1), 10), "0", 7), nil
 }
 
-func (c *Controller) sendEmail(orderID, venueID int64, userID string) {
-	result := c.handleEmailECert(venueID, userID)
-	if result == false {
-		c.reporter.Warningf("[handleUpdateOrderStatus] Failed sent email ECert")
+// orderVenue is a venue of an order with the aging ordered for it
+type orderVenue struct {
+	VenueID int64
+	AgingID int64
+}
+
+// orderVenues returns the venues of an order, a cart order has the venues of
+// its details
+func (c *Controller) orderVenues(o order.Order) ([]orderVenue, error) {
+	if o.OrderType != order.OrderTypeCart {
+		return []orderVenue{{VenueID: o.VenueID, AgingID: o.AgingID}}, nil
 	}
 
-	result = c.handleEmailInvoice(orderID, userID)
-	if result == false {
-		c.reporter.Warningf("[handleUpdateOrderStatus] Failed sent email invoice")
+	details, err := c.orderDetail.GetFromDBByOrderID(o.OrderID, c.projectID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var venues []orderVenue
+	index := make(map[int64]int)
+	for _, detail := range details {
+		i, ok := index[detail.VenueID]
+		if !ok {
+			i = len(venues)
+			index[detail.VenueID] = i
+			venues = append(venues, orderVenue{VenueID: detail.VenueID})
+		}
+		if detail.ItemType == "aging" {
+			venues[i].AgingID = detail.ItemID
+		}
 	}
+	return venues, nil
 }
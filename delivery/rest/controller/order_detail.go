@@ -1,34 +1,35 @@
 package controller
 
 import (
-	"math"
-
-	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/aging"
-	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/device"
-	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/installation"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_detail"
-	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/product"
-	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/room"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/promotion"
+	"gopkg.in/guregu/null.v3"
 )
 
-func (c *Controller) insertOrderDetail(order order.Order, device device.Device, product product.Product, installation installation.Installation, room room.Room, aging aging.Aging, isAdmin bool) (err error) {
-	var details = c.mappingDetailOrder(order.RoomQuantity, device, product, installation, room, aging)
+func (c *Controller) insertOrderDetail(order order.Order, venueID int64, breakdown pricing.Breakdown, isAdmin bool, requestID string) (err error) {
+	var details = c.mappingDetailOrder(breakdown)
 
 	for _, detail := range details {
 		insertDetail := order_detail.OrderDetail{
 			OrderID:      order.OrderID,
+			VenueID:      venueID,
 			ItemType:     detail.ItemType,
 			ItemID:       detail.ItemID,
 			Description:  detail.Description,
 			Amount:       detail.Amount,
 			Quantity:     detail.Quantity,
+			TaxRateID:    detail.TaxRateID,
+			TaxRate:      detail.TaxRate,
+			TaxBase:      detail.TaxBase,
+			TaxAmount:    detail.TaxAmount,
 			CreatedBy:    order.CreatedBy,
 			LastUpdateBy: order.LastUpdateBy,
 			ProjectID:    order.ProjectID,
 		}
 
-		err = c.orderDetail.Insert(&insertDetail, isAdmin)
+		err = c.orderDetail.Insert(&insertDetail, isAdmin, requestID)
 		if err != nil {
 			return err
 		}
@@ -37,32 +38,64 @@ func (c *Controller) insertOrderDetail(order order.Order, device device.Device,
 	return
 }
 
-func (c *Controller) updateOrderDetail(order order.Order, device device.Device, product product.Product, installation installation.Installation, room room.Room, aging aging.Aging, isAdmin bool) (err error) {
-	var details = c.mappingDetailOrder(order.RoomQuantity, device, product, installation, room, aging)
+// updateOrderDetail updates the details of the order to the lines of
+// breakdown. Discount lines are replaced as a whole since the promotions of
+// the order may differ from those it had
+func (c *Controller) updateOrderDetail(order order.Order, venueID int64, breakdown pricing.Breakdown, isAdmin bool, requestID string) (err error) {
+	var (
+		details   = c.mappingDetailOrder(breakdown)
+		discounts pricing.Breakdown
+	)
 
 	for _, detail := range details {
+		if detail.ItemType == promotion.ItemTypeDiscount {
+			continue
+		}
+
 		updateDetail := order_detail.OrderDetail{
 			OrderID:      order.OrderID,
+			VenueID:      venueID,
 			ItemType:     detail.ItemType,
 			ItemID:       detail.ItemID,
 			Description:  detail.Description,
 			Amount:       detail.Amount,
 			Quantity:     detail.Quantity,
+			TaxRateID:    detail.TaxRateID,
+			TaxRate:      detail.TaxRate,
+			TaxBase:      detail.TaxBase,
+			TaxAmount:    detail.TaxAmount,
 			CreatedBy:    order.CreatedBy,
 			LastUpdateBy: order.LastUpdateBy,
 			ProjectID:    order.ProjectID,
 		}
 
-		err = c.orderDetail.Update(&updateDetail, isAdmin)
+		err = c.orderDetail.Update(&updateDetail, isAdmin, requestID)
 		if err != nil {
 			return err
 		}
 	}
 
-	return
+	deleteDiscounts := order_detail.OrderDetail{
+		OrderID:      order.OrderID,
+		ItemType:     promotion.ItemTypeDiscount,
+		CreatedBy:    order.CreatedBy,
+		LastUpdateBy: order.LastUpdateBy,
+		ProjectID:    order.ProjectID,
+	}
+	err = c.orderDetail.Delete(&deleteDiscounts, isAdmin, requestID)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range breakdown.Lines {
+		if line.ItemType == promotion.ItemTypeDiscount {
+			discounts.Lines = append(discounts.Lines, line)
+		}
+	}
+	return c.insertOrderDetail(order, venueID, discounts, isAdmin, requestID)
 }
 
-func (c *Controller) deleteOrderDetail(order order.Order, isAdmin bool) (err error) {
+func (c *Controller) deleteOrderDetail(order order.Order, isAdmin bool, requestID string) (err error) {
 
 	deleteDetails := order_detail.OrderDetail{
 		OrderID:      order.OrderID,
@@ -71,7 +104,7 @@ func (c *Controller) deleteOrderDetail(order order.Order, isAdmin bool) (err err
 		LastUpdateBy: order.LastUpdateBy,
 	}
 
-	err = c.orderDetail.Delete(&deleteDetails, isAdmin)
+	err = c.orderDetail.Delete(&deleteDetails, isAdmin, requestID)
 	if err != nil {
 		return err
 	}
@@ -79,20 +112,17 @@ func (c *Controller) deleteOrderDetail(order order.Order, isAdmin bool) (err err
 	return
 }
 
-func (c *Controller) mappingDetailOrder(roomQuantity int64, device device.Device, product product.Product, installation installation.Installation, room room.Room, aging aging.Aging) order_detail.Details {
-	quantity := int64(1)
-
-	details := order_detail.Details{
-		{ItemType: "device", ItemID: device.ID, Description: device.Name, Amount: device.Price, Quantity: quantity},
-		{ItemType: "product", ItemID: product.ProductID, Description: product.ProductName, Amount: product.Price, Quantity: quantity},
-		{ItemType: "installation", ItemID: installation.ID, Description: installation.Name, Amount: installation.Price, Quantity: quantity},
-		{ItemType: "aging", ItemID: aging.ID, Description: aging.Name, Amount: aging.Price, Quantity: quantity},
-	}
-
-	if room.ID != 0 {
-		details = append(details, order_detail.Detail{
-			ItemType: "room", ItemID: room.ID, Description: room.Name, Amount: (math.Ceil(float64(roomQuantity)*0.3) * room.Price), Quantity: roomQuantity,
-		})
+func (c *Controller) mappingDetailOrder(breakdown pricing.Breakdown) order_detail.Details {
+	details := make(order_detail.Details, 0, len(breakdown.Lines))
+	for _, line := range breakdown.Lines {
+		detail := order_detail.Detail{
+			ItemType: line.ItemType, ItemID: line.ItemID, Description: line.Description, Amount: line.Amount, Quantity: line.Quantity,
+			TaxRate: line.TaxRate, TaxBase: line.TaxBase, TaxAmount: line.TaxAmount,
+		}
+		if line.TaxRateID != 0 {
+			detail.TaxRateID = null.IntFrom(line.TaxRateID)
+		}
+		details = append(details, detail)
 	}
 
 	return details
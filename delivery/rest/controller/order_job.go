@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
+	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+)
+
+// RunOrderJob runs a job queued when its order was paid or refunded, it is
+// run again by the order job worker until it returns nil. A job of an order
+// which is no longer paid, e.g. refunded meanwhile, has nothing left to do
+// but applying the refund
+func (c *Controller) RunOrderJob(job order_job.Job) error {
+	paidOrder, err := c.order.Get(job.OrderID, job.ProjectID, "")
+	if err != nil {
+		return fmt.Errorf("failed get order: %s", err.Error())
+	}
+	if job.Type == order_job.TypeCompleteRefund {
+		return c.runCompleteRefund(paidOrder, job)
+	}
+	if paidOrder.Status != order.StatusPaid {
+		c.reporter.Warningf("[RunOrderJob] order %d is %s, skip %s job %d", job.OrderID, order.StatusName(paidOrder.Status), job.Type, job.ID)
+		return nil
+	}
+
+	switch job.Type {
+	case order_job.TypeActivateLicense:
+		venues, err := c.orderVenues(paidOrder)
+		if err != nil {
+			return fmt.Errorf("failed get order venues: %s", err.Error())
+		}
+		for _, v := range venues {
+			if v.VenueID == job.VenueID {
+				return c.activateLicense(paidOrder, v.VenueID, v.AgingID, "")
+			}
+		}
+		return fmt.Errorf("venue %d is not ordered", job.VenueID)
+	case order_job.TypeEarnCommissions:
+		return c.earnCommissions(paidOrder)
+	}
+	return fmt.Errorf("unknown job type %s", job.Type)
+}
+
+// runCompleteRefund applies the completed refund of the job to its order
+func (c *Controller) runCompleteRefund(refundedOrder order.Order, job order_job.Job) error {
+	refunds, err := c.refund.SelectByOrderID(job.OrderID, job.ProjectID)
+	if err != nil {
+		return fmt.Errorf("failed get refunds: %s", err.Error())
+	}
+	for _, completed := range refunds {
+		if completed.ID == job.RefundID.Int64 {
+			return c.completeRefund(refundedOrder, completed, job.CreatedBy)
+		}
+	}
+	return fmt.Errorf("refund %d not found", job.RefundID.Int64)
+}
+
+func (c *Controller) handleGetOrderJobs(w http.ResponseWriter, r *http.Request) {
+	var err error
+	getParam := r.URL.Query()
+
+	status := getParam.Get("status")
+	if status != "" && status != order_job.StatusPending && status != order_job.StatusDone && status != order_job.StatusDead {
+		c.reporter.Warningf("[handleGetOrderJobs] invalid status %s", status)
+		view.RenderJSONError(w, "Invalid parameter status", http.StatusBadRequest)
+		return
+	}
+
+	page := 1
+	limit := 15
+	if limitVal := getParam.Get("limit"); limitVal != "" {
+		limit, err = strconv.Atoi(limitVal)
+		if err != nil || limit < 1 {
+			c.reporter.Warningf("[handleGetOrderJobs] invalid limit %s", limitVal)
+			view.RenderJSONError(w, "Invalid parameter limit", http.StatusBadRequest)
+			return
+		}
+	}
+	if pageVal := getParam.Get("page"); pageVal != "" {
+		page, err = strconv.Atoi(pageVal)
+		if err != nil || page < 1 {
+			c.reporter.Warningf("[handleGetOrderJobs] invalid page %s", pageVal)
+			view.RenderJSONError(w, "Invalid parameter page", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// one more job is selected to know whether there is a next page
+	jobs, err := c.orderJob.Select(c.projectID, status, limit+1, limit*(page-1))
+	if err != nil {
+		c.reporter.Errorf("[handleGetOrderJobs] failed get order jobs, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get order jobs", http.StatusInternalServerError)
+		return
+	}
+
+	hasNext := len(jobs) > limit
+	if hasNext {
+		jobs = jobs[:limit]
+	}
+
+	res := make([]view.DataResponseOrderJob, 0, len(jobs))
+	for _, job := range jobs {
+		res = append(res, toOrderJobResponse(job))
+	}
+
+	view.RenderJSONDataPage(w, res, hasNext, http.StatusOK)
+}
+
+func (c *Controller) handlePostOrderJobRetry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(router.GetParam(r, "id"), 10, 64)
+	if err != nil {
+		c.reporter.Warningf("[handlePostOrderJobRetry] id must be integer, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handlePostOrderJobRetry] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusBadRequest)
+		return
+	}
+	userID, _ := user["sub"].(string)
+
+	err = c.orderJob.Retry(id, c.projectID, userID)
+	if err == order_job.ErrNotDead {
+		_, errGet := c.orderJob.Get(id, c.projectID)
+		if errGet == sql.ErrNoRows {
+			c.reporter.Warningf("[handlePostOrderJobRetry] job %d not found", id)
+			view.RenderJSONError(w, "Job not found", http.StatusNotFound)
+			return
+		}
+		c.reporter.Warningf("[handlePostOrderJobRetry] job %d is not dead", id)
+		view.RenderJSONError(w, "Only dead job can be retried", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderJobRetry] failed retry job, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed retry job", http.StatusInternalServerError)
+		return
+	}
+
+	job, err := c.orderJob.Get(id, c.projectID)
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderJobRetry] failed get job, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get job", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderJSONData(w, toOrderJobResponse(job), http.StatusOK)
+}
+
+func toOrderJobResponse(job order_job.Job) view.DataResponseOrderJob {
+	return view.DataResponseOrderJob{
+		ID:   job.ID,
+		Type: "orderJob",
+		Attributes: view.OrderJobAttributes{
+			JobType:       job.Type,
+			OrderID:       job.OrderID,
+			VenueID:       job.VenueID,
+			RefundID:      job.RefundID,
+			Status:        job.Status,
+			Attempts:      job.Attempts,
+			NextAttemptAt: job.NextAttemptAt,
+			LastError:     job.LastError,
+			DoneAt:        job.DoneAt,
+			CreatedAt:     job.CreatedAt,
+			UpdatedAt:     job.UpdatedAt,
+		},
+	}
+}
@@ -90,7 +90,7 @@ func (c *Controller) handlePostOrderMatrix(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = c.orderMatrix.Insert(&matrix)
+	err = c.orderMatrix.Insert(&matrix, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePostOrderMatrix] failed post order matrix, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post order matrix", http.StatusInternalServerError)
@@ -222,7 +222,7 @@ func (c *Controller) handlePatchOrderMatrix(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = c.orderMatrix.Update(&matrix)
+	err = c.orderMatrix.Update(&matrix, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchOrderMatrix] failed post order matrix, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post order matrix", http.StatusInternalServerError)
@@ -290,7 +290,7 @@ func (c *Controller) handleDeleteOrderMatrix(w http.ResponseWriter, r *http.Requ
 		ProjectID:    c.projectID,
 	}
 
-	err = c.orderMatrix.Delete(&matrix)
+	err = c.orderMatrix.Delete(&matrix, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteOrderMatrix] failed delete order matrix, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete order matrix", http.StatusInternalServerError)
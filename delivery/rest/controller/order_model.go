@@ -1,21 +1,41 @@
 package controller
 
 type reqOrder struct {
-	VenueID        int64   `json:"venueID" validate:"required"`
-	DeviceID       int64   `json:"deviceID" validate:"required"`
-	ProductID      int64   `json:"productID" validate:"required"`
-	InstallationID int64   `json:"installationID" validate:"required"`
-	Quantity       int64   `json:"quantity"`
-	AgingID        int64   `json:"agingID" validate:"required"`
-	RoomID         int64   `json:"roomID"`
-	RoomQuantity   int64   `json:"roomQuantity"`
-	PaymentFee     float64 `json:"paymentFee"`
-	Email          string  `json:"email" validate:"required"`
-	UserID         string  `json:"userID"`
+	VenueID         int64  `json:"venueID" validate:"required"`
+	DeviceID        int64  `json:"deviceID" validate:"required"`
+	ProductID       int64  `json:"productID" validate:"required"`
+	InstallationID  int64  `json:"installationID" validate:"required"`
+	Quantity        int64  `json:"quantity"`
+	AgingID         int64  `json:"agingID" validate:"required"`
+	RoomID          int64  `json:"roomID"`
+	RoomQuantity    int64  `json:"roomQuantity"`
+	PaymentMethodID int64  `json:"paymentMethodID"`
+	Email           string `json:"email" validate:"required"`
+	VoucherCode     string `json:"voucherCode"`
+	UserID          string `json:"userID"`
+}
+
+type reqCartOrder struct {
+	Items           []reqCartItem `json:"items" validate:"required"`
+	PaymentMethodID int64         `json:"paymentMethodID"`
+	Email           string        `json:"email" validate:"required"`
+	VoucherCode     string        `json:"voucherCode"`
+	UserID          string        `json:"userID"`
+}
+
+type reqCartItem struct {
+	VenueID        int64 `json:"venueID" validate:"required"`
+	DeviceID       int64 `json:"deviceID" validate:"required"`
+	ProductID      int64 `json:"productID" validate:"required"`
+	InstallationID int64 `json:"installationID" validate:"required"`
+	AgingID        int64 `json:"agingID" validate:"required"`
+	RoomID         int64 `json:"roomID"`
+	RoomQuantity   int64 `json:"roomQuantity"`
 }
 
 type reqUpdateOrderStatus struct {
 	Status int16  `json:"status"`
+	Reason string `json:"reason"`
 	UserID string `json:"userID"`
 }
 
@@ -28,6 +48,11 @@ type reqUserID struct {
 	UserID string `json:"userID"`
 }
 
+type reqOrderPayment struct {
+	PaymentMethodID int64  `json:"paymentMethodID"`
+	UserID          string `json:"userID"`
+}
+
 type reqCalculateOrderPrice struct {
 	VenueID        int64  `json:"venueID" validate:"required"`
 	DeviceID       int64  `json:"deviceID" validate:"required"`
@@ -36,5 +61,7 @@ type reqCalculateOrderPrice struct {
 	AgingID        int64  `json:"agingID" validate:"required"`
 	RoomID         int64  `json:"roomID"`
 	RoomQuantity   int64  `json:"roomQuantity"`
+	OrderType      string `json:"orderType"`
+	VoucherCode    string `json:"voucherCode"`
 	UserID         string `json:"userID"`
 }
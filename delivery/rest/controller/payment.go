@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment"
+)
+
+// handlePaymentCallback receives payment notification from the gateway. The
+// gateway may send the same notification more than once, so a callback for an
+// order already in the notified status is answered with success. A paid
+// callback must carry the total price and payment fee of the order
+func (c *Controller) handlePaymentCallback(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		c.reporter.Errorf("[handlePaymentCallback] failed read body, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	callback, err := c.payment.VerifyCallback(body, r.Header.Get(payment.SignatureHeader))
+	if err == payment.ErrInvalidSignature {
+		c.reporter.Errorf("[handlePaymentCallback] invalid signature, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePaymentCallback] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.ParseInt(callback.Reference, 10, 64)
+	if err != nil {
+		c.reporter.Errorf("[handlePaymentCallback] invalid reference, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid reference", http.StatusBadRequest)
+		return
+	}
+
+	var status int16
+	switch callback.Status {
+	case payment.StatusPaid:
+		status = order.StatusPaid
+	case payment.StatusFailed:
+		status = order.StatusFailed
+	default:
+		c.reporter.Errorf("[handlePaymentCallback] unknown status, reference: %s, status: %s", callback.Reference, callback.Status)
+		view.RenderJSONError(w, "Unknown payment status", http.StatusBadRequest)
+		return
+	}
+
+	getOrder, err := c.order.Get(id, c.projectID, "")
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePaymentCallback] order not found, reference: %s", callback.Reference)
+		view.RenderJSONError(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePaymentCallback] Failed get order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get order", http.StatusInternalServerError)
+		return
+	}
+
+	// the order stays pending when the gateway was paid another amount, it is
+	// left for a manual check
+	if status == order.StatusPaid && getOrder.Status != status && !payment.AmountMatches(callback.Amount, getOrder.TotalPrice+getOrder.PaymentFee) {
+		c.reporter.Errorf("[handlePaymentCallback] Payment amount mismatch, reference: %s, transaction: %s, amount: %f, totalPrice: %f, paymentFee: %f",
+			callback.Reference, callback.TransactionID, callback.Amount, getOrder.TotalPrice, getOrder.PaymentFee)
+		view.RenderJSONError(w, "Payment amount does not match the order", http.StatusConflict)
+		return
+	}
+
+	if getOrder.Status != status {
+		if !order.CanTransition(getOrder.Status, status) {
+			c.reporter.Errorf("[handlePaymentCallback] Invalid status transition, reference: %s, from: %s, to: %s", callback.Reference, order.StatusName(getOrder.Status), order.StatusName(status))
+			view.RenderJSONError(w, "Invalid status transition", http.StatusConflict)
+			return
+		}
+
+		updateStatus := order.Order{
+			OrderID:      getOrder.OrderID,
+			ProjectID:    getOrder.ProjectID,
+			Status:       status,
+			CreatedBy:    getOrder.CreatedBy,
+			LastUpdateBy: "payment-gateway",
+			PendingAt:    getOrder.PendingAt,
+			PaidAt:       getOrder.PaidAt,
+			FailedAt:     getOrder.FailedAt,
+			VenueID:      getOrder.VenueID,
+			BuyerID:      getOrder.BuyerID,
+		}
+
+		err = c.order.UpdateOrderStatus(&updateStatus, "payment callback "+callback.TransactionID, true, getRequestID(r))
+		if err == order.ErrInvalidTransition {
+			// a concurrent delivery of the same callback may have won the race
+			getOrder, err = c.order.Get(id, c.projectID, "")
+			if err != nil || getOrder.Status != status {
+				c.reporter.Errorf("[handlePaymentCallback] Invalid status transition, reference: %s", callback.Reference)
+				view.RenderJSONError(w, "Invalid status transition", http.StatusConflict)
+				return
+			}
+		} else if err != nil {
+			c.reporter.Errorf("[handlePaymentCallback] failed update order status, err: %s", err.Error())
+			view.RenderJSONError(w, "Failed update order status", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	res := view.DataResponsePaymentCallback{
+		ID:   getOrder.OrderID,
+		Type: "payment_callback",
+		Attributes: view.PaymentCallbackAttributes{
+			Reference:     callback.Reference,
+			TransactionID: callback.TransactionID,
+			Status:        order.StatusName(status),
+		},
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
@@ -0,0 +1,277 @@
+package controller
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment_method"
+	"git.sstv.io/lib/go/gojunkyard.git/form"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+)
+
+func (c *Controller) handlePostPaymentMethod(w http.ResponseWriter, r *http.Request) {
+	var params reqPaymentMethod
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostPaymentMethod] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	method := payment_method.PaymentMethod{
+		Name:            params.Name,
+		Category:        params.Category,
+		GatewayMethodID: params.GatewayMethodID,
+		FixedFee:        params.FixedFee,
+		PercentageFee:   params.PercentageFee,
+		MinAmount:       params.MinAmount,
+		MaxAmount:       params.MaxAmount,
+		CreatedBy:       params.UserID,
+		LastUpdateBy:    params.UserID,
+		ProjectID:       c.projectID,
+	}
+
+	err = method.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePostPaymentMethod] invalid payment method, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.paymentMethod.Insert(&method, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostPaymentMethod] failed post payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post payment method", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePaymentMethod{
+		ID:         method.ID,
+		Type:       "paymentMethod",
+		Attributes: mappingPaymentMethodAttributes(method, nil),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handlePatchPaymentMethod(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqPaymentMethod
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPaymentMethod] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPaymentMethod] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	getMethod, err := c.paymentMethod.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchPaymentMethod] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchPaymentMethod] Failed get payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get payment method", http.StatusInternalServerError)
+		return
+	}
+
+	method := payment_method.PaymentMethod{
+		ID:              id,
+		Name:            params.Name,
+		Category:        params.Category,
+		GatewayMethodID: params.GatewayMethodID,
+		FixedFee:        params.FixedFee,
+		PercentageFee:   params.PercentageFee,
+		MinAmount:       params.MinAmount,
+		MaxAmount:       params.MaxAmount,
+		Status:          getMethod.Status,
+		CreatedAt:       getMethod.CreatedAt,
+		CreatedBy:       getMethod.CreatedBy,
+		LastUpdateBy:    params.UserID,
+		DeletedAt:       getMethod.DeletedAt,
+		ProjectID:       c.projectID,
+	}
+
+	err = method.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPaymentMethod] invalid payment method, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.paymentMethod.Update(&method, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPaymentMethod] failed update payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed update payment method", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePaymentMethod{
+		ID:         method.ID,
+		Type:       "paymentMethod",
+		Attributes: mappingPaymentMethodAttributes(method, nil),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleDeletePaymentMethod(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqDeletePaymentMethod
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePaymentMethod] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePaymentMethod] user id not found, err: %s", err.Error())
+		view.RenderJSONError(w, "User ID not found", http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.paymentMethod.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleDeletePaymentMethod] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleDeletePaymentMethod] Failed get payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get payment method", http.StatusInternalServerError)
+		return
+	}
+
+	method := payment_method.PaymentMethod{
+		ID:           id,
+		LastUpdateBy: params.UserID,
+		ProjectID:    c.projectID,
+	}
+
+	err = c.paymentMethod.Delete(&method, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePaymentMethod] failed delete payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed delete payment method", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePaymentMethod{
+		ID: id,
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// handleGetAllPaymentMethods returns the catalogue, with ?amount= only the
+// methods available for the amount are returned together with their fee
+func (c *Controller) handleGetAllPaymentMethods(w http.ResponseWriter, r *http.Request) {
+	var (
+		methods payment_method.PaymentMethods
+		amount  float64
+		err     error
+		_amount = r.URL.Query().Get("amount")
+	)
+
+	if _amount != "" {
+		amount, err = strconv.ParseFloat(_amount, 64)
+		if err != nil {
+			c.reporter.Errorf("[handleGetAllPaymentMethods] invalid parameter, err: %s", err.Error())
+			view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+			return
+		}
+		methods, err = c.paymentMethod.SelectAvailable(c.projectID, amount)
+	} else {
+		methods, err = c.paymentMethod.Select(c.projectID)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetAllPaymentMethods] failed get all payment methods, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get all payment methods", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponsePaymentMethod, 0, len(methods))
+	for _, method := range methods {
+		var fee *float64
+		if _amount != "" {
+			f := method.Fee(amount)
+			fee = &f
+		}
+
+		res = append(res, view.DataResponsePaymentMethod{
+			ID:         method.ID,
+			Type:       "paymentMethod",
+			Attributes: mappingPaymentMethodAttributes(method, fee),
+		})
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetPaymentMethodByID(w http.ResponseWriter, r *http.Request) {
+	var (
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleGetPaymentMethodByID] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	method, err := c.paymentMethod.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetPaymentMethodByID] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetPaymentMethodByID] Failed get payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get payment method", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePaymentMethod{
+		ID:         method.ID,
+		Type:       "paymentMethod",
+		Attributes: mappingPaymentMethodAttributes(method, nil),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func mappingPaymentMethodAttributes(method payment_method.PaymentMethod, fee *float64) view.PaymentMethodAttributes {
+	return view.PaymentMethodAttributes{
+		Name:            method.Name,
+		Category:        method.Category,
+		GatewayMethodID: method.GatewayMethodID,
+		FixedFee:        method.FixedFee,
+		PercentageFee:   method.PercentageFee,
+		MinAmount:       method.MinAmount,
+		MaxAmount:       method.MaxAmount,
+		Fee:             fee,
+		Status:          method.Status,
+		CreatedAt:       method.CreatedAt,
+		CreatedBy:       method.CreatedBy,
+		UpdatedAt:       method.UpdatedAt,
+		LastUpdateBy:    method.LastUpdateBy,
+		DeletedAt:       method.DeletedAt,
+		ProjectID:       method.ProjectID,
+	}
+}
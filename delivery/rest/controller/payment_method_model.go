@@ -0,0 +1,16 @@
+package controller
+
+type reqPaymentMethod struct {
+	Name            string  `json:"name" validate:"required"`
+	Category        string  `json:"category" validate:"required"`
+	GatewayMethodID int64   `json:"gatewayMethodID" validate:"required"`
+	FixedFee        float64 `json:"fixedFee"`
+	PercentageFee   float64 `json:"percentageFee"`
+	MinAmount       float64 `json:"minAmount"`
+	MaxAmount       float64 `json:"maxAmount"`
+	UserID          string  `json:"userID" validate:"required"`
+}
+
+type reqDeletePaymentMethod struct {
+	UserID string `json:"userID"`
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment"
+	"git.sstv.io/lib/go/gojunkyard.git/reporter"
+)
+
+const testCallbackSecret = "callback-secret"
+
+// testReporter logs what the handlers report
+type testReporter struct {
+	reporter.Reporter
+	t *testing.T
+}
+
+func (r testReporter) Errorf(format string, args ...interface{})   { r.t.Logf(format, args...) }
+func (r testReporter) Warningf(format string, args ...interface{}) { r.t.Logf(format, args...) }
+func (r testReporter) Infof(format string, args ...interface{})    { r.t.Logf(format, args...) }
+
+// testOrders keeps orders in memory, only the methods used by the callback
+// handler are implemented
+type testOrders struct {
+	order.ICore
+
+	mux     sync.Mutex
+	orders  map[int64]order.Order
+	updates int
+}
+
+func (o *testOrders) Get(id int64, pid int64, uid string) (order.Order, error) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	current, ok := o.orders[id]
+	if !ok {
+		return current, sql.ErrNoRows
+	}
+	return current, nil
+}
+
+func (o *testOrders) UpdateOrderStatus(updated *order.Order, reason string, isAdmin bool, requestID string) error {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	current := o.orders[updated.OrderID]
+	if !order.CanTransition(current.Status, updated.Status) {
+		return order.ErrInvalidTransition
+	}
+	current.Status = updated.Status
+	o.orders[updated.OrderID] = current
+	o.updates++
+	return nil
+}
+
+func (o *testOrders) status(id int64) int16 {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	return o.orders[id].Status
+}
+
+// newCallbackTest returns a fake gateway sending its callbacks to the callback
+// handler, with order 42 of 100000 and payment fee 5000 pending at the gateway
+func newCallbackTest(t *testing.T) (*payment.FakeGateway, *testOrders, func()) {
+	orders := &testOrders{orders: map[int64]order.Order{
+		42: {OrderID: 42, ProjectID: 1, Status: order.StatusPending, TotalPrice: 100000, PaymentFee: 5000},
+	}}
+	c := &Controller{
+		reporter:  testReporter{t: t},
+		projectID: 1,
+		payment:   payment.Init("", testCallbackSecret, nil),
+		order:     orders,
+	}
+	server := httptest.NewServer(http.HandlerFunc(c.handlePaymentCallback))
+
+	gateway := payment.NewFakeGateway(testCallbackSecret, server.URL)
+	w := httptest.NewRecorder()
+	gateway.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/dopay_molanobar", strings.NewReader(`{"id":"42","payment_method_id":1}`)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("dopay status = %d, want %d", w.Code, http.StatusOK)
+	}
+	return gateway, orders, server.Close
+}
+
+func TestPaymentCallbackInvalidSignature(t *testing.T) {
+	gateway, orders, stop := newCallbackTest(t)
+	defer stop()
+
+	body, _ := json.Marshal(payment.Callback{Reference: "42", TransactionID: "FAKE-1", Status: payment.StatusPaid, Amount: 105000})
+	request, _ := http.NewRequest(http.MethodPost, gateway.CallbackURL, bytes.NewBuffer(body))
+	request.Header.Set(payment.SignatureHeader, payment.Sign("other-secret", body))
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("callback err: %s", err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", response.StatusCode, http.StatusUnauthorized)
+	}
+	if status := orders.status(42); status != order.StatusPending {
+		t.Errorf("order status = %s, want pending", order.StatusName(status))
+	}
+}
+
+func TestPaymentCallbackAmountMismatch(t *testing.T) {
+	gateway, orders, stop := newCallbackTest(t)
+	defer stop()
+
+	err := gateway.Notify("42", payment.StatusPaid, 100000)
+	if err == nil || !strings.Contains(err.Error(), "409") {
+		t.Errorf("Notify() err = %v, want status 409", err)
+	}
+	if status := orders.status(42); status != order.StatusPending {
+		t.Errorf("order status = %s, want pending", order.StatusName(status))
+	}
+}
+
+func TestPaymentCallbackRedelivery(t *testing.T) {
+	gateway, orders, stop := newCallbackTest(t)
+	defer stop()
+
+	for i := 0; i < 2; i++ {
+		err := gateway.Notify("42", payment.StatusPaid, 105000)
+		if err != nil {
+			t.Fatalf("Notify() delivery %d err: %s", i+1, err)
+		}
+	}
+	if status := orders.status(42); status != order.StatusPaid {
+		t.Errorf("order status = %s, want paid", order.StatusName(status))
+	}
+	if orders.updates != 1 {
+		t.Errorf("order updated %d times, want 1", orders.updates)
+	}
+}
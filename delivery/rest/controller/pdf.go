@@ -2,158 +2,159 @@ package controller
 
 import (
 	"bytes"
-	"database/sql"
-	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
 
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/document"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_detail"
-	wkhtmltopdf "github.com/SebastiaanKlippert/go-wkhtmltopdf"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/tax"
 	"github.com/leekchan/accounting"
 )
 
-/*
-return 0 to failed get Data
-return 1 to failed get template
-*/
-
-func (c *Controller) handleBasePdf(templateData map[string]interface{}, tmp string, nameFile string, orientation string) string {
-	t, err := c.template.Get(tmp)
-	if err != nil {
-		return "1"
-	}
-
-	buff := bytes.NewBuffer([]byte{})
-	err = t.Execute(buff, templateData)
-	if err != nil {
-		c.reporter.Errorf("[handlePDF] Failed execute pdf, err: %s", err.Error())
-		return "1"
-	}
-
-	pdfBuffer := bytes.NewBuffer([]byte{})
-	gen, err := wkhtmltopdf.NewPDFGenerator()
-	if err != nil {
-		c.reporter.Errorf("[handlePDF] Failed generate pdf, err: %s", err.Error())
-		return "1"
-	}
-
-	if orientation == "Landscape" {
-		gen.Orientation.Set(wkhtmltopdf.OrientationLandscape)
-		gen.MarginBottom.Set(0)
-		gen.MarginTop.Set(0)
-		gen.MarginLeft.Set(0)
-		gen.MarginRight.Set(0)
-	}
-	gen.SetOutput(pdfBuffer)
-	gen.AddPage(wkhtmltopdf.NewPageReader(buff))
-	gen.Create()
-
-	b := pdfBuffer.Bytes()
-	b64Pdf := base64.StdEncoding.EncodeToString(b)
-
-	return b64Pdf
-}
-
-func (c *Controller) handleGetDataInvoice(id int64, userID string) (string, order_detail.DataDetails) {
+// invoiceDocument returns the invoice of the order and its details
+func (c *Controller) invoiceDocument(id int64, userID string) (document.Invoice, order_detail.DataDetails, error) {
 	var (
-		t           = "pdf_invoice.tmpl"
-		pdf         = "invoice.pdf"
+		invoice     document.Invoice
+		dataDetail  = order_detail.DataDetails{}
 		compAddress = ""
 	)
-	var dataDetail = order_detail.DataDetails{}
 	order, err := c.order.Get(id, c.projectID, userID)
-
-	if err == sql.ErrNoRows {
-		c.reporter.Warningf("[handlePatchPDF] order not found, err: %s", err.Error())
-		return "0", dataDetail
-	}
-	if err != nil && err != sql.ErrNoRows {
-		c.reporter.Errorf("[handlePatchPDF] Failed get order, err: %s", err.Error())
-		return "0", dataDetail
+	if err != nil {
+		return invoice, dataDetail, fmt.Errorf("failed get order %d: %s", id, err.Error())
 	}
 
 	dataDetail, err = c.orderDetail.GetDetailByOrderID(id, c.projectID, userID)
-	if err == sql.ErrNoRows {
-		c.reporter.Warningf("[handlePatchPDF] orderDetail not found, err: %s", err.Error())
-		return "0", dataDetail
+	if err != nil {
+		return invoice, dataDetail, fmt.Errorf("failed get details of order %d: %s", id, err.Error())
 	}
-
-	base := c.email.GetPic()
-	if err == sql.ErrNoRows {
-		c.reporter.Warningf("[handlePatchPDF] orderDetail not found, err: %s", err.Error())
-		return "0", dataDetail
+	if len(dataDetail) == 0 {
+		return invoice, dataDetail, fmt.Errorf("order %d has no details", id)
 	}
 
 	ac := accounting.Accounting{Precision: 2, Thousand: ".", Decimal: ","}
 
-	items := make([]map[string]interface{}, 0, len(dataDetail))
+	// items of a cart order spanning several venues are prefixed with their venue
+	venueName, venueAddress := dataDetail[0].VenueName, dataDetail[0].Address
+	var venueNames []string
+	seen := make(map[int64]bool)
+	for _, v := range dataDetail {
+		if !seen[v.VenueID] {
+			seen[v.VenueID] = true
+			venueNames = append(venueNames, v.VenueName)
+		}
+	}
+	multiVenue := len(venueNames) > 1
+	if multiVenue {
+		venueName, venueAddress = strings.Join(venueNames, ", "), ""
+	}
+
+	items := make([]document.InvoiceItem, 0, len(dataDetail))
 	for _, v := range dataDetail {
 		typePrice := v.Quantity * int64(v.Amount)
-		items = append(items, map[string]interface{}{
-			"Quantity":     v.Quantity,
-			"ProductName":  v.Description,
-			"ProductPrice": ac.FormatMoney(v.Amount),
-			"TotalPrice":   ac.FormatMoney(typePrice),
+		description := v.Description
+		if multiVenue {
+			description = v.VenueName + " - " + description
+		}
+		items = append(items, document.InvoiceItem{
+			Quantity:    v.Quantity,
+			Description: description,
+			Price:       ac.FormatMoney(v.Amount),
+			Total:       ac.FormatMoney(typePrice),
 		})
 	}
 
 	compAddress = dataDetail[0].CompanyAddress + ", " + dataDetail[0].CompanyCity + ", " + dataDetail[0].CompanyProvince + " " + dataDetail[0].CompanyZip
 
-	templateData := map[string]interface{}{
-		"CreatedAt":         order.CreatedAt.Format("2006-01-02"),
-		"OrderNumber":       order.OrderID,
-		"CustomerReference": "",
-		"BuyerName":         dataDetail[0].CompanyName,
-		"BuyerAddress":      compAddress,
-		"Items":             items,
-		"Total":             ac.FormatMoney(dataDetail[0].TotalPrice),
-		"BalanceDue":        ac.FormatMoney(dataDetail[0].TotalPrice),
-		"Logo":              base,
+	// orders priced before tax rates were configured are untaxed, their
+	// whole total is the tax base
+	var taxRate, taxBase, taxAmount float64
+	taxed := false
+	for _, v := range dataDetail {
+		if v.TaxRateID.Valid {
+			taxed = true
+			taxRate = v.TaxRate
+			taxBase += v.TaxBase
+			taxAmount += v.TaxAmount
+		}
+	}
+	if !taxed {
+		taxBase = dataDetail[0].TotalPrice
 	}
 
-	b64InvoicePdf := c.handleBasePdf(templateData, t, pdf, "Potrait")
+	npwp := ""
+	if dataDetail[0].CompanyNpwp != "" {
+		npwp = tax.FormatNpwp(dataDetail[0].CompanyNpwp)
+	}
 
-	return b64InvoicePdf, dataDetail
+	invoice = document.Invoice{
+		Date:         order.CreatedAt.Format("2006-01-02"),
+		Number:       strconv.FormatInt(order.OrderID, 10),
+		BuyerName:    dataDetail[0].CompanyName,
+		BuyerAddress: compAddress,
+		BuyerNpwp:    npwp,
+		VenueName:    venueName,
+		VenueAddress: venueAddress,
+		Items:        items,
+		TaxRate:      strconv.FormatFloat(taxRate, 'f', -1, 64) + "%",
+		TaxBase:      ac.FormatMoney(taxBase),
+		TaxAmount:    ac.FormatMoney(taxAmount),
+		Total:        ac.FormatMoney(dataDetail[0].TotalPrice),
+		BalanceDue:   ac.FormatMoney(dataDetail[0].TotalPrice),
+		Logo:         c.email.GetPic(),
+		Locale:       dataDetail[0].CompanyLocale,
+	}
+	return invoice, dataDetail, nil
 }
 
-func (c *Controller) handleGetDataSertificate(venueid int64, userID string) (string, order.SummaryVenue, string) {
-	var sumvenue order.SummaryVenue
-
-	t := "pdf_sertificate.tmpl"
-	pdf := "sertificate.pdf"
+// certificateDocument returns the e-certificate of the venue license
+func (c *Controller) certificateDocument(venueid int64, userID string) (document.Certificate, order.SummaryVenue, error) {
+	var certificate document.Certificate
 
 	sumvenue, err := c.order.GetSummaryVenueByVenueID(venueid, c.projectID, userID)
 	if err != nil {
-		c.reporter.Errorf("[handleSertificatePDF] sum order not found, err: %s", err.Error())
-		return "0", sumvenue, "0"
+		return certificate, sumvenue, fmt.Errorf("failed get summary of venue %d: %s", venueid, err.Error())
 	}
 	if sumvenue.LicenseNumber == "" {
-		c.reporter.Errorf("[handleSertificatePDF] License number not found, err: %s", err.Error())
-		return "0", sumvenue, "0"
+		return certificate, sumvenue, fmt.Errorf("venue %d has no license", venueid)
 	}
 
-	b64Png, backBase64 := c.email.GetBase64Png(sumvenue.LicenseNumber)
-	if b64Png == "0" && backBase64 == "0" {
-		c.reporter.Errorf("[handleSertificatePDF] Error base64 from image")
-		return "0", sumvenue, "0"
+	// without signing key the QR code holds the bare license number
+	licenseToken := sumvenue.LicenseNumber
+	if c.licenseToken.Enabled() {
+		licenseToken, err = c.licenseToken.Sign(sumvenue.LicenseNumber, sumvenue.VenueID, sumvenue.LicenseExpiredDate.Time)
+		if err != nil {
+			return certificate, sumvenue, fmt.Errorf("failed sign license token: %s", err.Error())
+		}
 	}
 
-	templateData := map[string]interface{}{
-		"VenueName":  strings.ToUpper(sumvenue.VenueName),
-		"Name":       strings.Title(sumvenue.VenueName),
-		"Address":    sumvenue.VenueAddress,
-		"Zip":        sumvenue.VenueZip,
-		"City":       sumvenue.VenueCity,
-		"Province":   sumvenue.VenueProvince,
-		"QrBase64":   b64Png,
-		"Background": backBase64,
+	b64Png, backBase64 := c.email.GetBase64Png(licenseToken)
+	if b64Png == "0" {
+		return certificate, sumvenue, errors.New("failed generate license qr code")
+	}
+	if backBase64 == "0" {
+		return certificate, sumvenue, errors.New("failed read certificate background")
 	}
-	b64SertificatePdf := c.handleBasePdf(templateData, t, pdf, "Landscape")
-	return b64SertificatePdf, sumvenue, b64Png
 
+	certificate = document.Certificate{
+		VenueName:     sumvenue.VenueName,
+		Address:       sumvenue.VenueAddress,
+		Zip:           sumvenue.VenueZip,
+		City:          sumvenue.VenueCity,
+		Province:      sumvenue.VenueProvince,
+		LicenseNumber: sumvenue.LicenseNumber,
+		VenueID:       sumvenue.VenueID,
+		ExpiredDate:   sumvenue.LicenseExpiredDate.Time,
+		QRCode:        b64Png,
+		Background:    backBase64,
+		Locale:        sumvenue.CompanyLocale,
+	}
+	return certificate, sumvenue, nil
 }
 
-func (c *Controller) handleGetHtmlBodyCert(venueName string, venueAddress string) string {
+func (c *Controller) handleGetHtmlBodyCert(venueName string, venueAddress string, locale string) (string, error) {
 
 	// file, err := os.Open("file/img_email_cert/artboard-background.png")
 	// if err != nil {
@@ -305,38 +306,58 @@ func (c *Controller) handleGetHtmlBodyCert(venueName string, venueAddress string
 		// "Artboardcombinedshape622x": artboardCombinedShape62,
 	}
 
-	t, err := c.template.Get("email_sertificate.tmpl")
+	t, err := c.template.GetLocale("email_sertificate.tmpl", templateLocale(locale))
 	if err != nil {
-		return "1"
+		return "", err
 	}
 
 	buff := bytes.NewBuffer([]byte{})
 	err = t.Execute(buff, templateData)
 	if err != nil {
-		c.reporter.Errorf("[handleGetHtmlBodyCert] Failed execute html, err: %s", err.Error())
-		return "1"
+		return "", fmt.Errorf("failed execute email_sertificate.tmpl: %s", err.Error())
 	}
-	return buff.String()
+	return buff.String(), nil
 
 }
 
-func (c *Controller) handleGetHtmlBodyInvoice(venueName string, venueAddress string) string {
+func (c *Controller) handleGetHtmlBodyInvoice(venueName string, venueAddress string, locale string) (string, error) {
 
 	templateData := map[string]interface{}{
 		"VenueName":    venueName,
 		"VenueAddress": venueAddress,
 	}
 
-	t, err := c.template.Get("email_invoice.tmpl")
+	t, err := c.template.GetLocale("email_invoice.tmpl", templateLocale(locale))
+	if err != nil {
+		return "", err
+	}
+
+	buff := bytes.NewBuffer([]byte{})
+	err = t.Execute(buff, templateData)
+	if err != nil {
+		return "", fmt.Errorf("failed execute email_invoice.tmpl: %s", err.Error())
+	}
+	return buff.String(), nil
+}
+
+// handleGetHtmlBodyQuotation renders the body of the quotation email
+func (c *Controller) handleGetHtmlBodyQuotation(quotation document.Quotation) (string, error) {
+	templateData := map[string]interface{}{
+		"VenueName":       quotation.VenueName,
+		"VenueAddress":    quotation.VenueAddress,
+		"QuotationNumber": quotation.Number,
+		"ValidUntil":      quotation.ValidUntil,
+	}
+
+	t, err := c.template.GetLocale("email_quotation.tmpl", templateLocale(quotation.Locale))
 	if err != nil {
-		return "1"
+		return "", err
 	}
 
 	buff := bytes.NewBuffer([]byte{})
 	err = t.Execute(buff, templateData)
 	if err != nil {
-		c.reporter.Errorf("[handleGetHtmlBodyCert] Failed execute html, err: %s", err.Error())
-		return "1"
+		return "", fmt.Errorf("failed execute email_quotation.tmpl: %s", err.Error())
 	}
-	return buff.String()
+	return buff.String(), nil
 }
@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+	"git.sstv.io/lib/go/gojunkyard.git/form"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+	"gopkg.in/guregu/null.v3"
+)
+
+func (c *Controller) handlePostPricingRule(w http.ResponseWriter, r *http.Request) {
+	var params reqPricingRule
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostPricingRule] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	if params.VenueTypeID != nil {
+		_, err = c.venueType.Get(c.projectID, *params.VenueTypeID)
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handlePostPricingRule] Venue Type Not Found, err: %s", err.Error())
+			view.RenderJSONError(w, "Venue Type Not Found", http.StatusNotFound)
+			return
+		}
+	}
+
+	rule := pricing.PricingRule{
+		Name:            params.Name,
+		VenueTypeID:     params.VenueTypeID,
+		PricingGroupID:  params.PricingGroupID,
+		ItemType:        params.ItemType,
+		OrderType:       params.OrderType,
+		RuleType:        params.RuleType,
+		Price:           null.FloatFromPtr(params.Price),
+		OccupancyFactor: params.OccupancyFactor,
+		Tiers:           params.Tiers,
+		CreatedBy:       params.UserID,
+		LastUpdateBy:    params.UserID,
+		ProjectID:       c.projectID,
+	}
+
+	err = rule.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePostPricingRule] invalid pricing rule, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.pricing.Insert(&rule, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostPricingRule] failed post pricing rule, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post pricing rule", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePricingRule{
+		ID:         rule.ID,
+		Type:       "pricingRule",
+		Attributes: mappingPricingRuleAttributes(rule),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handlePatchPricingRule(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqPricingRule
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPricingRule] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPricingRule] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	getRule, err := c.pricing.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchPricingRule] Pricing Rule Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Pricing Rule Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchPricingRule] Failed get pricing rule, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get pricing rule", http.StatusInternalServerError)
+		return
+	}
+
+	if params.VenueTypeID != nil {
+		_, err = c.venueType.Get(c.projectID, *params.VenueTypeID)
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handlePatchPricingRule] Venue Type Not Found, err: %s", err.Error())
+			view.RenderJSONError(w, "Venue Type Not Found", http.StatusNotFound)
+			return
+		}
+	}
+
+	rule := pricing.PricingRule{
+		ID:              id,
+		Name:            params.Name,
+		VenueTypeID:     params.VenueTypeID,
+		PricingGroupID:  params.PricingGroupID,
+		ItemType:        params.ItemType,
+		OrderType:       params.OrderType,
+		RuleType:        params.RuleType,
+		Price:           null.FloatFromPtr(params.Price),
+		OccupancyFactor: params.OccupancyFactor,
+		Tiers:           params.Tiers,
+		Status:          getRule.Status,
+		CreatedAt:       getRule.CreatedAt,
+		CreatedBy:       getRule.CreatedBy,
+		LastUpdateBy:    params.UserID,
+		DeletedAt:       getRule.DeletedAt,
+		ProjectID:       c.projectID,
+	}
+
+	err = rule.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPricingRule] invalid pricing rule, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.pricing.Update(&rule, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPricingRule] failed update pricing rule, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed update pricing rule", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePricingRule{
+		ID:         rule.ID,
+		Type:       "pricingRule",
+		Attributes: mappingPricingRuleAttributes(rule),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleDeletePricingRule(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqDeletePricingRule
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePricingRule] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePricingRule] user id not found, err: %s", err.Error())
+		view.RenderJSONError(w, "User ID not found", http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.pricing.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleDeletePricingRule] Pricing Rule Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Pricing Rule Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleDeletePricingRule] Failed get pricing rule, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get pricing rule", http.StatusInternalServerError)
+		return
+	}
+
+	rule := pricing.PricingRule{
+		ID:           id,
+		LastUpdateBy: params.UserID,
+		ProjectID:    c.projectID,
+	}
+
+	err = c.pricing.Delete(&rule, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePricingRule] failed delete pricing rule, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed delete pricing rule", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePricingRule{
+		ID: id,
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetAllPricingRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := c.pricing.Select(c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetAllPricingRules] failed get all pricing rules, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get all pricing rules", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponsePricingRule, 0, len(rules))
+	for _, rule := range rules {
+		res = append(res, view.DataResponsePricingRule{
+			ID:         rule.ID,
+			Type:       "pricingRule",
+			Attributes: mappingPricingRuleAttributes(rule),
+		})
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetPricingRuleByID(w http.ResponseWriter, r *http.Request) {
+	var (
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleGetPricingRuleByID] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := c.pricing.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetPricingRuleByID] Pricing Rule Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Pricing Rule Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetPricingRuleByID] Failed get pricing rule, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get pricing rule", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePricingRule{
+		ID:         rule.ID,
+		Type:       "pricingRule",
+		Attributes: mappingPricingRuleAttributes(rule),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func mappingPricingRuleAttributes(rule pricing.PricingRule) view.PricingRuleAttributes {
+	return view.PricingRuleAttributes{
+		Name:            rule.Name,
+		VenueTypeID:     rule.VenueTypeID,
+		PricingGroupID:  rule.PricingGroupID,
+		ItemType:        rule.ItemType,
+		OrderType:       rule.OrderType,
+		RuleType:        rule.RuleType,
+		Price:           rule.Price,
+		OccupancyFactor: rule.OccupancyFactor,
+		Tiers:           rule.Tiers,
+		Status:          rule.Status,
+		CreatedAt:       rule.CreatedAt,
+		CreatedBy:       rule.CreatedBy,
+		UpdatedAt:       rule.UpdatedAt,
+		LastUpdateBy:    rule.LastUpdateBy,
+		DeletedAt:       rule.DeletedAt,
+		ProjectID:       rule.ProjectID,
+	}
+}
+
+func mappingPriceDetails(breakdown pricing.Breakdown) []view.PriceDetailAttributes {
+	details := make([]view.PriceDetailAttributes, 0, len(breakdown.Lines))
+	for _, line := range breakdown.Lines {
+		details = append(details, view.PriceDetailAttributes{
+			ItemType:    line.ItemType,
+			ItemID:      line.ItemID,
+			Description: line.Description,
+			RuleID:      line.RuleID,
+			RuleType:    line.RuleType,
+			UnitPrice:   line.UnitPrice,
+			Quantity:    line.Quantity,
+			Amount:      line.Amount,
+			TaxRate:     line.TaxRate,
+			TaxBase:     line.TaxBase,
+			TaxAmount:   line.TaxAmount,
+		})
+	}
+	return details
+}
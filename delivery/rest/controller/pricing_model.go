@@ -0,0 +1,20 @@
+package controller
+
+import "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+
+type reqPricingRule struct {
+	Name            string        `json:"name" validate:"required"`
+	VenueTypeID     *int64        `json:"venueTypeID"`
+	PricingGroupID  *int64        `json:"pricingGroupID"`
+	ItemType        string        `json:"itemType" validate:"required"`
+	OrderType       string        `json:"orderType"`
+	RuleType        string        `json:"ruleType" validate:"required"`
+	Price           *float64      `json:"price"`
+	OccupancyFactor float64       `json:"occupancyFactor"`
+	Tiers           pricing.Tiers `json:"tiers"`
+	UserID          string        `json:"userID" validate:"required"`
+}
+
+type reqDeletePricingRule struct {
+	UserID string `json:"userID"`
+}
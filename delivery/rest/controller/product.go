@@ -136,7 +136,7 @@ func (c *Controller) handleDeleteProduct(w http.ResponseWriter, r *http.Request)
 		userID = params.UserID
 		isAdmin = true
 	}
-	err = c.product.Delete(c.projectID, id, venueTypeID, isAdmin, userID.(string))
+	err = c.product.Delete(c.projectID, id, venueTypeID, isAdmin, userID.(string), getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteProduct] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete product", http.StatusInternalServerError)
@@ -187,7 +187,7 @@ func (c *Controller) handlePostProduct(w http.ResponseWriter, r *http.Request) {
 		CreatedBy:    uid,
 	}
 
-	err = c.product.Insert(&product)
+	err = c.product.Insert(&product, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostProduct] error insert product repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post product", http.StatusInternalServerError)
@@ -261,7 +261,7 @@ func (c *Controller) handlePatchProduct(w http.ResponseWriter, r *http.Request)
 		LastUpdateBy: userID.(string),
 	}
 	venueTypeID, err := strconv.ParseInt(productParam.VenueTypeID, 10, 64)
-	err = c.product.Update(&product, venueTypeID, isAdmin)
+	err = c.product.Update(&product, venueTypeID, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchProduct] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update product", http.StatusInternalServerError)
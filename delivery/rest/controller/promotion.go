@@ -0,0 +1,495 @@
+package controller
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/promotion"
+	"git.sstv.io/lib/go/gojunkyard.git/form"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+	"gopkg.in/guregu/null.v3"
+)
+
+func (c *Controller) handlePostPromotion(w http.ResponseWriter, r *http.Request) {
+	var params reqPromotion
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostPromotion] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	p := c.mappingPromotion(params)
+	p.CreatedBy = params.UserID
+
+	err = p.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePostPromotion] invalid promotion, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.checkPromotionCode(p)
+	if err == promotion.ErrCodeExists {
+		c.reporter.Errorf("[handlePostPromotion] duplicate code %s", p.Code.String)
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostPromotion] failed check promotion code, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post promotion", http.StatusInternalServerError)
+		return
+	}
+
+	err = c.promotion.Insert(&p, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostPromotion] failed post promotion, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post promotion", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePromotion{
+		ID:         p.ID,
+		Type:       "promotion",
+		Attributes: mappingPromotionAttributes(p),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handlePatchPromotion(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqPromotion
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPromotion] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPromotion] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	getPromotion, err := c.promotion.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchPromotion] Promotion Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Promotion Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPromotion] Failed get promotion, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get promotion", http.StatusInternalServerError)
+		return
+	}
+
+	p := c.mappingPromotion(params)
+	p.ID = id
+	p.Status = getPromotion.Status
+	p.CreatedAt = getPromotion.CreatedAt
+	p.CreatedBy = getPromotion.CreatedBy
+	p.DeletedAt = getPromotion.DeletedAt
+
+	err = p.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPromotion] invalid promotion, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.checkPromotionCode(p)
+	if err == promotion.ErrCodeExists {
+		c.reporter.Errorf("[handlePatchPromotion] duplicate code %s", p.Code.String)
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPromotion] failed check promotion code, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed update promotion", http.StatusInternalServerError)
+		return
+	}
+
+	err = c.promotion.Update(&p, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePatchPromotion] failed update promotion, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed update promotion", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePromotion{
+		ID:         p.ID,
+		Type:       "promotion",
+		Attributes: mappingPromotionAttributes(p),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleDeletePromotion(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqDeletePromotion
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePromotion] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePromotion] user id not found, err: %s", err.Error())
+		view.RenderJSONError(w, "User ID not found", http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.promotion.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleDeletePromotion] Promotion Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Promotion Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePromotion] Failed get promotion, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get promotion", http.StatusInternalServerError)
+		return
+	}
+
+	p := promotion.Promotion{
+		ID:           id,
+		LastUpdateBy: params.UserID,
+		ProjectID:    c.projectID,
+	}
+
+	err = c.promotion.Delete(&p, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handleDeletePromotion] failed delete promotion, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed delete promotion", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePromotion{
+		ID: id,
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetAllPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := c.promotion.Select(c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetAllPromotions] failed get all promotions, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get all promotions", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponsePromotion, 0, len(promotions))
+	for _, p := range promotions {
+		res = append(res, view.DataResponsePromotion{
+			ID:         p.ID,
+			Type:       "promotion",
+			Attributes: mappingPromotionAttributes(p),
+		})
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetPromotionByID(w http.ResponseWriter, r *http.Request) {
+	var (
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleGetPromotionByID] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	p, err := c.promotion.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetPromotionByID] Promotion Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Promotion Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handleGetPromotionByID] Failed get promotion, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get promotion", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponsePromotion{
+		ID:         p.ID,
+		Type:       "promotion",
+		Attributes: mappingPromotionAttributes(p),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// handleGetPromotionsReport sums the discounts given per campaign on orders
+// created from the date from until the date to
+func (c *Controller) handleGetPromotionsReport(w http.ResponseWriter, r *http.Request) {
+	getParam := r.URL.Query()
+
+	from, err := time.ParseInLocation("2006-01-02", getParam.Get("from"), time.Local)
+	if err != nil {
+		c.reporter.Warningf("[handleGetPromotionsReport] invalid from date, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter from", http.StatusBadRequest)
+		return
+	}
+	to, err := time.ParseInLocation("2006-01-02", getParam.Get("to"), time.Local)
+	if err != nil || to.Before(from) {
+		c.reporter.Warningf("[handleGetPromotionsReport] invalid to date %s", getParam.Get("to"))
+		view.RenderJSONError(w, "Invalid parameter to", http.StatusBadRequest)
+		return
+	}
+
+	reports, err := c.promotion.Report(c.projectID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		c.reporter.Errorf("[handleGetPromotionsReport] failed get promotions report, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get promotions report", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponsePromotion, 0, len(reports))
+	for _, report := range reports {
+		res = append(res, view.DataResponsePromotion{
+			ID:   report.Campaign,
+			Type: "promotionCampaign",
+			Attributes: view.PromotionCampaignAttributes{
+				Campaign:     report.Campaign,
+				Promotions:   report.Promotions,
+				Orders:       report.Orders,
+				Discount:     report.Discount,
+				PaidOrders:   report.PaidOrders,
+				PaidDiscount: report.PaidDiscount,
+				PaidRevenue:  report.PaidRevenue,
+			},
+		})
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// checkPromotionCode returns promotion.ErrCodeExists when another live
+// promotion has the voucher code of p
+func (c *Controller) checkPromotionCode(p promotion.Promotion) error {
+	if !p.Code.Valid {
+		return nil
+	}
+
+	other, err := c.promotion.GetByCode(c.projectID, p.Code.String)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if other.ID != p.ID {
+		return promotion.ErrCodeExists
+	}
+	return nil
+}
+
+// orderPromotion is who a price is calculated for and the voucher code
+// entered. OrderID is set when an existing order is priced again so its own
+// usages do not count against the limits. Cart is set when the venues of a
+// cart are priced one by one, the voucher is skipped on venues it is not
+// eligible for instead of failing and is given once for the whole cart
+type orderPromotion struct {
+	BuyerID string
+	Code    string
+	OrderID int64
+	Cart    *cartVoucher
+}
+
+// cartVoucher is the discount the voucher of a cart gave on the venues priced
+// so far. Its fixed amount, or the maximum discount of a percentage, is
+// spread over the venues in cart order until it is used up
+type cartVoucher struct {
+	given float64
+}
+
+// limit lowers the amount or maximum discount of voucher by what was given,
+// ok is false once it is used up
+func (cart *cartVoucher) limit(voucher promotion.Promotion) (limited promotion.Promotion, ok bool) {
+	switch {
+	case voucher.DiscountType == promotion.DiscountFixed:
+		voucher.DiscountValue -= cart.given
+		return voucher, voucher.DiscountValue > 0
+	case voucher.MaxDiscount.Valid:
+		voucher.MaxDiscount.Float64 -= cart.given
+		return voucher, voucher.MaxDiscount.Float64 > 0
+	}
+	return voucher, true
+}
+
+// applyPromotions adds the discount lines of the automatic promotions the
+// order is eligible for and of the voucher code to breakdown, before tax
+func (c *Controller) applyPromotions(breakdown *pricing.Breakdown, target promotion.Target, promo orderPromotion) error {
+	promotions, err := c.promotion.Select(c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	var (
+		applied   promotion.Promotions
+		voucherID int64
+	)
+	for _, p := range promotions {
+		if p.Code.Valid || !p.Eligible(target) {
+			continue
+		}
+		count, err := c.promotion.Count(c.projectID, p.ID, promo.BuyerID, promo.OrderID)
+		if err != nil {
+			return err
+		}
+		if p.Allows(count) {
+			applied = append(applied, p)
+		}
+	}
+
+	if promo.Code != "" {
+		voucher, err := c.promotion.GetByCode(c.projectID, promo.Code)
+		if err == sql.ErrNoRows {
+			return promotion.ErrVoucherNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case voucher.Eligible(target):
+			count, err := c.promotion.Count(c.projectID, voucher.ID, promo.BuyerID, promo.OrderID)
+			if err != nil {
+				return err
+			}
+			if !voucher.Allows(count) {
+				return promotion.ErrVoucherUsedUp
+			}
+			if promo.Cart != nil {
+				var ok bool
+				if voucher, ok = promo.Cart.limit(voucher); !ok {
+					break
+				}
+			}
+			applied = append(applied, voucher)
+			voucherID = voucher.ID
+		case promo.Cart == nil:
+			return promotion.ErrVoucherNotEligible
+		}
+	}
+
+	for _, line := range promotion.Apply(applied, breakdown.Lines) {
+		if promo.Cart != nil && line.ItemID == voucherID {
+			promo.Cart.given -= line.Amount
+		}
+		breakdown.Lines = append(breakdown.Lines, line)
+		breakdown.TotalPrice += line.Amount
+	}
+	return nil
+}
+
+// redeemPromotions records the promotions given on the lines of the order,
+// replacing what was recorded before. promotion.ErrUsageLimit is returned
+// when one was used up by another order since the price was calculated
+func (c *Controller) redeemPromotions(o order.Order, lines pricing.Lines) error {
+	var (
+		usages promotion.Usages
+		index  = make(map[int64]int)
+	)
+	for _, line := range lines {
+		if line.ItemType != promotion.ItemTypeDiscount {
+			continue
+		}
+		i, ok := index[line.ItemID]
+		if !ok {
+			i = len(usages)
+			index[line.ItemID] = i
+			usages = append(usages, promotion.Usage{PromotionID: line.ItemID})
+		}
+		usages[i].Amount -= line.Amount
+	}
+
+	return c.promotion.Redeem(c.projectID, o.OrderID, o.BuyerID, usages)
+}
+
+// hasPromotion reports whether one of breakdowns has a discount line of the
+// promotion
+func hasPromotion(breakdowns []pricing.Breakdown, promotionID int64) bool {
+	for _, breakdown := range breakdowns {
+		for _, line := range breakdown.Lines {
+			if line.ItemType == promotion.ItemTypeDiscount && line.ItemID == promotionID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c *Controller) mappingPromotion(params reqPromotion) promotion.Promotion {
+	p := promotion.Promotion{
+		Name:              params.Name,
+		Campaign:          params.Campaign,
+		DiscountType:      params.DiscountType,
+		DiscountValue:     params.DiscountValue,
+		MaxDiscount:       null.FloatFromPtr(params.MaxDiscount),
+		ItemType:          params.ItemType,
+		OrderType:         params.OrderType,
+		VenueTypeIDs:      params.VenueTypeIDs,
+		CommercialTypeIDs: params.CommercialTypeIDs,
+		Cities:            params.Cities,
+		ProductIDs:        params.ProductIDs,
+		UsageLimit:        params.UsageLimit,
+		PerBuyerLimit:     params.PerBuyerLimit,
+		StartAt:           params.StartAt,
+		EndAt:             params.EndAt,
+		LastUpdateBy:      params.UserID,
+		ProjectID:         c.projectID,
+	}
+	if code := promotion.NormalizeCode(params.Code); code != "" {
+		p.Code = null.StringFrom(code)
+	}
+	return p
+}
+
+func mappingPromotionAttributes(p promotion.Promotion) view.PromotionAttributes {
+	return view.PromotionAttributes{
+		Name:              p.Name,
+		Campaign:          p.Campaign,
+		Code:              p.Code,
+		DiscountType:      p.DiscountType,
+		DiscountValue:     p.DiscountValue,
+		MaxDiscount:       p.MaxDiscount,
+		ItemType:          p.ItemType,
+		OrderType:         p.OrderType,
+		VenueTypeIDs:      p.VenueTypeIDs,
+		CommercialTypeIDs: p.CommercialTypeIDs,
+		Cities:            p.Cities,
+		ProductIDs:        p.ProductIDs,
+		UsageLimit:        p.UsageLimit,
+		PerBuyerLimit:     p.PerBuyerLimit,
+		StartAt:           p.StartAt,
+		EndAt:             p.EndAt,
+		Status:            p.Status,
+		CreatedAt:         p.CreatedAt,
+		CreatedBy:         p.CreatedBy,
+		UpdatedAt:         p.UpdatedAt,
+		LastUpdateBy:      p.LastUpdateBy,
+		DeletedAt:         p.DeletedAt,
+		ProjectID:         p.ProjectID,
+	}
+}
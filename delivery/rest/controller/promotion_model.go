@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/promotion"
+)
+
+type reqPromotion struct {
+	Name              string          `json:"name" validate:"required"`
+	Campaign          string          `json:"campaign" validate:"required"`
+	Code              string          `json:"code"`
+	DiscountType      string          `json:"discountType" validate:"required"`
+	DiscountValue     float64         `json:"discountValue"`
+	MaxDiscount       *float64        `json:"maxDiscount"`
+	ItemType          string          `json:"itemType"`
+	OrderType         string          `json:"orderType"`
+	VenueTypeIDs      promotion.IDs   `json:"venueTypeIDs"`
+	CommercialTypeIDs promotion.IDs   `json:"commercialTypeIDs"`
+	Cities            promotion.Names `json:"cities"`
+	ProductIDs        promotion.IDs   `json:"productIDs"`
+	UsageLimit        int64           `json:"usageLimit"`
+	PerBuyerLimit     int64           `json:"perBuyerLimit"`
+	StartAt           time.Time       `json:"startAt"`
+	EndAt             time.Time       `json:"endAt"`
+	UserID            string          `json:"userID" validate:"required"`
+}
+
+type reqDeletePromotion struct {
+	UserID string `json:"userID"`
+}
@@ -0,0 +1,699 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/document"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment_method"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/promotion"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/quotation"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/room"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/sequence"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/venue"
+	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
+	"git.sstv.io/lib/go/gojunkyard.git/form"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+	"github.com/leekchan/accounting"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// handlePostQuotation prices the items like an order and saves the priced
+// lines, so the quotation keeps its prices when the catalogue changes
+func (c *Controller) handlePostQuotation(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqQuotation
+		isAdmin = false
+	)
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostQuotation] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handlePostQuotation] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := user["sub"]
+	if !ok {
+		if params.UserID == "" {
+			c.reporter.Errorf("[handlePostQuotation] invalid parameter, failed get userID")
+			view.RenderJSONError(w, "invalid parameter, failed get userID", http.StatusBadRequest)
+			return
+		}
+		userID = params.UserID
+		isAdmin = true
+	}
+
+	// quotations are valid until the end of validUntil
+	var validUntil time.Time
+	if params.ValidUntil != "" {
+		validUntil, err = time.ParseInLocation("2006-01-02", params.ValidUntil, time.Local)
+		if err != nil {
+			c.reporter.Errorf("[handlePostQuotation] invalid validUntil, err: %s", err.Error())
+			view.RenderJSONError(w, "validUntil must be formatted as yyyy-mm-dd", http.StatusBadRequest)
+			return
+		}
+		validUntil = validUntil.AddDate(0, 0, 1).Add(-time.Second)
+		if validUntil.Before(time.Now()) {
+			c.reporter.Errorf("[handlePostQuotation] validUntil %s has passed", params.ValidUntil)
+			view.RenderJSONError(w, "validUntil has passed", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var venue venue.Venue
+	if isAdmin {
+		venue, err = c.venue.Get(c.projectID, params.VenueID, "")
+	} else {
+		venue, err = c.venue.Get(c.projectID, params.VenueID, userID.(string))
+	}
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostQuotation] Venue Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Venue Not Found", http.StatusNotFound)
+		return
+	}
+
+	device, err := c.device.Get(c.projectID, params.DeviceID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostQuotation] Device Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Device Not Found", http.StatusNotFound)
+		return
+	}
+
+	product, err := c.product.Get(c.projectID, params.ProductID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostQuotation] Product Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Product Not Found", http.StatusNotFound)
+		return
+	}
+
+	installation, err := c.installation.Get(params.InstallationID, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostQuotation] Installation Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Installation Not Found", http.StatusNotFound)
+		return
+	}
+
+	var room room.Room
+	if params.RoomID != 0 && params.RoomQuantity != 0 {
+		room, err = c.room.Get(c.projectID, params.RoomID)
+		if err == sql.ErrNoRows {
+			c.reporter.Errorf("[handlePostQuotation] Room Not Found, err: %s", err.Error())
+			view.RenderJSONError(w, "Room Not Found", http.StatusNotFound)
+			return
+		}
+	}
+
+	aging, err := c.aging.Get(params.AgingID, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostQuotation] Aging Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Aging Not Found", http.StatusNotFound)
+		return
+	}
+
+	validator, err := c.validateOrder(venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+	if err != nil {
+		c.reporter.Errorf("[handlePostQuotation] Failed validate order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed validate order", http.StatusInternalServerError)
+		return
+	}
+	if !validator.IsValid {
+		c.reporter.Errorf("[handlePostQuotation] Quotation not valid, %s does not match order matrix, venueType: %d, capacity: %d, agingID: %d, deviceID: %d, productID: %d, installationID: %d, roomID: %d, roomQuantity: %d",
+			validator.UnmatchedField, venue.VenueType, venue.Capacity, params.AgingID, params.DeviceID, params.ProductID, params.InstallationID, params.RoomID, params.RoomQuantity)
+		view.RenderJSONError(w, fmt.Sprintf("Quotation not valid, %s does not match order matrix", validator.UnmatchedField), http.StatusBadRequest)
+		return
+	}
+
+	breakdown, err := c.calculateOrderPrice(venue, params.RoomQuantity, device, product, installation, room, aging, order.OrderTypeNew, orderPromotion{BuyerID: userID.(string), Code: params.VoucherCode})
+	if err == pricing.ErrRuleNotFound {
+		c.reporter.Errorf("[handlePostQuotation] Pricing rule not found, venueType: %d", venue.VenueType)
+		view.RenderJSONError(w, "Pricing rule not found for venue type", http.StatusBadRequest)
+		return
+	}
+	if promotion.IsVoucherError(err) {
+		c.reporter.Warningf("[handlePostQuotation] Voucher not applied, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostQuotation] Failed calculate price, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed calculate price", http.StatusInternalServerError)
+		return
+	}
+
+	quotationNumber, err := c.sequence.Next(c.projectID, sequence.QuotationNumber)
+	if err != nil {
+		c.reporter.Errorf("[handlePostQuotation] Failed generate quotation number, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate quotation number", http.StatusInternalServerError)
+		return
+	}
+
+	insertQuotation := quotation.Quotation{
+		QuotationNumber: quotationNumber,
+		BuyerID:         userID.(string),
+		VenueID:         params.VenueID,
+		DeviceID:        params.DeviceID,
+		ProductID:       params.ProductID,
+		InstallationID:  params.InstallationID,
+		AgingID:         params.AgingID,
+		RoomID:          params.RoomID,
+		RoomQuantity:    params.RoomQuantity,
+		TotalPrice:      breakdown.TotalPrice,
+		TaxBase:         breakdown.TaxBase,
+		TaxAmount:       breakdown.TaxAmount,
+		Email:           params.Email,
+		ValidUntil:      validUntil,
+		CreatedBy:       userID.(string),
+		LastUpdateBy:    userID.(string),
+		ProjectID:       c.projectID,
+		Items:           quotationItems(breakdown),
+	}
+
+	err = c.quotation.Insert(&insertQuotation, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostQuotation] failed post quotation, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post quotation", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseQuotation{
+		ID:         insertQuotation.ID,
+		Type:       "quotation",
+		Attributes: mappingQuotationAttributes(insertQuotation, true),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetQuotations(w http.ResponseWriter, r *http.Request) {
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handleGetQuotations] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	// admins have no sub and get every quotation
+	userID, _ := user["sub"].(string)
+
+	quotations, err := c.quotation.Select(c.projectID, userID)
+	if err != nil {
+		c.reporter.Errorf("[handleGetQuotations] failed get quotations, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get quotations", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponseQuotation, 0, len(quotations))
+	for _, q := range quotations {
+		res = append(res, view.DataResponseQuotation{
+			ID:         q.ID,
+			Type:       "quotation",
+			Attributes: mappingQuotationAttributes(q, false),
+		})
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetQuotationByID(w http.ResponseWriter, r *http.Request) {
+	q, ok := c.getQuotation(w, r, "handleGetQuotationByID")
+	if !ok {
+		return
+	}
+
+	res := view.DataResponseQuotation{
+		ID:         q.ID,
+		Type:       "quotation",
+		Attributes: mappingQuotationAttributes(q, true),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetQuotationPDF(w http.ResponseWriter, r *http.Request) {
+	q, ok := c.getQuotation(w, r, "handleGetQuotationPDF")
+	if !ok {
+		return
+	}
+
+	doc, _, err := c.quotationDocument(q)
+	if err != nil {
+		c.reporter.Warningf("[handleGetQuotationPDF] %s", err.Error())
+		view.RenderJSONError(w, "Quotation venue not found", http.StatusNotFound)
+		return
+	}
+
+	pdf, err := c.document.Quotation(doc)
+	if err != nil {
+		c.reporter.Errorf("[handleGetQuotationPDF] failed generate quotation, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate quotation", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderPDF(w, pdf, "quotation-"+q.QuotationNumber+".pdf", "attachment", http.StatusOK)
+}
+
+// handlePostQuotationEmail sends the quotation pdf to the email of the
+// quotation, the email is logged like invoices
+func (c *Controller) handlePostQuotationEmail(w http.ResponseWriter, r *http.Request) {
+	q, ok := c.getQuotation(w, r, "handlePostQuotationEmail")
+	if !ok {
+		return
+	}
+	user, _ := authpassport.GetUser(r)
+	userID, _ := user["sub"].(string)
+
+	doc, companyID, err := c.quotationDocument(q)
+	if err != nil {
+		c.reporter.Warningf("[handlePostQuotationEmail] %s", err.Error())
+		view.RenderJSONError(w, "Quotation venue not found", http.StatusNotFound)
+		return
+	}
+
+	pdf, err := c.document.Quotation(doc)
+	if err != nil {
+		c.reporter.Errorf("[handlePostQuotationEmail] failed generate quotation, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate quotation", http.StatusInternalServerError)
+		return
+	}
+
+	htmlEmail, err := c.handleGetHtmlBodyQuotation(doc)
+	if err != nil {
+		c.reporter.Errorf("[handlePostQuotationEmail] %s", err.Error())
+		view.RenderJSONError(w, "Failed generate email", http.StatusInternalServerError)
+		return
+	}
+
+	emailReq := email.EmailRequest{
+		Subject: "Penawaran " + q.QuotationNumber,
+		To:      q.Email,
+		HTML:    htmlEmail,
+		From:    "no-reply@molalivearena.com",
+		Text:    " ",
+		Attachments: []email.Attachment{
+			{
+				Content:     base64.StdEncoding.EncodeToString(pdf),
+				Filename:    "quotation-" + q.QuotationNumber + ".pdf",
+				Type:        "application/pdf",
+				Disposition: "attachment",
+				ContentID:   "contentid-test",
+			},
+		},
+	}
+
+	errEmail := c.email.Send(emailReq)
+	if c.handlePostEmailEcertLog(userID, 0, q.VenueID, emailReq.To, "quotation", companyID, errEmail) == "0" {
+		c.reporter.Errorf("[handlePostQuotationEmail] failed log email of quotation %d", q.ID)
+	}
+	if errEmail != nil {
+		c.reporter.Errorf("[handlePostQuotationEmail] failed send email, err: %s", errEmail.Error())
+		view.RenderJSONError(w, "Failed send email", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderJSONData(w, true, http.StatusOK)
+}
+
+// handlePostConvertQuotation creates an order at the quoted prices, prices of
+// the catalogue at conversion time are not used. A quotation is converted at
+// most once and not after it expires
+func (c *Controller) handlePostConvertQuotation(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqConvertQuotation
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+		isAdmin = false
+	)
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handlePostConvertQuotation] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := user["sub"]
+	if !ok {
+		if params.UserID == "" {
+			c.reporter.Errorf("[handlePostConvertQuotation] invalid parameter, failed get userID")
+			view.RenderJSONError(w, "invalid parameter, failed get userID", http.StatusBadRequest)
+			return
+		}
+		userID = params.UserID
+		isAdmin = true
+	}
+
+	var q quotation.Quotation
+	if isAdmin {
+		q, err = c.quotation.Get(id, c.projectID, "")
+	} else {
+		q, err = c.quotation.Get(id, c.projectID, userID.(string))
+	}
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostConvertQuotation] quotation not found, err: %s", err.Error())
+		view.RenderJSONError(w, "Quotation not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] Failed get quotation, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get quotation", http.StatusInternalServerError)
+		return
+	}
+
+	err = q.Convertible(time.Now())
+	if err != nil {
+		c.reporter.Warningf("[handlePostConvertQuotation] quotation %d cannot be converted, err: %s", q.ID, err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	breakdown := quotationBreakdown(q)
+
+	//choose payment method
+	paymentMethod, paymentFee, err := c.paymentMethod.Choose(c.projectID, params.PaymentMethodID, breakdown.TotalPrice)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostConvertQuotation] Payment Method Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Payment Method Not Found", http.StatusNotFound)
+		return
+	}
+	if err == payment_method.ErrMethodNotAvailable {
+		c.reporter.Errorf("[handlePostConvertQuotation] Payment method not available, paymentMethodID: %d, totalPrice: %f", paymentMethod.ID, breakdown.TotalPrice)
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err == payment_method.ErrMethodNotConfigured {
+		c.reporter.Errorf("[handlePostConvertQuotation] Payment method not chosen and no default is configured")
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] Failed choose payment method, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed choose payment method", http.StatusInternalServerError)
+		return
+	}
+
+	orderNumber, err := c.generateOrderNumber()
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] Failed generate order number, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate order number", http.StatusInternalServerError)
+		return
+	}
+
+	insertOrder := order.Order{
+		OrderNumber:     orderNumber,
+		BuyerID:         q.BuyerID,
+		VenueID:         q.VenueID,
+		DeviceID:        q.DeviceID,
+		ProductID:       q.ProductID,
+		InstallationID:  q.InstallationID,
+		AgingID:         q.AgingID,
+		RoomID:          q.RoomID,
+		RoomQuantity:    q.RoomQuantity,
+		TotalPrice:      breakdown.TotalPrice,
+		PaymentMethodID: paymentMethod.ID,
+		PaymentFee:      paymentFee,
+		Status:          order.StatusDraft,
+		CreatedBy:       q.CreatedBy,
+		LastUpdateBy:    userID.(string),
+		ProjectID:       c.projectID,
+		Email:           q.Email,
+	}
+
+	err = c.order.Insert(&insertOrder, isAdmin, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] failed post order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post order", http.StatusInternalServerError)
+		return
+	}
+
+	err = c.insertOrderDetail(insertOrder, insertOrder.VenueID, breakdown, isAdmin, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] failed post order details, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, "Failed post order details", http.StatusInternalServerError)
+		return
+	}
+
+	//record promotions given
+	err = c.redeemPromotions(insertOrder, breakdown.Lines)
+	if err == promotion.ErrUsageLimit {
+		c.reporter.Warningf("[handlePostConvertQuotation] promotion used up, dropping order %d", insertOrder.OrderID)
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] failed redeem promotions, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, "Failed redeem promotions", http.StatusInternalServerError)
+		return
+	}
+
+	q.LastUpdateBy = userID.(string)
+	err = c.quotation.Convert(&q, insertOrder.OrderID, getRequestID(r))
+	if err == quotation.ErrNotOpen || err == quotation.ErrExpired {
+		// a concurrent conversion won, the order created here is dropped
+		c.reporter.Warningf("[handlePostConvertQuotation] quotation %d cannot be converted, dropping order %d, err: %s", q.ID, insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostConvertQuotation] failed convert quotation, dropping order %d, err: %s", insertOrder.OrderID, err.Error())
+		c.dropOrder(insertOrder, getRequestID(r))
+		view.RenderJSONError(w, "Failed convert quotation", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseOrder{
+		ID:   insertOrder.OrderID,
+		Type: "order",
+		Attributes: view.OrderAttributes{
+			OrderNumber:       insertOrder.OrderNumber,
+			BuyerID:           insertOrder.BuyerID,
+			VenueID:           insertOrder.VenueID,
+			DeviceID:          insertOrder.DeviceID,
+			ProductID:         insertOrder.ProductID,
+			InstallationID:    insertOrder.InstallationID,
+			Quantity:          insertOrder.Quantity,
+			AgingID:           insertOrder.AgingID,
+			RoomID:            insertOrder.RoomID,
+			RoomQuantity:      insertOrder.RoomQuantity,
+			TotalPrice:        insertOrder.TotalPrice,
+			PaymentMethodID:   insertOrder.PaymentMethodID,
+			PaymentFee:        insertOrder.PaymentFee,
+			Status:            insertOrder.Status,
+			CreatedAt:         insertOrder.CreatedAt,
+			CreatedBy:         insertOrder.CreatedBy,
+			UpdatedAt:         insertOrder.UpdatedAt,
+			LastUpdateBy:      insertOrder.LastUpdateBy,
+			DeletedAt:         insertOrder.DeletedAt,
+			PendingAt:         insertOrder.PendingAt,
+			PaidAt:            insertOrder.PaidAt,
+			FailedAt:          insertOrder.FailedAt,
+			ProjectID:         insertOrder.ProjectID,
+			Email:             insertOrder.Email,
+			OpenPaymentStatus: insertOrder.OpenPaymentStatus,
+			OrderType:         insertOrder.OrderType,
+			Details:           mappingPriceDetails(breakdown),
+		},
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// getQuotation returns the quotation of the id param, users only get their
+// own quotations. It renders the error response when it is not found
+func (c *Controller) getQuotation(w http.ResponseWriter, r *http.Request, handler string) (quotation.Quotation, bool) {
+	id, err := strconv.ParseInt(router.GetParam(r, "id"), 10, 64)
+	if err != nil {
+		c.reporter.Errorf("[%s] invalid parameter, err: %s", handler, err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return quotation.Quotation{}, false
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[%s] failed get user", handler)
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return quotation.Quotation{}, false
+	}
+	// admins have no sub and get any quotation
+	userID, _ := user["sub"].(string)
+
+	q, err := c.quotation.Get(id, c.projectID, userID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[%s] quotation not found, err: %s", handler, err.Error())
+		view.RenderJSONError(w, "Quotation not found", http.StatusNotFound)
+		return q, false
+	}
+	if err != nil {
+		c.reporter.Errorf("[%s] Failed get quotation, err: %s", handler, err.Error())
+		view.RenderJSONError(w, "Failed get quotation", http.StatusInternalServerError)
+		return q, false
+	}
+	return q, true
+}
+
+// quotationDocument returns the quotation document addressed to the company
+// of the venue and the id of that company
+func (c *Controller) quotationDocument(q quotation.Quotation) (document.Quotation, int64, error) {
+	var doc document.Quotation
+
+	venue, err := c.venue.Get(c.projectID, q.VenueID, "")
+	if err != nil {
+		return doc, 0, fmt.Errorf("failed get venue %d of quotation %d: %s", q.VenueID, q.ID, err.Error())
+	}
+	company, err := c.company.Get(venue.PtID, c.projectID, "", true)
+	if err != nil && err != sql.ErrNoRows {
+		return doc, 0, fmt.Errorf("failed get company %d of quotation %d: %s", venue.PtID, q.ID, err.Error())
+	}
+
+	ac := accounting.Accounting{Precision: 2, Thousand: ".", Decimal: ","}
+
+	var taxRate float64
+	items := make([]document.InvoiceItem, 0, len(q.Items))
+	for _, item := range q.Items {
+		if item.TaxRateID.Valid {
+			taxRate = item.TaxRate
+		}
+		items = append(items, document.InvoiceItem{
+			Quantity:    item.Quantity,
+			Description: item.Description,
+			Price:       ac.FormatMoney(item.UnitPrice),
+			Total:       ac.FormatMoney(item.Amount),
+		})
+	}
+
+	// quotations priced before tax rates were configured are untaxed, their
+	// whole total is the tax base
+	taxBase := q.TaxBase
+	if q.TaxAmount == 0 && taxBase == 0 {
+		taxBase = q.TotalPrice
+	}
+
+	doc = document.Quotation{
+		Date:         q.CreatedAt.Format("2006-01-02"),
+		Number:       q.QuotationNumber,
+		ValidUntil:   q.ValidUntil.Format("2006-01-02"),
+		BuyerName:    company.Name,
+		BuyerAddress: company.Address + ", " + company.City + ", " + company.Province + " " + company.Zip,
+		VenueName:    venue.VenueName,
+		VenueAddress: venue.Address,
+		Items:        items,
+		TaxRate:      strconv.FormatFloat(taxRate, 'f', -1, 64) + "%",
+		TaxBase:      ac.FormatMoney(taxBase),
+		TaxAmount:    ac.FormatMoney(q.TaxAmount),
+		Total:        ac.FormatMoney(q.TotalPrice),
+		Logo:         c.email.GetPic(),
+		Locale:       company.Locale,
+	}
+	return doc, company.ID, nil
+}
+
+// quotationItems snapshots the priced lines of breakdown
+func quotationItems(breakdown pricing.Breakdown) quotation.Items {
+	items := make(quotation.Items, 0, len(breakdown.Lines))
+	for _, line := range breakdown.Lines {
+		item := quotation.Item{
+			ItemType:    line.ItemType,
+			ItemID:      line.ItemID,
+			Description: line.Description,
+			RuleID:      line.RuleID,
+			RuleType:    line.RuleType,
+			UnitPrice:   line.UnitPrice,
+			Quantity:    line.Quantity,
+			Amount:      line.Amount,
+			TaxRate:     line.TaxRate,
+			TaxBase:     line.TaxBase,
+			TaxAmount:   line.TaxAmount,
+		}
+		if line.TaxRateID != 0 {
+			item.TaxRateID = null.IntFrom(line.TaxRateID)
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// quotationBreakdown returns the quoted prices as the breakdown of an order
+func quotationBreakdown(q quotation.Quotation) pricing.Breakdown {
+	breakdown := pricing.Breakdown{
+		TotalPrice: q.TotalPrice,
+		TaxBase:    q.TaxBase,
+		TaxAmount:  q.TaxAmount,
+		Lines:      make(pricing.Lines, 0, len(q.Items)),
+	}
+	for _, item := range q.Items {
+		breakdown.Lines = append(breakdown.Lines, pricing.Line{
+			ItemType:    item.ItemType,
+			ItemID:      item.ItemID,
+			Description: item.Description,
+			RuleID:      item.RuleID,
+			RuleType:    item.RuleType,
+			UnitPrice:   item.UnitPrice,
+			Quantity:    item.Quantity,
+			Amount:      item.Amount,
+			TaxRateID:   item.TaxRateID.Int64,
+			TaxRate:     item.TaxRate,
+			TaxBase:     item.TaxBase,
+			TaxAmount:   item.TaxAmount,
+		})
+	}
+	return breakdown
+}
+
+func mappingQuotationAttributes(q quotation.Quotation, withDetails bool) view.QuotationAttributes {
+	attributes := view.QuotationAttributes{
+		QuotationNumber: q.QuotationNumber,
+		BuyerID:         q.BuyerID,
+		VenueID:         q.VenueID,
+		DeviceID:        q.DeviceID,
+		ProductID:       q.ProductID,
+		InstallationID:  q.InstallationID,
+		AgingID:         q.AgingID,
+		RoomID:          q.RoomID,
+		RoomQuantity:    q.RoomQuantity,
+		TotalPrice:      q.TotalPrice,
+		TaxBase:         q.TaxBase,
+		TaxAmount:       q.TaxAmount,
+		Email:           q.Email,
+		ValidUntil:      q.ValidUntil,
+		Status:          q.StatusName(time.Now()),
+		OrderID:         q.OrderID,
+		ConvertedAt:     q.ConvertedAt,
+		CreatedAt:       q.CreatedAt,
+		CreatedBy:       q.CreatedBy,
+		UpdatedAt:       q.UpdatedAt,
+		LastUpdateBy:    q.LastUpdateBy,
+		ProjectID:       q.ProjectID,
+	}
+	if withDetails {
+		attributes.Details = mappingPriceDetails(quotationBreakdown(q))
+	}
+	return attributes
+}
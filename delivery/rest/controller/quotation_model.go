@@ -0,0 +1,20 @@
+package controller
+
+type reqQuotation struct {
+	VenueID        int64  `json:"venueID" validate:"required"`
+	DeviceID       int64  `json:"deviceID" validate:"required"`
+	ProductID      int64  `json:"productID" validate:"required"`
+	InstallationID int64  `json:"installationID" validate:"required"`
+	AgingID        int64  `json:"agingID" validate:"required"`
+	RoomID         int64  `json:"roomID"`
+	RoomQuantity   int64  `json:"roomQuantity"`
+	Email          string `json:"email" validate:"required"`
+	ValidUntil     string `json:"validUntil"`
+	VoucherCode    string `json:"voucherCode"`
+	UserID         string `json:"userID"`
+}
+
+type reqConvertQuotation struct {
+	PaymentMethodID int64  `json:"paymentMethodID"`
+	UserID          string `json:"userID"`
+}
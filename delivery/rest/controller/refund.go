@@ -0,0 +1,396 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/payment"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/refund"
+	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
+	"git.sstv.io/lib/go/gojunkyard.git/form"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+	"gopkg.in/guregu/null.v3"
+)
+
+// handlePostOrderRefund refunds all or part of a paid order. Once the gateway
+// completes the refund, the order job queued by it applies the refund to the
+// order, its licenses and commissions
+func (c *Controller) handlePostOrderRefund(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqRefund
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+		isAdmin = false
+	)
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderRefund] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderRefund] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handlePostOrderRefund] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := user["sub"]
+	if !ok {
+		if params.UserID == "" {
+			c.reporter.Errorf("[handlePostOrderRefund] invalid parameter, failed get userID")
+			view.RenderJSONError(w, "invalid parameter, failed get userID", http.StatusBadRequest)
+			return
+		}
+		userID = params.UserID
+		isAdmin = true
+	}
+
+	var getOrder order.Order
+	if isAdmin {
+		getOrder, err = c.order.Get(id, c.projectID, "")
+	} else {
+		getOrder, err = c.order.Get(id, c.projectID, userID.(string))
+	}
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostOrderRefund] order not found, err: %s", err.Error())
+		view.RenderJSONError(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostOrderRefund] Failed get order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get order", http.StatusInternalServerError)
+		return
+	}
+	if getOrder.Status != order.StatusPaid {
+		c.reporter.Errorf("[handlePostOrderRefund] order is not paid, status: %s", order.StatusName(getOrder.Status))
+		view.RenderJSONError(w, fmt.Sprintf("Order can not be refunded in %s status", order.StatusName(getOrder.Status)), http.StatusConflict)
+		return
+	}
+
+	//amount paid for each order detail, tax included, the refundable amount
+	//is taken from it while the order is locked
+	orderDetails, err := c.orderDetail.GetFromDBByOrderID(id, c.projectID, "")
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handlePostOrderRefund] Failed get order details, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get order details", http.StatusInternalServerError)
+		return
+	}
+
+	ordered := make(refund.Refundables, 0, len(orderDetails))
+	for _, orderDetail := range orderDetails {
+		ordered = append(ordered, refund.Refundable{
+			OrderDetailID: orderDetail.ID,
+			Amount:        orderDetail.PaidAmount(),
+		})
+	}
+
+	lines := make(map[int64]float64, len(params.Lines))
+	for _, line := range params.Lines {
+		lines[line.OrderDetailID] += line.Amount
+	}
+
+	//record refund
+	insertRefund := refund.Refund{
+		OrderID:      id,
+		Amount:       params.Amount,
+		Reason:       params.Reason,
+		CreatedBy:    userID.(string),
+		LastUpdateBy: userID.(string),
+		ProjectID:    c.projectID,
+	}
+
+	err = c.refund.Insert(&insertRefund, ordered, lines, getRequestID(r))
+	switch err {
+	case nil:
+	case refund.ErrInvalidAmount, refund.ErrAmountExceeded, refund.ErrInvalidDetailLine, refund.ErrNothingRefundable:
+		c.reporter.Errorf("[handlePostOrderRefund] invalid refund, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	default:
+		c.reporter.Errorf("[handlePostOrderRefund] failed post refund, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post refund", http.StatusInternalServerError)
+		return
+	}
+
+	//refund payment
+	gatewayRefund, err := c.payment.Refund(strconv.FormatInt(getOrder.OrderID, 10), insertRefund.Amount, params.Reason)
+	if err != nil || gatewayRefund == nil {
+		if err == nil {
+			err = fmt.Errorf("empty response")
+		}
+		c.reporter.Errorf("[handlePostOrderRefund] Failed processing refund, refundID: %d, err: %s", insertRefund.ID, err.Error())
+
+		insertRefund.Status = refund.StatusFailed
+		err = c.refund.UpdateStatus(&insertRefund, getRequestID(r))
+		if err != nil {
+			c.reporter.Errorf("[handlePostOrderRefund] failed update refund status, refundID: %d, err: %s", insertRefund.ID, err.Error())
+		}
+		view.RenderJSONError(w, "Failed processing refund", http.StatusInternalServerError)
+		return
+	}
+
+	insertRefund.GatewayRefundID = gatewayRefund.RefundID
+	if gatewayRefund.Status == payment.RefundStatusCompleted {
+		insertRefund.Status = refund.StatusCompleted
+	}
+	err = c.refund.UpdateStatus(&insertRefund, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostOrderRefund] failed update refund status, refundID: %d, err: %s", insertRefund.ID, err.Error())
+		view.RenderJSONError(w, "Failed update refund", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseRefund{
+		ID:         insertRefund.ID,
+		Type:       "refund",
+		Attributes: mappingRefundAttributes(insertRefund),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// completeRefund applies the completed refund. It is run by the order job
+// queued when the refund completed until it succeeds, so every step may be
+// repeated. The order is fully refunded once the completed refunds cover it,
+// so the last pending refund to complete decides it:
+//   - a fully refunded order moves to refunded, the licenses of a new order
+//     are revoked and the extension of a renewal is rolled back
+//   - a partially refunded order keeps its status, the licenses of the venues
+//     whose lines were refunded are suspended
+//
+// The commissions are reversed by the share refunded
+func (c *Controller) completeRefund(refundedOrder order.Order, completed refund.Refund, userID string) (err error) {
+	isFullRefund, err := c.isFullyRefunded(refundedOrder.OrderID)
+	if err != nil {
+		return err
+	}
+
+	if isFullRefund {
+		updateStatus := order.Order{
+			OrderID:      refundedOrder.OrderID,
+			ProjectID:    refundedOrder.ProjectID,
+			Status:       order.StatusRefunded,
+			CreatedBy:    refundedOrder.CreatedBy,
+			LastUpdateBy: userID,
+			PendingAt:    refundedOrder.PendingAt,
+			PaidAt:       refundedOrder.PaidAt,
+			FailedAt:     refundedOrder.FailedAt,
+			VenueID:      refundedOrder.VenueID,
+			BuyerID:      refundedOrder.BuyerID,
+		}
+
+		err = c.order.UpdateOrderStatus(&updateStatus, fmt.Sprintf("refund %d", completed.ID), true, "")
+		if err != nil && err != order.ErrInvalidTransition {
+			return err
+		}
+	}
+
+	venues, err := c.orderVenues(refundedOrder)
+	if err != nil {
+		return err
+	}
+	refundedVenues, err := c.refundedVenues(refundedOrder, completed)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range venues {
+		if !isFullRefund && !refundedVenues[v.VenueID] {
+			continue
+		}
+		err = c.refundLicense(refundedOrder, v, isFullRefund, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return c.reverseCommissions(refundedOrder, completed, isFullRefund)
+}
+
+// refundedVenues returns the venues of the order lines the refund is taken from
+func (c *Controller) refundedVenues(refundedOrder order.Order, completed refund.Refund) (map[int64]bool, error) {
+	orderDetails, err := c.orderDetail.GetFromDBByOrderID(refundedOrder.OrderID, c.projectID, "")
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	detailVenues := make(map[int64]int64, len(orderDetails))
+	for _, orderDetail := range orderDetails {
+		venueID := orderDetail.VenueID
+		if venueID == 0 {
+			venueID = refundedOrder.VenueID
+		}
+		detailVenues[orderDetail.ID] = venueID
+	}
+
+	venues := make(map[int64]bool)
+	for _, detail := range completed.Details {
+		if venueID, ok := detailVenues[detail.OrderDetailID]; ok {
+			venues[venueID] = true
+		}
+	}
+	return venues, nil
+}
+
+// refundLicense applies the refund of the order to the license of the venue.
+// A full refund of a renewal takes back the months the renewal extended the
+// license by, if it was activated by it, so time paid by earlier orders is
+// kept. The license records the order, so it is applied once
+func (c *Controller) refundLicense(refundedOrder order.Order, v orderVenue, isFullRefund bool, userID string) error {
+	venueLicense, err := c.license.GetByVenueID(c.projectID, v.VenueID)
+	if err == sql.ErrNoRows {
+		c.reporter.Warningf("[refundLicense] license not found, venueID: %d", v.VenueID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if venueLicense.LicenseStatus == license.LicenseStatusRevoked {
+		return nil
+	}
+	if venueLicense.RefundedOrderID.Valid && venueLicense.RefundedOrderID.Int64 == refundedOrder.OrderID {
+		return nil
+	}
+
+	switch {
+	case !isFullRefund:
+		venueLicense.LicenseStatus = license.LicenseStatusSuspended
+	case refundedOrder.OrderType == order.OrderTypeRenewal:
+		activated, err := c.orderJob.IsDone(c.projectID, order_job.TypeActivateLicense, refundedOrder.OrderID, v.VenueID)
+		if err != nil {
+			return err
+		}
+		if activated {
+			aging, err := c.aging.Get(v.AgingID, c.projectID)
+			if err != nil {
+				return err
+			}
+			venueLicense.Rollback(time.Now(), aging.DurationMonths)
+		}
+		venueLicense.RefundedOrderID = null.IntFrom(refundedOrder.OrderID)
+	default:
+		venueLicense.LicenseStatus = license.LicenseStatusRevoked
+		venueLicense.RefundedOrderID = null.IntFrom(refundedOrder.OrderID)
+	}
+	venueLicense.LastUpdateBy = userID
+
+	return c.license.Update(&venueLicense, venueLicense.BuyerID, "")
+}
+
+// isFullyRefunded reports whether the completed refunds of the order cover
+// every order detail
+func (c *Controller) isFullyRefunded(orderID int64) (bool, error) {
+	orderDetails, err := c.orderDetail.GetFromDBByOrderID(orderID, c.projectID, "")
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+	completed, err := c.refund.GetCompletedAmountByOrderID(orderID, c.projectID)
+	if err != nil {
+		return false, err
+	}
+
+	var total float64
+	for _, orderDetail := range orderDetails {
+		total += orderDetail.PaidAmount()
+	}
+	return math.Round(completed*100) >= math.Round(total*100), nil
+}
+
+func (c *Controller) handleGetOrderRefunds(w http.ResponseWriter, r *http.Request) {
+	var (
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+		isAdmin = false
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleGetOrderRefunds] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	user, ok := authpassport.GetUser(r)
+	if !ok {
+		c.reporter.Errorf("[handleGetOrderRefunds] failed get user")
+		view.RenderJSONError(w, "failed get user", http.StatusInternalServerError)
+		return
+	}
+	userID, ok := user["sub"]
+	if !ok {
+		isAdmin = true
+	}
+
+	if isAdmin {
+		_, err = c.order.Get(id, c.projectID, "")
+	} else {
+		_, err = c.order.Get(id, c.projectID, userID.(string))
+	}
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetOrderRefunds] order not found, err: %s", err.Error())
+		view.RenderJSONError(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetOrderRefunds] Failed get order, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get order", http.StatusInternalServerError)
+		return
+	}
+
+	refunds, err := c.refund.SelectByOrderID(id, c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetOrderRefunds] Failed get refunds, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get refunds", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponseRefund, 0, len(refunds))
+	for _, orderRefund := range refunds {
+		res = append(res, view.DataResponseRefund{
+			ID:         orderRefund.ID,
+			Type:       "refund",
+			Attributes: mappingRefundAttributes(orderRefund),
+		})
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func mappingRefundAttributes(orderRefund refund.Refund) view.RefundAttributes {
+	details := make([]view.RefundDetailAttributes, 0, len(orderRefund.Details))
+	for _, detail := range orderRefund.Details {
+		details = append(details, view.RefundDetailAttributes{
+			ID:            detail.ID,
+			OrderDetailID: detail.OrderDetailID,
+			Amount:        detail.Amount,
+		})
+	}
+
+	return view.RefundAttributes{
+		OrderID:         orderRefund.OrderID,
+		Amount:          orderRefund.Amount,
+		Reason:          orderRefund.Reason,
+		Status:          orderRefund.Status,
+		GatewayRefundID: orderRefund.GatewayRefundID,
+		Details:         details,
+		CreatedAt:       orderRefund.CreatedAt,
+		CreatedBy:       orderRefund.CreatedBy,
+		UpdatedAt:       orderRefund.UpdatedAt,
+		LastUpdateBy:    orderRefund.LastUpdateBy,
+		CompletedAt:     orderRefund.CompletedAt,
+		ProjectID:       orderRefund.ProjectID,
+	}
+}
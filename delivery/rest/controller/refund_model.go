@@ -0,0 +1,13 @@
+package controller
+
+type reqRefund struct {
+	Amount float64         `json:"amount"`
+	Lines  []reqRefundLine `json:"lines"`
+	Reason string          `json:"reason" validate:"required"`
+	UserID string          `json:"userID"`
+}
+
+type reqRefundLine struct {
+	OrderDetailID int64   `json:"orderDetailID"`
+	Amount        float64 `json:"amount"`
+}
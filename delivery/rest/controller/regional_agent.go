@@ -127,7 +127,7 @@ func (c *Controller) handleDeleteRegionalAgent(w http.ResponseWriter, r *http.Re
 		userID = params.UserID
 		isAdmin = true
 	}
-	err = c.regionalAgent.Delete(c.projectID, id, isAdmin, userID.(string))
+	err = c.regionalAgent.Delete(c.projectID, id, isAdmin, userID.(string), getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteRegionalAgent] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete regionalAgent", http.StatusInternalServerError)
@@ -175,7 +175,7 @@ func (c *Controller) handlePostRegionalAgent(w http.ResponseWriter, r *http.Requ
 		CreatedBy: uid,
 	}
 
-	err = c.regionalAgent.Insert(&regionalAgent)
+	err = c.regionalAgent.Insert(&regionalAgent, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostRegionalAgent] error insert regionalAgent repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post regionalAgent", http.StatusInternalServerError)
@@ -247,7 +247,7 @@ func (c *Controller) handlePatchRegionalAgent(w http.ResponseWriter, r *http.Req
 		ProjectID:    c.projectID,
 		LastUpdateBy: userID.(string),
 	}
-	err = c.regionalAgent.Update(&regionalAgent, isAdmin)
+	err = c.regionalAgent.Update(&regionalAgent, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchRegionalAgent] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update regionalAgent", http.StatusInternalServerError)
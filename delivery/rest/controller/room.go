@@ -94,7 +94,7 @@ func (c *Controller) handleDeleteRoom(w http.ResponseWriter, r *http.Request) {
 		userID = params.UserID
 		isAdmin = true
 	}
-	err = c.room.Delete(c.projectID, id, isAdmin, userID.(string))
+	err = c.room.Delete(c.projectID, id, isAdmin, userID.(string), getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteRoom] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete room", http.StatusInternalServerError)
@@ -140,7 +140,7 @@ func (c *Controller) handlePostRoom(w http.ResponseWriter, r *http.Request) {
 		CreatedBy:   uid,
 	}
 
-	err = c.room.Insert(&room)
+	err = c.room.Insert(&room, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostRoom] error insert room repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post room", http.StatusInternalServerError)
@@ -210,7 +210,7 @@ func (c *Controller) handlePatchRoom(w http.ResponseWriter, r *http.Request) {
 		ProjectID:    c.projectID,
 		LastUpdateBy: userID.(string),
 	}
-	err = c.room.Update(&room, isAdmin)
+	err = c.room.Update(&room, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchRoom] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update room", http.StatusInternalServerError)
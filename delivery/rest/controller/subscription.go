@@ -159,7 +159,7 @@ func (c *Controller) handleDeleteSubscription(w http.ResponseWriter, r *http.Req
 		isAdmin = true
 	}
 
-	err = c.subscription.Delete(c.projectID, id, isAdmin, userID.(string), orderID)
+	err = c.subscription.Delete(c.projectID, id, isAdmin, userID.(string), orderID, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteSubscription] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete subscription", http.StatusInternalServerError)
@@ -205,7 +205,7 @@ func (c *Controller) handlePostSubscription(w http.ResponseWriter, r *http.Reque
 		CreatedBy:       uid,
 	}
 
-	err = c.subscription.Insert(&subscription)
+	err = c.subscription.Insert(&subscription, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostSubscription] error insert subscription repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post subscription", http.StatusInternalServerError)
@@ -274,7 +274,7 @@ func (c *Controller) handlePatchSubscription(w http.ResponseWriter, r *http.Requ
 		ProjectID:       c.projectID,
 		LastUpdateBy:    userID.(string),
 	}
-	err = c.subscription.Update(&subscription, isAdmin, orderID)
+	err = c.subscription.Update(&subscription, isAdmin, orderID, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchSubscription] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update subscription", http.StatusInternalServerError)
@@ -5,11 +5,15 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"time"
 
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/license_token"
 	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
 	"git.sstv.io/lib/go/go-auth-api.git/authpassport"
 	"git.sstv.io/lib/go/gojunkyard.git/router"
+	null "gopkg.in/guregu/null.v3"
 )
 
 func (c *Controller) handleGetSumOrderByID(w http.ResponseWriter, r *http.Request) {
@@ -68,7 +72,8 @@ func (c *Controller) handleGetSumOrderByID(w http.ResponseWriter, r *http.Reques
 				AgingName:         sumorder.AgingName,
 				OrderStatus:       sumorder.OrderStatus,
 				OpenPaymentStatus: sumorder.OpenPaymentStatus,
-				EcertLastSentDate: sumorder.EcertLastSentDate},
+				EcertLastSentDate: sumorder.EcertLastSentDate,
+				RefundedAmount:    sumorder.RefundedAmount},
 			)
 		}
 
@@ -147,94 +152,161 @@ func (c *Controller) handleGetLicenseByIDForChecker(w http.ResponseWriter, r *ht
 		return
 	}
 
-	sumvenue, err := c.order.GetSummaryVenueByLicenseNumber(_id, c.projectID)
+	if !c.licenseToken.Enabled() {
+		c.reporter.Warningf("[handleGetLicenseByIDForChecker] license token key is not configured")
+		view.RenderJSONError(w, "License token is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	claims, err := c.licenseToken.Verify(_id)
+	if err != nil {
+		c.reporter.Warningf("[handleGetLicenseByIDForChecker] forged license token, err: %s", err.Error())
+		view.RenderJSONData(w, view.DataResponseOrder{
+			Type: "license_verdict",
+			Attributes: view.LicenseVerdictAttributes{
+				Verdict: license_token.VerdictForged,
+				Reason:  err.Error(),
+			},
+		}, http.StatusOK)
+		return
+	}
+
+	checkedLicense, err := c.license.GetByVenueID(c.projectID, claims.VenueID)
 	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetLicenseByIDForChecker] failed get license, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get license", http.StatusInternalServerError)
+		return
+	}
+	verdict, reason := judgeLicense(claims, checkedLicense, err == nil, time.Now())
+
+	sumvenue, err := c.getSummaryVenueForChecker(claims.LicenseNumber)
+	if err != nil {
 		c.reporter.Errorf("[handleGetLicenseByIDForChecker] failed get sum venue, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed get sum venue", http.StatusInternalServerError)
 		return
 	}
 
-	var res view.DataResponseOrder
-	if sumvenue.VenueID != 0 {
-		sumorders, err := c.order.SelectSummaryOrdersByLicenseNumber(_id, c.projectID)
-		if err != nil && err != sql.ErrNoRows {
-			c.reporter.Errorf("[handleGetLicenseByIDForChecker] failed get sum orders, err: %s", err.Error())
-			view.RenderJSONError(w, "Failed get sum orders", http.StatusInternalServerError)
-			return
-		}
+	res := view.DataResponseOrder{
+		ID:   claims.LicenseNumber,
+		Type: "license_verdict",
+		Attributes: view.LicenseVerdictAttributes{
+			Verdict:       verdict,
+			Reason:        reason,
+			LicenseNumber: claims.LicenseNumber,
+			VenueID:       claims.VenueID,
+			ExpiredAt:     null.TimeFrom(time.Unix(claims.ExpiredAt, 0)),
+			IssuedAt:      null.TimeFrom(time.Unix(claims.IssuedAt, 0)),
+			Venue:         sumvenue,
+		},
+	}
 
-		orders := make([]view.SumOrderAttributes, 0, len(sumorders))
-		for _, sumorder := range sumorders {
-			orders = append(orders, view.SumOrderAttributes{
-				OrderID:           sumorder.OrderID,
-				OrderNumber:       sumorder.OrderNumber,
-				OrderTotalPrice:   sumorder.OrderTotalPrice,
-				OrderCreatedAt:    sumorder.OrderCreatedAt,
-				OrderPaidAt:       sumorder.OrderPaidAt,
-				OrderFailedAt:     sumorder.OrderFailedAt,
-				OrderEmail:        sumorder.OrderEmail,
-				DeviceName:        sumorder.DeviceName,
-				ProductName:       sumorder.ProductName,
-				InstallationName:  sumorder.InstallationName,
-				RoomName:          sumorder.RoomName,
-				RoomQty:           sumorder.RoomQty,
-				AgingName:         sumorder.AgingName,
-				OrderStatus:       sumorder.OrderStatus,
-				OpenPaymentStatus: sumorder.OpenPaymentStatus,
-				EcertLastSentDate: sumorder.EcertLastSentDate},
-			)
-		}
+	view.RenderJSONData(w, res, http.StatusOK)
+}
 
-		res = view.DataResponseOrder{
-			ID:   sumvenue.VenueID,
-			Type: "summary_venue_order",
-			Attributes: view.SumVenueAttributes{
-				VenueName:             sumvenue.VenueName,
-				VenueType:             sumvenue.VenueType,
-				VenuePhone:            sumvenue.VenuePhone,
-				VenuePicName:          sumvenue.VenuePicName,
-				VenuePicContactNumber: sumvenue.VenuePicContactNumber,
-				VenueAddress:          sumvenue.VenueAddress,
-				VenueCity:             sumvenue.VenueCity,
-				VenueProvince:         sumvenue.VenueProvince,
-				VenueZip:              sumvenue.VenueZip,
-				VenueCapacity:         sumvenue.VenueCapacity,
-				VenueFacilities:       sumvenue.VenueFacilities,
-				VenueLongitude:        sumvenue.VenueLongitude,
-				VenueLatitude:         sumvenue.VenueLatitude,
-				VenueCategory:         sumvenue.VenueCategory,
-				VenueShowStatus:       sumvenue.VenueShowStatus,
-				CompanyID:             sumvenue.CompanyID,
-				CompanyName:           sumvenue.CompanyName,
-				CompanyAddress:        sumvenue.CompanyAddress,
-				CompanyCity:           sumvenue.CompanyCity,
-				CompanyProvince:       sumvenue.CompanyProvince,
-				CompanyZip:            sumvenue.CompanyZip,
-				CompanyEmail:          sumvenue.CompanyEmail,
-				EcertLastSent:         sumvenue.EcertLastSent,
-				LicenseNumber:         sumvenue.LicenseNumber,
-				LicenseActiveDate:     sumvenue.LicenseActiveDate,
-				LicenseExpiredDate:    sumvenue.LicenseExpiredDate,
-				LastOrderID:           sumvenue.LastOrderID,
-				LastOrderNumber:       sumvenue.LastOrderNumber,
-				LastOrderTotalPrice:   sumvenue.LastOrderTotalPrice,
-				LastRoomID:            sumvenue.LastRoomID,
-				LastRoomQuantity:      sumvenue.LastRoomQuantity,
-				LastAgingID:           sumvenue.LastAgingID,
-				LastDeviceID:          sumvenue.LastDeviceID,
-				LastProductID:         sumvenue.LastProductID,
-				LastInstallationID:    sumvenue.LastInstallationID,
-				LastOrderCreatedAt:    sumvenue.LastOrderCreatedAt,
-				LastOrderPaidAt:       sumvenue.LastOrderPaidAt,
-				LastOrderFailedAt:     sumvenue.LastOrderFailedAt,
-				LastOrderEmail:        sumvenue.LastOrderEmail,
-				LastOrderStatus:       sumvenue.LastOrderStatus,
-				Orders:                orders,
-			},
-		}
+// judgeLicense returns the verdict of a license token with valid signature
+// against the current license of its venue. The expiry signed in the token is
+// only for checkers offline, a renewal extends the current license past it
+func judgeLicense(claims license_token.Claims, current license.License, found bool, now time.Time) (verdict, reason string) {
+	switch {
+	case !found || current.LicenseNumber != claims.LicenseNumber:
+		return license_token.VerdictRevoked, "License is no longer issued to the venue"
+	case current.LicenseStatus == license.LicenseStatusRevoked || current.LicenseStatus == license.LicenseStatusSuspended:
+		return license_token.VerdictRevoked, "License is revoked"
+	case current.LicenseStatus == license.LicenseStatusExpired || !current.ExpiredDate.After(now):
+		return license_token.VerdictExpired, "License is expired"
 	}
+	return license_token.VerdictValid, ""
+}
 
-	view.RenderJSONData(w, res, http.StatusOK)
+// getSummaryVenueForChecker returns summary of the venue holding the license
+// number with its orders, or nil when there is none
+func (c *Controller) getSummaryVenueForChecker(licenseNumber string) (interface{}, error) {
+	sumvenue, err := c.order.GetSummaryVenueByLicenseNumber(licenseNumber, c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	if sumvenue.VenueID == 0 {
+		return nil, nil
+	}
+
+	sumorders, err := c.order.SelectSummaryOrdersByLicenseNumber(licenseNumber, c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+
+	orders := make([]view.SumOrderAttributes, 0, len(sumorders))
+	for _, sumorder := range sumorders {
+		orders = append(orders, view.SumOrderAttributes{
+			OrderID:           sumorder.OrderID,
+			OrderNumber:       sumorder.OrderNumber,
+			OrderTotalPrice:   sumorder.OrderTotalPrice,
+			OrderCreatedAt:    sumorder.OrderCreatedAt,
+			OrderPaidAt:       sumorder.OrderPaidAt,
+			OrderFailedAt:     sumorder.OrderFailedAt,
+			OrderEmail:        sumorder.OrderEmail,
+			DeviceName:        sumorder.DeviceName,
+			ProductName:       sumorder.ProductName,
+			InstallationName:  sumorder.InstallationName,
+			RoomName:          sumorder.RoomName,
+			RoomQty:           sumorder.RoomQty,
+			AgingName:         sumorder.AgingName,
+			OrderStatus:       sumorder.OrderStatus,
+			OpenPaymentStatus: sumorder.OpenPaymentStatus,
+			EcertLastSentDate: sumorder.EcertLastSentDate,
+			RefundedAmount:    sumorder.RefundedAmount},
+		)
+	}
+
+	res := view.DataResponseOrder{
+		ID:   sumvenue.VenueID,
+		Type: "summary_venue_order",
+		Attributes: view.SumVenueAttributes{
+			VenueName:             sumvenue.VenueName,
+			VenueType:             sumvenue.VenueType,
+			VenuePhone:            sumvenue.VenuePhone,
+			VenuePicName:          sumvenue.VenuePicName,
+			VenuePicContactNumber: sumvenue.VenuePicContactNumber,
+			VenueAddress:          sumvenue.VenueAddress,
+			VenueCity:             sumvenue.VenueCity,
+			VenueProvince:         sumvenue.VenueProvince,
+			VenueZip:              sumvenue.VenueZip,
+			VenueCapacity:         sumvenue.VenueCapacity,
+			VenueFacilities:       sumvenue.VenueFacilities,
+			VenueLongitude:        sumvenue.VenueLongitude,
+			VenueLatitude:         sumvenue.VenueLatitude,
+			VenueCategory:         sumvenue.VenueCategory,
+			VenueShowStatus:       sumvenue.VenueShowStatus,
+			CompanyID:             sumvenue.CompanyID,
+			CompanyName:           sumvenue.CompanyName,
+			CompanyAddress:        sumvenue.CompanyAddress,
+			CompanyCity:           sumvenue.CompanyCity,
+			CompanyProvince:       sumvenue.CompanyProvince,
+			CompanyZip:            sumvenue.CompanyZip,
+			CompanyEmail:          sumvenue.CompanyEmail,
+			EcertLastSent:         sumvenue.EcertLastSent,
+			LicenseNumber:         sumvenue.LicenseNumber,
+			LicenseActiveDate:     sumvenue.LicenseActiveDate,
+			LicenseExpiredDate:    sumvenue.LicenseExpiredDate,
+			LastOrderID:           sumvenue.LastOrderID,
+			LastOrderNumber:       sumvenue.LastOrderNumber,
+			LastOrderTotalPrice:   sumvenue.LastOrderTotalPrice,
+			LastRoomID:            sumvenue.LastRoomID,
+			LastRoomQuantity:      sumvenue.LastRoomQuantity,
+			LastAgingID:           sumvenue.LastAgingID,
+			LastDeviceID:          sumvenue.LastDeviceID,
+			LastProductID:         sumvenue.LastProductID,
+			LastInstallationID:    sumvenue.LastInstallationID,
+			LastOrderCreatedAt:    sumvenue.LastOrderCreatedAt,
+			LastOrderPaidAt:       sumvenue.LastOrderPaidAt,
+			LastOrderFailedAt:     sumvenue.LastOrderFailedAt,
+			LastOrderEmail:        sumvenue.LastOrderEmail,
+			LastOrderStatus:       sumvenue.LastOrderStatus,
+			Orders:                orders,
+		},
+	}
+
+	return res, nil
 }
 
 func (c *Controller) handleGetSumOrdersByUserID(w http.ResponseWriter, r *http.Request) {
@@ -312,7 +384,8 @@ func (c *Controller) handleGetSumOrdersByUserID(w http.ResponseWriter, r *http.R
 				AgingName:         sumorder.AgingName,
 				OrderStatus:       sumorder.OrderStatus,
 				OpenPaymentStatus: sumorder.OpenPaymentStatus,
-				EcertLastSentDate: sumorder.EcertLastSentDate},
+				EcertLastSentDate: sumorder.EcertLastSentDate,
+				RefundedAmount:    sumorder.RefundedAmount},
 			)
 		}
 
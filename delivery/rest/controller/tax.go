@@ -0,0 +1,323 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/tax"
+	"git.sstv.io/lib/go/gojunkyard.git/form"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+)
+
+func (c *Controller) handlePostTaxRate(w http.ResponseWriter, r *http.Request) {
+	var params reqTaxRate
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostTaxRate] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	effectiveFrom, err := time.ParseInLocation("2006-01-02", params.EffectiveFrom, time.Local)
+	if err != nil {
+		c.reporter.Warningf("[handlePostTaxRate] invalid effective from, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter effectiveFrom", http.StatusBadRequest)
+		return
+	}
+
+	rate := tax.Rate{
+		Name:          params.Name,
+		Rate:          params.Rate,
+		PriceMode:     params.PriceMode,
+		EffectiveFrom: effectiveFrom,
+		CreatedBy:     params.UserID,
+		LastUpdateBy:  params.UserID,
+		ProjectID:     c.projectID,
+	}
+
+	err = rate.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePostTaxRate] invalid tax rate, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.tax.Insert(&rate, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePostTaxRate] failed post tax rate, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed post tax rate", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseTaxRate{
+		ID:         rate.ID,
+		Type:       "taxRate",
+		Attributes: mappingTaxRateAttributes(rate),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handlePatchTaxRate(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqTaxRate
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchTaxRate] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchTaxRate] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	effectiveFrom, err := time.ParseInLocation("2006-01-02", params.EffectiveFrom, time.Local)
+	if err != nil {
+		c.reporter.Warningf("[handlePatchTaxRate] invalid effective from, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter effectiveFrom", http.StatusBadRequest)
+		return
+	}
+
+	getRate, err := c.tax.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchTaxRate] Tax Rate Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Tax Rate Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handlePatchTaxRate] Failed get tax rate, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get tax rate", http.StatusInternalServerError)
+		return
+	}
+
+	rate := tax.Rate{
+		ID:            id,
+		Name:          params.Name,
+		Rate:          params.Rate,
+		PriceMode:     params.PriceMode,
+		EffectiveFrom: effectiveFrom,
+		Status:        getRate.Status,
+		CreatedAt:     getRate.CreatedAt,
+		CreatedBy:     getRate.CreatedBy,
+		LastUpdateBy:  params.UserID,
+		DeletedAt:     getRate.DeletedAt,
+		ProjectID:     c.projectID,
+	}
+
+	err = rate.Validate()
+	if err != nil {
+		c.reporter.Errorf("[handlePatchTaxRate] invalid tax rate, err: %s", err.Error())
+		view.RenderJSONError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = c.tax.Update(&rate, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handlePatchTaxRate] failed update tax rate, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed update tax rate", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseTaxRate{
+		ID:         rate.ID,
+		Type:       "taxRate",
+		Attributes: mappingTaxRateAttributes(rate),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleDeleteTaxRate(w http.ResponseWriter, r *http.Request) {
+	var (
+		params  reqDeleteTaxRate
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleDeleteTaxRate] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handleDeleteTaxRate] user id not found, err: %s", err.Error())
+		view.RenderJSONError(w, "User ID not found", http.StatusBadRequest)
+		return
+	}
+
+	_, err = c.tax.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleDeleteTaxRate] Tax Rate Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Tax Rate Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleDeleteTaxRate] Failed get tax rate, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get tax rate", http.StatusInternalServerError)
+		return
+	}
+
+	rate := tax.Rate{
+		ID:           id,
+		LastUpdateBy: params.UserID,
+		ProjectID:    c.projectID,
+	}
+
+	err = c.tax.Delete(&rate, getRequestID(r))
+	if err != nil {
+		c.reporter.Errorf("[handleDeleteTaxRate] failed delete tax rate, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed delete tax rate", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseTaxRate{
+		ID: id,
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetAllTaxRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := c.tax.Select(c.projectID)
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetAllTaxRates] failed get all tax rates, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get all tax rates", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponseTaxRate, 0, len(rates))
+	for _, rate := range rates {
+		res = append(res, view.DataResponseTaxRate{
+			ID:         rate.ID,
+			Type:       "taxRate",
+			Attributes: mappingTaxRateAttributes(rate),
+		})
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handleGetTaxRateByID(w http.ResponseWriter, r *http.Request) {
+	var (
+		_id     = router.GetParam(r, "id")
+		id, err = strconv.ParseInt(_id, 10, 64)
+	)
+	if err != nil {
+		c.reporter.Errorf("[handleGetTaxRateByID] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	rate, err := c.tax.Get(id, c.projectID)
+	if err == sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetTaxRateByID] Tax Rate Not Found, err: %s", err.Error())
+		view.RenderJSONError(w, "Tax Rate Not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil && err != sql.ErrNoRows {
+		c.reporter.Errorf("[handleGetTaxRateByID] Failed get tax rate, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get tax rate", http.StatusInternalServerError)
+		return
+	}
+
+	res := view.DataResponseTaxRate{
+		ID:         rate.ID,
+		Type:       "taxRate",
+		Attributes: mappingTaxRateAttributes(rate),
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+// handleGetTaxInvoicesExport downloads the tax invoices of orders paid from
+// and to the given dates as e-Faktur import csv
+func (c *Controller) handleGetTaxInvoicesExport(w http.ResponseWriter, r *http.Request) {
+	getParam := r.URL.Query()
+
+	from, err := time.ParseInLocation("2006-01-02", getParam.Get("from"), time.Local)
+	if err != nil {
+		c.reporter.Warningf("[handleGetTaxInvoicesExport] invalid from date, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter from", http.StatusBadRequest)
+		return
+	}
+	to, err := time.ParseInLocation("2006-01-02", getParam.Get("to"), time.Local)
+	if err != nil {
+		c.reporter.Warningf("[handleGetTaxInvoicesExport] invalid to date, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter to", http.StatusBadRequest)
+		return
+	}
+
+	// to is inclusive, orders paid on the whole day are exported
+	invoices, err := c.tax.SelectInvoices(c.projectID, from, to.AddDate(0, 0, 1))
+	if err != nil {
+		c.reporter.Errorf("[handleGetTaxInvoicesExport] failed get tax invoices, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get tax invoices", http.StatusInternalServerError)
+		return
+	}
+
+	buff := bytes.NewBuffer([]byte{})
+	err = tax.WriteEFaktur(buff, invoices)
+	if err != nil {
+		c.reporter.Errorf("[handleGetTaxInvoicesExport] failed write tax invoices, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed export tax invoices", http.StatusInternalServerError)
+		return
+	}
+
+	filename := "efaktur-" + from.Format("20060102") + "-" + to.Format("20060102") + ".csv"
+	view.RenderCSV(w, buff.Bytes(), filename, http.StatusOK)
+}
+
+// applyTax splits the lines of breakdown by the tax rate effective at and
+// adds exclusive tax to the total, the breakdown is left untaxed when no
+// rate is effective
+func (c *Controller) applyTax(breakdown *pricing.Breakdown, at time.Time) error {
+	rate, err := c.tax.GetEffective(c.projectID, at)
+	if err == tax.ErrRateNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	breakdown.TotalPrice = 0
+	for i := range breakdown.Lines {
+		line := &breakdown.Lines[i]
+		line.TaxRateID = rate.ID
+		line.TaxRate = rate.Rate
+		line.TaxBase, line.TaxAmount = rate.Apply(line.Amount)
+
+		breakdown.TaxBase += line.TaxBase
+		breakdown.TaxAmount += line.TaxAmount
+		breakdown.TotalPrice += line.TaxBase + line.TaxAmount
+	}
+	return nil
+}
+
+func mappingTaxRateAttributes(rate tax.Rate) view.TaxRateAttributes {
+	return view.TaxRateAttributes{
+		Name:          rate.Name,
+		Rate:          rate.Rate,
+		PriceMode:     rate.PriceMode,
+		EffectiveFrom: rate.EffectiveFrom,
+		Status:        rate.Status,
+		CreatedAt:     rate.CreatedAt,
+		CreatedBy:     rate.CreatedBy,
+		UpdatedAt:     rate.UpdatedAt,
+		LastUpdateBy:  rate.LastUpdateBy,
+		DeletedAt:     rate.DeletedAt,
+		ProjectID:     rate.ProjectID,
+	}
+}
@@ -0,0 +1,13 @@
+package controller
+
+type reqTaxRate struct {
+	Name          string  `json:"name" validate:"required"`
+	Rate          float64 `json:"rate"`
+	PriceMode     string  `json:"priceMode" validate:"required"`
+	EffectiveFrom string  `json:"effectiveFrom" validate:"required"`
+	UserID        string  `json:"userID" validate:"required"`
+}
+
+type reqDeleteTaxRate struct {
+	UserID string `json:"userID"`
+}
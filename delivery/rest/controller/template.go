@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/delivery/rest/view"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/document"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/template"
+	"git.sstv.io/lib/go/gojunkyard.git/form"
+	"git.sstv.io/lib/go/gojunkyard.git/router"
+)
+
+func (c *Controller) handlePostTemplate(w http.ResponseWriter, r *http.Request) {
+	var params reqTemplate
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostTemplate] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+	if !template.IsValidLocale(params.Locale) {
+		c.reporter.Warningf("[handlePostTemplate] invalid locale %s", params.Locale)
+		view.RenderJSONError(w, template.ErrInvalidLocale.Error(), http.StatusBadRequest)
+		return
+	}
+	_, err = template.Parse(params.Name, params.Content)
+	if err != nil {
+		c.reporter.Warningf("[handlePostTemplate] invalid template, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid template: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tmpl := template.Template{
+		Name:      params.Name,
+		Locale:    params.Locale,
+		Content:   params.Content,
+		CreatedBy: params.UserID,
+	}
+	err = c.template.Upload(&tmpl, params.Activate)
+	if err != nil {
+		c.reporter.Errorf("[handlePostTemplate] failed upload template, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed upload template", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderJSONData(w, toTemplateResponse(tmpl), http.StatusCreated)
+}
+
+func (c *Controller) handleGetTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	name := router.GetParam(r, "name")
+
+	tmpls, err := c.template.SelectVersions(name)
+	if err != nil {
+		c.reporter.Errorf("[handleGetTemplateVersions] failed get template versions, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get template versions", http.StatusInternalServerError)
+		return
+	}
+
+	res := make([]view.DataResponseTemplate, 0, len(tmpls))
+	for _, tmpl := range tmpls {
+		res = append(res, toTemplateResponse(tmpl))
+	}
+
+	view.RenderJSONData(w, res, http.StatusOK)
+}
+
+func (c *Controller) handlePatchTemplateActive(w http.ResponseWriter, r *http.Request) {
+	var (
+		params reqActivateTemplate
+		name   = router.GetParam(r, "name")
+	)
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchTemplateActive] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+
+	err = c.template.Activate(name, params.Locale, params.Version, params.UserID)
+	if err == sql.ErrNoRows {
+		c.reporter.Warningf("[handlePatchTemplateActive] template %s %s version %d not found", name, params.Locale, params.Version)
+		view.RenderJSONError(w, "Template version not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePatchTemplateActive] failed activate template, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed activate template", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := c.template.GetVersion(name, params.Locale, params.Version)
+	if err != nil {
+		c.reporter.Errorf("[handlePatchTemplateActive] failed get template, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get template", http.StatusInternalServerError)
+		return
+	}
+
+	view.RenderJSONData(w, toTemplateResponse(tmpl), http.StatusOK)
+}
+
+// handlePostTemplatePreview renders the template with data of the order, the
+// venue or the quotation, the active version unless version is given
+func (c *Controller) handlePostTemplatePreview(w http.ResponseWriter, r *http.Request) {
+	var (
+		params reqPreviewTemplate
+		name   = router.GetParam(r, "name")
+	)
+
+	err := form.Bind(&params, r)
+	if err != nil {
+		c.reporter.Errorf("[handlePostTemplatePreview] invalid parameter, err: %s", err.Error())
+		view.RenderJSONError(w, "Invalid parameter", http.StatusBadRequest)
+		return
+	}
+	if params.Locale == "" {
+		params.Locale = template.DefaultLocale
+	}
+	if params.Format == "" {
+		params.Format = "html"
+	}
+	if params.Format != "html" && params.Format != "pdf" {
+		c.reporter.Warningf("[handlePostTemplatePreview] invalid format %s", params.Format)
+		view.RenderJSONError(w, "format must be html or pdf", http.StatusBadRequest)
+		return
+	}
+
+	var templateData map[string]interface{}
+	switch {
+	case params.OrderID != 0:
+		invoice, _, errData := c.invoiceDocument(params.OrderID, "")
+		err = errData
+		templateData = invoice.TemplateData()
+	case params.VenueID != 0:
+		certificate, _, errData := c.certificateDocument(params.VenueID, "")
+		err = errData
+		templateData = certificate.TemplateData()
+		if params.Orientation == "" {
+			params.Orientation = document.Landscape
+		}
+	case params.QuotationID != 0:
+		q, errData := c.quotation.Get(params.QuotationID, c.projectID, "")
+		if errData == nil {
+			var doc document.Quotation
+			doc, _, errData = c.quotationDocument(q)
+			templateData = doc.TemplateData()
+		}
+		err = errData
+	default:
+		c.reporter.Warningf("[handlePostTemplatePreview] orderID, venueID or quotationID is required")
+		view.RenderJSONError(w, "orderID, venueID or quotationID is required", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		c.reporter.Warningf("[handlePostTemplatePreview] %s", err.Error())
+		view.RenderJSONError(w, "Sample data not found", http.StatusNotFound)
+		return
+	}
+
+	t, err := c.template.GetLocale(name, params.Locale)
+	if params.Version != 0 {
+		var tmpl template.Template
+		tmpl, err = c.template.GetVersion(name, params.Locale, params.Version)
+		if err == nil {
+			t, err = template.Parse(tmpl.Name, tmpl.Content)
+		}
+	}
+	if err == sql.ErrNoRows || err == template.ErrTemplateNotFound {
+		c.reporter.Warningf("[handlePostTemplatePreview] template %s not found", name)
+		view.RenderJSONError(w, "Template not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		c.reporter.Errorf("[handlePostTemplatePreview] failed get template, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed get template", http.StatusInternalServerError)
+		return
+	}
+
+	buff := bytes.NewBuffer([]byte{})
+	err = t.Execute(buff, templateData)
+	if err != nil {
+		c.reporter.Warningf("[handlePostTemplatePreview] failed execute template, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed execute template: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	if params.Format == "html" {
+		view.RenderHTML(w, buff.Bytes(), http.StatusOK)
+		return
+	}
+
+	pdf, err := document.RenderHTML(buff, params.Orientation)
+	if err != nil {
+		c.reporter.Errorf("[handlePostTemplatePreview] failed generate pdf, err: %s", err.Error())
+		view.RenderJSONError(w, "Failed generate pdf", http.StatusInternalServerError)
+		return
+	}
+	view.RenderPDF(w, pdf, strings.TrimSuffix(name, ".tmpl")+".pdf", "inline", http.StatusOK)
+}
+
+func toTemplateResponse(tmpl template.Template) view.DataResponseTemplate {
+	return view.DataResponseTemplate{
+		ID:   tmpl.ID,
+		Type: "template",
+		Attributes: view.TemplateAttributes{
+			Name:      tmpl.Name,
+			Locale:    tmpl.Locale,
+			Version:   tmpl.Version,
+			Content:   tmpl.Content,
+			Active:    tmpl.Active,
+			CreatedAt: tmpl.CreatedAt,
+			CreatedBy: tmpl.CreatedBy,
+		},
+	}
+}
+
+// templateLocale is the locale documents and emails are rendered in for the
+// locale of a company, the default one when it has none
+func templateLocale(locale string) string {
+	if locale == "" {
+		return template.DefaultLocale
+	}
+	return locale
+}
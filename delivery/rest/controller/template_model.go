@@ -0,0 +1,25 @@
+package controller
+
+type reqTemplate struct {
+	Name     string `json:"name" validate:"required"`
+	Locale   string `json:"locale" validate:"required"`
+	Content  string `json:"content" validate:"required"`
+	Activate bool   `json:"activate"`
+	UserID   string `json:"userID" validate:"required"`
+}
+
+type reqActivateTemplate struct {
+	Locale  string `json:"locale" validate:"required"`
+	Version int64  `json:"version" validate:"required"`
+	UserID  string `json:"userID" validate:"required"`
+}
+
+type reqPreviewTemplate struct {
+	Locale      string `json:"locale"`
+	Version     int64  `json:"version"`
+	Format      string `json:"format"`
+	Orientation string `json:"orientation"`
+	OrderID     int64  `json:"orderID"`
+	VenueID     int64  `json:"venueID"`
+	QuotationID int64  `json:"quotationID"`
+}
@@ -448,7 +448,7 @@ func (c *Controller) handleDeleteVenue(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = c.venue.Delete(c.projectID, id, userid, venues.CreatedBy, isAdmin)
+	err = c.venue.Delete(c.projectID, id, userid, venues.CreatedBy, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteVenue] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete Venue", http.StatusInternalServerError)
@@ -511,7 +511,7 @@ func (c *Controller) handlePostVenue(w http.ResponseWriter, r *http.Request) {
 		ProjectID:					  c.projectID,
 	}
 
-	err = c.venue.Insert(&venue)
+	err = c.venue.Insert(&venue, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostVenue] error insert Venue repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post Venue", http.StatusInternalServerError)
@@ -522,7 +522,7 @@ func (c *Controller) handlePostVenue(w http.ResponseWriter, r *http.Request) {
 		err = c.venue.InsertVenueAvailable(params.City, 1)
 	}
 
-	err = c.InsertLicense(venue.Id, venue.CreatedBy, venue.CreatedBy)
+	err = c.InsertLicense(venue.Id, venue.CreatedBy, venue.CreatedBy, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostVenue] Failed post license, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post license", http.StatusInternalServerError)
@@ -612,7 +612,7 @@ func (c *Controller) handlePatchVenue(w http.ResponseWriter, r *http.Request) {
 		UpdatedAt:					  time.Now(),
 		ProjectID:					  c.projectID,
 	}
-	err = c.venue.Update(&venue, userid, isAdmin)
+	err = c.venue.Update(&venue, userid, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchVenue] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update Venue", http.StatusInternalServerError)
@@ -713,7 +713,7 @@ func (c *Controller) handleShowStatusVenue(w http.ResponseWriter, r *http.Reques
 		ShowStatus:       status,
 		ProjectID:		  c.projectID,
 	}
-	err = c.venue.Update(&venue, userid, isAdmin)
+	err = c.venue.Update(&venue, userid, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchVenue] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update Venue", http.StatusInternalServerError)
@@ -768,7 +768,7 @@ func (c *Controller) handleShowStatusVenue(w http.ResponseWriter, r *http.Reques
 	return
 }
 
-func (c *Controller) InsertLicense(venueID int64, createdBy string, buyerID string) error {
+func (c *Controller) InsertLicense(venueID int64, createdBy string, buyerID string, requestID string) error {
 	var (
 		licenseNumberUUID = util.GenerateUUID()
 		layout            = "2006-01-02T15:04:05.000Z"
@@ -789,7 +789,7 @@ func (c *Controller) InsertLicense(venueID int64, createdBy string, buyerID stri
 		BuyerID:       buyerID,
 	}
 
-	err = c.license.Insert(&license)
+	err = c.license.Insert(&license, requestID)
 	if err != nil {
 		return err
 	}
@@ -90,7 +90,7 @@ func (c *Controller) handleDeleteVenueType(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = c.venueType.Delete(c.projectID, id, venueTy.CommercialTypeID, userID.(string), isAdmin)
+	err = c.venueType.Delete(c.projectID, id, venueTy.CommercialTypeID, userID.(string), isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handleDeleteVenueType] error delete repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed delete VenueType", http.StatusInternalServerError)
@@ -124,7 +124,7 @@ func (c *Controller) handlePostVenueType(w http.ResponseWriter, r *http.Request)
 		ProjectID:		 c.projectID,
 	}
 
-	err = c.venueType.Insert(&venueType)
+	err = c.venueType.Insert(&venueType, getRequestID(r))
 	if err != nil {
 		c.reporter.Infof("[handlePostVenueType] error insert VenueType repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed post VenueType", http.StatusInternalServerError)
@@ -194,7 +194,7 @@ func (c *Controller) handlePatchVenueType(w http.ResponseWriter, r *http.Request
 		ProjectID:		  c.projectID,
 		UpdatedAt:		  time.Now(),
 	}
-	err = c.venueType.Update(&venueType, venueTy.CommercialTypeID, isAdmin)
+	err = c.venueType.Update(&venueType, venueTy.CommercialTypeID, isAdmin, getRequestID(r))
 	if err != nil {
 		c.reporter.Errorf("[handlePatchVenueType] error updating repository, err: %s", err.Error())
 		view.RenderJSONError(w, "Failed update VenueType", http.StatusInternalServerError)
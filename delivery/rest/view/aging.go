@@ -13,14 +13,15 @@ type DataResponseAging struct {
 }
 
 type AgingAttributes struct {
-	Name         string    `json:"name"`
-	Description  string    `json:"description"`
-	Price        float64   `json:"price"`
-	Status       int8      `json:"status"`
-	CreatedAt    time.Time `json:"created_at"`
-	CreatedBy    string    `json:"created_by"`
-	UpdatedAt    null.Time `json:"updated_at"`
-	LastUpdateBy string    `json:"last_update_by"`
-	DeletedAt    null.Time `json:"deleted_at"`
-	ProjectID    int64     `json:"project_id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	Price          float64   `json:"price"`
+	DurationMonths int64     `json:"duration_months"`
+	Status         int8      `json:"status"`
+	CreatedAt      time.Time `json:"created_at"`
+	CreatedBy      string    `json:"created_by"`
+	UpdatedAt      null.Time `json:"updated_at"`
+	LastUpdateBy   string    `json:"last_update_by"`
+	DeletedAt      null.Time `json:"deleted_at"`
+	ProjectID      int64     `json:"project_id"`
 }
@@ -0,0 +1,21 @@
+package view
+
+import (
+	"time"
+)
+
+type DataResponseAuditLog struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type AuditLogAttributes struct {
+	EntityType string      `json:"entityType"`
+	EntityID   int64       `json:"entityID"`
+	Action     string      `json:"action"`
+	ActorID    string      `json:"actorID"`
+	RequestID  string      `json:"requestID"`
+	Changes    interface{} `json:"changes"`
+	CreatedAt  time.Time   `json:"createdAt"`
+}
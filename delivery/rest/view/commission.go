@@ -0,0 +1,54 @@
+package view
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+type DataResponseCommission struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type CommissionSchemeAttributes struct {
+	Name            string      `json:"name"`
+	BeneficiaryType string      `json:"beneficiaryType"`
+	BeneficiaryID   int64       `json:"beneficiaryID"`
+	ProductID       null.Int    `json:"productID"`
+	VenueTypeID     null.Int    `json:"venueTypeID"`
+	Rate            float64     `json:"rate"`
+	Tiers           interface{} `json:"tiers"`
+	Status          int16       `json:"status"`
+	CreatedAt       time.Time   `json:"createdAt"`
+	CreatedBy       string      `json:"createdBy"`
+	UpdatedAt       time.Time   `json:"updatedAt"`
+	LastUpdateBy    string      `json:"lastUpdateBy"`
+	DeletedAt       null.Time   `json:"deletedAt"`
+	ProjectID       int64       `json:"projectID"`
+}
+
+type CommissionStatementAttributes struct {
+	BeneficiaryType string                      `json:"beneficiaryType"`
+	BeneficiaryID   int64                       `json:"beneficiaryID"`
+	Period          string                      `json:"period"`
+	Earned          float64                     `json:"earned"`
+	Reversed        float64                     `json:"reversed"`
+	Net             float64                     `json:"net"`
+	Entries         []CommissionEntryAttributes `json:"entries"`
+}
+
+type CommissionEntryAttributes struct {
+	ID          int64     `json:"id"`
+	SchemeID    int64     `json:"schemeID"`
+	OrderID     int64     `json:"orderID"`
+	OrderNumber string    `json:"orderNumber"`
+	VenueID     int64     `json:"venueID"`
+	EntryType   string    `json:"entryType"`
+	BaseAmount  float64   `json:"baseAmount"`
+	Rate        float64   `json:"rate"`
+	Amount      float64   `json:"amount"`
+	RefundID    null.Int  `json:"refundID"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
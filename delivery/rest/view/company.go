@@ -14,6 +14,7 @@ type CompanyAttributes struct {
 	Zip		  		string    `json:"zip"`
 	Email		  	string    `json:"email"`
 	Npwp		  	string    `json:"npwp"`
+	Locale		  	string    `json:"locale"`
 	CreatedAt    	time.Time `json:"createdAt"`
 	UpdatedAt    	time.Time `json:"updatedAt"`
 	DeletedAt    	null.Time `json:"deletedAt"`
@@ -0,0 +1,26 @@
+package view
+
+import (
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+type DataResponseEmailOutbox struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type EmailOutboxAttributes struct {
+	EmailType     string      `json:"emailType"`
+	OrderID       int64       `json:"orderID"`
+	VenueID       int64       `json:"venueID"`
+	Status        string      `json:"status"`
+	Attempts      int64       `json:"attempts"`
+	NextAttemptAt time.Time   `json:"nextAttemptAt"`
+	LastError     null.String `json:"lastError"`
+	SentAt        null.Time   `json:"sentAt"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	UpdatedAt     time.Time   `json:"updatedAt"`
+}
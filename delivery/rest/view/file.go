@@ -0,0 +1,47 @@
+package view
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+)
+
+// mimeHTML, mimePDF and mimeCSV are reusable text/html, application/pdf and
+// text/csv types
+var (
+	mimeHTML = [...]string{"text/html; charset=utf-8"}
+	mimePDF  = [...]string{"application/pdf"}
+	mimeCSV  = [...]string{"text/csv; charset=utf-8"}
+)
+
+// RenderHTML is used to render html page
+func RenderHTML(w http.ResponseWriter, html []byte, statusCode int) {
+	h := w.Header()
+	h["Content-Type"] = mimeHTML[:]
+
+	w.WriteHeader(statusCode)
+	w.Write(html)
+}
+
+// RenderPDF is used to render pdf document as filename, disposition is inline
+// to show it in the browser or attachment to download it
+func RenderPDF(w http.ResponseWriter, pdf []byte, filename string, disposition string, statusCode int) {
+	h := w.Header()
+	h["Content-Type"] = mimePDF[:]
+	h.Set("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": filename}))
+	h.Set("Content-Length", strconv.Itoa(len(pdf)))
+
+	w.WriteHeader(statusCode)
+	w.Write(pdf)
+}
+
+// RenderCSV is used to render csv document as attachment filename
+func RenderCSV(w http.ResponseWriter, csv []byte, filename string, statusCode int) {
+	h := w.Header()
+	h["Content-Type"] = mimeCSV[:]
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	h.Set("Content-Length", strconv.Itoa(len(csv)))
+
+	w.WriteHeader(statusCode)
+	w.Write(csv)
+}
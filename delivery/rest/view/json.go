@@ -12,8 +12,9 @@ type (
 		Error string `json:"error"`
 	}
 	jsonDataResponse struct {
-		Data    interface{} `json:"data"`
-		HasNext bool        `json:"hasNext,omitempty"`
+		Data       interface{} `json:"data"`
+		HasNext    bool        `json:"hasNext,omitempty"`
+		NextCursor string      `json:"nextCursor,omitempty"`
 	}
 )
 
@@ -36,6 +37,7 @@ func (r *jsonErrorResponse) put() {
 }
 
 func (r *jsonDataResponse) put() {
+	*r = jsonDataResponse{}
 	jsonDataPool.Put(r)
 }
 
@@ -83,6 +85,23 @@ func RenderJSONDataPage(w http.ResponseWriter, data interface{}, hasNext bool, s
 	response.put()
 }
 
+// RenderJSONDataCursor is used to render a page of json data with the cursor
+// of the next page, hasNext is set when there is one
+// Example Result: {"data":[{"id":1}],"hasNext":true,"nextCursor":"eyJzIjo"}
+func RenderJSONDataCursor(w http.ResponseWriter, data interface{}, nextCursor string, statusCode int) {
+	h := w.Header()
+	h["Content-Type"] = mimeJSON[:]
+
+	response := jsonDataPool.Get().(*jsonDataResponse)
+	response.Data = data
+	response.HasNext = nextCursor != ""
+	response.NextCursor = nextCursor
+
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+	response.put()
+}
+
 // RenderJSON is used to render json. It can render struct or primitive data type
 // Example Result: {"id":1,"name":"supersoccer"}
 func RenderJSON(w http.ResponseWriter, v interface{}, statusCode int) {
@@ -18,3 +18,18 @@ type LicenseAttributes struct {
 	LastUpdateBy  string    `json:"lastUpdateBy"`
 	BuyerID       string    `json:"buyerId"`
 }
+
+type LicenseVerdictAttributes struct {
+	Verdict       string      `json:"verdict"`
+	Reason        string      `json:"reason,omitempty"`
+	LicenseNumber string      `json:"licenseNumber,omitempty"`
+	VenueID       int64       `json:"venueId,omitempty"`
+	ExpiredAt     null.Time   `json:"expiredAt"`
+	IssuedAt      null.Time   `json:"issuedAt"`
+	Venue         interface{} `json:"venue,omitempty"`
+}
+
+type LicenseTokenKeyAttributes struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"`
+}
@@ -22,31 +22,44 @@ type DataResponseOrderPayment struct {
 }
 
 type OrderAttributes struct {
-	OrderNumber       string    `json:"order_number"`
-	BuyerID           string    `json:"buyer_id"`
-	VenueID           int64     `json:"venue_id"`
-	DeviceID          int64     `json:"device_id"`
-	ProductID         int64     `json:"product_id"`
-	InstallationID    int64     `json:"installation_id"`
-	Quantity          int64     `json:"quantity"`
-	AgingID           int64     `json:"aging_id"`
-	RoomID            int64     `json:"room_id"`
-	RoomQuantity      int64     `json:"room_quantity"`
-	TotalPrice        float64   `json:"total_price"`
-	PaymentMethodID   int64     `json:"payment_method_id"`
-	PaymentFee        float64   `json:"payment_fee"`
-	Status            int16     `json:"status"`
-	CreatedAt         time.Time `json:"created_at"`
-	CreatedBy         string    `json:"created_by"`
-	UpdatedAt         time.Time `json:"updated_at"`
-	LastUpdateBy      string    `json:"last_update_by"`
-	DeletedAt         null.Time `json:"deleted_at"`
-	PendingAt         null.Time `json:"pending_at"`
-	PaidAt            null.Time `json:"paid_at"`
-	FailedAt          null.Time `json:"failed_at"`
-	ProjectID         int64     `json:"project_id"`
-	Email             string    `json:"email"`
-	OpenPaymentStatus int16     `json:"open_payment_status"`
+	OrderNumber       string      `json:"order_number"`
+	BuyerID           string      `json:"buyer_id"`
+	VenueID           int64       `json:"venue_id"`
+	DeviceID          int64       `json:"device_id"`
+	ProductID         int64       `json:"product_id"`
+	InstallationID    int64       `json:"installation_id"`
+	Quantity          int64       `json:"quantity"`
+	AgingID           int64       `json:"aging_id"`
+	RoomID            int64       `json:"room_id"`
+	RoomQuantity      int64       `json:"room_quantity"`
+	TotalPrice        float64     `json:"total_price"`
+	PaymentMethodID   int64       `json:"payment_method_id"`
+	PaymentFee        float64     `json:"payment_fee"`
+	Status            int16       `json:"status"`
+	CreatedAt         time.Time   `json:"created_at"`
+	CreatedBy         string      `json:"created_by"`
+	UpdatedAt         time.Time   `json:"updated_at"`
+	LastUpdateBy      string      `json:"last_update_by"`
+	DeletedAt         null.Time   `json:"deleted_at"`
+	PendingAt         null.Time   `json:"pending_at"`
+	PaidAt            null.Time   `json:"paid_at"`
+	FailedAt          null.Time   `json:"failed_at"`
+	ProjectID         int64       `json:"project_id"`
+	Email             string      `json:"email"`
+	OpenPaymentStatus int16       `json:"open_payment_status"`
+	OrderType         string      `json:"order_type"`
+	Details           interface{} `json:"details,omitempty"`
+}
+
+type OrderStatusHistoryAttributes struct {
+	OrderID        int64     `json:"order_id"`
+	FromStatus     null.Int  `json:"from_status"`
+	FromStatusName string    `json:"from_status_name"`
+	ToStatus       int16     `json:"to_status"`
+	ToStatusName   string    `json:"to_status_name"`
+	Reason         string    `json:"reason"`
+	CreatedBy      string    `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 type PaymentAttributes struct {
@@ -55,6 +68,8 @@ type PaymentAttributes struct {
 
 type CalculatePriceAttributes struct {
 	TotalPrice float64     `json:"total_price"`
+	TaxBase    float64     `json:"tax_base"`
+	TaxAmount  float64     `json:"tax_amount"`
 	Details    interface{} `json:"details"`
 }
 
@@ -119,4 +134,5 @@ type SumOrderAttributes struct {
 	OrderStatus       int64     `db:"order_status"`
 	OpenPaymentStatus int64     `db:"open_payment_status"`
 	EcertLastSentDate null.Time `db:"ecert_last_sent_date"`
+	RefundedAmount    float64   `db:"order_refunded_amount"`
 }
@@ -0,0 +1,27 @@
+package view
+
+import (
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+type DataResponseOrderJob struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type OrderJobAttributes struct {
+	JobType       string      `json:"jobType"`
+	OrderID       int64       `json:"orderID"`
+	VenueID       int64       `json:"venueID"`
+	RefundID      null.Int    `json:"refundID"`
+	Status        string      `json:"status"`
+	Attempts      int64       `json:"attempts"`
+	NextAttemptAt time.Time   `json:"nextAttemptAt"`
+	LastError     null.String `json:"lastError"`
+	DoneAt        null.Time   `json:"doneAt"`
+	CreatedAt     time.Time   `json:"createdAt"`
+	UpdatedAt     time.Time   `json:"updatedAt"`
+}
@@ -0,0 +1,13 @@
+package view
+
+type DataResponsePaymentCallback struct {
+	ID         interface{} `json:"id"`
+	Type       string      `json:"type"`
+	Attributes interface{} `json:"attributes"`
+}
+
+type PaymentCallbackAttributes struct {
+	Reference     string `json:"reference"`
+	TransactionID string `json:"transaction_id"`
+	Status        string `json:"status"`
+}
@@ -0,0 +1,31 @@
+package view
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+type DataResponsePaymentMethod struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type PaymentMethodAttributes struct {
+	Name            string    `json:"name"`
+	Category        string    `json:"category"`
+	GatewayMethodID int64     `json:"gatewayMethodID"`
+	FixedFee        float64   `json:"fixedFee"`
+	PercentageFee   float64   `json:"percentageFee"`
+	MinAmount       float64   `json:"minAmount"`
+	MaxAmount       float64   `json:"maxAmount"`
+	Fee             *float64  `json:"fee,omitempty"`
+	Status          int16     `json:"status"`
+	CreatedAt       time.Time `json:"createdAt"`
+	CreatedBy       string    `json:"createdBy"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+	LastUpdateBy    string    `json:"lastUpdateBy"`
+	DeletedAt       null.Time `json:"deletedAt"`
+	ProjectID       int64     `json:"projectID"`
+}
@@ -0,0 +1,47 @@
+package view
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+type DataResponsePricingRule struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type PricingRuleAttributes struct {
+	Name            string      `json:"name"`
+	VenueTypeID     *int64      `json:"venueTypeID"`
+	PricingGroupID  *int64      `json:"pricingGroupID"`
+	ItemType        string      `json:"itemType"`
+	OrderType       string      `json:"orderType"`
+	RuleType        string      `json:"ruleType"`
+	Price           null.Float  `json:"price"`
+	OccupancyFactor float64     `json:"occupancyFactor"`
+	Tiers           interface{} `json:"tiers"`
+	Status          int16       `json:"status"`
+	CreatedAt       time.Time   `json:"createdAt"`
+	CreatedBy       string      `json:"createdBy"`
+	UpdatedAt       time.Time   `json:"updatedAt"`
+	LastUpdateBy    string      `json:"lastUpdateBy"`
+	DeletedAt       null.Time   `json:"deletedAt"`
+	ProjectID       int64       `json:"projectID"`
+}
+
+type PriceDetailAttributes struct {
+	VenueID     int64   `json:"venue_id,omitempty"`
+	ItemType    string  `json:"item_type"`
+	ItemID      int64   `json:"item_id"`
+	Description string  `json:"description"`
+	RuleID      int64   `json:"rule_id"`
+	RuleType    string  `json:"rule_type"`
+	UnitPrice   float64 `json:"unit_price"`
+	Quantity    int64   `json:"quantity"`
+	Amount      float64 `json:"amount"`
+	TaxRate     float64 `json:"tax_rate"`
+	TaxBase     float64 `json:"tax_base"`
+	TaxAmount   float64 `json:"tax_amount"`
+}
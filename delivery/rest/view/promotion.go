@@ -0,0 +1,49 @@
+package view
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+type DataResponsePromotion struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type PromotionAttributes struct {
+	Name              string      `json:"name"`
+	Campaign          string      `json:"campaign"`
+	Code              null.String `json:"code"`
+	DiscountType      string      `json:"discountType"`
+	DiscountValue     float64     `json:"discountValue"`
+	MaxDiscount       null.Float  `json:"maxDiscount"`
+	ItemType          string      `json:"itemType"`
+	OrderType         string      `json:"orderType"`
+	VenueTypeIDs      []int64     `json:"venueTypeIDs"`
+	CommercialTypeIDs []int64     `json:"commercialTypeIDs"`
+	Cities            []string    `json:"cities"`
+	ProductIDs        []int64     `json:"productIDs"`
+	UsageLimit        int64       `json:"usageLimit"`
+	PerBuyerLimit     int64       `json:"perBuyerLimit"`
+	StartAt           time.Time   `json:"startAt"`
+	EndAt             time.Time   `json:"endAt"`
+	Status            int16       `json:"status"`
+	CreatedAt         time.Time   `json:"createdAt"`
+	CreatedBy         string      `json:"createdBy"`
+	UpdatedAt         time.Time   `json:"updatedAt"`
+	LastUpdateBy      string      `json:"lastUpdateBy"`
+	DeletedAt         null.Time   `json:"deletedAt"`
+	ProjectID         int64       `json:"projectID"`
+}
+
+type PromotionCampaignAttributes struct {
+	Campaign     string  `json:"campaign"`
+	Promotions   int64   `json:"promotions"`
+	Orders       int64   `json:"orders"`
+	Discount     float64 `json:"discount"`
+	PaidOrders   int64   `json:"paidOrders"`
+	PaidDiscount float64 `json:"paidDiscount"`
+	PaidRevenue  float64 `json:"paidRevenue"`
+}
@@ -0,0 +1,39 @@
+package view
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+type DataResponseQuotation struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type QuotationAttributes struct {
+	QuotationNumber string      `json:"quotation_number"`
+	BuyerID         string      `json:"buyer_id"`
+	VenueID         int64       `json:"venue_id"`
+	DeviceID        int64       `json:"device_id"`
+	ProductID       int64       `json:"product_id"`
+	InstallationID  int64       `json:"installation_id"`
+	AgingID         int64       `json:"aging_id"`
+	RoomID          int64       `json:"room_id"`
+	RoomQuantity    int64       `json:"room_quantity"`
+	TotalPrice      float64     `json:"total_price"`
+	TaxBase         float64     `json:"tax_base"`
+	TaxAmount       float64     `json:"tax_amount"`
+	Email           string      `json:"email"`
+	ValidUntil      time.Time   `json:"valid_until"`
+	Status          string      `json:"status"`
+	OrderID         null.Int    `json:"order_id"`
+	ConvertedAt     null.Time   `json:"converted_at"`
+	CreatedAt       time.Time   `json:"created_at"`
+	CreatedBy       string      `json:"created_by"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+	LastUpdateBy    string      `json:"last_update_by"`
+	ProjectID       int64       `json:"project_id"`
+	Details         interface{} `json:"details,omitempty"`
+}
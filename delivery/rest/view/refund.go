@@ -0,0 +1,34 @@
+package view
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+type DataResponseRefund struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type RefundAttributes struct {
+	OrderID         int64       `json:"orderID"`
+	Amount          float64     `json:"amount"`
+	Reason          string      `json:"reason"`
+	Status          string      `json:"status"`
+	GatewayRefundID string      `json:"gatewayRefundID"`
+	Details         interface{} `json:"details"`
+	CreatedAt       time.Time   `json:"createdAt"`
+	CreatedBy       string      `json:"createdBy"`
+	UpdatedAt       time.Time   `json:"updatedAt"`
+	LastUpdateBy    string      `json:"lastUpdateBy"`
+	CompletedAt     null.Time   `json:"completedAt"`
+	ProjectID       int64       `json:"projectID"`
+}
+
+type RefundDetailAttributes struct {
+	ID            int64   `json:"id"`
+	OrderDetailID int64   `json:"orderDetailID"`
+	Amount        float64 `json:"amount"`
+}
@@ -0,0 +1,27 @@
+package view
+
+import (
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+type DataResponseTaxRate struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type TaxRateAttributes struct {
+	Name          string    `json:"name"`
+	Rate          float64   `json:"rate"`
+	PriceMode     string    `json:"priceMode"`
+	EffectiveFrom time.Time `json:"effectiveFrom"`
+	Status        int16     `json:"status"`
+	CreatedAt     time.Time `json:"createdAt"`
+	CreatedBy     string    `json:"createdBy"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+	LastUpdateBy  string    `json:"lastUpdateBy"`
+	DeletedAt     null.Time `json:"deletedAt"`
+	ProjectID     int64     `json:"projectID"`
+}
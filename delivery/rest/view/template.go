@@ -0,0 +1,21 @@
+package view
+
+import (
+	"time"
+)
+
+type DataResponseTemplate struct {
+	ID         interface{} `json:"id,omitempty"`
+	Type       string      `json:"type,omitempty"`
+	Attributes interface{} `json:"attributes,omitempty"`
+}
+
+type TemplateAttributes struct {
+	Name      string    `json:"name"`
+	Locale    string    `json:"locale"`
+	Version   int64     `json:"version"`
+	Content   string    `json:"content,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"createdAt"`
+	CreatedBy string    `json:"createdBy"`
+}
@@ -14,5 +14,6 @@ require (
 	github.com/leekchan/accounting v0.0.0-20190702062627-a09595581342
 	github.com/skip2/go-qrcode v0.0.0-20190110000554-dc11ecdae0a9
 	github.com/stretchr/testify v1.3.0 // indirect
+	golang.org/x/crypto v0.0.0-20190605123033-f99c8df09eb5
 	gopkg.in/guregu/null.v3 v3.4.0
 )
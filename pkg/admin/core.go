@@ -1,14 +1,11 @@
 package admin
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
@@ -26,44 +23,32 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db    *sqlx.DB
-	redis *redis.Pool
+	cache cache.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "admin"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (admins Admins, err error) {
-	redisKey := fmt.Sprintf("%s:admins", redisPrefix)
-	admins, err = c.selectFromCache(redisKey)
-	if err != nil {
-		admins, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(admins)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "admins", cacheTTL, &admins, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
 func (c *core) SelectByUserID(pid int64, userID string) (admins Admins, err error) {
-	redisKey := fmt.Sprintf("%s:admins:%s", redisPrefix, userID)
-	admins, err = c.selectFromCache(redisKey)
-	if err != nil {
-		admins, err = c.selectByUserIDFromDB(pid, userID)
-		byt, _ := jsoniter.ConfigFastest.Marshal(admins)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("admins:%s", userID), cacheTTL, &admins, func() (interface{}, error) {
+		return c.selectByUserIDFromDB(pid, userID)
+	})
 	return
 }
 
 func (c *core) Get(pid int64, id int64) (admin Admin, err error) {
-	redisKey := fmt.Sprintf("%s:%d:admins:%d", redisPrefix, pid, id)
-
-	admin, err = c.getFromCache(redisKey)
-	if err != nil {
-		admin, err = c.getFromDB(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(admin)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("admins:%d", id), cacheTTL, &admin, func() (interface{}, error) {
+		return c.getFromDB(pid, id)
+	})
 	return
 }
 
@@ -193,11 +178,7 @@ func (c *core) Insert(admin *Admin) (err error) {
 	`, admin)
 	admin.ID, err = res.LastInsertId()
 
-	redisKey := fmt.Sprintf("%s:admins", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:admins:%s", redisPrefix, admin.UserID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, admin.ProjectID))
 
 	return
 }
@@ -220,14 +201,7 @@ func (c *core) Update(admin *Admin, userID string) (err error) {
 			status = 1
 	`, admin)
 
-	redisKey := fmt.Sprintf("%s:%d:admins:%d", redisPrefix, admin.ProjectID, admin.ID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:admins", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:admins:%s", redisPrefix, userID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, admin.ProjectID))
 
 	return
 }
@@ -247,14 +221,7 @@ func (c *core) Delete(pid int64, id int64, userID string) (err error) {
 			project_id = ?
 	`, now, id, pid)
 
-	redisKey := fmt.Sprintf("%s:%d:admins:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:admins", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:admins:%s", redisPrefix, userID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 
 	return
 }
@@ -284,38 +251,3 @@ func (c *core) Check(userID string) (admin Admin, err error) {
 	`, userID)
 	return
 }
-
-func (c *core) selectFromCache(key string) (admins Admins, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &admins)
-	return
-}
-
-func (c *core) getFromCache(key string) (admin Admin, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &admin)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
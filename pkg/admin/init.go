@@ -5,16 +5,16 @@ import (
 	"log"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
 )
 
 // Init is used to initialize admin package
-func Init(db *sqlx.DB, redis *redis.Pool) ICore {
+func Init(db *sqlx.DB, cache cache.ICore) ICore {
 	examineDBHealth(db)
 	return &core{
 		db:    db,
-		redis: redis,
+		cache: cache,
 	}
 }
 
@@ -1,14 +1,11 @@
 package agent
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
@@ -26,44 +23,32 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db    *sqlx.DB
-	redis *redis.Pool
+	cache cache.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "agent"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (agents Agents, err error) {
-	redisKey := fmt.Sprintf("%s:agents", redisPrefix)
-	agents, err = c.selectFromCache(redisKey)
-	if err != nil {
-		agents, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(agents)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "agents", cacheTTL, &agents, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
 func (c *core) SelectByUserID(pid int64, userID string) (agents Agents, err error) {
-	redisKey := fmt.Sprintf("%s:agents:%s", redisPrefix, userID)
-	agents, err = c.selectFromCache(redisKey)
-	if err != nil {
-		agents, err = c.selectByUserIDFromDB(pid, userID)
-		byt, _ := jsoniter.ConfigFastest.Marshal(agents)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("agents:%s", userID), cacheTTL, &agents, func() (interface{}, error) {
+		return c.selectByUserIDFromDB(pid, userID)
+	})
 	return
 }
 
 func (c *core) Get(pid int64, id int64) (agent Agent, err error) {
-	redisKey := fmt.Sprintf("%s:%d:agents:%d", redisPrefix, pid, id)
-
-	agent, err = c.getFromCache(redisKey)
-	if err != nil {
-		agent, err = c.getFromDB(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(agent)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("agents:%d", id), cacheTTL, &agent, func() (interface{}, error) {
+		return c.getFromDB(pid, id)
+	})
 	return
 }
 
@@ -101,6 +86,7 @@ func (c *core) selectFromDB(pid int64) (agent Agents, err error) {
 		SELECT
 			id,
 			user_id,
+			regional_agent_id,
 			status,
 			created_at,
 			updated_at,
@@ -123,6 +109,7 @@ func (c *core) selectByUserIDFromDB(pid int64, userID string) (agent Agents, err
 		SELECT
 			id,
 			user_id,
+			regional_agent_id,
 			status,
 			created_at,
 			updated_at,
@@ -146,6 +133,7 @@ func (c *core) getFromDB(pid int64, id int64) (agent Agent, err error) {
 			SELECT
 				id,
 				user_id,
+				regional_agent_id,
 				status,
 				created_at,
 				updated_at,
@@ -173,6 +161,7 @@ func (c *core) Insert(agent *Agent) (err error) {
 	res, err := c.db.NamedExec(`
 		INSERT INTO mla_user_checker (
 			user_id,
+			regional_agent_id,
 			created_at,
 			updated_at,
 			deleted_at,
@@ -182,6 +171,7 @@ func (c *core) Insert(agent *Agent) (err error) {
 			last_update_by
 		) VALUES (
 			:user_id,
+			:regional_agent_id,
 			:created_at,
 			:updated_at,
 			:deleted_at,
@@ -193,11 +183,7 @@ func (c *core) Insert(agent *Agent) (err error) {
 	`, agent)
 	agent.ID, err = res.LastInsertId()
 
-	redisKey := fmt.Sprintf("%s:agents", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:agents:%s", redisPrefix, agent.UserID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, agent.ProjectID))
 
 	return
 }
@@ -211,6 +197,7 @@ func (c *core) Update(agent *Agent, userID string) (err error) {
 			mla_user_checker
 		SET
 			user_id = :user_id,
+			regional_agent_id = :regional_agent_id,
 			updated_at = :updated_at,
 			project_id = :project_id,
 			last_update_by = :last_update_by
@@ -220,14 +207,7 @@ func (c *core) Update(agent *Agent, userID string) (err error) {
 			status = 1
 	`, agent)
 
-	redisKey := fmt.Sprintf("%s:%d:agents:%d", redisPrefix, agent.ProjectID, agent.ID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:agents", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:agents:%s", redisPrefix, userID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, agent.ProjectID))
 
 	return
 }
@@ -247,14 +227,7 @@ func (c *core) Delete(pid int64, id int64, userID string) (err error) {
 			project_id = ?
 	`, now, id, pid)
 
-	redisKey := fmt.Sprintf("%s:%d:agents:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:agents", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:agents:%s", redisPrefix, userID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 
 	return
 }
@@ -267,6 +240,7 @@ func (c *core) Check(userID string) (agent Agent, err error) {
 		SELECT
 			id,
 			user_id,
+			regional_agent_id,
 			status,
 			created_at,
 			updated_at,
@@ -284,38 +258,3 @@ func (c *core) Check(userID string) (agent Agent, err error) {
 	`, userID)
 	return
 }
-
-func (c *core) selectFromCache(key string) (agents Agents, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &agents)
-	return
-}
-
-func (c *core) getFromCache(key string) (agent Agent, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &agent)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
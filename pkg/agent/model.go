@@ -3,16 +3,19 @@ package agent
 import "time"
 import "gopkg.in/guregu/null.v3"
 
+// Agent is model for mla_user_checker in db, RegionalAgentID is the regional
+// agent the agent works under
 type Agent struct {
-	ID           int64     `db:"id"`
-	UserID       string    `db:"user_id"`
-	Status       int8      `db:"status"`
-	CreatedAt    time.Time `db:"created_at"`
-	UpdatedAt    time.Time `db:"updated_at"`
-	DeletedAt    null.Time `db:"deleted_at"`
-	ProjectID    int64     `db:"project_id"`
-	CreatedBy    string    `db:"created_by"`
-	LastUpdateBy string    `db:"last_update_by"`
+	ID              int64     `db:"id"`
+	UserID          string    `db:"user_id"`
+	RegionalAgentID null.Int  `db:"regional_agent_id"`
+	Status          int8      `db:"status"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+	DeletedAt       null.Time `db:"deleted_at"`
+	ProjectID       int64     `db:"project_id"`
+	CreatedBy       string    `db:"created_by"`
+	LastUpdateBy    string    `db:"last_update_by"`
 }
 
 type Agents []Agent
@@ -1,23 +1,20 @@
 package aging
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 	"gopkg.in/guregu/null.v3"
 )
 
 // ICore is the interface
 type ICore interface {
-	Insert(aging *Aging) (err error)
-	Update(aging *Aging, isAdmin bool) (err error)
-	Delete(id int64, pid int64, uid string, isAdmin bool) (err error)
+	Insert(aging *Aging, requestID string) (err error)
+	Update(aging *Aging, isAdmin bool, requestID string) (err error)
+	Delete(id int64, pid int64, uid string, isAdmin bool, requestID string) (err error)
 
 	Get(id int64, pid int64) (aging Aging, err error)
 
@@ -27,13 +24,16 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "aging"
+	cacheTTL       = 5 * time.Minute
+)
 
-func (c *core) Insert(aging *Aging) (err error) {
+func (c *core) Insert(aging *Aging, requestID string) (err error) {
 	aging.CreatedAt = time.Now()
 	aging.UpdatedAt = null.TimeFrom(aging.CreatedAt)
 	aging.Status = 1
@@ -43,6 +43,7 @@ func (c *core) Insert(aging *Aging) (err error) {
 			name,
 			description,
 			price,
+			duration_months,
 			status,
 			created_at,
 			created_by,
@@ -50,12 +51,13 @@ func (c *core) Insert(aging *Aging) (err error) {
 			last_update_by,
 			project_id
 		) VALUES (
-			?,?,?,?,?,?,?,?,?)`
+			?,?,?,?,?,?,?,?,?,?)`
 
 	args := []interface{}{
 		aging.Name,
 		aging.Description,
 		aging.Price,
+		aging.DurationMonths,
 		aging.Status,
 		aging.CreatedAt,
 		aging.CreatedBy,
@@ -63,13 +65,17 @@ func (c *core) Insert(aging *Aging) (err error) {
 		aging.LastUpdateBy,
 		aging.ProjectID,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_aging",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    aging.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -77,25 +83,17 @@ func (c *core) Insert(aging *Aging) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    aging.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_aging",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:aging", redisPrefix, aging.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, aging.ProjectID))
 
 	return
 }
 
-func (c *core) Update(aging *Aging, isAdmin bool) (err error) {
+func (c *core) Update(aging *Aging, isAdmin bool, requestID string) (err error) {
 	aging.UpdatedAt = null.TimeFrom(time.Now())
 
 	query := `
@@ -105,6 +103,7 @@ func (c *core) Update(aging *Aging, isAdmin bool) (err error) {
 			name = ?,
 			description = ?,
 			price = ?,
+			duration_months = ?,
 			updated_at = ?,
 			last_update_by = ?
 		WHERE
@@ -116,6 +115,7 @@ func (c *core) Update(aging *Aging, isAdmin bool) (err error) {
 		aging.Name,
 		aging.Description,
 		aging.Price,
+		aging.DurationMonths,
 		aging.UpdatedAt,
 		aging.LastUpdateBy,
 		aging.ID,
@@ -127,37 +127,32 @@ func (c *core) Update(aging *Aging, isAdmin bool) (err error) {
 		args = append(args, aging.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_aging",
+		EntityID:   aging.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    aging.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    aging.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_aging",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:aging", redisPrefix, aging.ProjectID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:aging:%d", redisPrefix, aging.ProjectID, aging.ID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, aging.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(id int64, pid int64, uid string, isAdmin bool) (err error) {
+func (c *core) Delete(id int64, pid int64, uid string, isAdmin bool, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -184,47 +179,35 @@ func (c *core) Delete(id int64, pid int64, uid string, isAdmin bool) (err error)
 		args = append(args, uid)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_aging",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    uid,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    uid,
-		Query:     queryTrail,
-		TableName: "mla_aging",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:aging", redisPrefix, pid)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:aging:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 
 	return
 }
 
 func (c *core) Get(id int64, pid int64) (aging Aging, err error) {
-	redisKey := fmt.Sprintf("%s:%d:aging:%d", redisPrefix, pid, id)
-
-	aging, err = c.getFromCache(redisKey)
-	if err != nil {
-		aging, err = c.getFromDB(id, pid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(aging)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("aging:%d", id), cacheTTL, &aging, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
 	return
 }
 
@@ -235,6 +218,7 @@ func (c *core) getFromDB(id int64, pid int64) (aging Aging, err error) {
 			name,
 			description,
 			price,
+			duration_months,
 			status,
 			created_at,
 			created_by,
@@ -253,14 +237,9 @@ func (c *core) getFromDB(id int64, pid int64) (aging Aging, err error) {
 }
 
 func (c *core) Select(pid int64) (agings Agings, err error) {
-	redisKey := fmt.Sprintf("%s:%d:aging", redisPrefix, pid)
-
-	agings, err = c.selectFromCache()
-	if err != nil {
-		agings, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(agings)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "aging", cacheTTL, &agings, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -271,6 +250,7 @@ func (c *core) selectFromDB(pid int64) (agings Agings, err error) {
 			name,
 			description,
 			price,
+			duration_months,
 			status,
 			created_at,
 			created_by,
@@ -286,38 +266,3 @@ func (c *core) selectFromDB(pid int64) (agings Agings, err error) {
 	`, pid)
 	return
 }
-
-func (c *core) selectFromCache() (agings Agings, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &agings)
-	return
-}
-
-func (c *core) getFromCache(key string) (aging Aging, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &aging)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
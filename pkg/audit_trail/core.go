@@ -1,68 +1,344 @@
 package audit_trail
 
 import (
-	"fmt"
-	"strings"
+	"database/sql"
+	"reflect"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
 	"github.com/jmoiron/sqlx"
-	"gopkg.in/guregu/null.v3"
 )
 
+// ICore is the interface
 type ICore interface {
-	Insert(tx *sqlx.Tx, data_audit *AuditTrail) (err error)
+	Snapshot(tx *sqlx.Tx, entityType string, entityID int64) (row Row, err error)
+	Insert(tx *sqlx.Tx, audit *AuditTrail, before Row) (err error)
+	Exec(tx *sqlx.Tx, audit *AuditTrail, query string, args ...interface{}) (res sql.Result, err error)
+	Select(pid int64, filter Filter) (audits AuditTrails, err error)
+	Verify(pid int64) (checked int64, broken *ChainBreak, err error)
 }
 
 // core contains db client
 type core struct {
-	db    *sqlx.DB
-	redis *redis.Pool
-	pid   int64
+	db  *sqlx.DB
+	pid int64
 }
 
-const redisPrefix = "molanobar-v1"
+// keyColumns holds the key column of entities not keyed by id
+var keyColumns = map[string]string{
+	"mla_orders":      "order_id",
+	"mla_productlist": "product_id",
+}
+
+// ignoredColumns are not recorded as changes, they change on every write
+var ignoredColumns = map[string]bool{
+	"updated_at": true,
+}
+
+// Snapshot returns the row of the entity, locked until tx ends
+func (c *core) Snapshot(tx *sqlx.Tx, entityType string, entityID int64) (row Row, err error) {
+	keyColumn, ok := keyColumns[entityType]
+	if !ok {
+		keyColumn = "id"
+	}
+
+	row = Row{}
+	err = tx.QueryRowx(`SELECT * FROM `+entityType+` WHERE `+keyColumn+` = ? FOR UPDATE`, entityID).MapScan(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for column, value := range row {
+		if byt, ok := value.([]byte); ok {
+			row[column] = string(byt)
+		}
+	}
+	return row, nil
+}
+
+// Insert records the changes of the entity since before in tx, an error must
+// fail the write. Nothing is recorded when the write changed nothing
+func (c *core) Insert(tx *sqlx.Tx, audit *AuditTrail, before Row) (err error) {
+	after, err := c.Snapshot(tx, audit.EntityType, audit.EntityID)
+	if err != nil {
+		return err
+	}
+
+	audit.Changes = diff(before, after)
+	if len(audit.Changes) == 0 {
+		return nil
+	}
+	audit.ProjectID = c.pid
+	audit.CreatedAt = time.Now().Truncate(time.Second)
 
-func (c *core) Insert(tx *sqlx.Tx, data_audit *AuditTrail) (err error) {
-	data_audit.Timestamp = time.Now()
-	query := `INSERT INTO mla_logs(user_id, query_executed, table_name, project_id,timestamp) VALUES (?,?,?,?,?)`
-	_, err = tx.Exec(query, data_audit.UserID, data_audit.Query, data_audit.TableName, c.pid, data_audit.Timestamp)
+	head, err := c.lockChainHead(tx, audit.ProjectID)
 	if err != nil {
 		return err
 	}
+	audit.PrevHash = head.LastHash
+	audit.Hash, err = audit.computeHash()
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`
+		INSERT INTO mla_audit_logs (
+			entity_type,
+			entity_id,
+			action,
+			actor_id,
+			request_id,
+			changes,
+			project_id,
+			created_at,
+			prev_hash,
+			hash
+		) VALUES (
+			?,?,?,?,?,?,?,?,?,?
+		)`,
+		audit.EntityType,
+		audit.EntityID,
+		audit.Action,
+		audit.ActorID,
+		audit.RequestID,
+		audit.Changes,
+		audit.ProjectID,
+		audit.CreatedAt,
+		audit.PrevHash,
+		audit.Hash,
+	)
+	if err != nil {
+		return err
+	}
+
+	audit.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE
+			mla_audit_chains
+		SET
+			last_id = ?,
+			last_hash = ?
+		WHERE
+			project_id = ?
+	`, audit.ID, audit.Hash, audit.ProjectID)
 	return err
 }
 
-func ConstructLogQuery(query string, args ...interface{}) string {
-	getParamString := func(v interface{}) string {
-		switch v.(type) {
-		case int:
-			return fmt.Sprintf("%d", v.(int))
-		case int16:
-			return fmt.Sprintf("%d", v.(int16))
-		case int64:
-			return fmt.Sprintf("%d", v.(int64))
-		case float64:
-			return fmt.Sprintf("%f", v.(float64))
-		case string:
-			return fmt.Sprintf("'%s'", v.(string))
-		case time.Time:
-			return fmt.Sprintf("'%s'", v.(time.Time))
-		case null.Time:
-			return fmt.Sprintf("'%v'", v.(null.Time))
-		case bool:
-			if v.(bool) {
-				return "1"
+// lockChainHead returns the chain head of the project, creating it for the
+// first audit trail. The row stays locked until tx ends so audit trails of
+// the project are appended one at a time
+func (c *core) lockChainHead(tx *sqlx.Tx, pid int64) (head chainHead, err error) {
+	_, err = tx.Exec(`
+		INSERT INTO mla_audit_chains (
+			project_id,
+			last_id,
+			last_hash
+		) VALUES (
+			?,0,''
+		) ON DUPLICATE KEY UPDATE
+			project_id = project_id
+	`, pid)
+	if err != nil {
+		return head, err
+	}
+
+	err = tx.Get(&head, `
+		SELECT
+			project_id,
+			last_id,
+			last_hash
+		FROM
+			mla_audit_chains
+		WHERE
+			project_id = ?
+		FOR UPDATE
+	`, pid)
+	return head, err
+}
+
+// Exec runs query in tx and records the changes it made to the entity. For
+// created entities EntityID is left 0 and taken from the inserted id
+func (c *core) Exec(tx *sqlx.Tx, audit *AuditTrail, query string, args ...interface{}) (res sql.Result, err error) {
+	var before Row
+	if audit.EntityID != 0 {
+		before, err = c.Snapshot(tx, audit.EntityType, audit.EntityID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	res, err = tx.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if audit.EntityID == 0 {
+		audit.EntityID, err = res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = c.Insert(tx, audit, before)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (c *core) Select(pid int64, filter Filter) (audits AuditTrails, err error) {
+	query := `
+		SELECT
+			id,
+			entity_type,
+			entity_id,
+			action,
+			actor_id,
+			request_id,
+			changes,
+			project_id,
+			created_at,
+			prev_hash,
+			hash
+		FROM
+			mla_audit_logs
+		WHERE
+			project_id = ?`
+	args := []interface{}{pid}
+
+	if filter.EntityType != "" {
+		query += ` AND entity_type = ?`
+		args = append(args, filter.EntityType)
+	}
+	if filter.EntityID != 0 {
+		query += ` AND entity_id = ?`
+		args = append(args, filter.EntityID)
+	}
+	if filter.ActorID != "" {
+		query += ` AND actor_id = ?`
+		args = append(args, filter.ActorID)
+	}
+	if filter.From.Valid {
+		query += ` AND created_at >= ?`
+		args = append(args, filter.From.Time)
+	}
+	if filter.To.Valid {
+		query += ` AND created_at < ?`
+		args = append(args, filter.To.Time)
+	}
+
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, filter.Limit, filter.Offset)
+
+	err = c.db.Select(&audits, query, args...)
+	return
+}
+
+const verifyBatchSize = 1000
+
+// Verify walks the audit trails of the project in insert order and returns
+// the first one whose hash or link to the previous one does not match, nil
+// when the whole chain is intact
+func (c *core) Verify(pid int64) (checked int64, broken *ChainBreak, err error) {
+	var (
+		lastID   int64
+		prevHash string
+	)
+	for {
+		var audits AuditTrails
+		err = c.db.Select(&audits, `
+			SELECT
+				id,
+				entity_type,
+				entity_id,
+				action,
+				actor_id,
+				request_id,
+				changes,
+				project_id,
+				created_at,
+				prev_hash,
+				hash
+			FROM
+				mla_audit_logs
+			WHERE
+				project_id = ? AND
+				id > ?
+			ORDER BY id
+			LIMIT ?
+		`, pid, lastID, verifyBatchSize)
+		if err != nil {
+			return checked, nil, err
+		}
+
+		for _, audit := range audits {
+			if audit.PrevHash != prevHash {
+				return checked, &ChainBreak{ID: audit.ID, Reason: "previous hash does not match, a record before it was changed or removed"}, nil
 			}
-			return "0"
-		default:
-			return "'unsupported type'"
+			hash, err := audit.computeHash()
+			if err != nil {
+				return checked, nil, err
+			}
+			if hash != audit.Hash {
+				return checked, &ChainBreak{ID: audit.ID, Reason: "hash does not match its content"}, nil
+			}
+			lastID = audit.ID
+			prevHash = audit.Hash
+			checked++
+		}
+
+		if len(audits) < verifyBatchSize {
+			break
 		}
 	}
 
-	newQuery := query
-	for _, v := range args {
-		newQuery = strings.Replace(newQuery, "?", getParamString(v), 1)
+	var head chainHead
+	err = c.db.Get(&head, `
+		SELECT
+			project_id,
+			last_id,
+			last_hash
+		FROM
+			mla_audit_chains
+		WHERE
+			project_id = ?
+	`, pid)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	if err != nil {
+		return checked, nil, err
+	}
+	if head.LastID != lastID || head.LastHash != prevHash {
+		return checked, &ChainBreak{ID: head.LastID, Reason: "chain head does not match the last record, records at the end were removed"}, nil
+	}
+	return checked, nil, nil
+}
+
+// diff returns the columns whose value differs between before and after
+func diff(before, after Row) Changes {
+	changes := Changes{}
+	for column, value := range after {
+		if ignoredColumns[column] {
+			continue
+		}
+		old, ok := before[column]
+		if ok && reflect.DeepEqual(old, value) {
+			continue
+		}
+		changes[column] = Change{From: old, To: value}
+	}
+	for column, value := range before {
+		if _, ok := after[column]; ok || ignoredColumns[column] {
+			continue
+		}
+		changes[column] = Change{From: value}
 	}
-	return newQuery
+	return changes
 }
@@ -1,16 +1,144 @@
 package audit_trail
 
 import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// Actions recorded in audit log
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
 )
 
+// AuditTrail is model for mla_audit_logs in db. EntityType is the table of the
+// changed row and EntityID its key, Changes holds the fields the write changed.
+// Hash covers the content and PrevHash, the hash of the previous audit trail
+// of the project, so editing or removing a record breaks the chain
 type AuditTrail struct {
-	ID        int64     `db:"id"`
-	UserID    string    `db:"user_id"`
-	Query     string    `db:"query_executed"`
-	TableName string    `db:"table_name"`
-	ProjectID int64     `db:"project_id"`
-	Timestamp time.Time `db:"timestamp"`
+	ID         int64     `db:"id"`
+	EntityType string    `db:"entity_type"`
+	EntityID   int64     `db:"entity_id"`
+	Action     string    `db:"action"`
+	ActorID    string    `db:"actor_id"`
+	RequestID  string    `db:"request_id"`
+	Changes    Changes   `db:"changes"`
+	ProjectID  int64     `db:"project_id"`
+	CreatedAt  time.Time `db:"created_at"`
+	PrevHash   string    `db:"prev_hash"`
+	Hash       string    `db:"hash"`
 }
 
+// AuditTrails is list of audit trail
 type AuditTrails []AuditTrail
+
+// Change is the value of a field before and after a write, From is nil for
+// created rows and To is nil for removed rows
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Changes is changed fields by column name, stored as json in db
+type Changes map[string]Change
+
+// Scan implements sql.Scanner
+func (changes *Changes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*changes = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, changes)
+	case string:
+		return json.Unmarshal([]byte(v), changes)
+	}
+	return fmt.Errorf("unsupported type for changes: %T", src)
+}
+
+// Value implements driver.Valuer
+func (changes Changes) Value() (driver.Value, error) {
+	byt, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+	return string(byt), nil
+}
+
+// Row is a row of an entity by column name, nil when the row does not exist
+type Row map[string]interface{}
+
+// Filter of audit trails, zero values are not filtered
+type Filter struct {
+	EntityType string
+	EntityID   int64
+	ActorID    string
+	From       null.Time
+	To         null.Time
+	Limit      int
+	Offset     int
+}
+
+// computeHash returns the hash of the audit trail chained to PrevHash.
+// CreatedAt is hashed in seconds as stored in db
+func (audit AuditTrail) computeHash() (string, error) {
+	changes, err := audit.Changes.canonical()
+	if err != nil {
+		return "", err
+	}
+
+	content, err := json.Marshal([]interface{}{
+		audit.PrevHash,
+		audit.EntityType,
+		audit.EntityID,
+		audit.Action,
+		audit.ActorID,
+		audit.RequestID,
+		json.RawMessage(changes),
+		audit.ProjectID,
+		audit.CreatedAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// canonical returns changes as json the same way before they are stored and
+// after they are read back, db may reorder keys and numbers are read as float
+func (changes Changes) canonical() ([]byte, error) {
+	byt, err := json.Marshal(changes)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	err = json.Unmarshal(byt, &generic)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
+
+// chainHead is model for mla_audit_chains in db, the last audit trail of a
+// project. Its row is locked while an audit trail is appended
+type chainHead struct {
+	ProjectID int64  `db:"project_id"`
+	LastID    int64  `db:"last_id"`
+	LastHash  string `db:"last_hash"`
+}
+
+// ChainBreak is the first audit trail found not following the chain
+type ChainBreak struct {
+	ID     int64
+	Reason string
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	jsoniter "github.com/json-iterator/go"
+)
+
+// ICore is the interface
+type ICore interface {
+	GetOrLoad(namespace string, key string, ttl time.Duration, dest interface{}, load func() (interface{}, error)) (err error)
+	Invalidate(namespaces ...string) (err error)
+	Stats() (stats map[string]Stats)
+}
+
+// core contains redis client
+type core struct {
+	redis  *redis.Pool
+	flight *flightGroup
+
+	mu    sync.Mutex
+	stats map[string]*Stats
+}
+
+const redisPrefix = "molanobar-v1"
+
+// Namespace returns the namespace of name in the project, values of a
+// namespace are invalidated together
+func Namespace(name string, pid int64) string {
+	return fmt.Sprintf("%s:%d", name, pid)
+}
+
+// GetOrLoad reads the value of key in namespace into dest. On a miss load is
+// called once for all concurrent callers of the key and its value is cached
+// for ttl. Errors of load are returned and not cached. When redis is down the
+// value is loaded without caching
+func (c *core) GetOrLoad(namespace string, key string, ttl time.Duration, dest interface{}, load func() (interface{}, error)) (err error) {
+	generation, err := c.generation(namespace)
+	if err != nil {
+		c.count(namespace, func(stats *Stats) { stats.Errors++ })
+		value, err := load()
+		if err != nil {
+			return err
+		}
+		return c.copy(value, dest)
+	}
+
+	redisKey := fmt.Sprintf("%s:%s:%d:%s", redisPrefix, namespace, generation, key)
+	byt, err := c.get(redisKey)
+	if err == nil {
+		c.count(namespace, func(stats *Stats) { stats.Hits++ })
+		return jsoniter.ConfigFastest.Unmarshal(byt, dest)
+	}
+	c.count(namespace, func(stats *Stats) { stats.Misses++ })
+
+	byt, err = c.flight.do(redisKey, func() ([]byte, error) {
+		c.count(namespace, func(stats *Stats) { stats.Loads++ })
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		byt, err := jsoniter.ConfigFastest.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.set(redisKey, ttl, byt); err != nil {
+			c.count(namespace, func(stats *Stats) { stats.Errors++ })
+		}
+		return byt, nil
+	})
+	if err != nil {
+		return err
+	}
+	return jsoniter.ConfigFastest.Unmarshal(byt, dest)
+}
+
+// Invalidate drops every cached value of the namespaces by moving them to
+// the next generation, the old values are left to expire
+func (c *core) Invalidate(namespaces ...string) (err error) {
+	conn := c.redis.Get()
+	defer conn.Close()
+
+	for _, namespace := range namespaces {
+		_, err = conn.Do("INCR", generationKey(namespace))
+		if err != nil {
+			c.count(namespace, func(stats *Stats) { stats.Errors++ })
+			return err
+		}
+		c.count(namespace, func(stats *Stats) { stats.Invalidations++ })
+	}
+	return nil
+}
+
+// Stats returns the counters of every namespace used since start
+func (c *core) Stats() (stats map[string]Stats) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats = make(map[string]Stats, len(c.stats))
+	for namespace, counters := range c.stats {
+		stats[namespace] = *counters
+	}
+	return stats
+}
+
+func (c *core) count(namespace string, update func(stats *Stats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats, ok := c.stats[namespace]
+	if !ok {
+		stats = &Stats{}
+		c.stats[namespace] = stats
+	}
+	update(stats)
+}
+
+func generationKey(namespace string) string {
+	return fmt.Sprintf("%s:generation:%s", redisPrefix, namespace)
+}
+
+func (c *core) generation(namespace string) (generation int64, err error) {
+	conn := c.redis.Get()
+	defer conn.Close()
+
+	generation, err = redis.Int64(conn.Do("GET", generationKey(namespace)))
+	if err == redis.ErrNil {
+		return 0, nil
+	}
+	return generation, err
+}
+
+func (c *core) get(key string) ([]byte, error) {
+	conn := c.redis.Get()
+	defer conn.Close()
+
+	return redis.Bytes(conn.Do("GET", key))
+}
+
+func (c *core) set(key string, ttl time.Duration, data []byte) error {
+	conn := c.redis.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("SET", key, data, "EX", int64(ttl/time.Second))
+	return err
+}
+
+// copy gives dest the value load returned the same way a cached value would
+func (c *core) copy(value interface{}, dest interface{}) error {
+	byt, err := jsoniter.ConfigFastest.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return jsoniter.ConfigFastest.Unmarshal(byt, dest)
+}
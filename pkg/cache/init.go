@@ -0,0 +1,31 @@
+package cache
+
+import (
+	"log"
+
+	"github.com/gomodule/redigo/redis"
+)
+
+// Init is used to initialize cache package
+func Init(redis *redis.Pool) ICore {
+	examineRedisHealth(redis)
+	return &core{
+		redis:  redis,
+		flight: &flightGroup{calls: map[string]*flightCall{}},
+		stats:  map[string]*Stats{},
+	}
+}
+
+func examineRedisHealth(pool *redis.Pool) {
+	if pool == nil {
+		log.Fatalf("Failed to initialize cache. redis object cannot be nil")
+	}
+
+	conn := pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("PING")
+	if err != nil {
+		log.Fatalf("Failed to initialize cache. cannot pinging to redis. err: %s", err)
+	}
+}
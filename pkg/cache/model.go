@@ -0,0 +1,11 @@
+package cache
+
+// Stats counts the use of a namespace. Loads are the calls of load after
+// misses, fewer than Misses when concurrent misses shared a load
+type Stats struct {
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Loads         int64 `json:"loads"`
+	Invalidations int64 `json:"invalidations"`
+	Errors        int64 `json:"errors"`
+}
@@ -1,13 +1,11 @@
 package city
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
+	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
@@ -20,19 +18,18 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db    *sqlx.DB
-	redis *redis.Pool
+	cache cache.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "city"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (cities Cities, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:city", redisPrefix, pid)
-	cities, err = c.selectFromCache(redisKey)
-	if err != nil {
-		cities, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(cities)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "cities", cacheTTL, &cities, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -54,16 +51,9 @@ func (c *core) selectFromDB(pid int64) (cities Cities, err error) {
 }
 
 func (c *core) Get(id int64, pid int64) (city City, err error) {
-	redisKey := fmt.Sprintf("%s:%d:city:%d", redisPrefix, pid, id)
-
-	city, err = c.getFromCache(redisKey)
-	if err != nil {
-		city, err = c.getFromDB(id, pid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(city)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("city:%d", id), cacheTTL, &city, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
 	return
 }
 
@@ -108,38 +98,3 @@ func (c *core) getFromDBProvince(id int64, pid int64) (cities Cities, err error)
 
 	return
 }
-
-func (c *core) selectFromCache(redisKey string) (cities Cities, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", redisKey))
-	err = json.Unmarshal(b, &cities)
-	return
-}
-
-func (c *core) getFromCache(key string) (city City, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &city)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
@@ -1,44 +1,39 @@
 package commercial_type
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
 
-	"encoding/json"
-
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
 type ICore interface {
 	Select(pid int64) (commercialTypes CommercialTypes, err error)
 	Get(id int64, pid int64) (commercial_type CommercialType, err error)
-	Insert(commercialType *CommercialType) (err error)
-	Update(commercialType *CommercialType) (err error)
-	Delete(id int64, pid int64) (err error)
+	Insert(commercialType *CommercialType, requestID string) (err error)
+	Update(commercialType *CommercialType, requestID string) (err error)
+	Delete(id int64, pid int64, userID string, requestID string) (err error)
 }
 
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "commercial_type"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (commercialTypes CommercialTypes, err error) {
-	redisKey := fmt.Sprintf("%s:%d:commercial_type", redisPrefix, pid)
-	commercialTypes, err = c.selectFromCache(redisKey)
-	if err != nil {
-		commercialTypes, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(commercialTypes)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "commercial_type", cacheTTL, &commercialTypes, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -65,16 +60,9 @@ func (c *core) selectFromDB(pid int64) (commercialType CommercialTypes, err erro
 }
 
 func (c *core) Get(id int64, pid int64) (commercialType CommercialType, err error) {
-	redisKey := fmt.Sprintf("%s:%d:commercial_type:%d", redisPrefix, pid, id)
-
-	commercialType, err = c.getFromCache(redisKey)
-	if err != nil {
-		commercialType, err = c.getFromDB(id, pid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(commercialType)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("commercial_type:%d", id), cacheTTL, &commercialType, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
 	return
 }
 func (c *core) getFromDB(id int64, pid int64) (commercialType CommercialType, err error) {
@@ -100,7 +88,7 @@ func (c *core) getFromDB(id int64, pid int64) (commercialType CommercialType, er
 	return
 }
 
-func (c *core) Insert(commercialType *CommercialType) (err error) {
+func (c *core) Insert(commercialType *CommercialType, requestID string) (err error) {
 	query := `
 		INSERT INTO mla_commercial_type (
 			name,
@@ -131,13 +119,17 @@ func (c *core) Insert(commercialType *CommercialType) (err error) {
 		commercialType.CreatedBy,
 		commercialType.LastUpdateBy,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_commercial_type",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    commercialType.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -145,25 +137,17 @@ func (c *core) Insert(commercialType *CommercialType) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    commercialType.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_commercial_type",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:commercial_type", redisPrefix, commercialType.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, commercialType.ProjectID))
 
 	return
 }
 
-func (c *core) Update(commercialType *CommercialType) (err error) {
+func (c *core) Update(commercialType *CommercialType, requestID string) (err error) {
 	query := `
 		UPDATE
 			mla_commercial_type
@@ -184,37 +168,32 @@ func (c *core) Update(commercialType *CommercialType) (err error) {
 		commercialType.ID,
 		commercialType.ProjectID,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_commercial_type",
+		EntityID:   commercialType.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    commercialType.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    commercialType.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_commercial_type",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:commercial_type:%d", redisPrefix, commercialType.ProjectID, commercialType.ID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:commercial_type", redisPrefix, commercialType.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, commercialType.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(id int64, pid int64) (err error) {
+func (c *core) Delete(id int64, pid int64, userID string, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -229,66 +208,26 @@ func (c *core) Delete(id int64, pid int64) (err error) {
 	args := []interface{}{
 		now, id, pid,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_commercial_type",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    userID,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    "uid",
-		Query:     queryTrail,
-		TableName: "mla_commercial_type",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:commercial_type:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:commercial_type", redisPrefix, pid)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 	return
 }
-
-func (c *core) selectFromCache(redisKey string) (commercialType CommercialTypes, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", redisKey))
-	err = json.Unmarshal(b, &commercialType)
-	return
-}
-
-func (c *core) getFromCache(key string) (commercialType CommercialType, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &commercialType)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
@@ -0,0 +1,526 @@
+package commission
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+// ICore is the interface
+type ICore interface {
+	InsertScheme(scheme *Scheme, requestID string) (err error)
+	UpdateScheme(scheme *Scheme, requestID string) (err error)
+	DeleteScheme(scheme *Scheme, requestID string) (err error)
+	GetScheme(id int64, pid int64) (scheme Scheme, err error)
+	SelectSchemes(pid int64) (schemes Schemes, err error)
+
+	Earn(scheme Scheme, entry *Entry) (err error)
+	Reverse(pid, orderID, refundID int64, shares map[int64]float64, at time.Time) (err error)
+	SelectEntries(pid int64, beneficiaryType string, beneficiaryID int64, period string) (entries Entries, err error)
+	SelectPayouts(pid int64, period string) (payouts Payouts, err error)
+}
+
+// core contains db client
+type core struct {
+	db         *sqlx.DB
+	cache      cache.ICore
+	auditTrail auditTrail.ICore
+}
+
+const (
+	cacheNamespace = "commission"
+	cacheTTL       = 5 * time.Minute
+)
+
+func (c *core) InsertScheme(scheme *Scheme, requestID string) (err error) {
+	scheme.CreatedAt = time.Now()
+	scheme.UpdatedAt = scheme.CreatedAt
+	scheme.Status = 1
+
+	query := `
+	INSERT INTO mla_commission_schemes (
+		name,
+		beneficiary_type,
+		beneficiary_id,
+		product_id,
+		venue_type_id,
+		rate,
+		tiers,
+		status,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		project_id
+	) VALUES (
+		?,?,?,?,?,?,?,?,?,?,?,?,?
+	)`
+
+	args := []interface{}{
+		scheme.Name,
+		scheme.BeneficiaryType,
+		scheme.BeneficiaryID,
+		scheme.ProductID,
+		scheme.VenueTypeID,
+		scheme.Rate,
+		scheme.Tiers,
+		scheme.Status,
+		scheme.CreatedAt,
+		scheme.CreatedBy,
+		scheme.UpdatedAt,
+		scheme.LastUpdateBy,
+		scheme.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_commission_schemes",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    scheme.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	scheme.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, scheme.ProjectID))
+	return
+}
+
+func (c *core) UpdateScheme(scheme *Scheme, requestID string) (err error) {
+	scheme.UpdatedAt = time.Now()
+
+	query := `
+	UPDATE
+		mla_commission_schemes
+	SET
+		name = ?,
+		beneficiary_type = ?,
+		beneficiary_id = ?,
+		product_id = ?,
+		venue_type_id = ?,
+		rate = ?,
+		tiers = ?,
+		updated_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		scheme.Name,
+		scheme.BeneficiaryType,
+		scheme.BeneficiaryID,
+		scheme.ProductID,
+		scheme.VenueTypeID,
+		scheme.Rate,
+		scheme.Tiers,
+		scheme.UpdatedAt,
+		scheme.LastUpdateBy,
+		scheme.ID,
+		scheme.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_commission_schemes",
+		EntityID:   scheme.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    scheme.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, scheme.ProjectID))
+	return
+}
+
+func (c *core) DeleteScheme(scheme *Scheme, requestID string) (err error) {
+	query := `
+	UPDATE
+		mla_commission_schemes
+	SET
+		status = ?,
+		deleted_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		0,
+		time.Now(),
+		scheme.LastUpdateBy,
+		scheme.ID,
+		scheme.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_commission_schemes",
+		EntityID:   scheme.ID,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    scheme.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, scheme.ProjectID))
+	return
+}
+
+const selectScheme = `
+	SELECT
+		id,
+		name,
+		beneficiary_type,
+		beneficiary_id,
+		product_id,
+		venue_type_id,
+		rate,
+		tiers,
+		status,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		deleted_at,
+		project_id
+	FROM
+		mla_commission_schemes
+`
+
+func (c *core) GetScheme(id int64, pid int64) (scheme Scheme, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("commission-scheme:%d", id), cacheTTL, &scheme, func() (interface{}, error) {
+		return c.getSchemeFromDB(id, pid)
+	})
+	return
+}
+
+func (c *core) getSchemeFromDB(id int64, pid int64) (scheme Scheme, err error) {
+	query := selectScheme + `
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+	err = c.db.Get(&scheme, query, id, pid)
+	return
+}
+
+func (c *core) SelectSchemes(pid int64) (schemes Schemes, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "commission-schemes", cacheTTL, &schemes, func() (interface{}, error) {
+		return c.selectSchemesFromDB(pid)
+	})
+	return
+}
+
+func (c *core) selectSchemesFromDB(pid int64) (schemes Schemes, err error) {
+	query := selectScheme + `
+	WHERE
+		project_id = ? AND
+		status = 1
+	ORDER BY
+		id
+	`
+	err = c.db.Select(&schemes, query, pid)
+	return
+}
+
+// Earn records what the beneficiary of scheme earns on entry, once per order
+// venue. The rate of a tiered scheme is taken at the volume of the period
+// including entry, the scheme is locked while the volume is read so
+// concurrent earnings see each other
+func (c *core) Earn(scheme Scheme, entry *Entry) (err error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var locked int64
+	err = tx.Get(&locked, `SELECT id FROM mla_commission_schemes WHERE id = ? FOR UPDATE`, scheme.ID)
+	if err != nil {
+		return err
+	}
+
+	var earned int64
+	err = tx.Get(&earned, `
+		SELECT
+			COUNT(*)
+		FROM
+			mla_commission_entries
+		WHERE
+			order_id = ? AND
+			venue_id = ? AND
+			beneficiary_type = ? AND
+			beneficiary_id = ? AND
+			entry_type = ? AND
+			project_id = ?
+	`, entry.OrderID, entry.VenueID, scheme.BeneficiaryType, scheme.BeneficiaryID, EntryEarned, scheme.ProjectID)
+	if err != nil {
+		return err
+	}
+	if earned > 0 {
+		return nil
+	}
+
+	var volume float64
+	err = tx.Get(&volume, `
+		SELECT
+			COALESCE(SUM(base_amount), 0)
+		FROM
+			mla_commission_entries
+		WHERE
+			beneficiary_type = ? AND
+			beneficiary_id = ? AND
+			period = ? AND
+			project_id = ?
+	`, scheme.BeneficiaryType, scheme.BeneficiaryID, entry.Period, scheme.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	entry.BeneficiaryType = scheme.BeneficiaryType
+	entry.BeneficiaryID = scheme.BeneficiaryID
+	entry.SchemeID = scheme.ID
+	entry.ProjectID = scheme.ProjectID
+	entry.CreatedAt = time.Now()
+	entry.Earn(scheme.RateAt(volume + entry.BaseAmount))
+
+	entry.ID, err = insertEntry(tx, entry)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Reverse takes back the refunded share of every earning on the order, shares
+// are by venue. A refund is reversed once and never more than was earned
+func (c *core) Reverse(pid, orderID, refundID int64, shares map[int64]float64, at time.Time) (err error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var entries Entries
+	err = tx.Select(&entries, selectEntry+`
+		WHERE
+			order_id = ? AND
+			project_id = ?
+		ORDER BY
+			id
+		FOR UPDATE
+	`, orderID, pid)
+	if err != nil {
+		return err
+	}
+
+	type key struct {
+		beneficiaryType string
+		beneficiaryID   int64
+		venueID         int64
+	}
+	var (
+		earnings []Entry
+		left     = make(map[key]float64)
+		done     = make(map[key]bool)
+	)
+	for _, entry := range entries {
+		k := key{entry.BeneficiaryType, entry.BeneficiaryID, entry.VenueID}
+		left[k] += entry.Amount
+		if entry.EntryType == EntryEarned {
+			earnings = append(earnings, entry)
+		}
+		if entry.RefundID.Valid && entry.RefundID.Int64 == refundID {
+			done[k] = true
+		}
+	}
+
+	for _, earning := range earnings {
+		k := key{earning.BeneficiaryType, earning.BeneficiaryID, earning.VenueID}
+		share := shares[earning.VenueID]
+		if done[k] || share <= 0 {
+			continue
+		}
+		share = math.Min(share, 1)
+
+		amount := math.Min(math.Round(earning.Amount*share*100)/100, left[k])
+		if amount <= 0 {
+			continue
+		}
+
+		reversal := Entry{
+			BeneficiaryType: earning.BeneficiaryType,
+			BeneficiaryID:   earning.BeneficiaryID,
+			SchemeID:        earning.SchemeID,
+			OrderID:         earning.OrderID,
+			OrderNumber:     earning.OrderNumber,
+			VenueID:         earning.VenueID,
+			EntryType:       EntryReversed,
+			BaseAmount:      -math.Round(earning.BaseAmount*share*100) / 100,
+			Rate:            earning.Rate,
+			Amount:          -amount,
+			Period:          at.Format(PeriodLayout),
+			RefundID:        null.IntFrom(refundID),
+			CreatedAt:       time.Now(),
+			ProjectID:       pid,
+		}
+		_, err = insertEntry(tx, &reversal)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertEntry(tx *sqlx.Tx, entry *Entry) (int64, error) {
+	res, err := tx.Exec(`
+		INSERT INTO mla_commission_entries (
+			beneficiary_type,
+			beneficiary_id,
+			scheme_id,
+			order_id,
+			order_number,
+			venue_id,
+			entry_type,
+			base_amount,
+			rate,
+			amount,
+			period,
+			refund_id,
+			created_at,
+			project_id
+		) VALUES (
+			?,?,?,?,?,?,?,?,?,?,?,?,?,?
+		)`,
+		entry.BeneficiaryType,
+		entry.BeneficiaryID,
+		entry.SchemeID,
+		entry.OrderID,
+		entry.OrderNumber,
+		entry.VenueID,
+		entry.EntryType,
+		entry.BaseAmount,
+		entry.Rate,
+		entry.Amount,
+		entry.Period,
+		entry.RefundID,
+		entry.CreatedAt,
+		entry.ProjectID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+const selectEntry = `
+	SELECT
+		id,
+		beneficiary_type,
+		beneficiary_id,
+		scheme_id,
+		order_id,
+		order_number,
+		venue_id,
+		entry_type,
+		base_amount,
+		rate,
+		amount,
+		period,
+		refund_id,
+		created_at,
+		project_id
+	FROM
+		mla_commission_entries
+`
+
+// SelectEntries returns the entries of a beneficiary in a period
+func (c *core) SelectEntries(pid int64, beneficiaryType string, beneficiaryID int64, period string) (entries Entries, err error) {
+	query := selectEntry + `
+	WHERE
+		beneficiary_type = ? AND
+		beneficiary_id = ? AND
+		period = ? AND
+		project_id = ?
+	ORDER BY
+		id
+	`
+	err = c.db.Select(&entries, query, beneficiaryType, beneficiaryID, period, pid)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+// SelectPayouts returns the net commission of every beneficiary with entries
+// in a period
+func (c *core) SelectPayouts(pid int64, period string) (payouts Payouts, err error) {
+	query := `
+	SELECT
+		beneficiary_type,
+		beneficiary_id,
+		COUNT(*) AS entries,
+		COALESCE(SUM(CASE WHEN entry_type = ? THEN amount END), 0) AS earned,
+		COALESCE(-SUM(CASE WHEN entry_type = ? THEN amount END), 0) AS reversed,
+		COALESCE(SUM(amount), 0) AS net
+	FROM
+		mla_commission_entries
+	WHERE
+		period = ? AND
+		project_id = ?
+	GROUP BY
+		beneficiary_type,
+		beneficiary_id
+	ORDER BY
+		beneficiary_type,
+		beneficiary_id
+	`
+	err = c.db.Select(&payouts, query, EntryEarned, EntryReversed, period, pid)
+	return
+}
@@ -0,0 +1,44 @@
+package commission
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+var payoutHeader = []string{"period", "beneficiary_type", "beneficiary_id", "name", "email", "entries", "earned", "reversed", "net"}
+
+// WritePayouts writes the payouts of a period as csv for finance, Name and
+// Email are taken from the beneficiaries
+func WritePayouts(w io.Writer, period string, payouts Payouts) error {
+	cw := csv.NewWriter(w)
+
+	err := cw.Write(payoutHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, payout := range payouts {
+		err = cw.Write([]string{
+			period,
+			payout.BeneficiaryType,
+			strconv.FormatInt(payout.BeneficiaryID, 10),
+			payout.Name,
+			payout.Email,
+			strconv.FormatInt(payout.Entries, 10),
+			formatAmount(payout.Earned),
+			formatAmount(payout.Reversed),
+			formatAmount(payout.Net),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
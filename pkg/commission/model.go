@@ -0,0 +1,245 @@
+package commission
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// Beneficiary types, an agent earns on the paid orders it placed and a
+// regional agent on the paid orders of the agents working under it
+const (
+	BeneficiaryAgent         = "agent"
+	BeneficiaryRegionalAgent = "regional_agent"
+)
+
+// Entry types, a reversal takes back an earning when its order is refunded
+const (
+	EntryEarned   = "earned"
+	EntryReversed = "reversed"
+)
+
+// PeriodLayout is the layout of entry periods, a calendar month
+const PeriodLayout = "2006-01"
+
+// Scheme is model for mla_commission_schemes in db. A scheme gives its
+// beneficiary Rate percent of the order amount, or the rate of the highest
+// tier reached by the monthly volume when it has tiers. ProductID and
+// VenueTypeID limit the orders it applies to
+type Scheme struct {
+	ID              int64     `db:"id"`
+	Name            string    `db:"name"`
+	BeneficiaryType string    `db:"beneficiary_type"`
+	BeneficiaryID   int64     `db:"beneficiary_id"`
+	ProductID       null.Int  `db:"product_id"`
+	VenueTypeID     null.Int  `db:"venue_type_id"`
+	Rate            float64   `db:"rate"`
+	Tiers           Tiers     `db:"tiers"`
+	Status          int16     `db:"status"`
+	CreatedAt       time.Time `db:"created_at"`
+	CreatedBy       string    `db:"created_by"`
+	UpdatedAt       time.Time `db:"updated_at"`
+	LastUpdateBy    string    `db:"last_update_by"`
+	DeletedAt       null.Time `db:"deleted_at"`
+	ProjectID       int64     `db:"project_id"`
+}
+
+// Schemes is list of scheme
+type Schemes []Scheme
+
+// Tier is the rate earned once the monthly volume reaches MinVolume
+type Tier struct {
+	MinVolume float64 `json:"minVolume"`
+	Rate      float64 `json:"rate"`
+}
+
+// Tiers is list of tier, stored as json in db
+type Tiers []Tier
+
+// Scan implements sql.Scanner
+func (tiers *Tiers) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*tiers = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, tiers)
+	case string:
+		return json.Unmarshal([]byte(v), tiers)
+	}
+	return fmt.Errorf("unsupported type for tiers: %T", src)
+}
+
+// Value implements driver.Valuer
+func (tiers Tiers) Value() (driver.Value, error) {
+	if len(tiers) == 0 {
+		return nil, nil
+	}
+	byt, err := json.Marshal(tiers)
+	if err != nil {
+		return nil, err
+	}
+	return string(byt), nil
+}
+
+// Errors returned when a scheme is not valid
+var (
+	ErrInvalidBeneficiary = errors.New("Beneficiary type must be agent or regional_agent")
+	ErrInvalidRate        = errors.New("Rate must be between 0 and 100")
+	ErrInvalidTiers       = errors.New("Tiers must have ascending minimum volumes starting at 0 and rates between 0 and 100")
+)
+
+// Validate checks the scheme is complete
+func (scheme Scheme) Validate() error {
+	if scheme.BeneficiaryType != BeneficiaryAgent && scheme.BeneficiaryType != BeneficiaryRegionalAgent {
+		return ErrInvalidBeneficiary
+	}
+	if scheme.Rate < 0 || scheme.Rate > 100 {
+		return ErrInvalidRate
+	}
+	for i, tier := range scheme.Tiers {
+		if tier.Rate < 0 || tier.Rate > 100 {
+			return ErrInvalidTiers
+		}
+		if (i == 0 && tier.MinVolume != 0) || (i > 0 && tier.MinVolume <= scheme.Tiers[i-1].MinVolume) {
+			return ErrInvalidTiers
+		}
+	}
+	return nil
+}
+
+// RateAt returns the rate of the scheme once the monthly volume is volume
+func (scheme Scheme) RateAt(volume float64) float64 {
+	if len(scheme.Tiers) == 0 {
+		return scheme.Rate
+	}
+
+	rate := scheme.Tiers[0].Rate
+	for _, tier := range scheme.Tiers {
+		if volume >= tier.MinVolume {
+			rate = tier.Rate
+		}
+	}
+	return rate
+}
+
+// specificity ranks schemes limited to a product and venue type above those
+// limited to one of them and those above the general scheme
+func (scheme Scheme) specificity() int {
+	rank := 0
+	if scheme.ProductID.Valid {
+		rank += 2
+	}
+	if scheme.VenueTypeID.Valid {
+		rank++
+	}
+	return rank
+}
+
+// Match returns the most specific scheme of the beneficiary applying to an
+// order of the product at a venue of the venue type
+func (schemes Schemes) Match(beneficiaryType string, beneficiaryID, productID, venueTypeID int64) (Scheme, bool) {
+	var candidates Schemes
+	for _, scheme := range schemes {
+		if scheme.BeneficiaryType != beneficiaryType || scheme.BeneficiaryID != beneficiaryID {
+			continue
+		}
+		if scheme.ProductID.Valid && scheme.ProductID.Int64 != productID {
+			continue
+		}
+		if scheme.VenueTypeID.Valid && scheme.VenueTypeID.Int64 != venueTypeID {
+			continue
+		}
+		candidates = append(candidates, scheme)
+	}
+	if len(candidates) == 0 {
+		return Scheme{}, false
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].specificity() > candidates[j].specificity()
+	})
+	return candidates[0], true
+}
+
+// Entry is model for mla_commission_entries in db. Entries are never updated,
+// a refund adds a reversed entry with the negative refunded share of the
+// earning in the period of the refund
+type Entry struct {
+	ID              int64     `db:"id"`
+	BeneficiaryType string    `db:"beneficiary_type"`
+	BeneficiaryID   int64     `db:"beneficiary_id"`
+	SchemeID        int64     `db:"scheme_id"`
+	OrderID         int64     `db:"order_id"`
+	OrderNumber     string    `db:"order_number"`
+	VenueID         int64     `db:"venue_id"`
+	EntryType       string    `db:"entry_type"`
+	BaseAmount      float64   `db:"base_amount"`
+	Rate            float64   `db:"rate"`
+	Amount          float64   `db:"amount"`
+	Period          string    `db:"period"`
+	RefundID        null.Int  `db:"refund_id"`
+	CreatedAt       time.Time `db:"created_at"`
+	ProjectID       int64     `db:"project_id"`
+}
+
+// Entries is list of entry
+type Entries []Entry
+
+// Earn sets the rate and amount of an earning, rounded to cents
+func (entry *Entry) Earn(rate float64) {
+	entry.EntryType = EntryEarned
+	entry.Rate = rate
+	entry.Amount = math.Round(entry.BaseAmount*rate) / 100
+}
+
+// Statement is the entries of a beneficiary in a period with their totals
+type Statement struct {
+	BeneficiaryType string
+	BeneficiaryID   int64
+	Period          string
+	Earned          float64
+	Reversed        float64
+	Net             float64
+	Entries         Entries
+}
+
+// NewStatement totals entries of a period
+func NewStatement(beneficiaryType string, beneficiaryID int64, period string, entries Entries) Statement {
+	statement := Statement{
+		BeneficiaryType: beneficiaryType,
+		BeneficiaryID:   beneficiaryID,
+		Period:          period,
+		Entries:         entries,
+	}
+	for _, entry := range entries {
+		if entry.EntryType == EntryReversed {
+			statement.Reversed -= entry.Amount
+		} else {
+			statement.Earned += entry.Amount
+		}
+		statement.Net += entry.Amount
+	}
+	return statement
+}
+
+// Payout is the net commission of a beneficiary in a period
+type Payout struct {
+	BeneficiaryType string  `db:"beneficiary_type"`
+	BeneficiaryID   int64   `db:"beneficiary_id"`
+	Entries         int64   `db:"entries"`
+	Earned          float64 `db:"earned"`
+	Reversed        float64 `db:"reversed"`
+	Net             float64 `db:"net"`
+	Name            string  `db:"-"`
+	Email           string  `db:"-"`
+}
+
+// Payouts is list of payout
+type Payouts []Payout
@@ -1,15 +1,11 @@
 package company
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
 
-	"encoding/json"
-
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
@@ -25,19 +21,21 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db    *sqlx.DB
-	redis *redis.Pool
+	cache cache.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "company"
+	cacheTTL       = 5 * time.Minute
+
+	// orderCacheNamespace holds the order summaries, they show company data
+	orderCacheNamespace = "order"
+)
 
 func (c *core) Select(pid int64, userID string) (companies Companies, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:company", redisPrefix, pid, userID)
-	companies, err = c.selectFromCache(redisKey)
-	if err != nil {
-		companies, err = c.selectFromDB(pid, userID)
-		byt, _ := jsoniter.ConfigFastest.Marshal(companies)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:company", userID), cacheTTL, &companies, func() (interface{}, error) {
+		return c.selectFromDB(pid, userID)
+	})
 	return
 }
 
@@ -52,6 +50,7 @@ func (c *core) selectFromDB(pid int64, userID string) (companies Companies, err
 		zip,
 		email,
 		npwp,
+		locale,
 		created_at,
 		updated_at,
 		deleted_at,
@@ -74,15 +73,9 @@ func (c *core) selectFromDB(pid int64, userID string) (companies Companies, err
 }
 
 func (c *core) Get(id int64, pid int64, userID string, isAdmin bool) (company Company, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:company:%d", redisPrefix, pid, userID, id)
-	company, err = c.getFromCache(redisKey)
-	if err != nil {
-		company, err = c.getFromDB(id, pid, userID, isAdmin)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(company)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:company:%d", userID, id), cacheTTL, &company, func() (interface{}, error) {
+		return c.getFromDB(id, pid, userID, isAdmin)
+	})
 	return
 }
 func (c *core) getFromDB(id int64, pid int64, userID string, isAdmin bool) (company Company, err error) {
@@ -96,6 +89,7 @@ func (c *core) getFromDB(id int64, pid int64, userID string, isAdmin bool) (comp
 			zip,
 			email,
 			npwp,
+			locale,
 			created_at,
 			updated_at,
 			deleted_at,
@@ -147,6 +141,7 @@ func (c *core) Insert(company *Company) (err error) {
 			zip,
 			email,
 			npwp,
+			locale,
 			created_at,
 			updated_at,
 			deleted_at,
@@ -162,6 +157,7 @@ func (c *core) Insert(company *Company) (err error) {
 			:zip,
 			:email,
 			:npwp,
+			:locale,
 			:created_at,
 			:updated_at,
 			:deleted_at,
@@ -173,10 +169,7 @@ func (c *core) Insert(company *Company) (err error) {
 	`, company)
 	company.ID, err = res.LastInsertId()
 
-	redisKey := fmt.Sprintf("%s:%d:%s:company", redisPrefix, company.ProjectID, company.CreatedBy)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::company", redisPrefix, company.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, company.ProjectID), cache.Namespace(orderCacheNamespace, company.ProjectID))
 
 	return
 }
@@ -193,6 +186,7 @@ func (c *core) Update(company *Company, uid string, isAdmin bool) (err error) {
 		zip = :zip,
 		email = :email,
 		npwp = :npwp,
+		locale = :locale,
 		updated_at = :updated_at,
 		last_update_by = :last_update_by
 	WHERE
@@ -200,27 +194,13 @@ func (c *core) Update(company *Company, uid string, isAdmin bool) (err error) {
 		project_id = :project_id AND 
 		status = 1
 	`
-	var redisKey string
 	if isAdmin == false {
 		query = query + ` AND created_by = :created_by`
 	}
 
 	_, err = c.db.NamedExec(query, company)
 
-	redisKey = fmt.Sprintf("%s:%d:%s:company:%d", redisPrefix, company.ProjectID, company.CreatedBy, company.ID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::company:%d", redisPrefix, company.ProjectID, company.ID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:company", redisPrefix, company.ProjectID, company.CreatedBy)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::company", redisPrefix, company.ProjectID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:sumvenue-id:*", redisPrefix, company.ProjectID, company.CreatedBy)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:sumvenue", redisPrefix, company.ProjectID, company.CreatedBy)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:sumvenue-licnumber:*", redisPrefix, company.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, company.ProjectID), cache.Namespace(orderCacheNamespace, company.ProjectID))
 
 	return
 }
@@ -239,7 +219,6 @@ func (c *core) Delete(id int64, pid int64, userID string, created_by string, isA
 			status = 1 AND
 			project_id = ? `
 
-	var redisKey string
 	if isAdmin == true {
 		_, err = c.db.Exec(query, now, userID, id, pid)
 	} else {
@@ -247,54 +226,6 @@ func (c *core) Delete(id int64, pid int64, userID string, created_by string, isA
 		_, err = c.db.Exec(query, now, userID, id, pid, userID)
 
 	}
-	redisKey = fmt.Sprintf("%s:%d:%s:company:%d", redisPrefix, pid, created_by, id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::company:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:company", redisPrefix, pid, created_by)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::company", redisPrefix, pid)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:sumvenue-id:*", redisPrefix, pid, created_by)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:sumvenue", redisPrefix, pid, created_by)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:sumvenue-licnumber:*", redisPrefix, pid)
-	_ = c.deleteCache(redisKey)
-	return
-}
-
-func (c *core) selectFromCache(redisKey string) (companies Companies, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", redisKey))
-	err = json.Unmarshal(b, &companies)
-	return
-}
-
-func (c *core) getFromCache(key string) (company Company, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &company)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid), cache.Namespace(orderCacheNamespace, pid))
 	return
 }
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
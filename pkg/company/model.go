@@ -14,6 +14,7 @@ type Company struct {
 	Province     string    `db:"province"`
 	Zip          string    `db:"zip"`
 	Npwp         string    `db:"npwp"`
+	Locale       string    `db:"locale"`
 	Email        string    `db:"email"`
 	CreatedAt    time.Time `db:"created_at"`
 	UpdatedAt    time.Time `db:"updated_at"`
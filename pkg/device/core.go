@@ -1,41 +1,37 @@
 package device
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 type ICore interface {
 	Select(pid int64) (devices Devices, err error)
 	Get(pid int64, id int64) (device Device, err error)
-	Insert(device *Device) (err error)
-	Update(device *Device, isAdmin bool) (err error)
-	Delete(pid int64, id int64, isAdmin bool, userID string) (err error)
+	Insert(device *Device, requestID string) (err error)
+	Update(device *Device, isAdmin bool, requestID string) (err error)
+	Delete(pid int64, id int64, isAdmin bool, userID string, requestID string) (err error)
 }
 
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "device"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (devices Devices, err error) {
-	redisKey := fmt.Sprintf("%s:devices", redisPrefix)
-	devices, err = c.selectFromCache(redisKey)
-	if err != nil {
-		devices, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(devices)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "devices", cacheTTL, &devices, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -64,16 +60,9 @@ func (c *core) selectFromDB(pid int64) (device Devices, err error) {
 }
 
 func (c *core) Get(pid int64, id int64) (device Device, err error) {
-	redisKey := fmt.Sprintf("%s:%d:device:%d", redisPrefix, pid, id)
-
-	device, err = c.getFromCache(redisKey)
-	if err != nil {
-		device, err = c.getFromDB(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(device)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("device:%d", id), cacheTTL, &device, func() (interface{}, error) {
+		return c.getFromDB(pid, id)
+	})
 	return
 }
 
@@ -102,7 +91,7 @@ func (c *core) getFromDB(pid int64, id int64) (device Device, err error) {
 	return
 }
 
-func (c *core) Insert(device *Device) (err error) {
+func (c *core) Insert(device *Device, requestID string) (err error) {
 	device.CreatedAt = time.Now()
 	device.UpdatedAt = device.CreatedAt
 	device.Status = 1
@@ -143,13 +132,17 @@ func (c *core) Insert(device *Device) (err error) {
 		device.CreatedBy,
 		device.LastUpdateBy,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_devices",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    device.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -157,25 +150,17 @@ func (c *core) Insert(device *Device) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    device.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_devices",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:devices", redisPrefix)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, device.ProjectID))
 
 	return
 }
 
-func (c *core) Update(device *Device, isAdmin bool) (err error) {
+func (c *core) Update(device *Device, isAdmin bool, requestID string) (err error) {
 	device.UpdatedAt = time.Now()
 	device.Status = 1
 	query := `
@@ -209,37 +194,31 @@ func (c *core) Update(device *Device, isAdmin bool) (err error) {
 		args = append(args, device.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_devices",
+		EntityID:   device.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    device.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    device.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_devices",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:%d:device:%d", redisPrefix, device.ProjectID, device.ID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:devices", redisPrefix)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, device.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err error) {
+func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -262,7 +241,6 @@ func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err err
 		args = append(args, userID)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 
 	if err != nil {
@@ -270,63 +248,23 @@ func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err err
 	}
 
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_devices",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    userID,
+		RequestID:  requestID,
+	}, query, args...)
 
 	if err != nil {
 		return err
 	}
 
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    "uid",
-		Query:     queryTrail,
-		TableName: "mla_devices",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:%d:device:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:devices", redisPrefix)
-	_ = c.deleteCache(redisKey)
-	return
-}
-
-func (c *core) selectFromCache(key string) (devices Devices, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &devices)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 	return
 }
-
-func (c *core) getFromCache(key string) (device Device, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &device)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
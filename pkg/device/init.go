@@ -6,16 +6,16 @@ import (
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
 )
 
 // Init is used to initialize history package
-func Init(db *sqlx.DB, redis *redis.Pool, auditTrail auditTrail.ICore) ICore {
+func Init(db *sqlx.DB, cache cache.ICore, auditTrail auditTrail.ICore) ICore {
 	examineDBHealth(db)
 	return &core{
 		db:         db,
-		redis:      redis,
+		cache:      cache,
 		auditTrail: auditTrail,
 	}
 }
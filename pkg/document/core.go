@@ -0,0 +1,78 @@
+package document
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+)
+
+// ICore is the interface
+type ICore interface {
+	Invoice(invoice Invoice) (pdf []byte, err error)
+	Quotation(quotation Quotation) (pdf []byte, err error)
+	Certificate(certificate Certificate) (pdf []byte, err error)
+}
+
+// core contains renderer and cache of rendered documents
+type core struct {
+	renderer  Renderer
+	cache     cache.ICore
+	projectID int64
+}
+
+const (
+	cacheNamespace = "document"
+	cacheTTL       = 24 * time.Hour
+)
+
+func (c *core) Invoice(invoice Invoice) (pdf []byte, err error) {
+	return c.render(KindInvoice, invoice, func() ([]byte, error) {
+		return c.renderer.RenderInvoice(invoice)
+	})
+}
+
+func (c *core) Quotation(quotation Quotation) (pdf []byte, err error) {
+	return c.render(KindQuotation, quotation, func() ([]byte, error) {
+		return c.renderer.RenderQuotation(quotation)
+	})
+}
+
+func (c *core) Certificate(certificate Certificate) (pdf []byte, err error) {
+	return c.render(KindCertificate, certificate, func() ([]byte, error) {
+		return c.renderer.RenderCertificate(certificate)
+	})
+}
+
+// render caches documents by the hash of their layout and content, so the
+// same document is rendered once until either changes
+func (c *core) render(kind string, content interface{}, render func() ([]byte, error)) (pdf []byte, err error) {
+	layout, err := c.renderer.Layout(kind)
+	if err != nil {
+		return nil, err
+	}
+	byt, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s\x00%s\x00", kind, layout)
+	hash.Write(byt)
+	key := hex.EncodeToString(hash.Sum(nil))
+
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, c.projectID), key, cacheTTL, &pdf, func() (interface{}, error) {
+		pdf, err := render()
+		if err != nil {
+			return nil, err
+		}
+		if len(pdf) == 0 {
+			return nil, fmt.Errorf("%s rendered empty pdf", kind)
+		}
+		return pdf, nil
+	})
+	return
+}
@@ -0,0 +1,20 @@
+package document
+
+import (
+	"log"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+)
+
+// Init is used to initialize document package, documents are rendered with
+// renderer
+func Init(renderer Renderer, cache cache.ICore, pid int64) ICore {
+	if renderer == nil {
+		log.Fatalf("Failed to initialize document. renderer cannot be nil")
+	}
+	return &core{
+		renderer:  renderer,
+		cache:     cache,
+		projectID: pid,
+	}
+}
@@ -0,0 +1,166 @@
+package document
+
+import (
+	"strings"
+	"time"
+)
+
+// Kinds of document
+const (
+	KindInvoice     = "invoice"
+	KindQuotation   = "quotation"
+	KindCertificate = "certificate"
+)
+
+// Orientations of html rendered into pdf
+const (
+	Portrait  = "Portrait"
+	Landscape = "Landscape"
+)
+
+// Invoice is the invoice of an order
+type Invoice struct {
+	Date              string        `json:"date"`
+	Number            string        `json:"number"`
+	CustomerReference string        `json:"customerReference"`
+	BuyerName         string        `json:"buyerName"`
+	BuyerAddress      string        `json:"buyerAddress"`
+	BuyerNpwp         string        `json:"buyerNpwp"`
+	VenueName         string        `json:"venueName"`
+	VenueAddress      string        `json:"venueAddress"`
+	Items             []InvoiceItem `json:"items"`
+	TaxRate           string        `json:"taxRate"`
+	TaxBase           string        `json:"taxBase"`
+	TaxAmount         string        `json:"taxAmount"`
+	Total             string        `json:"total"`
+	BalanceDue        string        `json:"balanceDue"`
+	// Logo is base64 encoded png
+	Logo string `json:"logo"`
+	// Locale is the locale of the template, the default one when empty
+	Locale string `json:"locale"`
+}
+
+// InvoiceItem is a line of invoice, prices are formatted
+type InvoiceItem struct {
+	Quantity    int64  `json:"quantity"`
+	Description string `json:"description"`
+	Price       string `json:"price"`
+	Total       string `json:"total"`
+}
+
+// Quotation is the quotation of a venue, prices are formatted
+type Quotation struct {
+	Date         string        `json:"date"`
+	Number       string        `json:"number"`
+	ValidUntil   string        `json:"validUntil"`
+	BuyerName    string        `json:"buyerName"`
+	BuyerAddress string        `json:"buyerAddress"`
+	VenueName    string        `json:"venueName"`
+	VenueAddress string        `json:"venueAddress"`
+	Items        []InvoiceItem `json:"items"`
+	TaxRate      string        `json:"taxRate"`
+	TaxBase      string        `json:"taxBase"`
+	TaxAmount    string        `json:"taxAmount"`
+	Total        string        `json:"total"`
+	// Logo is base64 encoded png
+	Logo string `json:"logo"`
+	// Locale is the locale of the template, the default one when empty
+	Locale string `json:"locale"`
+}
+
+// Certificate is the e-certificate of a venue license
+type Certificate struct {
+	VenueName string `json:"venueName"`
+	Address   string `json:"address"`
+	Zip       string `json:"zip"`
+	City      string `json:"city"`
+	Province  string `json:"province"`
+	// LicenseNumber, VenueID and ExpiredDate are what the license token in the
+	// QR code holds, they key the cached certificate in place of the QR code
+	LicenseNumber string    `json:"licenseNumber"`
+	VenueID       int64     `json:"venueID"`
+	ExpiredDate   time.Time `json:"expiredDate"`
+	// QRCode is base64 encoded png of the signed license token. It is signed
+	// with its issue time, so it is left out of the cache key
+	QRCode string `json:"-"`
+	// Background is base64 encoded png
+	Background string `json:"background"`
+	// Locale is the locale of the template, the default one when empty
+	Locale string `json:"locale"`
+}
+
+// TemplateData returns the data of invoice templates
+func (invoice Invoice) TemplateData() map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(invoice.Items))
+	for _, item := range invoice.Items {
+		items = append(items, map[string]interface{}{
+			"Quantity":     item.Quantity,
+			"ProductName":  item.Description,
+			"ProductPrice": item.Price,
+			"TotalPrice":   item.Total,
+		})
+	}
+
+	return map[string]interface{}{
+		"CreatedAt":         invoice.Date,
+		"OrderNumber":       invoice.Number,
+		"CustomerReference": invoice.CustomerReference,
+		"BuyerName":         invoice.BuyerName,
+		"BuyerAddress":      invoice.BuyerAddress,
+		"BuyerNpwp":         invoice.BuyerNpwp,
+		"Items":             items,
+		"TaxRate":           invoice.TaxRate,
+		"Dpp":               invoice.TaxBase,
+		"Ppn":               invoice.TaxAmount,
+		"Total":             invoice.Total,
+		"BalanceDue":        invoice.BalanceDue,
+		"Logo":              invoice.Logo,
+		"VenueName":         invoice.VenueName,
+		"VenueAddress":      invoice.VenueAddress,
+	}
+}
+
+// TemplateData returns the data of quotation templates, items have the keys
+// of invoice items
+func (quotation Quotation) TemplateData() map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(quotation.Items))
+	for _, item := range quotation.Items {
+		items = append(items, map[string]interface{}{
+			"Quantity":     item.Quantity,
+			"ProductName":  item.Description,
+			"ProductPrice": item.Price,
+			"TotalPrice":   item.Total,
+		})
+	}
+
+	return map[string]interface{}{
+		"CreatedAt":       quotation.Date,
+		"QuotationNumber": quotation.Number,
+		"ValidUntil":      quotation.ValidUntil,
+		"BuyerName":       quotation.BuyerName,
+		"BuyerAddress":    quotation.BuyerAddress,
+		"Items":           items,
+		"TaxRate":         quotation.TaxRate,
+		"Dpp":             quotation.TaxBase,
+		"Ppn":             quotation.TaxAmount,
+		"Total":           quotation.Total,
+		"Logo":            quotation.Logo,
+		"VenueName":       quotation.VenueName,
+		"VenueAddress":    quotation.VenueAddress,
+	}
+}
+
+// TemplateData returns the data of certificate templates
+func (certificate Certificate) TemplateData() map[string]interface{} {
+	return map[string]interface{}{
+		"VenueName":    strings.ToUpper(certificate.VenueName),
+		"Name":         strings.Title(certificate.VenueName),
+		"Address":      certificate.Address,
+		"VenueAddress": certificate.Address,
+		"Zip":          certificate.Zip,
+		"City":         certificate.City,
+		"Province":     certificate.Province,
+		"QrBase64":     certificate.QRCode,
+		"Background":   certificate.Background,
+	}
+}
@@ -0,0 +1,249 @@
+package document
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// nativeLayoutVersion changes whenever the native layouts change, so cached
+// documents are rendered again
+const nativeLayoutVersion = "native-3"
+
+// A4 page size in points
+const (
+	a4Short = 595.28
+	a4Long  = 841.89
+)
+
+// navy of the invoice headers, as in pdf_invoice.tmpl
+var navy = [3]int{0, 0, 128}
+
+// nativeRenderer lays out documents in pure Go, for tests and local runs
+// without wkhtmltopdf. The layouts follow pdf_invoice.tmpl, pdf_quotation.tmpl
+// and pdf_sertificate.tmpl but are not read from them
+type nativeRenderer struct{}
+
+// NewNativeRenderer returns renderer of the built in invoice, quotation and
+// certificate layouts
+func NewNativeRenderer() Renderer {
+	return &nativeRenderer{}
+}
+
+// Layout is the version of the built in layouts
+func (r *nativeRenderer) Layout(kind string) (layout string, err error) {
+	return nativeLayoutVersion, nil
+}
+
+func (r *nativeRenderer) RenderInvoice(invoice Invoice) (pdf []byte, err error) {
+	return renderBill(bill{
+		Title: "Invoice",
+		Details: [][2]string{
+			{"Date", invoice.Date},
+			{"Invoice #", invoice.Number},
+			{"Customer Reference", invoice.CustomerReference},
+		},
+		BuyerName:    invoice.BuyerName,
+		BuyerAddress: invoice.BuyerAddress,
+		BuyerNpwp:    invoice.BuyerNpwp,
+		Items:        invoice.Items,
+		Totals: [][2]string{
+			{"DPP", invoice.TaxBase},
+			{"PPN " + invoice.TaxRate, invoice.TaxAmount},
+			{"TOTAL", invoice.Total},
+		},
+		Due:  [2]string{"Balance Due", invoice.BalanceDue},
+		Logo: invoice.Logo,
+	})
+}
+
+func (r *nativeRenderer) RenderQuotation(quotation Quotation) (pdf []byte, err error) {
+	return renderBill(bill{
+		Title: "Quotation",
+		Details: [][2]string{
+			{"Date", quotation.Date},
+			{"Quotation #", quotation.Number},
+			{"Valid Until", quotation.ValidUntil},
+			{"Venue", quotation.VenueName},
+		},
+		BuyerName:    quotation.BuyerName,
+		BuyerAddress: quotation.BuyerAddress,
+		Items:        quotation.Items,
+		Totals: [][2]string{
+			{"DPP", quotation.TaxBase},
+			{"PPN " + quotation.TaxRate, quotation.TaxAmount},
+		},
+		Due:  [2]string{"TOTAL", quotation.Total},
+		Logo: quotation.Logo,
+	})
+}
+
+// bill is the layout shared by invoices and quotations
+type bill struct {
+	Title        string
+	Details      [][2]string
+	BuyerName    string
+	BuyerAddress string
+	BuyerNpwp    string
+	Items        []InvoiceItem
+	Totals       [][2]string
+	Due          [2]string
+	Logo         string
+}
+
+func renderBill(b bill) (pdf []byte, err error) {
+	const (
+		margin = 40.0
+		right  = a4Short - margin
+		bottom = a4Long - margin
+	)
+	w := newPDFWriter(a4Short, a4Long)
+	w.addPage()
+
+	y := margin
+	w.color(0, 0, 0)
+	if b.Logo != "" {
+		err = w.image(b.Logo, margin, y, 132, 72)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s logo: %s", strings.ToLower(b.Title), err.Error())
+		}
+	}
+	w.textRight(right, y+14, 14, false, b.Title)
+	y += 100
+
+	w.text(margin, y, 20, true, "PT MITRA MEDIA INTEGRASI")
+	y += 24
+
+	for i, detail := range b.Details {
+		bold := i == 0
+		w.text(340, y, 9, bold, detail[0])
+		w.text(440, y, 9, bold, ": "+detail[1])
+		y += 13
+	}
+	y += 12
+
+	// bill to
+	w.color(navy[0], navy[1], navy[2])
+	w.fillRect(margin, y, 240, 16)
+	w.color(255, 255, 255)
+	w.text(margin+4, y+11.5, 9, true, "BILL TO")
+	y += 16
+	w.color(0, 0, 0)
+	buyer := append(wrapText(b.BuyerName, 9, false, 232), wrapText(b.BuyerAddress, 9, false, 232)...)
+	if b.BuyerNpwp != "" {
+		buyer = append(buyer, "NPWP: "+b.BuyerNpwp)
+	}
+	for _, line := range buyer {
+		y += 13
+		w.text(margin+4, y, 9, false, line)
+	}
+	y += 30
+
+	// items
+	var (
+		columns = [5]float64{margin, margin + 50, margin + 295, margin + 405, right}
+		headers = [4]string{"QTY", "ITEM #", "UNIT PRICE (Rp. )", "AMOUNT (Rp. )"}
+	)
+	header := func() {
+		w.color(navy[0], navy[1], navy[2])
+		w.fillRect(margin, y, right-margin, 18)
+		w.color(255, 255, 255)
+		for i, title := range headers {
+			w.text(columns[i]+4, y+12.5, 9, true, title)
+		}
+		w.color(0, 0, 0)
+		y += 18
+	}
+	header()
+	for _, item := range b.Items {
+		lines := wrapText(item.Description, 9, false, columns[2]-columns[1]-8)
+		height := float64(len(lines))*12 + 6
+		if y+height > bottom {
+			w.addPage()
+			y = margin
+			header()
+		}
+
+		w.strokeRect(margin, y, right-margin, height)
+		for i := 1; i < 4; i++ {
+			w.line(columns[i], y, columns[i], y+height)
+		}
+		w.text(columns[0]+4, y+13, 9, false, strconv.FormatInt(item.Quantity, 10))
+		for i, line := range lines {
+			w.text(columns[1]+4, y+13+float64(i)*12, 9, false, line)
+		}
+		w.textRight(columns[3]-4, y+13, 9, false, item.Price)
+		w.textRight(columns[4]-4, y+13, 9, false, item.Total)
+		y += height
+	}
+	y += 30
+
+	// totals
+	if y+float64(len(b.Totals)+1)*18 > bottom {
+		w.addPage()
+		y = margin
+	}
+	for _, total := range b.Totals {
+		w.text(columns[2]+4, y+12.5, 9, false, total[0])
+		w.textRight(right-4, y+12.5, 9, false, total[1])
+		y += 18
+	}
+	w.color(navy[0], navy[1], navy[2])
+	w.fillRect(columns[2], y, right-columns[2], 18)
+	w.color(255, 255, 255)
+	w.text(columns[2]+4, y+12.5, 9, true, b.Due[0])
+	w.textRight(right-4, y+12.5, 9, true, b.Due[1])
+
+	return w.bytes()
+}
+
+func (r *nativeRenderer) RenderCertificate(certificate Certificate) (pdf []byte, err error) {
+	const center = a4Long / 2
+
+	w := newPDFWriter(a4Long, a4Short)
+	w.addPage()
+
+	w.color(navy[0], navy[1], navy[2])
+	w.fillRect(0, 0, a4Long, a4Short)
+	if certificate.Background != "" {
+		err = w.image(certificate.Background, 0, 0, a4Long, a4Short)
+		if err != nil {
+			return nil, fmt.Errorf("invalid certificate background: %s", err.Error())
+		}
+	}
+
+	w.color(255, 255, 255)
+	y := 250.0
+	for _, line := range wrapText(strings.ToUpper(certificate.VenueName), 28, true, a4Long-80) {
+		w.textCenter(center, y, 28, true, line)
+		y += 32
+	}
+
+	y = 320
+	body := []string{
+		"Selamat atas Keanggotaan Mola Live Arena !",
+		"Nama Perusahaan serta Lokasi Venue anda Sudah Ter-Registrasi di sistem kami,",
+		"",
+		"MOLA Live Arena terkait Premier League Football Competition Musim 2019/2020 dan konten MOLA TV lainnya",
+		"untuk penggunaan di Corporate & Commercial Area.",
+		"",
+		"Masa berlaku Keanggotaan Mola Live Arena ini sesuai dengan masa berlaku paket berlangganan",
+		"yang dibayarkan.",
+	}
+	for _, line := range body {
+		w.textCenter(center, y, 12, false, line)
+		y += 16
+	}
+
+	y = 500
+	note := []string{
+		"Catatan: Keanggotaan dapat dibatalkan apabila perusahaan atau Venue tidak melakukan perpanjangan masa berlangganan.",
+		"Harap cetak QR Code, digunting dan ditempel pada stiker resmi MOLA Live Arena.",
+	}
+	for _, line := range note {
+		w.textCenter(center, y, 9, false, line)
+		y += 12
+	}
+
+	return w.bytes()
+}
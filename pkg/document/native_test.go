@@ -0,0 +1,156 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestNativeRenderInvoice(t *testing.T) {
+	pdf, err := NewNativeRenderer().RenderInvoice(Invoice{
+		Date:              "2019-08-01",
+		Number:            "MN1908010000001",
+		CustomerReference: "PO-77",
+		BuyerName:         "PT Kopi Nusantara",
+		BuyerAddress:      "Jl. Sudirman 1, Jakarta",
+		BuyerNpwp:         "01.234.567.8-901.000",
+		Items: []InvoiceItem{
+			{Quantity: 1, Description: "Premier League 12 months", Price: "10.000.000,00", Total: "10.000.000,00"},
+		},
+		TaxRate:    "10%",
+		TaxBase:    "10.000.000,00",
+		TaxAmount:  "1.000.000,00",
+		Total:      "11.000.000,00",
+		BalanceDue: "11.000.000,00",
+		Logo:       testPNG(t),
+	})
+	if err != nil {
+		t.Fatalf("RenderInvoice() err: %s", err)
+	}
+
+	checkPDF(t, pdf)
+	text := pdfText(t, pdf)
+	for _, s := range []string{
+		"Invoice",
+		"MN1908010000001",
+		"PO-77",
+		"PT Kopi Nusantara",
+		"Premier League 12 months",
+		"PPN 10%",
+		"11.000.000,00",
+	} {
+		if !bytes.Contains(text, []byte(s)) {
+			t.Errorf("invoice does not show %q", s)
+		}
+	}
+}
+
+func TestNativeRenderCertificate(t *testing.T) {
+	pdf, err := NewNativeRenderer().RenderCertificate(Certificate{
+		VenueName:  "Kopi Kenangan (Senayan)",
+		Address:    "Jl. Asia Afrika 8",
+		City:       "Jakarta",
+		Background: testPNG(t),
+	})
+	if err != nil {
+		t.Fatalf("RenderCertificate() err: %s", err)
+	}
+
+	checkPDF(t, pdf)
+	text := pdfText(t, pdf)
+	for _, s := range []string{
+		`(KOPI KENANGAN \(SENAYAN\)) Tj`,
+		"Selamat atas Keanggotaan Mola Live Arena !",
+	} {
+		if !bytes.Contains(text, []byte(s)) {
+			t.Errorf("certificate does not show %q", s)
+		}
+	}
+}
+
+func TestNativeRenderInvalidLogo(t *testing.T) {
+	_, err := NewNativeRenderer().RenderInvoice(Invoice{Logo: "not a png"})
+	if err == nil {
+		t.Fatal("RenderInvoice() with invalid logo err is nil")
+	}
+}
+
+// checkPDF checks the header and trailer of pdf, and that startxref and the
+// xref table point to where the objects are
+func checkPDF(t *testing.T, pdf []byte) {
+	t.Helper()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-")) {
+		t.Fatalf("pdf starts with %q", pdf[:8])
+	}
+	if !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatal("pdf does not end with the EOF marker")
+	}
+
+	match := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if match == nil {
+		t.Fatal("pdf has no startxref")
+	}
+	xref, _ := strconv.Atoi(string(match[1]))
+	if xref >= len(pdf) || !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point to the xref table", xref)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("xref table has no objects")
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		want := fmt.Sprintf("%d 0 obj\n", i+1)
+		if offset >= len(pdf) || !bytes.HasPrefix(pdf[offset:], []byte(want)) {
+			t.Errorf("xref offset %d of object %d does not point to it", offset, i+1)
+		}
+	}
+}
+
+// pdfText returns the inflated content of every stream of pdf which is not an
+// image
+func pdfText(t *testing.T, pdf []byte) []byte {
+	t.Helper()
+
+	var text bytes.Buffer
+	streams := regexp.MustCompile(`(?s)<< /Filter /FlateDecode /Length (\d+) >>\nstream\n`).FindAllSubmatchIndex(pdf, -1)
+	for _, stream := range streams {
+		length, _ := strconv.Atoi(string(pdf[stream[2]:stream[3]]))
+		zr, err := zlib.NewReader(bytes.NewReader(pdf[stream[1] : stream[1]+length]))
+		if err != nil {
+			t.Fatalf("invalid content stream: %s", err)
+		}
+		content, err := ioutil.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("invalid content stream: %s", err)
+		}
+		text.Write(content)
+	}
+	return text.Bytes()
+}
+
+// testPNG returns a base64 encoded half transparent png
+func testPNG(t *testing.T) string {
+	t.Helper()
+
+	img := image.NewNRGBA(image.Rect(0, 0, 2, 2))
+	img.Set(0, 0, color.NRGBA{R: 255, A: 255})
+	img.Set(1, 1, color.NRGBA{B: 255, A: 128})
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		t.Fatalf("failed encode png: %s", err)
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes())
+}
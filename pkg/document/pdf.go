@@ -0,0 +1,262 @@
+package document
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/png"
+	"strings"
+)
+
+// pdfWriter writes simple pdf documents with the standard Helvetica fonts,
+// filled rectangles, lines and images. Coordinates are in points from the
+// top left of the page, text is placed by its baseline
+type pdfWriter struct {
+	width  float64
+	height float64
+
+	pages  []*bytes.Buffer
+	page   *bytes.Buffer
+	images []pdfImage
+}
+
+type pdfImage struct {
+	width  int
+	height int
+	rgb    []byte
+	alpha  []byte
+}
+
+func newPDFWriter(width, height float64) *pdfWriter {
+	return &pdfWriter{
+		width:  width,
+		height: height,
+	}
+}
+
+func (w *pdfWriter) addPage() {
+	w.page = &bytes.Buffer{}
+	w.pages = append(w.pages, w.page)
+}
+
+// color sets color of following fill and stroke, components are 0 to 255
+func (w *pdfWriter) color(r, g, b int) {
+	fmt.Fprintf(w.page, "%.3f %.3f %.3f rg %.3f %.3f %.3f RG\n",
+		float64(r)/255, float64(g)/255, float64(b)/255,
+		float64(r)/255, float64(g)/255, float64(b)/255)
+}
+
+func (w *pdfWriter) text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.page, "BT /%s %.2f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, w.height-y, escapeText(s))
+}
+
+// textRight places s ending at x
+func (w *pdfWriter) textRight(x, y, size float64, bold bool, s string) {
+	w.text(x-textWidth(s, size, bold), y, size, bold, s)
+}
+
+// textCenter places s centered on x
+func (w *pdfWriter) textCenter(x, y, size float64, bold bool, s string) {
+	w.text(x-textWidth(s, size, bold)/2, y, size, bold, s)
+}
+
+func (w *pdfWriter) fillRect(x, y, width, height float64) {
+	fmt.Fprintf(w.page, "%.2f %.2f %.2f %.2f re f\n", x, w.height-y-height, width, height)
+}
+
+func (w *pdfWriter) strokeRect(x, y, width, height float64) {
+	fmt.Fprintf(w.page, "0.5 w %.2f %.2f %.2f %.2f re S\n", x, w.height-y-height, width, height)
+}
+
+func (w *pdfWriter) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(w.page, "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, w.height-y1, x2, w.height-y2)
+}
+
+// image draws the base64 encoded png b64 into the box
+func (w *pdfWriter) image(b64 string, x, y, width, height float64) error {
+	byt, err := base64.StdEncoding.DecodeString(b64)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(bytes.NewReader(byt))
+	if err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	pi := pdfImage{
+		width:  bounds.Dx(),
+		height: bounds.Dy(),
+		rgb:    make([]byte, 0, bounds.Dx()*bounds.Dy()*3),
+	}
+	alpha := make([]byte, 0, bounds.Dx()*bounds.Dy())
+	opaque := true
+	for py := bounds.Min.Y; py < bounds.Max.Y; py++ {
+		for px := bounds.Min.X; px < bounds.Max.X; px++ {
+			c := color.NRGBAModel.Convert(img.At(px, py)).(color.NRGBA)
+			pi.rgb = append(pi.rgb, c.R, c.G, c.B)
+			alpha = append(alpha, c.A)
+			if c.A != 255 {
+				opaque = false
+			}
+		}
+	}
+	if !opaque {
+		pi.alpha = alpha
+	}
+
+	w.images = append(w.images, pi)
+	fmt.Fprintf(w.page, "q %.2f 0 0 %.2f %.2f %.2f cm /Im%d Do Q\n", width, height, x, w.height-y-height, len(w.images))
+	return nil
+}
+
+// bytes returns the pdf document
+func (w *pdfWriter) bytes() ([]byte, error) {
+	var (
+		buf     bytes.Buffer
+		offsets []int
+	)
+	object := func(body string, stream []byte) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\n", len(offsets), body)
+		if stream != nil {
+			buf.WriteString("stream\n")
+			buf.Write(stream)
+			buf.WriteString("\nendstream\n")
+		}
+		buf.WriteString("endobj\n")
+	}
+
+	// objects are numbered: catalog, pages, two fonts, images with their
+	// masks, then each page followed by its content
+	imageIDs := make([]int, len(w.images))
+	next := 5
+	for i, img := range w.images {
+		imageIDs[i] = next
+		next++
+		if img.alpha != nil {
+			next++
+		}
+	}
+	pageIDs := make([]int, len(w.pages))
+	for i := range w.pages {
+		pageIDs[i] = next
+		next += 2
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	kids := make([]string, 0, len(pageIDs))
+	for _, id := range pageIDs {
+		kids = append(kids, fmt.Sprintf("%d 0 R", id))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>", nil)
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pageIDs)), nil)
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>", nil)
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>", nil)
+
+	xObjects := make([]string, 0, len(w.images))
+	for i, img := range w.images {
+		rgb, err := deflate(img.rgb)
+		if err != nil {
+			return nil, err
+		}
+		mask := ""
+		if img.alpha != nil {
+			mask = fmt.Sprintf(" /SMask %d 0 R", imageIDs[i]+1)
+		}
+		object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode /Length %d%s >>",
+			img.width, img.height, len(rgb), mask), rgb)
+		if img.alpha != nil {
+			alpha, err := deflate(img.alpha)
+			if err != nil {
+				return nil, err
+			}
+			object(fmt.Sprintf("<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /Length %d >>",
+				img.width, img.height, len(alpha)), alpha)
+		}
+		xObjects = append(xObjects, fmt.Sprintf("/Im%d %d 0 R", i+1, imageIDs[i]))
+	}
+
+	resources := fmt.Sprintf("<< /Font << /F1 3 0 R /F2 4 0 R >> /XObject << %s >> >>", strings.Join(xObjects, " "))
+	for i, page := range w.pages {
+		content, err := deflate(page.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources %s /Contents %d 0 R >>",
+			w.width, w.height, resources, pageIDs[i]+1), nil)
+		object(fmt.Sprintf("<< /Filter /FlateDecode /Length %d >>", len(content)), content)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes(), nil
+}
+
+func deflate(byt []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	_, err := zw.Write(byt)
+	if err != nil {
+		return nil, err
+	}
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// escapeText encodes s for a pdf string in WinAnsiEncoding, characters
+// outside Latin-1 are replaced by ?
+func escapeText(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r >= 32 && r <= 126:
+			buf.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&buf, "\\%03o", r)
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	return buf.String()
+}
+
+// wrapText splits s into lines not wider than width
+func wrapText(s string, size float64, bold bool, width float64) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(s, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			candidate := word
+			if line != "" {
+				candidate = line + " " + word
+			}
+			if line != "" && textWidth(candidate, size, bold) > width {
+				lines = append(lines, line)
+				candidate = word
+			}
+			line = candidate
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
@@ -0,0 +1,17 @@
+package document
+
+// Renderer renders documents into pdf
+type Renderer interface {
+	RenderInvoice(invoice Invoice) (pdf []byte, err error)
+	RenderQuotation(quotation Quotation) (pdf []byte, err error)
+	RenderCertificate(certificate Certificate) (pdf []byte, err error)
+	// Layout identifies the layout of kind, rendered documents are cached
+	// until it changes
+	Layout(kind string) (layout string, err error)
+}
+
+// Names of the renderers selectable in config
+const (
+	RendererWkhtmltopdf = "wkhtmltopdf"
+	RendererNative      = "native"
+)
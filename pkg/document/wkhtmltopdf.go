@@ -0,0 +1,100 @@
+package document
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/template"
+	wkhtmltopdf "github.com/SebastiaanKlippert/go-wkhtmltopdf"
+)
+
+// templates of documents rendered with wkhtmltopdf
+var wkhtmltopdfTemplates = map[string]string{
+	KindInvoice:     "pdf_invoice.tmpl",
+	KindQuotation:   "pdf_quotation.tmpl",
+	KindCertificate: "pdf_sertificate.tmpl",
+}
+
+// wkhtmltopdfRenderer renders the html templates of documents with the
+// wkhtmltopdf binary
+type wkhtmltopdfRenderer struct {
+	template template.ICore
+}
+
+// NewWkhtmltopdfRenderer returns renderer of pdf_invoice.tmpl,
+// pdf_quotation.tmpl and pdf_sertificate.tmpl templates, it needs wkhtmltopdf
+// installed
+func NewWkhtmltopdfRenderer(template template.ICore) Renderer {
+	return &wkhtmltopdfRenderer{
+		template: template,
+	}
+}
+
+func (r *wkhtmltopdfRenderer) RenderInvoice(invoice Invoice) (pdf []byte, err error) {
+	return r.render(KindInvoice, invoice.Locale, invoice.TemplateData(), Portrait)
+}
+
+func (r *wkhtmltopdfRenderer) RenderQuotation(quotation Quotation) (pdf []byte, err error) {
+	return r.render(KindQuotation, quotation.Locale, quotation.TemplateData(), Portrait)
+}
+
+func (r *wkhtmltopdfRenderer) RenderCertificate(certificate Certificate) (pdf []byte, err error) {
+	return r.render(KindCertificate, certificate.Locale, certificate.TemplateData(), Landscape)
+}
+
+// Layout is the source of the template of kind
+func (r *wkhtmltopdfRenderer) Layout(kind string) (layout string, err error) {
+	t, err := r.template.Get(wkhtmltopdfTemplates[kind])
+	if err != nil {
+		return "", err
+	}
+	if t.Tree == nil {
+		return "", nil
+	}
+	return t.Tree.Root.String(), nil
+}
+
+func (r *wkhtmltopdfRenderer) render(kind string, locale string, templateData map[string]interface{}, orientation string) (pdf []byte, err error) {
+	if locale == "" {
+		locale = template.DefaultLocale
+	}
+	t, err := r.template.GetLocale(wkhtmltopdfTemplates[kind], locale)
+	if err != nil {
+		return nil, err
+	}
+
+	buff := bytes.NewBuffer([]byte{})
+	err = t.Execute(buff, templateData)
+	if err != nil {
+		return nil, fmt.Errorf("failed execute %s template: %s", kind, err.Error())
+	}
+
+	return RenderHTML(buff, orientation)
+}
+
+// RenderHTML converts html into pdf with wkhtmltopdf, Landscape orientation
+// has no margin
+func RenderHTML(html io.Reader, orientation string) (pdf []byte, err error) {
+	pdfBuffer := bytes.NewBuffer([]byte{})
+	gen, err := wkhtmltopdf.NewPDFGenerator()
+	if err != nil {
+		return nil, err
+	}
+
+	if orientation == Landscape {
+		gen.Orientation.Set(wkhtmltopdf.OrientationLandscape)
+		gen.MarginBottom.Set(0)
+		gen.MarginTop.Set(0)
+		gen.MarginLeft.Set(0)
+		gen.MarginRight.Set(0)
+	}
+	gen.SetOutput(pdfBuffer)
+	gen.AddPage(wkhtmltopdf.NewPageReader(html))
+	err = gen.Create()
+	if err != nil {
+		return nil, err
+	}
+
+	return pdfBuffer.Bytes(), nil
+}
@@ -2,16 +2,12 @@ package email
 
 import (
 	"bufio"
-	"bytes"
 	"encoding/base64"
-	"encoding/json"
 	"flag"
 	"fmt"
 	"image"
 	_ "image/png"
-	"net/http"
 	"os"
-	"time"
 
 	"github.com/divan/qrlogo"
 )
@@ -19,57 +15,21 @@ import (
 // ICore is the interface
 type ICore interface {
 	Send(emailRequest EmailRequest) (err error)
-	GetBase64Png(licenseNum string) (string, string)
+	GetBase64Png(payload string) (string, string)
 	GetPic() (string)
 }
 
-// core contains db client
+// core contains email transport
 type core struct {
-	urlQrCode           string
-	apiBaseURL          string
-	tokenGeneratorEmail TokenGeneratorEmail
+	urlQrCode string
+	transport Transport
 }
 
-var httpClient = http.Client{
-	Timeout: time.Second * 10,
-}
-
-// this is the example to create http request
 func (c *core) Send(emailRequest EmailRequest) (err error) {
-	// accessToken, err := c.tokenGeneratorEmail.GetAccessToken(5)
-
-	if err != nil {
-		return err
-	}
-
-	body, err := json.Marshal(EmailRequest{
-		Subject:     emailRequest.Subject,
-		To:          emailRequest.To,
-		HTML:        emailRequest.HTML,
-		From:        emailRequest.From,
-		Text:        emailRequest.Text,
-		Attachments: emailRequest.Attachments,
-	})
-
-	// var url = c.apiBaseURL + "/v1/email/send"
-	var url = c.apiBaseURL + "/send"
-
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
-	if err != nil {
-		return err
-	}
-	request.Header.Add("Content-Type", "application/json")
-	// request.Header.Add("Authorization", "Bearer "+accessToken)
-
-	response, err := httpClient.Do(request)
+	err = c.transport.Send(emailRequest)
 	if err != nil {
 		return err
 	}
-	defer response.Body.Close()
-
-	if response.StatusCode != 200 {
-		return err
-	}
 	fmt.Printf("Email Sent To : %s", emailRequest.To)
 	return
 }
@@ -80,9 +40,11 @@ var (
 	size   = flag.Int("size", 302, "Image size in pixels")
 )
 
-func (c *core) GetBase64Png(licenseNum string) (string, string) {
+// GetBase64Png returns QR code of urlQrCode + payload, e.g. the signed license
+// token, and the certificate background
+func (c *core) GetBase64Png(payload string) (string, string) {
 
-	qrCode := c.urlQrCode + licenseNum
+	qrCode := c.urlQrCode + payload
 
 	file, err := os.Open(*input)
 	if err != nil {
@@ -4,11 +4,10 @@ type TokenGeneratorEmail interface {
 	GetAccessToken(pid int64) (string, error)
 }
 
-// Init is used to initialize room package
-func Init(apiBaseURL string, urlQrCode string, tokenGeneratorEmail TokenGeneratorEmail) ICore {
+// Init is used to initialize email package, emails are sent with transport
+func Init(transport Transport, urlQrCode string) ICore {
 	return &core{
-		urlQrCode:           urlQrCode,
-		apiBaseURL:          apiBaseURL,
-		tokenGeneratorEmail: tokenGeneratorEmail,
+		urlQrCode: urlQrCode,
+		transport: transport,
 	}
 }
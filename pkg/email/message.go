@@ -0,0 +1,173 @@
+package email
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// buildMessage renders emailRequest as a MIME message: the text and html
+// bodies as alternatives, followed by the attachments
+func buildMessage(emailRequest EmailRequest, now time.Time) ([]byte, error) {
+	from, err := mail.ParseAddress(emailRequest.From)
+	if err != nil {
+		return nil, err
+	}
+	messageID, err := newMessageID(from.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	mixed := multipart.NewWriter(&buf)
+
+	header := []string{
+		"From: " + from.String(),
+		"To: " + emailRequest.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", emailRequest.Subject),
+		"Date: " + now.Format(time.RFC1123Z),
+		"Message-ID: " + messageID,
+		"MIME-Version: 1.0",
+		"Content-Type: multipart/mixed; boundary=" + mixed.Boundary(),
+	}
+	var message bytes.Buffer
+	message.WriteString(strings.Join(header, "\r\n") + "\r\n\r\n")
+
+	err = writeBody(mixed, emailRequest)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range emailRequest.Attachments {
+		err = writeAttachment(mixed, attachment)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = mixed.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	message.Write(buf.Bytes())
+	return message.Bytes(), nil
+}
+
+func writeBody(mixed *multipart.Writer, emailRequest EmailRequest) error {
+	var buf bytes.Buffer
+	alternative := multipart.NewWriter(&buf)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", emailRequest.Text},
+		{"text/html; charset=utf-8", emailRequest.HTML},
+	}
+	for _, part := range parts {
+		if part.content == "" {
+			continue
+		}
+		w, err := alternative.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return err
+		}
+		qp := quotedprintable.NewWriter(w)
+		_, err = qp.Write([]byte(part.content))
+		if err != nil {
+			return err
+		}
+		err = qp.Close()
+		if err != nil {
+			return err
+		}
+	}
+	err := alternative.Close()
+	if err != nil {
+		return err
+	}
+
+	w, err := mixed.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {"multipart/alternative; boundary=" + alternative.Boundary()},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func writeAttachment(mixed *multipart.Writer, attachment Attachment) error {
+	content, err := base64.StdEncoding.DecodeString(attachment.Content)
+	if err != nil {
+		return fmt.Errorf("attachment %s is not base64 encoded: %s", attachment.Filename, err.Error())
+	}
+
+	disposition := attachment.Disposition
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	header := textproto.MIMEHeader{
+		"Content-Type":              {attachmentType(attachment)},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename})},
+	}
+	if attachment.ContentID != "" {
+		header.Set("Content-ID", "<"+attachment.ContentID+">")
+	}
+
+	w, err := mixed.CreatePart(header)
+	if err != nil {
+		return err
+	}
+
+	// base64 lines of MIME are at most 76 characters
+	encoded := base64.StdEncoding.EncodeToString(content)
+	for len(encoded) > 76 {
+		_, err = w.Write([]byte(encoded[:76] + "\r\n"))
+		if err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = w.Write([]byte(encoded + "\r\n"))
+	return err
+}
+
+// attachmentType returns the content type of attachment by its file
+// extension, Type is only a fallback as callers set plain/text for pdf
+func attachmentType(attachment Attachment) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(attachment.Filename)); contentType != "" {
+		return contentType
+	}
+	if _, _, err := mime.ParseMediaType(attachment.Type); err == nil {
+		return attachment.Type
+	}
+	return "application/octet-stream"
+}
+
+func newMessageID(from string) (string, error) {
+	random := make([]byte, 16)
+	_, err := rand.Read(random)
+	if err != nil {
+		return "", err
+	}
+
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">", nil
+}
@@ -0,0 +1,14 @@
+package email
+
+// Transport delivers a rendered email. EmailRequest is the same for every
+// transport, attachments carry base64 encoded content
+type Transport interface {
+	Send(emailRequest EmailRequest) (err error)
+}
+
+// Names of the transports selectable in config
+const (
+	TransportHTTP = "http"
+	TransportSMTP = "smtp"
+	TransportFile = "file"
+)
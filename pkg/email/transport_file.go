@@ -0,0 +1,42 @@
+package email
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// fileTransport writes email as .eml files instead of sending them, for local
+// development and tests
+type fileTransport struct {
+	dir string
+}
+
+var unsafeFilename = regexp.MustCompile(`[^a-zA-Z0-9@._-]+`)
+
+// NewFileTransport returns transport writing email into dir, which is created
+// when it does not exist
+func NewFileTransport(dir string) (Transport, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+	return &fileTransport{
+		dir: dir,
+	}, nil
+}
+
+func (t *fileTransport) Send(emailRequest EmailRequest) (err error) {
+	now := time.Now()
+
+	message, err := buildMessage(emailRequest, now)
+	if err != nil {
+		return err
+	}
+
+	filename := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), unsafeFilename.ReplaceAllString(emailRequest.To, "_"))
+	return ioutil.WriteFile(filepath.Join(t.dir, filename), message, 0644)
+}
@@ -0,0 +1,61 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// tokenProjectID is the project of the email service token mapping
+const tokenProjectID = 5
+
+// httpTransport sends email through the email service API
+type httpTransport struct {
+	apiBaseURL          string
+	tokenGeneratorEmail TokenGeneratorEmail
+}
+
+var httpClient = http.Client{
+	Timeout: time.Second * 10,
+}
+
+// NewHTTPTransport returns transport posting email to apiBaseURL + "/send"
+// authorized with token of tokenGeneratorEmail
+func NewHTTPTransport(apiBaseURL string, tokenGeneratorEmail TokenGeneratorEmail) Transport {
+	return &httpTransport{
+		apiBaseURL:          apiBaseURL,
+		tokenGeneratorEmail: tokenGeneratorEmail,
+	}
+}
+
+func (t *httpTransport) Send(emailRequest EmailRequest) (err error) {
+	accessToken, err := t.tokenGeneratorEmail.GetAccessToken(tokenProjectID)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(emailRequest)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", t.apiBaseURL+"/send", bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add("Authorization", "Bearer "+accessToken)
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("email service responded with status %d", response.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package email
+
+import (
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// SMTPOption configures the smtp transport. With ImplicitTLS the connection
+// is TLS from the start (usually port 465), otherwise it is upgraded with
+// STARTTLS (usually port 587). Plain text connections are never used
+type SMTPOption struct {
+	Host        string
+	Port        int
+	Username    string
+	Password    string
+	ImplicitTLS bool
+	Timeout     time.Duration
+}
+
+// smtpTransport sends email directly to a smtp server
+type smtpTransport struct {
+	option SMTPOption
+}
+
+// NewSMTPTransport returns transport sending email to the smtp server of option
+func NewSMTPTransport(option SMTPOption) Transport {
+	if option.Timeout <= 0 {
+		option.Timeout = 10 * time.Second
+	}
+	return &smtpTransport{
+		option: option,
+	}
+}
+
+func (t *smtpTransport) Send(emailRequest EmailRequest) (err error) {
+	from, err := mail.ParseAddress(emailRequest.From)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddressList(emailRequest.To)
+	if err != nil {
+		return err
+	}
+
+	message, err := buildMessage(emailRequest, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := t.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if t.option.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", t.option.Username, t.option.Password, t.option.Host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		err = client.Rcpt(rcpt.Address)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(message)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// dial connects to the smtp server over TLS
+func (t *smtpTransport) dial() (*smtp.Client, error) {
+	var (
+		addr      = net.JoinHostPort(t.option.Host, strconv.Itoa(t.option.Port))
+		tlsConfig = &tls.Config{ServerName: t.option.Host}
+		dialer    = &net.Dialer{Timeout: t.option.Timeout}
+		conn      net.Conn
+		err       error
+	)
+	if t.option.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = conn.SetDeadline(time.Now().Add(t.option.Timeout))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	client, err := smtp.NewClient(conn, t.option.Host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !t.option.ImplicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, errors.New("smtp server does not support STARTTLS")
+		}
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+	}
+	return client, nil
+}
@@ -3,19 +3,21 @@ package email_log
 import (
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
 )
 
 // ICore is the interface
 type ICore interface {
 	Insert(emailLog *EmailLog) (err error)
+	RecordAttempt(emailLog *EmailLog) (err error)
+	IsSent(venueID int64, emailType string, since time.Time) (sent bool, err error)
 }
 
 // core contains db client
 type core struct {
 	db    *sqlx.DB
-	redis *redis.Pool
+	cache cache.ICore
 }
 
 func (c *core) Insert(emailLog *EmailLog) (err error) {
@@ -24,6 +26,10 @@ func (c *core) Insert(emailLog *EmailLog) (err error) {
 	emailLog.ProjectID = 10
 	emailLog.Status = 1
 	emailLog.LastUpdateBy = emailLog.CreatedBy
+	if emailLog.DeliveryStatus == "" {
+		emailLog.DeliveryStatus = DeliverySent
+		emailLog.Attempts = 1
+	}
 
 	_, err = c.db.NamedExec(`
 		INSERT INTO mla_email_log (
@@ -33,6 +39,9 @@ func (c *core) Insert(emailLog *EmailLog) (err error) {
 			company_id,
 			to_email,
 			email_type,
+			delivery_status,
+			attempts,
+			last_error,
 			created_at,
 			updated_at,
 			project_id,
@@ -46,6 +55,9 @@ func (c *core) Insert(emailLog *EmailLog) (err error) {
 			:company_id,
 			:to_email,
 			:email_type,
+			:delivery_status,
+			:attempts,
+			:last_error,
 			:created_at,
 			:updated_at,
 			:project_id,
@@ -57,3 +69,77 @@ func (c *core) Insert(emailLog *EmailLog) (err error) {
 
 	return
 }
+
+// RecordAttempt keeps one log per outbox email, updated with the delivery
+// status, attempts and error of its latest attempt
+func (c *core) RecordAttempt(emailLog *EmailLog) (err error) {
+	emailLog.CreatedAt = time.Now()
+	emailLog.UpdatedAt = emailLog.CreatedAt
+	emailLog.Status = 1
+	emailLog.LastUpdateBy = emailLog.CreatedBy
+
+	_, err = c.db.NamedExec(`
+		INSERT INTO mla_email_log (
+			sender_uid,
+			order_id,
+			venue_id,
+			company_id,
+			to_email,
+			email_type,
+			outbox_id,
+			delivery_status,
+			attempts,
+			last_error,
+			created_at,
+			updated_at,
+			project_id,
+			created_by,
+			last_update_by,
+			status
+		) VALUES (
+			:sender_uid,
+			:order_id,
+			:venue_id,
+			:company_id,
+			:to_email,
+			:email_type,
+			:outbox_id,
+			:delivery_status,
+			:attempts,
+			:last_error,
+			:created_at,
+			:updated_at,
+			:project_id,
+			:created_by,
+			:last_update_by,
+			:status
+		) ON DUPLICATE KEY UPDATE
+			to_email = VALUES(to_email),
+			delivery_status = VALUES(delivery_status),
+			attempts = VALUES(attempts),
+			last_error = VALUES(last_error),
+			updated_at = VALUES(updated_at),
+			last_update_by = VALUES(last_update_by)
+	`, emailLog)
+
+	return
+}
+
+// IsSent reports whether email of emailType has been sent for the venue since the given time
+func (c *core) IsSent(venueID int64, emailType string, since time.Time) (sent bool, err error) {
+	var count int64
+	err = c.db.Get(&count, `
+		SELECT
+			COUNT(id)
+		FROM
+			mla_email_log
+		WHERE
+			venue_id = ? AND
+			email_type = ? AND
+			delivery_status = ? AND
+			created_at >= ? AND
+			deleted_at IS NULL
+	`, venueID, emailType, DeliverySent, since)
+
+	return count > 0, err
+}
@@ -0,0 +1,284 @@
+package email_outbox
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// ICore is the interface
+type ICore interface {
+	Enqueue(tx *sqlx.Tx, message *Message) (err error)
+	Claim(pid int64, lease time.Duration, limit int) (messages Messages, err error)
+	MarkSent(message *Message) (err error)
+	MarkFailed(message *Message, cause error) (err error)
+	Select(pid int64, status string, limit, offset int) (messages Messages, err error)
+	Get(id int64, pid int64) (message Message, err error)
+	Retry(id int64, pid int64, userID string) (err error)
+}
+
+// core contains db client
+type core struct {
+	db     *sqlx.DB
+	policy Policy
+}
+
+const workerUser = "email-outbox"
+
+// Enqueue adds message to outbox in tx, so it is only sent when the write
+// needing it commits
+func (c *core) Enqueue(tx *sqlx.Tx, message *Message) (err error) {
+	message.Status = StatusPending
+	message.Attempts = 0
+	message.CreatedAt = time.Now()
+	message.UpdatedAt = message.CreatedAt
+	message.NextAttemptAt = message.CreatedAt
+	message.LastUpdateBy = message.CreatedBy
+
+	res, err := tx.NamedExec(`
+		INSERT INTO mla_email_outbox (
+			type,
+			order_id,
+			venue_id,
+			status,
+			attempts,
+			next_attempt_at,
+			project_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by
+		) VALUES (
+			:type,
+			:order_id,
+			:venue_id,
+			:status,
+			:attempts,
+			:next_attempt_at,
+			:project_id,
+			:created_at,
+			:created_by,
+			:updated_at,
+			:last_update_by
+		)
+	`, message)
+	if err != nil {
+		return err
+	}
+
+	message.ID, err = res.LastInsertId()
+	return err
+}
+
+// Claim returns pending messages due now and moves their next attempt lease
+// ahead, so other workers skip them while they are being sent
+func (c *core) Claim(pid int64, lease time.Duration, limit int) (messages Messages, err error) {
+	now := time.Now()
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.Select(&messages, `
+		SELECT
+			id,
+			type,
+			order_id,
+			venue_id,
+			status,
+			attempts,
+			next_attempt_at,
+			last_error,
+			sent_at,
+			project_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by
+		FROM
+			mla_email_outbox
+		WHERE
+			project_id = ? AND
+			status = ? AND
+			next_attempt_at <= ?
+		ORDER BY next_attempt_at
+		LIMIT ?
+		FOR UPDATE
+	`, pid, StatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) == 0 {
+		return messages, nil
+	}
+
+	ids := make([]int64, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	query, args, err := sqlx.In(`
+		UPDATE
+			mla_email_outbox
+		SET
+			next_attempt_at = ?
+		WHERE
+			id IN (?)
+	`, now.Add(lease), ids)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// MarkSent records a successful attempt of message
+func (c *core) MarkSent(message *Message) (err error) {
+	message.Attempts++
+	message.Status = StatusSent
+	message.LastError = null.String{}
+	message.UpdatedAt = time.Now()
+	message.SentAt = null.TimeFrom(message.UpdatedAt)
+	message.LastUpdateBy = workerUser
+
+	return c.update(message)
+}
+
+// MarkFailed records a failed attempt of message, it is retried after the
+// backoff of the policy or becomes dead after the last attempt
+func (c *core) MarkFailed(message *Message, cause error) (err error) {
+	message.Attempts++
+	message.LastError = null.StringFrom(cause.Error())
+	message.UpdatedAt = time.Now()
+	message.LastUpdateBy = workerUser
+	if message.Attempts >= c.policy.MaxAttempts {
+		message.Status = StatusDead
+	} else {
+		message.NextAttemptAt = message.UpdatedAt.Add(c.policy.backoff(message.Attempts))
+	}
+
+	return c.update(message)
+}
+
+func (c *core) update(message *Message) (err error) {
+	_, err = c.db.NamedExec(`
+		UPDATE
+			mla_email_outbox
+		SET
+			status = :status,
+			attempts = :attempts,
+			next_attempt_at = :next_attempt_at,
+			last_error = :last_error,
+			sent_at = :sent_at,
+			updated_at = :updated_at,
+			last_update_by = :last_update_by
+		WHERE
+			id = :id AND
+			project_id = :project_id
+	`, message)
+	return
+}
+
+// Select returns messages of the project newest first, all statuses when
+// status is empty
+func (c *core) Select(pid int64, status string, limit, offset int) (messages Messages, err error) {
+	query := `
+		SELECT
+			id,
+			type,
+			order_id,
+			venue_id,
+			status,
+			attempts,
+			next_attempt_at,
+			last_error,
+			sent_at,
+			project_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by
+		FROM
+			mla_email_outbox
+		WHERE
+			project_id = ?`
+	args := []interface{}{pid}
+
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	err = c.db.Select(&messages, query, args...)
+	return
+}
+
+func (c *core) Get(id int64, pid int64) (message Message, err error) {
+	err = c.db.Get(&message, `
+		SELECT
+			id,
+			type,
+			order_id,
+			venue_id,
+			status,
+			attempts,
+			next_attempt_at,
+			last_error,
+			sent_at,
+			project_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by
+		FROM
+			mla_email_outbox
+		WHERE
+			id = ? AND
+			project_id = ?
+	`, id, pid)
+	return
+}
+
+// Retry makes a dead message pending again with a fresh set of attempts
+func (c *core) Retry(id int64, pid int64, userID string) (err error) {
+	now := time.Now()
+
+	res, err := c.db.Exec(`
+		UPDATE
+			mla_email_outbox
+		SET
+			status = ?,
+			attempts = 0,
+			next_attempt_at = ?,
+			updated_at = ?,
+			last_update_by = ?
+		WHERE
+			id = ? AND
+			project_id = ? AND
+			status = ?
+	`, StatusPending, now, now, userID, id, pid, StatusDead)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotDead
+	}
+	return nil
+}
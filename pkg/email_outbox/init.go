@@ -0,0 +1,35 @@
+package email_outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Init is used to initialize email outbox package
+func Init(db *sqlx.DB, policy Policy) ICore {
+	examineDBHealth(db)
+	if policy.MaxAttempts <= 0 {
+		log.Fatalf("Failed to initialize email outbox. max attempts must be positive")
+	}
+	return &core{
+		db:     db,
+		policy: policy,
+	}
+}
+
+func examineDBHealth(db *sqlx.DB) {
+	if db == nil {
+		log.Fatalf("Failed to initialize email outbox. db object cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize email outbox. cannot pinging to db. err: %s", err)
+	}
+}
@@ -0,0 +1,67 @@
+package email_outbox
+
+import (
+	"errors"
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Types of email in outbox
+const (
+	TypeECert   = "ecert"
+	TypeInvoice = "invoice"
+)
+
+// Statuses of email in outbox. Pending emails are sent by the worker until
+// they are sent or run out of attempts and become dead
+const (
+	StatusPending = "pending"
+	StatusSent    = "sent"
+	StatusDead    = "dead"
+)
+
+// ErrNotDead is returned when retrying an email which is not dead
+var ErrNotDead = errors.New("email is not dead")
+
+// Message is model for mla_email_outbox in db. It keeps what to send, the
+// email itself is rendered on every attempt
+type Message struct {
+	ID            int64       `db:"id"`
+	Type          string      `db:"type"`
+	OrderID       int64       `db:"order_id"`
+	VenueID       int64       `db:"venue_id"`
+	Status        string      `db:"status"`
+	Attempts      int64       `db:"attempts"`
+	NextAttemptAt time.Time   `db:"next_attempt_at"`
+	LastError     null.String `db:"last_error"`
+	SentAt        null.Time   `db:"sent_at"`
+	ProjectID     int64       `db:"project_id"`
+	CreatedAt     time.Time   `db:"created_at"`
+	CreatedBy     string      `db:"created_by"`
+	UpdatedAt     time.Time   `db:"updated_at"`
+	LastUpdateBy  string      `db:"last_update_by"`
+}
+
+// Messages is list of message
+type Messages []Message
+
+// Policy is how failed emails are retried. The delay after the nth failed
+// attempt is BaseDelay * 2^(n-1), at most MaxDelay
+type Policy struct {
+	MaxAttempts int64
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// backoff returns the delay before the next attempt after attempts failed
+func (policy Policy) backoff(attempts int64) time.Duration {
+	delay := policy.BaseDelay
+	for i := int64(1); i < attempts && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return delay
+}
@@ -1,7 +1,7 @@
 package history
 
 import (
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -18,7 +18,7 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db    *sqlx.DB
-	redis *redis.Pool
+	cache cache.ICore
 }
 
 func (c *core) SelectByIDs(ids []int64, pid int64, limit int) (histories Histories, err error) {
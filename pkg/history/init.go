@@ -5,12 +5,12 @@ import (
 	"log"
 	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
 )
 
 // Init is used to initialize history package
-func Init(db *sqlx.DB, redis *redis.Pool) ICore {
+func Init(db *sqlx.DB, cache cache.ICore) ICore {
 	examineDBHealth(db)
 	return &core{
 		db: db,
@@ -1,44 +1,39 @@
 package installation
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
 
-	"encoding/json"
-
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
 type ICore interface {
 	Select(pid int64) (installations Installations, err error)
 	Get(id int64, pid int64) (installation Installation, err error)
-	Insert(installation *Installation) (err error)
-	Update(installation *Installation, isAdmin bool) (err error)
-	Delete(id int64, pid int64, uid string, isAdmin bool) (err error)
+	Insert(installation *Installation, requestID string) (err error)
+	Update(installation *Installation, isAdmin bool, requestID string) (err error)
+	Delete(id int64, pid int64, uid string, isAdmin bool, requestID string) (err error)
 }
 
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "installation"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (installations Installations, err error) {
-	redisKey := fmt.Sprintf("%s:%d:installation", redisPrefix, pid)
-	installations, err = c.selectFromCache(redisKey)
-	if err != nil {
-		installations, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(installations)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "installation", cacheTTL, &installations, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -67,16 +62,9 @@ func (c *core) selectFromDB(pid int64) (installation Installations, err error) {
 }
 
 func (c *core) Get(id int64, pid int64) (installation Installation, err error) {
-	redisKey := fmt.Sprintf("%s:%d:installation:%d", redisPrefix, pid, id)
-
-	installation, err = c.getFromCache(redisKey)
-	if err != nil {
-		installation, err = c.getFromDB(id, pid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(installation)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("installation:%d", id), cacheTTL, &installation, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
 	return
 }
 func (c *core) getFromDB(id int64, pid int64) (installation Installation, err error) {
@@ -104,7 +92,7 @@ func (c *core) getFromDB(id int64, pid int64) (installation Installation, err er
 	return
 }
 
-func (c *core) Insert(installation *Installation) (err error) {
+func (c *core) Insert(installation *Installation, requestID string) (err error) {
 	query := `
 	INSERT INTO mla_installation (
 		name,
@@ -144,13 +132,17 @@ func (c *core) Insert(installation *Installation) (err error) {
 		installation.CreatedBy,
 		installation.LastUpdateBy,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_installation",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    installation.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -158,25 +150,17 @@ func (c *core) Insert(installation *Installation) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    installation.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_installation",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:installation", redisPrefix, installation.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, installation.ProjectID))
 
 	return
 }
 
-func (c *core) Update(installation *Installation, isAdmin bool) (err error) {
+func (c *core) Update(installation *Installation, isAdmin bool, requestID string) (err error) {
 	query := `
 		UPDATE
 			mla_installation
@@ -207,37 +191,32 @@ func (c *core) Update(installation *Installation, isAdmin bool) (err error) {
 		query += ` AND created_by = ? `
 		args = append(args, installation.CreatedBy)
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_installation",
+		EntityID:   installation.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    installation.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    installation.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_installation",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:installation:%d", redisPrefix, installation.ProjectID, installation.ID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:installation", redisPrefix, installation.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, installation.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(id int64, pid int64, uid string, isAdmin bool) (err error) {
+func (c *core) Delete(id int64, pid int64, uid string, isAdmin bool, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -258,7 +237,6 @@ func (c *core) Delete(id int64, pid int64, uid string, isAdmin bool) (err error)
 		args = append(args, uid)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 
 	if err != nil {
@@ -266,63 +244,24 @@ func (c *core) Delete(id int64, pid int64, uid string, isAdmin bool) (err error)
 	}
 
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_installation",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    uid,
+		RequestID:  requestID,
+	}, query, args...)
 
 	if err != nil {
 		return err
 	}
 
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    "uid",
-		Query:     queryTrail,
-		TableName: "mla_installation",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:installation:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:installation", redisPrefix, pid)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 	return
 }
-
-func (c *core) selectFromCache(redisKey string) (installations Installations, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", redisKey))
-	err = json.Unmarshal(b, &installations)
-	return
-}
-
-func (c *core) getFromCache(key string) (installation Installation, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &installation)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
@@ -1,43 +1,44 @@
 package license
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 type ICore interface {
 	Select(pid int64) (licenses Licenses, err error)
 	SelectByIDs(ids []int64, pid int64, limit int) (license License, err error)
 	Get(pid int64, id int64) (license License, err error)
-	Insert(license *License) (err error)
-	Update(license *License, buyerID string) (err error)
-	Delete(pid int64, id int64, buyerID string, licenseNumber string, isAdmin bool, userID string) (err error)
+	Insert(license *License, requestID string) (err error)
+	Update(license *License, buyerID string, requestID string) (err error)
+	Delete(pid int64, id int64, buyerID string, licenseNumber string, isAdmin bool, userID string, requestID string) (err error)
 	GetByBuyerId(pid int64, id string) (licenses Licenses, err error)
+	GetByVenueID(pid int64, venueID int64) (license License, err error)
+	SelectExpiringBefore(pid int64, before time.Time) (licenses Licenses, err error)
 }
 
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "license"
+	cacheTTL       = 5 * time.Minute
+
+	// orderCacheNamespace holds the order summaries, they show license data
+	orderCacheNamespace = "order"
+)
 
 func (c *core) Select(pid int64) (licenses Licenses, err error) {
-	redisKey := fmt.Sprintf("%s:licenses", redisPrefix)
-	licenses, err = c.selectFromCache(redisKey)
-	if err != nil {
-		licenses, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(licenses)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "licenses", cacheTTL, &licenses, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -81,7 +82,9 @@ func (c *core) selectFromDB(pid int64) (license Licenses, err error) {
 			project_id,
 			created_by,
 			last_update_by,
-			buyer_id
+			buyer_id,
+			activated_order_id,
+			refunded_order_id
 		FROM
 			mla_license
 		WHERE
@@ -93,16 +96,9 @@ func (c *core) selectFromDB(pid int64) (license Licenses, err error) {
 }
 
 func (c *core) Get(pid int64, id int64) (license License, err error) {
-	redisKey := fmt.Sprintf("%s:%d:license:%d", redisPrefix, pid, id)
-
-	license, err = c.getFromCache(redisKey)
-	if err != nil {
-		license, err = c.getFromDB(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(license)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("license:%d", id), cacheTTL, &license, func() (interface{}, error) {
+		return c.getFromDB(pid, id)
+	})
 	return
 }
 
@@ -122,7 +118,9 @@ func (c *core) getFromDB(pid int64, id int64) (license License, err error) {
 		project_id,
 		created_by,
 		last_update_by,
-		buyer_id
+		buyer_id,
+		activated_order_id,
+		refunded_order_id
 	FROM
 		mla_license
 	WHERE
@@ -134,15 +132,79 @@ func (c *core) getFromDB(pid int64, id int64) (license License, err error) {
 	return
 }
 
-func (c *core) GetByBuyerId(pid int64, id string) (licenses Licenses, err error) {
-	redisKey := fmt.Sprintf("%s:license-by-buyer-id:%s", redisPrefix, id)
-	licenses, err = c.selectFromCache(redisKey)
+// GetByVenueID returns the license of the venue, it is not cached since it is
+// only used before changing the license
+func (c *core) GetByVenueID(pid int64, venueID int64) (license License, err error) {
+	err = c.db.Get(&license, `
+	SELECT
+		id,
+		license_number,
+		venue_id,
+		license_status,
+		active_date,
+		expired_date,
+		status,
+		created_at,
+		updated_at,
+		deleted_at,
+		project_id,
+		created_by,
+		last_update_by,
+		buyer_id,
+		activated_order_id,
+		refunded_order_id
+	FROM
+		mla_license
+	WHERE
+		status = 1 AND
+		project_id = ? AND
+		venue_id = ?
+	ORDER BY id DESC
+	LIMIT 1
+	`, pid, venueID)
 
-	if err != nil {
-		licenses, err = c.getByBuyerIdFromDB(pid, id)
-		byt, _ := jsoniter.ConfigFastest.Marshal(licenses)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	return
+}
+
+// SelectExpiringBefore returns activated licenses which are still active
+// and expire before the given time
+func (c *core) SelectExpiringBefore(pid int64, before time.Time) (licenses Licenses, err error) {
+	err = c.db.Select(&licenses, `
+	SELECT
+		id,
+		license_number,
+		venue_id,
+		license_status,
+		active_date,
+		expired_date,
+		status,
+		created_at,
+		updated_at,
+		deleted_at,
+		project_id,
+		created_by,
+		last_update_by,
+		buyer_id,
+		activated_order_id,
+		refunded_order_id
+	FROM
+		mla_license
+	WHERE
+		status = 1 AND
+		project_id = ? AND
+		license_status = ? AND
+		expired_date > active_date AND
+		expired_date < ?
+	ORDER BY expired_date
+	`, pid, LicenseStatusActive, before)
+
+	return
+}
+
+func (c *core) GetByBuyerId(pid int64, id string) (licenses Licenses, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("license-by-buyer-id:%s", id), cacheTTL, &licenses, func() (interface{}, error) {
+		return c.getByBuyerIdFromDB(pid, id)
+	})
 	return
 }
 
@@ -162,7 +224,9 @@ func (c *core) getByBuyerIdFromDB(pid int64, buyerID string) (licenses Licenses,
 		project_id,
 		created_by,
 		last_update_by,
-		buyer_id
+		buyer_id,
+		activated_order_id,
+		refunded_order_id
 	FROM
 		mla_license
 	WHERE
@@ -174,7 +238,7 @@ func (c *core) getByBuyerIdFromDB(pid int64, buyerID string) (licenses Licenses,
 	return
 }
 
-func (c *core) Insert(license *License) (err error) {
+func (c *core) Insert(license *License, requestID string) (err error) {
 	license.CreatedAt = time.Now()
 	license.UpdatedAt = license.CreatedAt
 	license.Status = 1
@@ -194,7 +258,9 @@ func (c *core) Insert(license *License) (err error) {
 			project_id,
 			created_by,
 			last_update_by,
-			buyer_id
+			buyer_id,
+			activated_order_id,
+			refunded_order_id
 		) VALUES (
 			?,
 			?,
@@ -208,6 +274,8 @@ func (c *core) Insert(license *License) (err error) {
 			?,
 			?,
 			?,
+			?,
+			?,
 			?
 		)`
 	args := []interface{}{
@@ -224,14 +292,20 @@ func (c *core) Insert(license *License) (err error) {
 		license.CreatedBy,
 		license.LastUpdateBy,
 		license.BuyerID,
+		license.ActivatedOrderID,
+		license.RefundedOrderID,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_license",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    license.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -239,28 +313,17 @@ func (c *core) Insert(license *License) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    license.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_license",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:licenses", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:license-by-buyer-id:%s", redisPrefix, license.BuyerID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, license.ProjectID), cache.Namespace(orderCacheNamespace, license.ProjectID))
 
 	return
 }
 
-func (c *core) Update(license *License, buyerID string) (err error) {
+func (c *core) Update(license *License, buyerID string, requestID string) (err error) {
 	license.UpdatedAt = time.Now()
 	license.Status = 1
 
@@ -275,7 +338,9 @@ func (c *core) Update(license *License, buyerID string) (err error) {
 			updated_at=	?,
 			project_id=	?,
 			last_update_by= ?,
-			buyer_id = ?
+			buyer_id = ?,
+			activated_order_id = ?,
+			refunded_order_id = ?
 		WHERE
 			id = 		? AND
 			project_id =? AND 
@@ -290,47 +355,37 @@ func (c *core) Update(license *License, buyerID string) (err error) {
 		license.ProjectID,
 		license.LastUpdateBy,
 		license.BuyerID,
+		license.ActivatedOrderID,
+		license.RefundedOrderID,
 		license.ID,
 		license.ProjectID,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_license",
+		EntityID:   license.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    license.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    license.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_license",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:license:%d", redisPrefix, license.ProjectID, license.ID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:licenses", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:license-by-buyer-id:%s", redisPrefix, buyerID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:%d:sumvenue-licnumber:%s", redisPrefix, license.ProjectID, license.LicenseNumber)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, license.ProjectID), cache.Namespace(orderCacheNamespace, license.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(pid int64, id int64, buyerID string, licenseNumber string, isAdmin bool, userID string) (err error) {
+func (c *core) Delete(pid int64, id int64, buyerID string, licenseNumber string, isAdmin bool, userID string, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -351,7 +406,6 @@ func (c *core) Delete(pid int64, id int64, buyerID string, licenseNumber string,
 		args = append(args, userID)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 
 	if err != nil {
@@ -359,71 +413,25 @@ func (c *core) Delete(pid int64, id int64, buyerID string, licenseNumber string,
 	}
 
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_license",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    userID,
+		RequestID:  requestID,
+	}, query, args...)
 
 	if err != nil {
 		return err
 	}
 
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    buyerID,
-		Query:     queryTrail,
-		TableName: "mla_license",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:license:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:licenses", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:license-by-buyer-id:%s", redisPrefix, buyerID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:%d:sumvenue-licnumber:%s", redisPrefix, pid, licenseNumber)
-	_ = c.deleteCache(redisKey)
-
-	return
-}
-
-func (c *core) selectFromCache(key string) (licenses Licenses, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &licenses)
-	return
-}
-
-func (c *core) getFromCache(key string) (license License, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &license)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid), cache.Namespace(orderCacheNamespace, pid))
 
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
 	return
 }
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
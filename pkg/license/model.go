@@ -3,6 +3,15 @@ package license
 import "time"
 import "gopkg.in/guregu/null.v3"
 
+// License statuses, a license is suspended or revoked when its order is refunded
+// and expired once its expired date has passed
+const (
+	LicenseStatusActive    int8 = 1
+	LicenseStatusSuspended int8 = 2
+	LicenseStatusRevoked   int8 = 3
+	LicenseStatusExpired   int8 = 4
+)
+
 type License struct {
 	ID            int64     `db:"id"`
 	LicenseNumber string    `db:"license_number"`
@@ -18,6 +27,41 @@ type License struct {
 	CreatedBy     string    `db:"created_by"`
 	LastUpdateBy  string    `db:"last_update_by"`
 	BuyerID       string    `db:"buyer_id"`
+	// ActivatedOrderID is the last order the license was activated by, so the
+	// activation of an order is applied once even when it is retried
+	ActivatedOrderID null.Int `db:"activated_order_id"`
+	// RefundedOrderID is the last order whose refund was applied to the
+	// license, so a renewal is rolled back once even when it is retried
+	RefundedOrderID null.Int `db:"refunded_order_id"`
 }
 
 type Licenses []License
+
+// IsActivated reports whether the license has real dates, licenses are
+// created with the same placeholder active and expired date
+func (license License) IsActivated() bool {
+	return license.ExpiredDate.After(license.ActiveDate)
+}
+
+// Activate makes the license active for months from now. A license which is
+// still active is extended from its current expired date instead
+func (license *License) Activate(now time.Time, months int64) {
+	if license.LicenseStatus == LicenseStatusActive && license.IsActivated() && license.ExpiredDate.After(now) {
+		license.ExpiredDate = license.ExpiredDate.AddDate(0, int(months), 0)
+	} else {
+		license.ActiveDate = now
+		license.ExpiredDate = now.AddDate(0, int(months), 0)
+	}
+	license.LicenseStatus = LicenseStatusActive
+}
+
+// Rollback takes back the months a refunded renewal extended the license by.
+// The license expires when no time paid by earlier orders is left
+func (license *License) Rollback(now time.Time, months int64) {
+	license.ExpiredDate = license.ExpiredDate.AddDate(0, -int(months), 0)
+	if license.ExpiredDate.After(now) {
+		license.LicenseStatus = LicenseStatusActive
+	} else {
+		license.LicenseStatus = LicenseStatusExpired
+	}
+}
@@ -0,0 +1,103 @@
+package license_token
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// ICore is the interface
+type ICore interface {
+	Sign(licenseNumber string, venueID int64, expiredAt time.Time) (token string, err error)
+	Verify(token string) (claims Claims, err error)
+	PublicKeys() map[string]string
+	Enabled() bool
+}
+
+// core contains signing keys
+type core struct {
+	keys        map[string]ed25519.PrivateKey
+	activeKeyID string
+}
+
+var encoding = base64.RawURLEncoding
+
+// Sign returns token in the form v1.<key id>.<payload>.<signature>, payload and
+// signature are base64url encoded and the signature covers everything before it
+func (c *core) Sign(licenseNumber string, venueID int64, expiredAt time.Time) (token string, err error) {
+	if !c.Enabled() {
+		return "", ErrNotConfigured
+	}
+
+	payload, err := json.Marshal(Claims{
+		LicenseNumber: licenseNumber,
+		VenueID:       venueID,
+		ExpiredAt:     expiredAt.Unix(),
+		IssuedAt:      time.Now().Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := tokenVersion + "." + c.activeKeyID + "." + encoding.EncodeToString(payload)
+	signature := ed25519.Sign(c.keys[c.activeKeyID], []byte(signed))
+
+	return signed + "." + encoding.EncodeToString(signature), nil
+}
+
+// Verify checks the signature of token and returns its claims, it does not
+// check the expiry, see Claims.Expired
+func (c *core) Verify(token string) (claims Claims, err error) {
+	if !c.Enabled() {
+		return claims, ErrNotConfigured
+	}
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 4 || parts[0] != tokenVersion {
+		return claims, ErrMalformedToken
+	}
+
+	key, ok := c.keys[parts[1]]
+	if !ok {
+		return claims, ErrUnknownKey
+	}
+
+	signature, err := encoding.DecodeString(parts[3])
+	if err != nil {
+		return claims, ErrMalformedToken
+	}
+	signed := token[:len(token)-len(parts[3])-1]
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), []byte(signed), signature) {
+		return claims, ErrInvalidSignature
+	}
+
+	payload, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return claims, ErrMalformedToken
+	}
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return claims, ErrMalformedToken
+	}
+
+	return claims, nil
+}
+
+// PublicKeys returns base64 encoded public key by key id, for checker apps
+// verifying tokens offline
+func (c *core) PublicKeys() map[string]string {
+	keys := make(map[string]string, len(c.keys))
+	for id, key := range c.keys {
+		keys[id] = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	}
+	return keys
+}
+
+// Enabled reports whether a signing key is configured, tokens can not be
+// signed nor verified without it
+func (c *core) Enabled() bool {
+	return c.activeKeyID != ""
+}
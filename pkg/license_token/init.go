@@ -0,0 +1,40 @@
+package license_token
+
+import (
+	"encoding/base64"
+	"log"
+	"strings"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Init is used to initialize license token package. keys maps key id to base64
+// encoded ed25519 seed, tokens are signed with activeKeyID and verified with
+// any of the keys, so a rotated key keeps verifying the tokens it signed.
+// Without activeKeyID license tokens are disabled, see ICore.Enabled
+func Init(keys map[string]string, activeKeyID string) ICore {
+	c := &core{
+		keys:        make(map[string]ed25519.PrivateKey, len(keys)),
+		activeKeyID: activeKeyID,
+	}
+
+	for id, encoded := range keys {
+		if strings.Contains(id, ".") {
+			log.Fatalf("Failed to initialize license token. key id %s must not contain dot", id)
+		}
+		seed, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			log.Fatalf("Failed to initialize license token. key %s must be base64 encoded %d bytes seed", id, ed25519.SeedSize)
+		}
+		c.keys[id] = ed25519.NewKeyFromSeed(seed)
+	}
+
+	if activeKeyID == "" {
+		return c
+	}
+	if _, ok := c.keys[activeKeyID]; !ok {
+		log.Fatalf("Failed to initialize license token. active key %s is not configured", activeKeyID)
+	}
+
+	return c
+}
@@ -0,0 +1,38 @@
+package license_token
+
+import (
+	"errors"
+	"time"
+)
+
+// tokenVersion prefixes every token, so the format can change later
+const tokenVersion = "v1"
+
+// Verdicts of the license checker
+const (
+	VerdictValid   = "valid"
+	VerdictExpired = "expired"
+	VerdictRevoked = "revoked"
+	VerdictForged  = "forged"
+)
+
+// Claims is the payload signed into the QR code of a license
+type Claims struct {
+	LicenseNumber string `json:"lic"`
+	VenueID       int64  `json:"vid"`
+	ExpiredAt     int64  `json:"exp"`
+	IssuedAt      int64  `json:"iat"`
+}
+
+// Expired reports whether the license was expired at now according to the claims
+func (claims Claims) Expired(now time.Time) bool {
+	return now.Unix() >= claims.ExpiredAt
+}
+
+// Errors returned when a token can not be verified
+var (
+	ErrMalformedToken   = errors.New("Token is malformed")
+	ErrUnknownKey       = errors.New("Token is signed with unknown key")
+	ErrInvalidSignature = errors.New("Token signature is not valid")
+	ErrNotConfigured    = errors.New("License token key is not configured")
+)
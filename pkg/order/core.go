@@ -2,32 +2,32 @@ package order
 
 import (
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	emailOutbox "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_outbox"
+	orderJob "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 	null "gopkg.in/guregu/null.v3"
 )
 
 // ICore is the interface
 type ICore interface {
-	Insert(order *Order, isAdmin bool) (err error)
-	Update(order *Order, isAdmin bool) (err error)
-	UpdateOrderStatus(order *Order, isAdmin bool) (err error)
-	UpdateOpenPaymentStatus(order *Order, isAdmin bool) (err error)
-	Delete(order *Order, isAdmin bool) (err error)
+	Insert(order *Order, isAdmin bool, requestID string) (err error)
+	Update(order *Order, isAdmin bool, requestID string) (err error)
+	UpdateOrderStatus(order *Order, reason string, isAdmin bool, requestID string) (err error)
+	UpdateOpenPaymentStatus(order *Order, isAdmin bool, requestID string) (err error)
+	UpdatePaymentMethod(order *Order, isAdmin bool, requestID string) (err error)
+	Delete(order *Order, isAdmin bool, requestID string) (err error)
 
 	Get(id int64, pid int64, uid string) (order Order, err error)
-	GetLastOrderNumber() (lastOrderNumber LastOrderNumber, err error)
+	GetStatusHistories(id int64, pid int64, uid string) (histories StatusHistories, err error)
 
-	Select(pid int64, uid string) (orders Orders, err error)
-	SelectByBuyerID(buyerID string, pid int64, uid string) (orders Orders, err error)
-	SelectByVenueID(venueID int64, pid int64, uid string) (orders Orders, err error)
-	SelectByPaidDate(paidDate string, pid int64, uid string) (orders Orders, err error)
+	SelectPage(pid int64, filter Filter) (orders Orders, err error)
+	SelectPendingBefore(pid int64, before time.Time) (orders Orders, err error)
 
 	GetSummaryVenueByVenueID(venueID, pid int64, uid string) (sumvenue SummaryVenue, err error)
 	SelectSummaryVenuesByUserID(pid int64, uid string) (sumvenues SummaryVenues, err error)
@@ -39,23 +39,66 @@ type ICore interface {
 
 // core contains db client
 type core struct {
-	db              *sqlx.DB
-	redis           *redis.Pool
-	paymentMethodID int64
-	auditTrail      auditTrail.ICore
+	db          *sqlx.DB
+	cache       cache.ICore
+	auditTrail  auditTrail.ICore
+	emailOutbox emailOutbox.ICore
+	orderJob    orderJob.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "order"
+	cacheTTL       = 5 * time.Minute
+)
+
+// venueOrders is mla_orders with a row for every venue of an order. A cart
+// order is split into its venues, each with the items and subtotal ordered
+// for it, so summaries of a venue read cart orders as single venue orders
+const venueOrders = `(
+	select
+		order_id, order_number, buyer_id, venue_id, device_id, product_id,
+		installation_id, aging_id, room_id, room_quantity, total_price,
+		status, created_at, created_by, updated_at, pending_at, paid_at,
+		failed_at, deleted_at, project_id, email, open_payment_status,
+		order_type
+	from
+		mla_orders
+	where
+		order_type <> 'cart'
+	union all
+	select
+		orders.order_id, orders.order_number, orders.buyer_id, detail.venue_id,
+		max(case when detail.item_type = 'device' then detail.item_id else 0 end),
+		max(case when detail.item_type = 'product' then detail.item_id else 0 end),
+		max(case when detail.item_type = 'installation' then detail.item_id else 0 end),
+		max(case when detail.item_type = 'aging' then detail.item_id else 0 end),
+		max(case when detail.item_type = 'room' then detail.item_id else 0 end),
+		max(case when detail.item_type = 'room' then detail.quantity else 0 end),
+		sum(case when detail.tax_rate_id is null then detail.amount else detail.tax_base + detail.tax_amount end),
+		orders.status, orders.created_at, orders.created_by, orders.updated_at,
+		orders.pending_at, orders.paid_at, orders.failed_at, orders.deleted_at,
+		orders.project_id, orders.email, orders.open_payment_status,
+		orders.order_type
+	from
+		mla_orders orders
+		join mla_order_details detail on detail.order_id = orders.order_id and detail.status = 1
+	where
+		orders.order_type = 'cart'
+	group by
+		orders.order_id, detail.venue_id
+)`
 
-func (c *core) Insert(order *Order, isAdmin bool) (err error) {
+func (c *core) Insert(order *Order, isAdmin bool, requestID string) (err error) {
 	order.CreatedAt = time.Now()
 	order.UpdatedAt = order.CreatedAt
-	order.PaymentMethodID = c.paymentMethodID
 	order.OpenPaymentStatus = 0
 
 	if order.Quantity == 0 {
 		order.Quantity = 1
 	}
+	if order.OrderType == "" {
+		order.OrderType = OrderTypeNew
+	}
 
 	query := `
 	INSERT INTO mla_orders (
@@ -79,9 +122,10 @@ func (c *core) Insert(order *Order, isAdmin bool) (err error) {
 		last_update_by,
 		project_id,
 		email,
-		open_payment_status
+		open_payment_status,
+		order_type
 	) VALUES (
-		?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?
+		?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?
 	)`
 
 	args := []interface{}{
@@ -106,38 +150,51 @@ func (c *core) Insert(order *Order, isAdmin bool) (err error) {
 		order.ProjectID,
 		order.Email,
 		order.OpenPaymentStatus,
+		order.OrderType,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_orders",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    order.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
 	order.OrderID, err = res.LastInsertId()
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    order.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_orders",
+	err = c.insertStatusHistory(tx, &StatusHistory{
+		OrderID:   order.OrderID,
+		ToStatus:  order.Status,
+		Reason:    "order created",
+		CreatedBy: order.CreatedBy,
+		ProjectID: order.ProjectID,
+	})
+	if err != nil {
+		return err
 	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(order.ProjectID, order.CreatedBy, 0, order.VenueID, order.Status, "", isAdmin)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, order.ProjectID))
 
 	return
 }
 
-func (c *core) Update(order *Order, isAdmin bool) (err error) {
+// Update changes the items, price and payment of a draft order, it returns
+// ErrNotEditable when the order is no longer draft. The status is left as it
+// is
+func (c *core) Update(order *Order, isAdmin bool, requestID string) (err error) {
 	order.UpdatedAt = time.Now()
-	order.PaymentMethodID = c.paymentMethodID
 
 	if order.Quantity == 0 {
 		order.Quantity = 1
@@ -158,13 +215,13 @@ func (c *core) Update(order *Order, isAdmin bool) (err error) {
 			total_price = ?,
 			payment_method_id = ?,
 			payment_fee = ?,
-			status = ?,
 			updated_at = ?,
 			last_update_by = ?,
 			email = ?
 		WHERE
 			order_id = ? AND
 			project_id = ? AND 
+			status IN (?, ?) AND
 			deleted_at IS NULL `
 
 	args := []interface{}{
@@ -179,12 +236,13 @@ func (c *core) Update(order *Order, isAdmin bool) (err error) {
 		order.TotalPrice,
 		order.PaymentMethodID,
 		order.PaymentFee,
-		order.Status,
 		order.UpdatedAt,
 		order.LastUpdateBy,
 		order.Email,
 		order.OrderID,
 		order.ProjectID,
+		StatusDraft,
+		StatusAgentDraft,
 	}
 
 	if !isAdmin {
@@ -192,42 +250,78 @@ func (c *core) Update(order *Order, isAdmin bool) (err error) {
 		args = append(args, order.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_orders",
+		EntityID:   order.OrderID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    order.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    order.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_orders",
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotEditable
 	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(order.ProjectID, order.CreatedBy, order.OrderID, order.VenueID, order.Status, order.PaidAt.Time.String(), isAdmin)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, order.ProjectID))
 
 	return
 }
 
-func (c *core) UpdateOrderStatus(order *Order, isAdmin bool) (err error) {
+// UpdateOrderStatus moves the order to order.Status, it returns
+// ErrInvalidTransition when the move is not allowed from the current status
+func (c *core) UpdateOrderStatus(order *Order, reason string, isAdmin bool, requestID string) (err error) {
 	order.UpdatedAt = time.Now()
 
-	if order.Status == 1 {
-		order.PendingAt = null.TimeFrom(time.Now())
-	} else if order.Status == 2 {
-		order.PaidAt = null.TimeFrom(time.Now())
-	} else if order.Status == 3 {
-		order.FailedAt = null.TimeFrom(time.Now())
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current struct {
+		Status  int16 `db:"status"`
+		VenueID int64 `db:"venue_id"`
+	}
+	err = tx.Get(&current, `
+		SELECT
+			status,
+			venue_id
+		FROM
+			mla_orders
+		WHERE
+			order_id = ? AND
+			project_id = ? AND
+			deleted_at IS NULL
+		FOR UPDATE`, order.OrderID, order.ProjectID)
+	if err != nil {
+		return err
+	}
+	fromStatus := current.Status
+	if !CanTransition(fromStatus, order.Status) {
+		return ErrInvalidTransition
+	}
+
+	if order.Status == StatusPending {
+		order.PendingAt = null.TimeFrom(order.UpdatedAt)
+	} else if order.Status == StatusPaid {
+		order.PaidAt = null.TimeFrom(order.UpdatedAt)
+	} else if order.Status == StatusFailed {
+		order.FailedAt = null.TimeFrom(order.UpdatedAt)
 	}
 	query := `
 		UPDATE
@@ -242,6 +336,7 @@ func (c *core) UpdateOrderStatus(order *Order, isAdmin bool) (err error) {
 		WHERE
 			order_id = ? AND
 			project_id = ? AND
+			status = ? AND
 			deleted_at IS NULL`
 
 	args := []interface{}{
@@ -253,6 +348,7 @@ func (c *core) UpdateOrderStatus(order *Order, isAdmin bool) (err error) {
 		order.FailedAt,
 		order.OrderID,
 		order.ProjectID,
+		fromStatus,
 	}
 
 	if !isAdmin {
@@ -260,34 +356,138 @@ func (c *core) UpdateOrderStatus(order *Order, isAdmin bool) (err error) {
 		args = append(args, order.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
-	tx, err := c.db.Beginx()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_orders",
+		EntityID:   order.OrderID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    order.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	err = c.insertStatusHistory(tx, &StatusHistory{
+		OrderID:    order.OrderID,
+		FromStatus: null.IntFrom(int64(fromStatus)),
+		ToStatus:   order.Status,
+		Reason:     reason,
+		CreatedBy:  order.LastUpdateBy,
+		ProjectID:  order.ProjectID,
+	})
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    order.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_orders",
+	if order.Status == StatusPaid {
+		err = c.enqueuePaid(tx, order, current.VenueID)
+		if err != nil {
+			return err
+		}
 	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(order.ProjectID, order.CreatedBy, order.OrderID, order.VenueID, order.Status, order.PaidAt.Time.String(), isAdmin)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, order.ProjectID))
 
 	return
 }
 
-func (c *core) UpdateOpenPaymentStatus(order *Order, isAdmin bool) (err error) {
+// enqueuePaid queues the license activations, commissions, e-certificates and
+// invoice of a paid order in the same tx as the status change, so they are
+// done exactly when it commits. A cart order has no venue of its own, every
+// venue of its details gets a license activation and an e-certificate
+func (c *core) enqueuePaid(tx *sqlx.Tx, order *Order, venueID int64) (err error) {
+	venueIDs := []int64{venueID}
+	if venueID == 0 {
+		venueIDs = nil
+		err = tx.Select(&venueIDs, `
+			SELECT DISTINCT
+				venue_id
+			FROM
+				mla_order_details
+			WHERE
+				order_id = ? AND
+				project_id = ? AND
+				status = 1
+			ORDER BY venue_id`, order.OrderID, order.ProjectID)
+		if err != nil {
+			return err
+		}
+	}
+
+	messages := make([]emailOutbox.Message, 0, len(venueIDs)+1)
+	for _, id := range venueIDs {
+		messages = append(messages, emailOutbox.Message{Type: emailOutbox.TypeECert, VenueID: id})
+	}
+	messages = append(messages, emailOutbox.Message{Type: emailOutbox.TypeInvoice, VenueID: venueID})
+
+	for _, message := range messages {
+		message.OrderID = order.OrderID
+		message.ProjectID = order.ProjectID
+		message.CreatedBy = order.LastUpdateBy
+		err = c.emailOutbox.Enqueue(tx, &message)
+		if err != nil {
+			return err
+		}
+	}
+
+	jobs := make([]orderJob.Job, 0, len(venueIDs)+1)
+	for _, id := range venueIDs {
+		jobs = append(jobs, orderJob.Job{Type: orderJob.TypeActivateLicense, VenueID: id})
+	}
+	jobs = append(jobs, orderJob.Job{Type: orderJob.TypeEarnCommissions, VenueID: venueID})
+
+	for _, job := range jobs {
+		job.OrderID = order.OrderID
+		job.ProjectID = order.ProjectID
+		job.CreatedBy = order.LastUpdateBy
+		err = c.orderJob.Enqueue(tx, &job)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *core) insertStatusHistory(tx *sqlx.Tx, history *StatusHistory) (err error) {
+	history.CreatedAt = time.Now()
+
+	res, err := tx.Exec(`
+		INSERT INTO mla_order_status_history (
+			order_id,
+			from_status,
+			to_status,
+			reason,
+			created_by,
+			created_at,
+			project_id
+		) VALUES (
+			?,?,?,?,?,?,?
+		)`,
+		history.OrderID,
+		history.FromStatus,
+		history.ToStatus,
+		history.Reason,
+		history.CreatedBy,
+		history.CreatedAt,
+		history.ProjectID,
+	)
+	if err != nil {
+		return err
+	}
+	history.ID, err = res.LastInsertId()
+	return
+}
+
+func (c *core) UpdateOpenPaymentStatus(order *Order, isAdmin bool, requestID string) (err error) {
 	order.UpdatedAt = time.Now()
 	query := `
 		UPDATE
@@ -314,34 +514,89 @@ func (c *core) UpdateOpenPaymentStatus(order *Order, isAdmin bool) (err error) {
 		args = append(args, order.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_orders",
+		EntityID:   order.OrderID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    order.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    order.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_orders",
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, order.ProjectID))
+
+	return
+}
+
+// UpdatePaymentMethod sets the payment method and fee chosen for the order
+func (c *core) UpdatePaymentMethod(order *Order, isAdmin bool, requestID string) (err error) {
+	order.UpdatedAt = time.Now()
+	query := `
+		UPDATE
+			mla_orders
+		SET
+			payment_method_id = ?,
+			payment_fee = ?,
+			updated_at = ?,
+			last_update_by = ?
+		WHERE
+			order_id = ? AND
+			project_id = ? AND
+			deleted_at IS NULL `
+
+	args := []interface{}{
+		order.PaymentMethodID,
+		order.PaymentFee,
+		order.UpdatedAt,
+		order.LastUpdateBy,
+		order.OrderID,
+		order.ProjectID,
+	}
+
+	if !isAdmin {
+		query += ` AND created_by = ? `
+		args = append(args, order.CreatedBy)
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_orders",
+		EntityID:   order.OrderID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    order.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
 	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(order.ProjectID, order.CreatedBy, order.OrderID, order.VenueID, order.Status, order.PaidAt.Time.String(), isAdmin)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, order.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(order *Order, isAdmin bool) (err error) {
+// Delete soft deletes a draft order, it returns ErrNotEditable when the order
+// is no longer draft. Orders past draft are cancelled instead
+func (c *core) Delete(order *Order, isAdmin bool, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -353,13 +608,16 @@ func (c *core) Delete(order *Order, isAdmin bool) (err error) {
 		WHERE
 			order_id = ? AND
 			project_id = ? AND
+			status IN (?, ?) AND
 			deleted_at IS NULL`
 
 	args := []interface{}{
 		order.LastUpdateBy,
 		now,
 		order.OrderID,
-		order.ProductID,
+		order.ProjectID,
+		StatusDraft,
+		StatusAgentDraft,
 	}
 
 	if !isAdmin {
@@ -367,44 +625,42 @@ func (c *core) Delete(order *Order, isAdmin bool) (err error) {
 		args = append(args, order.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_orders",
+		EntityID:   order.OrderID,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    order.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    order.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_orders",
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotEditable
 	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(order.ProjectID, order.CreatedBy, order.OrderID, order.VenueID, order.Status, order.PaidAt.Time.String(), isAdmin)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, order.ProjectID))
 
 	return
 }
 
 func (c *core) Get(id int64, pid int64, uid string) (order Order, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:orders:%d", redisPrefix, pid, uid, id)
-
-	order, err = c.getFromCache(redisKey)
-	if err != nil {
-		order, err = c.getFromDB(id, pid, uid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(order)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:orders:%d", uid, id), cacheTTL, &order, func() (interface{}, error) {
+		return c.getFromDB(id, pid, uid)
+	})
 	return
 }
 
@@ -434,7 +690,8 @@ func (c *core) getFromDB(id int64, pid int64, uid string) (order Order, err erro
 			failed_at,
 			project_id,
 			email,
-			open_payment_status
+			open_payment_status,
+			order_type
 		FROM
 			mla_orders
 		WHERE
@@ -455,155 +712,46 @@ func (c *core) getFromDB(id int64, pid int64, uid string) (order Order, err erro
 	return
 }
 
-func (c *core) GetLastOrderNumber() (lastOrderNumber LastOrderNumber, err error) {
-	err = c.db.Get(&lastOrderNumber, `
-		SELECT
-			SUBSTRING(order_number, 3, 6) AS date,
-			CAST(SUBSTRING(order_number, 9, 7) AS SIGNED) AS number
-		FROM
-			mla_orders
-		ORDER BY order_id DESC
-		LIMIT 1
-	`)
-	return
-}
-
-func (c *core) Select(pid int64, uid string) (orders Orders, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:orders", redisPrefix, pid, uid)
-
-	orders, err = c.selectFromCache()
-	if err != nil {
-		orders, err = c.selectFromDB(pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(orders)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
-	return
-}
-
-func (c *core) selectFromDB(pid int64, uid string) (orders Orders, err error) {
+func (c *core) GetStatusHistories(id int64, pid int64, uid string) (histories StatusHistories, err error) {
 	query := `
 		SELECT
-			order_id,
-			order_number,
-			buyer_id,
-			device_id,
-			venue_id,
-			product_id,
-			installation_id,
-			quantity,
-			aging_id,
-			room_id,
-			room_quantity,
-			total_price,
-			payment_method_id,
-			payment_fee,
-			status,
-			created_at,
-			created_by,
-			updated_at,
-			last_update_by,
-			deleted_at,
-			pending_at,
-			paid_at,
-			failed_at,
-			project_id,
-			email,
-			open_payment_status
+			history.id,
+			history.order_id,
+			history.from_status,
+			history.to_status,
+			history.reason,
+			history.created_by,
+			history.created_at,
+			history.project_id
 		FROM
-			mla_orders
+			mla_order_status_history history
+		JOIN
+			mla_orders orders on orders.order_id = history.order_id
 		WHERE
-			project_id = ? AND 
-			deleted_at IS NULL
-		`
-
-	if uid != "" {
-		query += ` AND created_by = ? `
-		err = c.db.Select(&orders, query, pid, uid)
-	} else {
-		err = c.db.Select(&orders, query, pid)
-	}
-
-	return
-}
-
-func (c *core) SelectByVenueID(venueID int64, pid int64, uid string) (orders Orders, err error) {
-	if venueID == 0 {
-		return nil, nil
-	}
-	redisKey := fmt.Sprintf("%s:%d:%s:orders-venueid:%d", redisPrefix, pid, uid, venueID)
+			history.order_id = ? AND
+			history.project_id = ? AND
+			orders.deleted_at IS NULL`
 
-	orders, err = c.selectFromCache()
-	if err != nil {
-		orders, err = c.selectFromDBByVenueID(venueID, pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(orders)
-		_ = c.setToCache(redisKey, 300, byt)
+	args := []interface{}{
+		id,
+		pid,
 	}
-	return
-}
-
-func (c *core) selectFromDBByVenueID(venueID int64, pid int64, uid string) (orders Orders, err error) {
-	query := `
-	SELECT
-		order_id,
-		order_number,
-		buyer_id,
-		venue_id,
-		device_id,
-		product_id,
-		installation_id,
-		quantity,
-		aging_id,
-		room_id,
-		room_quantity,
-		total_price,
-		payment_method_id,
-		payment_fee,
-		status,
-		created_at,
-		created_by,
-		updated_at,
-		last_update_by,
-		deleted_at,
-		pending_at,
-		paid_at,
-		failed_at,
-		project_id,
-		email,
-		open_payment_status
-	FROM
-		mla_orders
-	WHERE
-		venue_id = ? AND
-		project_id = ? AND
-		deleted_at IS NULL `
 
 	if uid != "" {
-		query += ` AND created_by = ? `
-		err = c.db.Select(&orders, query, venueID, pid, uid)
-	} else {
-		err = c.db.Select(&orders, query, venueID, pid)
+		query += ` AND orders.created_by = ?`
+		args = append(args, uid)
 	}
+	query += `
+		ORDER BY history.id`
 
-	return
-}
-
-func (c *core) SelectByBuyerID(buyerID string, pid int64, uid string) (orders Orders, err error) {
-	if buyerID == "" {
-		return nil, nil
-	}
-
-	redisKey := fmt.Sprintf("%s:%d:%s:orders-buyerid:%s", redisPrefix, pid, uid, buyerID)
+	err = c.db.Select(&histories, query, args...)
 
-	orders, err = c.selectFromCache()
-	if err != nil {
-		orders, err = c.selectFromDBByBuyerID(buyerID, pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(orders)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
 	return
 }
 
-func (c *core) selectFromDBByBuyerID(buyerID string, pid int64, uid string) (orders Orders, err error) {
+// SelectPage returns a page of the orders matching the filter, it is not
+// cached since every filter and cursor is a different page
+func (c *core) SelectPage(pid int64, filter Filter) (orders Orders, err error) {
 	query := `
 		SELECT
 			order_id,
@@ -631,48 +779,88 @@ func (c *core) selectFromDBByBuyerID(buyerID string, pid int64, uid string) (ord
 			failed_at,
 			project_id,
 			email,
-			open_payment_status
+			open_payment_status,
+			order_type
 		FROM
 			mla_orders
 		WHERE
-			buyer_id = ? AND
 			project_id = ? AND
-			deleted_at IS NULL
-	`
+			deleted_at IS NULL`
+	args := []interface{}{pid}
 
-	if uid != "" {
-		query += ` AND created_by = ? `
-		err = c.db.Select(&orders, query, buyerID, pid, uid)
-	} else {
-		err = c.db.Select(&orders, query, buyerID, pid)
+	if len(filter.Status) > 0 {
+		query += ` AND status IN (?` + strings.Repeat(`,?`, len(filter.Status)-1) + `)`
+		for _, status := range filter.Status {
+			args = append(args, status)
+		}
 	}
-
-	return
-}
-
-func (c *core) SelectByPaidDate(paidDate string, pid int64, uid string) (orders Orders, err error) {
-	if paidDate == "" {
-		return nil, nil
+	if filter.VenueID != 0 {
+		query += ` AND (venue_id = ? OR order_id IN (SELECT order_id FROM mla_order_details WHERE venue_id = ? AND status = 1))`
+		args = append(args, filter.VenueID, filter.VenueID)
+	}
+	if filter.BuyerID != "" {
+		query += ` AND buyer_id = ?`
+		args = append(args, filter.BuyerID)
+	}
+	if filter.CreatedBy != "" {
+		query += ` AND created_by = ?`
+		args = append(args, filter.CreatedBy)
+	}
+	for _, r := range []struct {
+		column   string
+		from, to null.Time
+	}{
+		{"created_at", filter.CreatedFrom, filter.CreatedTo},
+		{"paid_at", filter.PaidFrom, filter.PaidTo},
+		{"failed_at", filter.FailedFrom, filter.FailedTo},
+	} {
+		if r.from.Valid {
+			query += ` AND ` + r.column + ` >= ?`
+			args = append(args, r.from.Time)
+		}
+		if r.to.Valid {
+			query += ` AND ` + r.column + ` < ?`
+			args = append(args, r.to.Time)
+		}
+	}
+	if filter.MinAmount.Valid {
+		query += ` AND total_price >= ?`
+		args = append(args, filter.MinAmount.Float64)
+	}
+	if filter.MaxAmount.Valid {
+		query += ` AND total_price <= ?`
+		args = append(args, filter.MaxAmount.Float64)
+	}
+	if filter.OrderNumberPrefix != "" {
+		query += ` AND order_number LIKE ?`
+		args = append(args, likePrefix(filter.OrderNumberPrefix))
+	}
+	if len(filter.Cursor.Values) > 0 {
+		after, afterArgs := filter.Cursor.after(filter.Sorts)
+		query += ` AND ` + after
+		args = append(args, afterArgs...)
 	}
-	redisKey := fmt.Sprintf("%s:%d:%s:orders-paiddate:%s", redisPrefix, pid, uid, paidDate)
 
-	orders, err = c.selectFromCache()
-	if err != nil {
-		orders, err = c.selectFromDBByPaidDate(paidDate, pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(orders)
-		_ = c.setToCache(redisKey, 300, byt)
+	query += filter.Sorts.orderBy()
+	if filter.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, filter.Limit)
 	}
 
+	err = c.db.Select(&orders, query, args...)
 	return
 }
 
-func (c *core) selectFromDBByPaidDate(paidDate string, pid int64, uid string) (orders Orders, err error) {
-	if paidDate == "" {
-		return nil, nil
-	}
+// likePrefix returns the LIKE pattern of the values starting with prefix
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
 
+// SelectPendingBefore returns orders waiting for payment since before, it is not
+// cached since it is used to reconcile the status with the payment gateway
+func (c *core) SelectPendingBefore(pid int64, before time.Time) (orders Orders, err error) {
 	query := `
-	 	SELECT
+		SELECT
 			order_id,
 			order_number,
 			buyer_id,
@@ -697,34 +885,26 @@ func (c *core) selectFromDBByPaidDate(paidDate string, pid int64, uid string) (o
 			failed_at,
 			project_id,
 			email,
-			open_payment_status
-	 	FROM
-	 		mla_orders
-	 	WHERE
-		 	SUBSTRING(paid_at, 1, 10) = ? AND
-			project_id = ? AND 
+			open_payment_status,
+			order_type
+		FROM
+			mla_orders
+		WHERE
+			status = ? AND
+			pending_at < ? AND
+			project_id = ? AND
 			deleted_at IS NULL
-		`
-
-	if uid != "" {
-		query += ` AND created_by = ? `
-		err = c.db.Select(&orders, query, paidDate, pid, uid)
-	} else {
-		err = c.db.Select(&orders, query, paidDate, pid)
-	}
+		ORDER BY
+			pending_at`
 
+	err = c.db.Select(&orders, query, StatusPending, before, pid)
 	return
 }
 
 func (c *core) GetSummaryVenueByVenueID(venueID, pid int64, uid string) (sumvenue SummaryVenue, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:sumvenue-id:%d", redisPrefix, pid, uid, venueID)
-
-	sumvenue, err = c.getSumVenueFromCache()
-	if err != nil {
-		sumvenue, err = c.getSummaryVenueFromDBByVenueID(venueID, pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumvenue)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:sumvenue-id:%d", uid, venueID), cacheTTL, &sumvenue, func() (interface{}, error) {
+		return c.getSummaryVenueFromDBByVenueID(venueID, pid, uid)
+	})
 	return
 }
 
@@ -758,6 +938,7 @@ func (c *core) getSummaryVenueFromDBByVenueID(venueID, pid int64, uid string) (s
 		COALESCE(comp.province,'') as company_province,
 		COALESCE(comp.zip,'') as company_zip,
 		COALESCE(comp.email,'') as company_email,
+		COALESCE(comp.locale,'') as company_locale,
 		orders.order_id as last_order_id,
 		COALESCE(orders.order_number,'') as last_order_number,
 		COALESCE(orders.total_price,0) as last_order_total_price,
@@ -780,8 +961,8 @@ func (c *core) getSummaryVenueFromDBByVenueID(venueID, pid int64, uid string) (s
 	left join (select venue_id, max(created_at) as created_at from mla_email_log 
 		where deleted_at is null and project_id=? and email_type='ecert' group by venue_id) emaillog 
 		on venues.id = emaillog.venue_id
-	left join (select * from mla_orders where venue_id= ? and deleted_at is null and project_id = ?
-		and created_at = (SELECT max(created_at) FROM mla_orders where venue_id = ?) order by order_id LIMIT 1) orders on venues.id = orders.venue_id
+	left join (select * from ` + venueOrders + ` venue_orders where venue_id= ? and deleted_at is null and project_id = ?
+		and created_at = (SELECT max(created_at) FROM ` + venueOrders + ` venue_orders where venue_id = ?) order by order_id LIMIT 1) orders on venues.id = orders.venue_id
 	where
 		venues.project_id = ? AND
 		venues.deleted_at IS NULL AND
@@ -804,14 +985,9 @@ func (c *core) getSummaryVenueFromDBByVenueID(venueID, pid int64, uid string) (s
 }
 
 func (c *core) SelectSummaryVenuesByUserID(pid int64, uid string) (sumvenues SummaryVenues, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:sumvenue", redisPrefix, pid, uid)
-
-	sumvenues, err = c.selectSumVenueFromCache()
-	if err != nil {
-		sumvenues, err = c.selectSummaryVenuesFromDBByUserID(pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumvenues)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:sumvenue", uid), cacheTTL, &sumvenues, func() (interface{}, error) {
+		return c.selectSummaryVenuesFromDBByUserID(pid, uid)
+	})
 	return
 }
 
@@ -845,6 +1021,7 @@ func (c *core) selectSummaryVenuesFromDBByUserID(pid int64, uid string) (sumvenu
 		COALESCE(comp.province,'') as company_province,
 		COALESCE(comp.zip,'') as company_zip,
 		COALESCE(comp.email,'') as company_email,
+		COALESCE(comp.locale,'') as company_locale,
 		orders.order_id as last_order_id,
 		COALESCE(orders.order_number,'') as last_order_number,
 		COALESCE(orders.total_price,0) as last_order_total_price,
@@ -868,8 +1045,8 @@ func (c *core) selectSummaryVenuesFromDBByUserID(pid int64, uid string) (sumvenu
 		where deleted_at is null and project_id=? and email_type='ecert' group by venue_id) emaillog 
 		on venues.id = emaillog.venue_id
 	left join (select t.*
-		from mla_orders t
-		inner join (select venue_id, max(created_at) as created_at from mla_orders where deleted_at is null and project_id=? group by venue_id)
+		from ` + venueOrders + ` t
+		inner join (select venue_id, max(created_at) as created_at from ` + venueOrders + ` venue_orders where deleted_at is null and project_id=? group by venue_id)
 		tm on t.venue_id = tm.venue_id and t.created_at = tm.created_at) orders
 		on venues.id = orders.venue_id
 	where
@@ -892,14 +1069,9 @@ func (c *core) selectSummaryVenuesFromDBByUserID(pid int64, uid string) (sumvenu
 }
 
 func (c *core) SelectSummaryVenuesByUserIDPagination(pid int64, uid string, limit int64, offset int64) (sumvenues SummaryVenues, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:sumvenue", redisPrefix, pid, uid)
-
-	sumvenues, err = c.selectSumVenueFromCache()
-	if err != nil {
-		sumvenues, err = c.selectSummaryVenuesFromDBByUserIDPagination(pid, uid, limit, offset)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumvenues)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:sumvenue:%d:%d", uid, limit, offset), cacheTTL, &sumvenues, func() (interface{}, error) {
+		return c.selectSummaryVenuesFromDBByUserIDPagination(pid, uid, limit, offset)
+	})
 	return
 }
 
@@ -933,6 +1105,7 @@ func (c *core) selectSummaryVenuesFromDBByUserIDPagination(pid int64, uid string
 		COALESCE(comp.province,'') as company_province,
 		COALESCE(comp.zip,'') as company_zip,
 		COALESCE(comp.email,'') as company_email,
+		COALESCE(comp.locale,'') as company_locale,
 		orders.order_id as last_order_id,
 		COALESCE(orders.order_number,'') as last_order_number,
 		COALESCE(orders.total_price,0) as last_order_total_price,
@@ -956,8 +1129,8 @@ func (c *core) selectSummaryVenuesFromDBByUserIDPagination(pid int64, uid string
 		where deleted_at is null and project_id=? and email_type='ecert' group by venue_id) emaillog 
 		on venues.id = emaillog.venue_id
 	left join (select t.*
-		from mla_orders t
-		inner join (select venue_id, max(created_at) as created_at from mla_orders where deleted_at is null and project_id=? group by venue_id)
+		from ` + venueOrders + ` t
+		inner join (select venue_id, max(created_at) as created_at from ` + venueOrders + ` venue_orders where deleted_at is null and project_id=? group by venue_id)
 		tm on t.venue_id = tm.venue_id and t.created_at = tm.created_at) orders
 		on venues.id = orders.venue_id
 	where
@@ -984,14 +1157,9 @@ func (c *core) selectSummaryVenuesFromDBByUserIDPagination(pid int64, uid string
 }
 
 func (c *core) SelectSummaryOrdersByVenueID(venueID, pid int64, uid string) (sumorders SummaryOrders, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:sumorder-venueid:%d", redisPrefix, pid, uid, venueID)
-
-	sumorders, err = c.selectSumOrderFromCache()
-	if err != nil {
-		sumorders, err = c.selectSummaryOrdersFromDBByVenueID(venueID, pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumorders)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:sumorder-venueid:%d", uid, venueID), cacheTTL, &sumorders, func() (interface{}, error) {
+		return c.selectSummaryOrdersFromDBByVenueID(venueID, pid, uid)
+	})
 	return
 }
 
@@ -1008,6 +1176,7 @@ func (c *core) selectSummaryOrdersFromDBByVenueID(venueID, pid int64, uid string
 		COALESCE(orders.status,0) as order_status,
 		COALESCE(orders.open_payment_status,0) as open_payment_status,
 		ecertsent.last_sent_date as ecert_last_sent_date,
+		COALESCE(refunds.refunded_amount,0) as order_refunded_amount,
 		COALESCE(devices.description,'') as device_name,
 		COALESCE(product.description,'') as product_name,
 		COALESCE(installation.description,'') as installation_name,
@@ -1015,19 +1184,23 @@ func (c *core) selectSummaryOrdersFromDBByVenueID(venueID, pid int64, uid string
 		COALESCE(room.quantity,0) as room_qty,
 		COALESCE(aging.description,'') as aging_name
 	from
-		mla_orders orders
+		` + venueOrders + ` orders
 	left join mla_venues venues on venues.id = orders.venue_id
 	left join mla_license license on venues.id = license.venue_id
 	left join mla_company comp on comp.id = venues.pt_id
-	left join (select order_id, max(created_at) as last_sent_date 
+	left join (select order_id, venue_id, max(created_at) as last_sent_date 
 			from mla_email_log where deleted_at is null and email_type='ecert' 
-			and project_id= ? group by order_id) ecertsent 
-			on orders.order_id = ecertsent.order_id
-	left join mla_order_details devices on orders.order_id = devices.order_id and devices.item_type='device'
-	left join mla_order_details product on orders.order_id = product.order_id and product.item_type='product'
-	left join mla_order_details installation on orders.order_id = installation.order_id and installation.item_type='installation'
-	left join mla_order_details room on orders.order_id = room.order_id and room.item_type='room'
-	left join mla_order_details aging on orders.order_id = aging.order_id and aging.item_type='aging'
+			and project_id= ? group by order_id, venue_id) ecertsent 
+			on orders.order_id = ecertsent.order_id and orders.venue_id = ecertsent.venue_id
+	left join (select order_id, sum(amount) as refunded_amount
+			from mla_refunds where status='completed'
+			and project_id= ? group by order_id) refunds
+			on orders.order_id = refunds.order_id
+	left join mla_order_details devices on orders.order_id = devices.order_id and devices.venue_id = orders.venue_id and devices.item_type='device'
+	left join mla_order_details product on orders.order_id = product.order_id and product.venue_id = orders.venue_id and product.item_type='product'
+	left join mla_order_details installation on orders.order_id = installation.order_id and installation.venue_id = orders.venue_id and installation.item_type='installation'
+	left join mla_order_details room on orders.order_id = room.order_id and room.venue_id = orders.venue_id and room.item_type='room'
+	left join mla_order_details aging on orders.order_id = aging.order_id and aging.venue_id = orders.venue_id and aging.item_type='aging'
 	where
 		venues.project_id = ? AND
 		venues.deleted_at IS NULL AND
@@ -1039,24 +1212,19 @@ func (c *core) selectSummaryOrdersFromDBByVenueID(venueID, pid int64, uid string
 			`	AND venues.created_by = ?
 			ORDER BY 
 				orders.updated_at DESC`
-		err = c.db.Select(&sumorders, query, pid, pid, venueID, uid)
+		err = c.db.Select(&sumorders, query, pid, pid, pid, venueID, uid)
 	} else {
 		query += ` ORDER BY orders.updated_at DESC`
-		err = c.db.Select(&sumorders, query, pid, pid, venueID)
+		err = c.db.Select(&sumorders, query, pid, pid, pid, venueID)
 	}
 
 	return
 }
 
 func (c *core) GetSummaryVenueByLicenseNumber(licNumber string, pid int64) (sumvenue SummaryVenue, err error) {
-	redisKey := fmt.Sprintf("%s:%d:sumvenue-licnumber:%s", redisPrefix, pid, licNumber)
-
-	sumvenue, err = c.getSumVenueFromCache()
-	if err != nil {
-		sumvenue, err = c.getSummaryVenueFromDBByLicenseNumber(licNumber, pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumvenue)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("sumvenue-licnumber:%s", licNumber), cacheTTL, &sumvenue, func() (interface{}, error) {
+		return c.getSummaryVenueFromDBByLicenseNumber(licNumber, pid)
+	})
 	return
 }
 
@@ -1090,6 +1258,7 @@ func (c *core) getSummaryVenueFromDBByLicenseNumber(licNumber string, pid int64)
 		COALESCE(comp.province,'') as company_province,
 		COALESCE(comp.zip,'') as company_zip,
 		COALESCE(comp.email,'') as company_email,
+		COALESCE(comp.locale,'') as company_locale,
 		orders.order_id as last_order_id,
 		COALESCE(orders.order_number,'') as last_order_number,
 		COALESCE(orders.total_price,0) as last_order_total_price,
@@ -1113,8 +1282,8 @@ func (c *core) getSummaryVenueFromDBByLicenseNumber(licNumber string, pid int64)
 		where deleted_at is null and project_id=? and email_type='ecert' group by venue_id) emaillog 
 		on venues.id = emaillog.venue_id
 	left join (select t.*
-		from mla_orders t
-		inner join (select venue_id, max(created_at) as created_at from mla_orders where deleted_at is null and project_id=? group by venue_id)
+		from ` + venueOrders + ` t
+		inner join (select venue_id, max(created_at) as created_at from ` + venueOrders + ` venue_orders where deleted_at is null and project_id=? group by venue_id)
 		tm on t.venue_id = tm.venue_id and t.created_at = tm.created_at) orders
 		on venues.id = orders.venue_id
 	where
@@ -1127,14 +1296,9 @@ func (c *core) getSummaryVenueFromDBByLicenseNumber(licNumber string, pid int64)
 }
 
 func (c *core) SelectSummaryOrdersByLicenseNumber(licNumber string, pid int64) (sumorders SummaryOrders, err error) {
-	redisKey := fmt.Sprintf("%s:%d:sumorder-licnumber:%s", redisPrefix, pid, licNumber)
-
-	sumorders, err = c.selectSumOrderFromCache()
-	if err != nil {
-		sumorders, err = c.selectSummaryOrdersFromDBByLicenseNumber(licNumber, pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumorders)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("sumorder-licnumber:%s", licNumber), cacheTTL, &sumorders, func() (interface{}, error) {
+		return c.selectSummaryOrdersFromDBByLicenseNumber(licNumber, pid)
+	})
 	return
 }
 
@@ -1158,19 +1322,19 @@ func (c *core) selectSummaryOrdersFromDBByLicenseNumber(licNumber string, pid in
 		COALESCE(room.quantity,0) as room_qty,
 		COALESCE(aging.description,'') as aging_name
 	from
-		mla_orders orders
+		` + venueOrders + ` orders
 	left join mla_venues venues on venues.id = orders.venue_id
 	left join mla_license license on venues.id = license.venue_id
 	left join mla_company comp on comp.id = venues.pt_id
-	left join (select order_id, max(created_at) as last_sent_date 
+	left join (select order_id, venue_id, max(created_at) as last_sent_date 
 			from mla_email_log where deleted_at is null and email_type='ecert' 
-			and project_id= ? group by order_id) ecertsent 
-			on orders.order_id = ecertsent.order_id
-	left join mla_order_details devices on orders.order_id = devices.order_id and devices.item_type='device'
-	left join mla_order_details product on orders.order_id = product.order_id and product.item_type='product'
-	left join mla_order_details installation on orders.order_id = installation.order_id and installation.item_type='installation'
-	left join mla_order_details room on orders.order_id = room.order_id and room.item_type='room'
-	left join mla_order_details aging on orders.order_id = aging.order_id and aging.item_type='aging'
+			and project_id= ? group by order_id, venue_id) ecertsent 
+			on orders.order_id = ecertsent.order_id and orders.venue_id = ecertsent.venue_id
+	left join mla_order_details devices on orders.order_id = devices.order_id and devices.venue_id = orders.venue_id and devices.item_type='device'
+	left join mla_order_details product on orders.order_id = product.order_id and product.venue_id = orders.venue_id and product.item_type='product'
+	left join mla_order_details installation on orders.order_id = installation.order_id and installation.venue_id = orders.venue_id and installation.item_type='installation'
+	left join mla_order_details room on orders.order_id = room.order_id and room.venue_id = orders.venue_id and room.item_type='room'
+	left join mla_order_details aging on orders.order_id = aging.order_id and aging.venue_id = orders.venue_id and aging.item_type='aging'
 	where
 		license.license_number = ? AND
 		license.project_id = ? AND
@@ -1178,109 +1342,3 @@ func (c *core) selectSummaryOrdersFromDBByLicenseNumber(licNumber string, pid in
 	`, pid, licNumber, pid)
 	return
 }
-
-func (c *core) selectFromCache() (orders Orders, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &orders)
-	return
-}
-
-func (c *core) selectSumVenueFromCache() (sumvenues SummaryVenues, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &sumvenues)
-	return
-}
-
-func (c *core) selectSumOrderFromCache() (sumorders SummaryOrders, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &sumorders)
-	return
-}
-
-func (c *core) getFromCache(key string) (order Order, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &order)
-	return
-}
-
-func (c *core) getSumVenueFromCache() (sumvenue SummaryVenue, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &sumvenue)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
-
-func (c *core) clearRedis(projectID int64, UserID string, orderID, venueID int64, orderStatus int16, paidDate string, isAdmin bool) {
-
-	redisKeys := []string{
-		fmt.Sprintf("%s:%d:%s:orders", redisPrefix, projectID, UserID),
-		fmt.Sprintf("%s:%d:%s:orders-buyerid:%s", redisPrefix, projectID, UserID, UserID),
-		fmt.Sprintf("%s:%d:%s:orders-venueid:%d", redisPrefix, projectID, UserID, venueID),
-		fmt.Sprintf("%s:%d:%s:sumorder-venueid:%d", redisPrefix, projectID, UserID, venueID),
-		fmt.Sprintf("%s:%d:sumorder-licnumber:*", redisPrefix, projectID),
-	}
-
-	if orderID != 0 {
-		redisKeys = append(redisKeys,
-			fmt.Sprintf("%s:%d:%s:orders:%d", redisPrefix, projectID, UserID, orderID),
-		)
-	}
-
-	if orderStatus == 2 {
-		redisKeys = append(redisKeys, fmt.Sprintf("%s:%d:%s:orders-paiddate:%s", redisPrefix, projectID, UserID, paidDate[:10]))
-	}
-
-	if isAdmin {
-		redisKeys = append(redisKeys,
-			fmt.Sprintf("%s:%d::orders", redisPrefix, projectID),
-			fmt.Sprintf("%s:%d::orders-buyerid:%s", redisPrefix, projectID, UserID),
-			fmt.Sprintf("%s:%d::orders-venueid:%d", redisPrefix, projectID, venueID),
-			fmt.Sprintf("%s:%d::sumorder-venueid:%d", redisPrefix, projectID, venueID),
-		)
-
-		if orderID != 0 {
-			redisKeys = append(redisKeys,
-				fmt.Sprintf("%s:%d::orders:%d", redisPrefix, projectID, orderID),
-			)
-		}
-
-		if orderStatus == 2 {
-			redisKeys = append(redisKeys, fmt.Sprintf("%s:%d::orders-paiddate:%s", redisPrefix, projectID, paidDate[:10]))
-		}
-	}
-
-	for _, redisKey := range redisKeys {
-		_ = c.deleteCache(redisKey)
-	}
-}
@@ -0,0 +1,265 @@
+package order
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Filter narrows and pages the orders listing, zero values do not filter nor
+// limit. Date ranges include From and exclude To
+type Filter struct {
+	Status            []int16
+	VenueID           int64
+	BuyerID           string
+	CreatedBy         string
+	CreatedFrom       null.Time
+	CreatedTo         null.Time
+	PaidFrom          null.Time
+	PaidTo            null.Time
+	FailedFrom        null.Time
+	FailedTo          null.Time
+	MinAmount         null.Float
+	MaxAmount         null.Float
+	OrderNumberPrefix string
+	Sorts             Sorts
+	Cursor            Cursor
+	Limit             int
+}
+
+// Errors of the listing params
+var (
+	ErrInvalidSort   = errors.New("invalid sort")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+type sortKind int
+
+const (
+	sortTime sortKind = iota
+	sortFloat
+	sortInt
+	sortString
+)
+
+type sortField struct {
+	column   string
+	kind     sortKind
+	nullable bool
+}
+
+// sortFields are the fields orders can be sorted by
+var sortFields = map[string]sortField{
+	"id":          {"order_id", sortInt, false},
+	"orderNumber": {"order_number", sortString, false},
+	"status":      {"status", sortInt, false},
+	"totalPrice":  {"total_price", sortFloat, false},
+	"createdAt":   {"created_at", sortTime, false},
+	"paidAt":      {"paid_at", sortTime, true},
+	"failedAt":    {"failed_at", sortTime, true},
+}
+
+// Sort is a field of the listing order, ascending unless Desc
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Sorts is the listing order, the order id breaks the ties
+type Sorts []Sort
+
+// DefaultSort lists the newest orders first
+const DefaultSort = "-createdAt"
+
+// ParseSorts parses comma separated fields, descending when prefixed by -.
+// e.g. -paidAt,totalPrice
+func ParseSorts(s string) (sorts Sorts, err error) {
+	if s == "" {
+		s = DefaultSort
+	}
+
+	seen := make(map[string]bool)
+	for _, field := range strings.Split(s, ",") {
+		sort := Sort{Field: strings.TrimSpace(field)}
+		if strings.HasPrefix(sort.Field, "-") {
+			sort.Field = sort.Field[1:]
+			sort.Desc = true
+		}
+		if _, ok := sortFields[sort.Field]; !ok || seen[sort.Field] {
+			return nil, ErrInvalidSort
+		}
+		seen[sort.Field] = true
+		sorts = append(sorts, sort)
+		if sort.Field == "id" {
+			return sorts, nil
+		}
+	}
+	return append(sorts, Sort{Field: "id", Desc: sorts[len(sorts)-1].Desc}), nil
+}
+
+func (sorts Sorts) String() string {
+	fields := make([]string, 0, len(sorts))
+	for _, sort := range sorts {
+		if sort.Desc {
+			fields = append(fields, "-"+sort.Field)
+		} else {
+			fields = append(fields, sort.Field)
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// orderBy returns the ORDER BY clause, nulls come first ascending as in MySQL
+func (sorts Sorts) orderBy() string {
+	columns := make([]string, 0, len(sorts))
+	for _, sort := range sorts {
+		column := sortFields[sort.Field].column
+		if sort.Desc {
+			column += " DESC"
+		}
+		columns = append(columns, column)
+	}
+	return " ORDER BY " + strings.Join(columns, ", ")
+}
+
+// Cursor is the position after the last order of a page, the values of its
+// sort fields. The zero cursor is the first page
+type Cursor struct {
+	Sort   string    `json:"s"`
+	Values []*string `json:"v"`
+}
+
+// NewCursor returns the cursor after the order
+func (sorts Sorts) NewCursor(o Order) Cursor {
+	cursor := Cursor{Sort: sorts.String()}
+	for _, sort := range sorts {
+		var value *string
+		switch sort.Field {
+		case "id":
+			value = stringPtr(strconv.FormatInt(o.OrderID, 10))
+		case "orderNumber":
+			value = stringPtr(o.OrderNumber)
+		case "status":
+			value = stringPtr(strconv.FormatInt(int64(o.Status), 10))
+		case "totalPrice":
+			value = stringPtr(strconv.FormatFloat(o.TotalPrice, 'f', -1, 64))
+		case "createdAt":
+			value = stringPtr(o.CreatedAt.Format(time.RFC3339Nano))
+		case "paidAt":
+			value = timePtr(o.PaidAt)
+		case "failedAt":
+			value = timePtr(o.FailedAt)
+		}
+		cursor.Values = append(cursor.Values, value)
+	}
+	return cursor
+}
+
+// Encode returns the cursor as an opaque url safe string
+func (cursor Cursor) Encode() string {
+	b, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor returns the cursor of an encoded string, it must have been
+// made for the same sorts
+func DecodeCursor(s string, sorts Sorts) (cursor Cursor, err error) {
+	if s == "" {
+		return
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	err = json.Unmarshal(b, &cursor)
+	if err != nil || cursor.Sort != sorts.String() || len(cursor.Values) != len(sorts) {
+		return Cursor{}, ErrInvalidCursor
+	}
+	for i, sort := range sorts {
+		_, err = cursorArg(sortFields[sort.Field], cursor.Values[i])
+		if err != nil {
+			return Cursor{}, ErrInvalidCursor
+		}
+	}
+	return
+}
+
+// after returns the condition of the orders after the cursor. For every sort
+// field, orders equal on the fields before it and past it on the field
+func (cursor Cursor) after(sorts Sorts) (string, []interface{}) {
+	var (
+		conds []string
+		args  []interface{}
+		equal []string
+		eargs []interface{}
+	)
+	for i, sort := range sorts {
+		field := sortFields[sort.Field]
+		value, _ := cursorArg(field, cursor.Values[i])
+
+		var past, same string
+		var pastArgs, sameArgs []interface{}
+		switch {
+		case value == nil && sort.Desc:
+			past = "FALSE"
+			same = field.column + " IS NULL"
+		case value == nil:
+			past = field.column + " IS NOT NULL"
+			same = field.column + " IS NULL"
+		case sort.Desc && field.nullable:
+			past = "(" + field.column + " < ? OR " + field.column + " IS NULL)"
+			same = field.column + " = ?"
+			pastArgs, sameArgs = []interface{}{value}, []interface{}{value}
+		case sort.Desc:
+			past = field.column + " < ?"
+			same = field.column + " = ?"
+			pastArgs, sameArgs = []interface{}{value}, []interface{}{value}
+		default:
+			past = field.column + " > ?"
+			same = field.column + " = ?"
+			pastArgs, sameArgs = []interface{}{value}, []interface{}{value}
+		}
+
+		conds = append(conds, "("+strings.Join(append(append([]string{}, equal...), past), " AND ")+")")
+		args = append(append(args, eargs...), pastArgs...)
+		equal = append(equal, same)
+		eargs = append(eargs, sameArgs...)
+	}
+	return "(" + strings.Join(conds, " OR ") + ")", args
+}
+
+func cursorArg(field sortField, value *string) (interface{}, error) {
+	if value == nil {
+		if !field.nullable {
+			return nil, ErrInvalidCursor
+		}
+		return nil, nil
+	}
+
+	switch field.kind {
+	case sortTime:
+		return time.Parse(time.RFC3339Nano, *value)
+	case sortFloat:
+		return strconv.ParseFloat(*value, 64)
+	case sortInt:
+		return strconv.ParseInt(*value, 10, 64)
+	}
+	return *value, nil
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func timePtr(t null.Time) *string {
+	if !t.Valid {
+		return nil
+	}
+	return stringPtr(t.Time.Format(time.RFC3339Nano))
+}
@@ -6,18 +6,21 @@ import (
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	emailOutbox "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/email_outbox"
+	orderJob "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
 	"github.com/jmoiron/sqlx"
 )
 
 // Init is used to initialize order package
-func Init(db *sqlx.DB, redis *redis.Pool, paymentMethodID int64, auditTrail auditTrail.ICore) ICore {
+func Init(db *sqlx.DB, cache cache.ICore, auditTrail auditTrail.ICore, emailOutbox emailOutbox.ICore, orderJob orderJob.ICore) ICore {
 	examineDBHealth(db)
 	return &core{
-		db:              db,
-		redis:           redis,
-		paymentMethodID: paymentMethodID,
-		auditTrail:      auditTrail,
+		db:          db,
+		cache:       cache,
+		auditTrail:  auditTrail,
+		emailOutbox: emailOutbox,
+		orderJob:    orderJob,
 	}
 }
 
@@ -34,16 +34,38 @@ type Order struct {
 	ProjectID         int64     `db:"project_id"`
 	Email             string    `db:"email"`
 	OpenPaymentStatus int16     `db:"open_payment_status"`
+	OrderType         string    `db:"order_type"`
 }
 
+//Order types, a renewal order extends the existing license of the venue.
+//A cart order has no venue or items of its own, its details hold the items
+//of every venue in the cart. Orders made before order types are new, the
+//column is added as NOT NULL DEFAULT 'new'
+const (
+	OrderTypeNew     = "new"
+	OrderTypeRenewal = "renewal"
+	OrderTypeCart    = "cart"
+)
+
 //Orders is list of order
 type Orders []Order
 
-type LastOrderNumber struct {
-	Date   string `db:"date"`
-	Number int64  `db:"number"`
+//StatusHistory is model for mla_order_status_history in db,
+//FromStatus is null for the status an order is created with
+type StatusHistory struct {
+	ID         int64     `db:"id"`
+	OrderID    int64     `db:"order_id"`
+	FromStatus null.Int  `db:"from_status"`
+	ToStatus   int16     `db:"to_status"`
+	Reason     string    `db:"reason"`
+	CreatedBy  string    `db:"created_by"`
+	CreatedAt  time.Time `db:"created_at"`
+	ProjectID  int64     `db:"project_id"`
 }
 
+//StatusHistories is list of status history
+type StatusHistories []StatusHistory
+
 type SummaryVenue struct {
 	VenueID               int64     `db:"venue_id"`
 	VenueName             string    `db:"venue_name"`
@@ -68,6 +90,7 @@ type SummaryVenue struct {
 	CompanyProvince       string    `db:"company_province"`
 	CompanyZip            string    `db:"company_zip"`
 	CompanyEmail          string    `db:"company_email"`
+	CompanyLocale         string    `db:"company_locale"`
 	EcertLastSent         null.Time `db:"ecert_last_sent"`
 	LicenseNumber         string    `db:"license_number"`
 	LicenseActiveDate     null.Time `db:"license_active_date"`
@@ -108,6 +131,7 @@ type SummaryOrder struct {
 	OrderStatus       int64     `db:"order_status"`
 	OpenPaymentStatus int64     `db:"open_payment_status"`
 	EcertLastSentDate null.Time `db:"ecert_last_sent_date"`
+	RefundedAmount    float64   `db:"order_refunded_amount"`
 }
 
 type SummaryOrders []SummaryOrder
@@ -0,0 +1,69 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Order statuses stored in mla_orders.status
+const (
+	StatusDraft      int16 = 0
+	StatusPending    int16 = 1
+	StatusPaid       int16 = 2
+	StatusFailed     int16 = 3
+	StatusAgentDraft int16 = 4
+	StatusCancelled  int16 = 5
+	StatusRefunded   int16 = 6
+	StatusExpired    int16 = 7
+)
+
+var statusNames = map[int16]string{
+	StatusDraft:      "draft",
+	StatusPending:    "pending",
+	StatusPaid:       "paid",
+	StatusFailed:     "failed",
+	StatusAgentDraft: "agent_draft",
+	StatusCancelled:  "cancelled",
+	StatusRefunded:   "refunded",
+	StatusExpired:    "expired",
+}
+
+// transitions lists the statuses an order may move to from each status,
+// statuses without entry (cancelled, refunded, expired) are final
+var transitions = map[int16][]int16{
+	StatusDraft:      {StatusPending, StatusCancelled, StatusExpired},
+	StatusAgentDraft: {StatusPending, StatusPaid, StatusCancelled, StatusExpired},
+	StatusPending:    {StatusPending, StatusPaid, StatusFailed, StatusCancelled, StatusExpired},
+	StatusFailed:     {StatusPending, StatusCancelled},
+	StatusPaid:       {StatusRefunded},
+}
+
+// ErrInvalidTransition is returned when an order can not move to the requested status
+var ErrInvalidTransition = errors.New("Invalid order status transition")
+
+// ErrNotEditable is returned when changing an order which is no longer draft
+var ErrNotEditable = errors.New("Order can only be changed while draft")
+
+// IsEditable reports whether an order in status may still be changed, only
+// drafts are, the status itself moves through UpdateOrderStatus
+func IsEditable(status int16) bool {
+	return status == StatusDraft || status == StatusAgentDraft
+}
+
+// StatusName returns name of the status
+func StatusName(status int16) string {
+	if name, ok := statusNames[status]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", status)
+}
+
+// CanTransition reports whether an order in status from may move to status to
+func CanTransition(from, to int16) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
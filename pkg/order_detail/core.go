@@ -1,22 +1,20 @@
 package order_detail
 
 import (
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 	"gopkg.in/guregu/null.v3"
 )
 
 // ICore is the interface
 type ICore interface {
-	Insert(orderDetail *OrderDetail, isAdmin bool) (err error)
-	Update(orderDetail *OrderDetail, isAdmin bool) (err error)
-	Delete(orderDetail *OrderDetail, isAdmin bool) (err error)
+	Insert(orderDetail *OrderDetail, isAdmin bool, requestID string) (err error)
+	Update(orderDetail *OrderDetail, isAdmin bool, requestID string) (err error)
+	Delete(orderDetail *OrderDetail, isAdmin bool, requestID string) (err error)
 	GetFromDBByOrderID(orderID int64, pid int64, uid string) (orderDetails OrderDetails, err error)
 	GetDetailByOrderID(orderID int64, pid int64, uid string) (dataDetails DataDetails, err error)
 }
@@ -24,13 +22,20 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "order_detail"
+	cacheTTL       = 5 * time.Minute
 
-func (c *core) Insert(orderDetail *OrderDetail, isAdmin bool) (err error) {
+	// orderCacheNamespace holds the order summaries, they show the prices and
+	// discounts of the details
+	orderCacheNamespace = "order"
+)
+
+func (c *core) Insert(orderDetail *OrderDetail, isAdmin bool, requestID string) (err error) {
 	orderDetail.CreatedAt = time.Now()
 	orderDetail.UpdatedAt = orderDetail.CreatedAt
 	orderDetail.Status = 1
@@ -38,11 +43,16 @@ func (c *core) Insert(orderDetail *OrderDetail, isAdmin bool) (err error) {
 	query := `
 		INSERT INTO mla_order_details(
 			order_id,
+			venue_id,
 			item_type,
 			item_id,
 			description,
 			amount,
 			quantity,
+			tax_rate_id,
+			tax_rate,
+			tax_base,
+			tax_amount,
 			status,
 			created_at,
 			created_by,
@@ -50,16 +60,21 @@ func (c *core) Insert(orderDetail *OrderDetail, isAdmin bool) (err error) {
 			last_update_by,
 			project_id
 		) VALUES (
-			?,?,?,?,?,?,?,?,?,?,?,?
+			?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?
 		)`
 
 	args := []interface{}{
 		orderDetail.OrderID,
+		orderDetail.VenueID,
 		orderDetail.ItemType,
 		orderDetail.ItemID,
 		orderDetail.Description,
 		orderDetail.Amount,
 		orderDetail.Quantity,
+		orderDetail.TaxRateID,
+		orderDetail.TaxRate,
+		orderDetail.TaxBase,
+		orderDetail.TaxAmount,
 		orderDetail.Status,
 		orderDetail.CreatedAt,
 		orderDetail.CreatedBy,
@@ -67,45 +82,50 @@ func (c *core) Insert(orderDetail *OrderDetail, isAdmin bool) (err error) {
 		orderDetail.LastUpdateBy,
 		orderDetail.ProjectID,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
-	orderDetail.ID, err = res.LastInsertId()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_order_details",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    orderDetail.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    orderDetail.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_order_details",
+	orderDetail.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
 	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(orderDetail.CreatedBy, orderDetail.ProjectID, orderDetail.OrderID, isAdmin)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, orderDetail.ProjectID), cache.Namespace(orderCacheNamespace, orderDetail.ProjectID))
 
 	return
 }
 
-func (c *core) Update(orderDetail *OrderDetail, isAdmin bool) (err error) {
+func (c *core) Update(orderDetail *OrderDetail, isAdmin bool, requestID string) (err error) {
 	orderDetail.UpdatedAt = time.Now()
 
 	query := `
 		UPDATE
 			mla_order_details
 		SET
+			venue_id = ?,
 			item_id = ?,
 			description = ?,
 			amount = ?,
 			quantity = ?,
+			tax_rate_id = ?,
+			tax_rate = ?,
+			tax_base = ?,
+			tax_amount = ?,
 			updated_at = ?,
 			last_update_by = ?
 		WHERE
@@ -114,10 +134,15 @@ func (c *core) Update(orderDetail *OrderDetail, isAdmin bool) (err error) {
 			project_id = ? AND
 			status = 1`
 	args := []interface{}{
+		orderDetail.VenueID,
 		orderDetail.ItemID,
 		orderDetail.Description,
 		orderDetail.Amount,
 		orderDetail.Quantity,
+		orderDetail.TaxRateID,
+		orderDetail.TaxRate,
+		orderDetail.TaxBase,
+		orderDetail.TaxAmount,
 		orderDetail.UpdatedAt,
 		orderDetail.LastUpdateBy,
 		orderDetail.OrderID,
@@ -130,34 +155,31 @@ func (c *core) Update(orderDetail *OrderDetail, isAdmin bool) (err error) {
 		args = append(args, orderDetail.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	err = c.execAudited(tx, auditTrail.AuditTrail{
+		Action:    auditTrail.ActionUpdate,
+		ActorID:   orderDetail.LastUpdateBy,
+		RequestID: requestID,
+	}, orderDetail.OrderID, orderDetail.ItemType, orderDetail.ProjectID, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    orderDetail.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_order_details",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(orderDetail.CreatedBy, orderDetail.ProjectID, orderDetail.OrderID, isAdmin)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, orderDetail.ProjectID), cache.Namespace(orderCacheNamespace, orderDetail.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(orderDetail *OrderDetail, isAdmin bool) (err error) {
+// Delete removes the details of the order, only those of ItemType when it is set
+func (c *core) Delete(orderDetail *OrderDetail, isAdmin bool, requestID string) (err error) {
 	orderDetail.DeletedAt = null.TimeFrom(time.Now())
 
 	query := `
@@ -179,47 +201,92 @@ func (c *core) Delete(orderDetail *OrderDetail, isAdmin bool) (err error) {
 		orderDetail.ProjectID,
 	}
 
+	if orderDetail.ItemType != "" {
+		query += ` AND item_type = ? `
+		args = append(args, orderDetail.ItemType)
+	}
+
 	if !isAdmin {
 		query += ` AND created_by = ? `
 		args = append(args, orderDetail.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	err = c.execAudited(tx, auditTrail.AuditTrail{
+		Action:    auditTrail.ActionDelete,
+		ActorID:   orderDetail.LastUpdateBy,
+		RequestID: requestID,
+	}, orderDetail.OrderID, orderDetail.ItemType, orderDetail.ProjectID, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    orderDetail.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_order_details",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(orderDetail.CreatedBy, orderDetail.ProjectID, orderDetail.OrderID, isAdmin)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, orderDetail.ProjectID), cache.Namespace(orderCacheNamespace, orderDetail.ProjectID))
 
 	return
 }
 
-func (c *core) GetByOrderID(orderID int64, pid int64, uid string) (orderDetails OrderDetails, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:order-details:%d", redisPrefix, pid, uid, orderID)
+// execAudited runs query updating the details of the order in tx and records
+// the changes of every detail, itemType limits the details when not empty
+func (c *core) execAudited(tx *sqlx.Tx, audit auditTrail.AuditTrail, orderID int64, itemType string, pid int64, query string, args ...interface{}) (err error) {
+	idQuery := `
+		SELECT
+			id
+		FROM
+			mla_order_details
+		WHERE
+			order_id = ? AND
+			project_id = ? AND
+			status = 1`
+	idArgs := []interface{}{orderID, pid}
+	if itemType != "" {
+		idQuery += ` AND item_type = ?`
+		idArgs = append(idArgs, itemType)
+	}
 
-	orderDetails, err = c.selectFromCache()
+	var ids []int64
+	err = tx.Select(&ids, idQuery, idArgs...)
+	if err != nil {
+		return err
+	}
+
+	befores := make([]auditTrail.Row, len(ids))
+	for i, id := range ids {
+		befores[i], err = c.auditTrail.Snapshot(tx, "mla_order_details", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(query, args...)
 	if err != nil {
-		orderDetails, err = c.GetFromDBByOrderID(orderID, pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(orderDetails)
-		_ = c.setToCache(redisKey, 300, byt)
+		return err
+	}
+
+	for i, id := range ids {
+		detailAudit := audit
+		detailAudit.EntityType = "mla_order_details"
+		detailAudit.EntityID = id
+		err = c.auditTrail.Insert(tx, &detailAudit, befores[i])
+		if err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+func (c *core) GetByOrderID(orderID int64, pid int64, uid string) (orderDetails OrderDetails, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:order-details:%d", uid, orderID), cacheTTL, &orderDetails, func() (interface{}, error) {
+		return c.GetFromDBByOrderID(orderID, pid, uid)
+	})
 	return
 }
 
@@ -228,11 +295,16 @@ func (c *core) GetFromDBByOrderID(orderID int64, pid int64, uid string) (orderDe
 		SELECT
 			id,
 			order_id,
+			venue_id,
 			item_type,
 			item_id,
 			description,
 			amount,
 			quantity,
+			tax_rate_id,
+			tax_rate,
+			tax_base,
+			tax_amount,
 			status,
 			created_at,
 			created_by,
@@ -268,6 +340,10 @@ func (c *core) GetDetailByOrderID(orderID int64, pid int64, uid string) (dataDet
 		detail.description,
 		detail.amount,
 		detail.quantity,
+		detail.tax_rate_id,
+		detail.tax_rate,
+		detail.tax_base,
+		detail.tax_amount,
 		detail.created_at,
 		orders.total_price,
 		venue.id as venue_id,
@@ -279,11 +355,13 @@ func (c *core) GetDetailByOrderID(orderID int64, pid int64, uid string) (dataDet
 		comp.address as company_address,
 		comp.city as company_city,
 		comp.province as company_province,
-		comp.zip as company_zip
+		comp.zip as company_zip,
+		comp.npwp as company_npwp,
+		comp.locale as company_locale
 	from
 		mla_order_details detail
 		left join mla_orders orders on detail.order_id = orders.order_id
-		left join mla_venues venue on orders.venue_id = venue.id
+		left join mla_venues venue on detail.venue_id = venue.id
 		left join mla_company comp on venue.pt_id = comp.id
 	where
 		detail.order_id = ? AND
@@ -305,54 +383,3 @@ func (c *core) GetDetailByOrderID(orderID int64, pid int64, uid string) (dataDet
 
 	return
 }
-
-func (c *core) selectFromCache() (orderDetails OrderDetails, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &orderDetails)
-	return
-}
-
-func (c *core) getFromCache(key string) (orderDetail OrderDetail, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &orderDetail)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
-
-func (c *core) clearRedis(userID string, projectID, orderID int64, isAdmin bool) {
-	redisKeys := []string{
-		fmt.Sprintf("%s:%d:%s:order-details:%d", redisPrefix, projectID, userID, orderID),
-	}
-
-	if isAdmin {
-		redisKeys = append(redisKeys,
-			fmt.Sprintf("%s:%d::order-details:%d", redisPrefix, projectID, orderID),
-		)
-	}
-
-	for _, redisKey := range redisKeys {
-		_ = c.deleteCache(redisKey)
-	}
-}
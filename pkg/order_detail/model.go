@@ -9,11 +9,16 @@ import (
 type OrderDetail struct {
 	ID           int64     `db:"id"`
 	OrderID      int64     `db:"order_id"`
+	VenueID      int64     `db:"venue_id"`
 	ItemType     string    `db:"item_type"`
 	ItemID       int64     `db:"item_id"`
 	Description  string    `db:"description"`
 	Amount       float64   `db:"amount"`
 	Quantity     int64     `db:"quantity"`
+	TaxRateID    null.Int  `db:"tax_rate_id"`
+	TaxRate      float64   `db:"tax_rate"`
+	TaxBase      float64   `db:"tax_base"`
+	TaxAmount    float64   `db:"tax_amount"`
 	Status       int8      `db:"status"`
 	CreatedAt    time.Time `db:"created_at"`
 	CreatedBy    string    `db:"created_by"`
@@ -25,6 +30,16 @@ type OrderDetail struct {
 
 type OrderDetails []OrderDetail
 
+// PaidAmount returns what the buyer paid for the line. The tax of a taxed line
+// is added on top of Amount when prices exclude tax, so it is its tax base
+// and tax amount
+func (detail OrderDetail) PaidAmount() float64 {
+	if detail.TaxRateID.Valid {
+		return detail.TaxBase + detail.TaxAmount
+	}
+	return detail.Amount
+}
+
 type DataDetail struct {
 	ID             	int64     `db:"id"`
 	ItemType     	string    `db:"item_type"`
@@ -32,6 +47,10 @@ type DataDetail struct {
 	Description  	string    `db:"description"`
 	Amount       	float64   `db:"amount"`
 	Quantity     	int64     `db:"quantity"`
+	TaxRateID       null.Int  `db:"tax_rate_id"`
+	TaxRate         float64   `db:"tax_rate"`
+	TaxBase         float64   `db:"tax_base"`
+	TaxAmount       float64   `db:"tax_amount"`
 	TotalPrice     	float64   `db:"total_price"`
 	CreatedAt    	time.Time `db:"created_at"`
 	VenueID      	int64     `db:"venue_id"`
@@ -44,16 +63,23 @@ type DataDetail struct {
 	CompanyCity     string    `db:"company_city"`
 	CompanyProvince string    `db:"company_province"`
 	CompanyZip		string    `db:"company_zip"`
+	CompanyNpwp     string    `db:"company_npwp"`
+	CompanyLocale   string    `db:"company_locale"`
 }
 
 type DataDetails []DataDetail
 
 type Detail struct {
-	ItemType    string  `db:"item_type"`
-	ItemID      int64   `db:"item_id"`
-	Description string  `db:"description"`
-	Amount      float64 `db:"amount"`
-	Quantity    int64   `db:"quantity"`
+	VenueID     int64    `db:"venue_id"`
+	ItemType    string   `db:"item_type"`
+	ItemID      int64    `db:"item_id"`
+	Description string   `db:"description"`
+	Amount      float64  `db:"amount"`
+	Quantity    int64    `db:"quantity"`
+	TaxRateID   null.Int `db:"tax_rate_id"`
+	TaxRate     float64  `db:"tax_rate"`
+	TaxBase     float64  `db:"tax_base"`
+	TaxAmount   float64  `db:"tax_amount"`
 }
 
 type Details []Detail
@@ -0,0 +1,308 @@
+package order_job
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	null "gopkg.in/guregu/null.v3"
+)
+
+// ICore is the interface
+type ICore interface {
+	Enqueue(tx *sqlx.Tx, job *Job) (err error)
+	Claim(pid int64, lease time.Duration, limit int) (jobs Jobs, err error)
+	MarkDone(job *Job) (err error)
+	MarkFailed(job *Job, cause error) (err error)
+	Select(pid int64, status string, limit, offset int) (jobs Jobs, err error)
+	Get(id int64, pid int64) (job Job, err error)
+	IsDone(pid int64, jobType string, orderID, venueID int64) (done bool, err error)
+	Retry(id int64, pid int64, userID string) (err error)
+}
+
+// core contains db client
+type core struct {
+	db     *sqlx.DB
+	policy Policy
+}
+
+const workerUser = "order-job"
+
+// Enqueue adds job in tx, so it is only run when the write needing it commits
+func (c *core) Enqueue(tx *sqlx.Tx, job *Job) (err error) {
+	job.Status = StatusPending
+	job.Attempts = 0
+	job.CreatedAt = time.Now()
+	job.UpdatedAt = job.CreatedAt
+	job.NextAttemptAt = job.CreatedAt
+	job.LastUpdateBy = job.CreatedBy
+
+	res, err := tx.NamedExec(`
+		INSERT INTO mla_order_jobs (
+			type,
+			order_id,
+			venue_id,
+			refund_id,
+			status,
+			attempts,
+			next_attempt_at,
+			project_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by
+		) VALUES (
+			:type,
+			:order_id,
+			:venue_id,
+			:refund_id,
+			:status,
+			:attempts,
+			:next_attempt_at,
+			:project_id,
+			:created_at,
+			:created_by,
+			:updated_at,
+			:last_update_by
+		)
+	`, job)
+	if err != nil {
+		return err
+	}
+
+	job.ID, err = res.LastInsertId()
+	return err
+}
+
+// Claim returns pending jobs due now and moves their next attempt lease
+// ahead, so other workers skip them while they are being run
+func (c *core) Claim(pid int64, lease time.Duration, limit int) (jobs Jobs, err error) {
+	now := time.Now()
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	err = tx.Select(&jobs, `
+		SELECT
+			id,
+			type,
+			order_id,
+			venue_id,
+			refund_id,
+			status,
+			attempts,
+			next_attempt_at,
+			last_error,
+			done_at,
+			project_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by
+		FROM
+			mla_order_jobs
+		WHERE
+			project_id = ? AND
+			status = ? AND
+			next_attempt_at <= ?
+		ORDER BY next_attempt_at
+		LIMIT ?
+		FOR UPDATE
+	`, pid, StatusPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return jobs, nil
+	}
+
+	ids := make([]int64, 0, len(jobs))
+	for _, job := range jobs {
+		ids = append(ids, job.ID)
+	}
+	query, args, err := sqlx.In(`
+		UPDATE
+			mla_order_jobs
+		SET
+			next_attempt_at = ?
+		WHERE
+			id IN (?)
+	`, now.Add(lease), ids)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec(query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// MarkDone records a successful attempt of job
+func (c *core) MarkDone(job *Job) (err error) {
+	job.Attempts++
+	job.Status = StatusDone
+	job.LastError = null.String{}
+	job.UpdatedAt = time.Now()
+	job.DoneAt = null.TimeFrom(job.UpdatedAt)
+	job.LastUpdateBy = workerUser
+
+	return c.update(job)
+}
+
+// MarkFailed records a failed attempt of job, it is retried after the
+// backoff of the policy or becomes dead after the last attempt
+func (c *core) MarkFailed(job *Job, cause error) (err error) {
+	job.Attempts++
+	job.LastError = null.StringFrom(cause.Error())
+	job.UpdatedAt = time.Now()
+	job.LastUpdateBy = workerUser
+	if job.Attempts >= c.policy.MaxAttempts {
+		job.Status = StatusDead
+	} else {
+		job.NextAttemptAt = job.UpdatedAt.Add(c.policy.backoff(job.Attempts))
+	}
+
+	return c.update(job)
+}
+
+func (c *core) update(job *Job) (err error) {
+	_, err = c.db.NamedExec(`
+		UPDATE
+			mla_order_jobs
+		SET
+			status = :status,
+			attempts = :attempts,
+			next_attempt_at = :next_attempt_at,
+			last_error = :last_error,
+			done_at = :done_at,
+			updated_at = :updated_at,
+			last_update_by = :last_update_by
+		WHERE
+			id = :id AND
+			project_id = :project_id
+	`, job)
+	return
+}
+
+// Select returns jobs of the project newest first, all statuses when
+// status is empty
+func (c *core) Select(pid int64, status string, limit, offset int) (jobs Jobs, err error) {
+	query := `
+		SELECT
+			id,
+			type,
+			order_id,
+			venue_id,
+			refund_id,
+			status,
+			attempts,
+			next_attempt_at,
+			last_error,
+			done_at,
+			project_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by
+		FROM
+			mla_order_jobs
+		WHERE
+			project_id = ?`
+	args := []interface{}{pid}
+
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC LIMIT ? OFFSET ?`
+	args = append(args, limit, offset)
+
+	err = c.db.Select(&jobs, query, args...)
+	return
+}
+
+func (c *core) Get(id int64, pid int64) (job Job, err error) {
+	err = c.db.Get(&job, `
+		SELECT
+			id,
+			type,
+			order_id,
+			venue_id,
+			refund_id,
+			status,
+			attempts,
+			next_attempt_at,
+			last_error,
+			done_at,
+			project_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by
+		FROM
+			mla_order_jobs
+		WHERE
+			id = ? AND
+			project_id = ?
+	`, id, pid)
+	return
+}
+
+// IsDone reports whether the job of type for the order and venue is done, e.g.
+// whether the license of the venue was activated by the order
+func (c *core) IsDone(pid int64, jobType string, orderID, venueID int64) (done bool, err error) {
+	var count int
+	err = c.db.Get(&count, `
+		SELECT
+			COUNT(*)
+		FROM
+			mla_order_jobs
+		WHERE
+			project_id = ? AND
+			type = ? AND
+			order_id = ? AND
+			venue_id = ? AND
+			status = ?
+	`, pid, jobType, orderID, venueID, StatusDone)
+	return count > 0, err
+}
+
+// Retry makes a dead job pending again with a fresh set of attempts
+func (c *core) Retry(id int64, pid int64, userID string) (err error) {
+	now := time.Now()
+
+	res, err := c.db.Exec(`
+		UPDATE
+			mla_order_jobs
+		SET
+			status = ?,
+			attempts = 0,
+			next_attempt_at = ?,
+			updated_at = ?,
+			last_update_by = ?
+		WHERE
+			id = ? AND
+			project_id = ? AND
+			status = ?
+	`, StatusPending, now, now, userID, id, pid, StatusDead)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotDead
+	}
+	return nil
+}
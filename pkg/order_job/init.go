@@ -0,0 +1,35 @@
+package order_job
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Init is used to initialize order job package
+func Init(db *sqlx.DB, policy Policy) ICore {
+	examineDBHealth(db)
+	if policy.MaxAttempts <= 0 {
+		log.Fatalf("Failed to initialize order jobs. max attempts must be positive")
+	}
+	return &core{
+		db:     db,
+		policy: policy,
+	}
+}
+
+func examineDBHealth(db *sqlx.DB) {
+	if db == nil {
+		log.Fatalf("Failed to initialize order jobs. db object cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize order jobs. cannot pinging to db. err: %s", err)
+	}
+}
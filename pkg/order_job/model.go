@@ -0,0 +1,71 @@
+package order_job
+
+import (
+	"errors"
+	"time"
+
+	null "gopkg.in/guregu/null.v3"
+)
+
+// Types of job of an order. Paid orders activate licenses and earn
+// commissions, completed refunds update the order, licenses and commissions
+const (
+	TypeActivateLicense = "activate_license"
+	TypeEarnCommissions = "earn_commissions"
+	TypeCompleteRefund  = "complete_refund"
+)
+
+// Statuses of job. Pending jobs are run by the worker until they are done or
+// run out of attempts and become dead
+const (
+	StatusPending = "pending"
+	StatusDone    = "done"
+	StatusDead    = "dead"
+)
+
+// ErrNotDead is returned when retrying a job which is not dead
+var ErrNotDead = errors.New("job is not dead")
+
+// Job is model for mla_order_jobs in db. It is the work left to do once an
+// order is paid or refunded, VenueID is the venue whose license is activated
+// and RefundID the refund completed
+type Job struct {
+	ID            int64       `db:"id"`
+	Type          string      `db:"type"`
+	OrderID       int64       `db:"order_id"`
+	VenueID       int64       `db:"venue_id"`
+	RefundID      null.Int    `db:"refund_id"`
+	Status        string      `db:"status"`
+	Attempts      int64       `db:"attempts"`
+	NextAttemptAt time.Time   `db:"next_attempt_at"`
+	LastError     null.String `db:"last_error"`
+	DoneAt        null.Time   `db:"done_at"`
+	ProjectID     int64       `db:"project_id"`
+	CreatedAt     time.Time   `db:"created_at"`
+	CreatedBy     string      `db:"created_by"`
+	UpdatedAt     time.Time   `db:"updated_at"`
+	LastUpdateBy  string      `db:"last_update_by"`
+}
+
+// Jobs is list of job
+type Jobs []Job
+
+// Policy is how failed jobs are retried. The delay after the nth failed
+// attempt is BaseDelay * 2^(n-1), at most MaxDelay
+type Policy struct {
+	MaxAttempts int64
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// backoff returns the delay before the next attempt after attempts failed
+func (policy Policy) backoff(attempts int64) time.Duration {
+	delay := policy.BaseDelay
+	for i := int64(1); i < attempts && delay < policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+	return delay
+}
@@ -1,27 +1,27 @@
 package order_matrix
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
 type ICore interface {
-	Insert(matrix *OrderMatrix) (err error)
-	Update(matrix *OrderMatrix) (err error)
-	Delete(matrix *OrderMatrix) (err error)
+	Insert(matrix *OrderMatrix, requestID string) (err error)
+	Update(matrix *OrderMatrix, requestID string) (err error)
+	Delete(matrix *OrderMatrix, requestID string) (err error)
 
 	Get(id int64, pid int64) (matrix OrderMatrix, err error)
 	GetDetails(id int64, pid int64) (matrix OrderMatrixDetail, err error)
 
 	MatrixChecker(matrix OrderMatrix) (value OrderMatrixChecker, err error)
+	MatrixValidator(matrix OrderMatrix) (value OrderMatrixValidator, err error)
+
+	Select(pid int64) (matrices OrderMatrices, err error)
 
 	SelectDetails(pid int64) (matrices OrderMatrixDetails, err error)
 	SelectVenueTypes(pid int64) (sumVenueTypes SummaryVenueTypes, err error)
@@ -33,13 +33,16 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "order_matrix"
+	cacheTTL       = 5 * time.Minute
+)
 
-func (c *core) Insert(matrix *OrderMatrix) (err error) {
+func (c *core) Insert(matrix *OrderMatrix, requestID string) (err error) {
 	matrix.CreatedAt = time.Now()
 	matrix.UpdatedAt = matrix.CreatedAt
 	matrix.Status = 1
@@ -79,35 +82,32 @@ func (c *core) Insert(matrix *OrderMatrix) (err error) {
 		matrix.ProjectID,
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_order_matrix",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    matrix.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	matrix.ID, err = res.LastInsertId()
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    matrix.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_order_matrix",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(matrix.ProjectID, 0)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, matrix.ProjectID))
 
 	return
 }
 
-func (c *core) Update(matrix *OrderMatrix) (err error) {
+func (c *core) Update(matrix *OrderMatrix, requestID string) (err error) {
 	matrix.UpdatedAt = time.Now()
 
 	query := `
@@ -143,34 +143,32 @@ func (c *core) Update(matrix *OrderMatrix) (err error) {
 		matrix.ProjectID,
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_order_matrix",
+		EntityID:   matrix.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    matrix.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    matrix.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_order_matrix",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(matrix.ProjectID, matrix.ID)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, matrix.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(matrix *OrderMatrix) (err error) {
+func (c *core) Delete(matrix *OrderMatrix, requestID string) (err error) {
 	query := `
 	UPDATE 
 		mla_order_matrix 
@@ -192,29 +190,27 @@ func (c *core) Delete(matrix *OrderMatrix) (err error) {
 		matrix.ProjectID,
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_order_matrix",
+		EntityID:   matrix.ID,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    matrix.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    matrix.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_order_matrix",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	c.clearRedis(matrix.ProjectID, matrix.ID)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, matrix.ProjectID))
 
 	return
 }
@@ -290,17 +286,93 @@ func (c *core) MatrixChecker(matrix OrderMatrix) (value OrderMatrixChecker, err
 	return
 }
 
-func (c *core) Get(id int64, pid int64) (matrix OrderMatrix, err error) {
-	redisKey := fmt.Sprintf("%s:%d:order-matrix:%d", redisPrefix, pid, id)
-
-	matrix, err = c.getMatrixFromCache(redisKey)
+func (c *core) MatrixValidator(matrix OrderMatrix) (value OrderMatrixValidator, err error) {
+	matrices, err := c.Select(matrix.ProjectID)
 	if err != nil {
-		matrix, err = c.getFromDB(id, pid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(matrix)
-			_ = c.setToCache(redisKey, 300, byt)
+		return
+	}
+
+	// narrow down the matrices one dimension at a time, so the first
+	// dimension that leaves nothing to match is the one reported back
+	dimensions := []struct {
+		name  string
+		match func(m OrderMatrix) bool
+	}{
+		{"venue type", func(m OrderMatrix) bool { return m.VenueTypeID == matrix.VenueTypeID }},
+		{"capacity", func(m OrderMatrix) bool { return isNullableEqual(m.Capacity, matrix.Capacity) }},
+		{"room", func(m OrderMatrix) bool { return isNullableEqual(m.RoomID, matrix.RoomID) }},
+		{"aging", func(m OrderMatrix) bool { return m.AgingID == matrix.AgingID }},
+		{"device", func(m OrderMatrix) bool { return m.DeviceID == matrix.DeviceID }},
+		{"product", func(m OrderMatrix) bool { return m.ProductID == matrix.ProductID }},
+		{"installation", func(m OrderMatrix) bool { return m.InstallationID == matrix.InstallationID }},
+	}
+
+	for _, dimension := range dimensions {
+		var matched OrderMatrices
+		for _, m := range matrices {
+			if dimension.match(m) {
+				matched = append(matched, m)
+			}
 		}
+		if len(matched) == 0 {
+			value.UnmatchedField = dimension.name
+			return
+		}
+		matrices = matched
+	}
+
+	value.IsValid = true
+	return
+}
+
+func isNullableEqual(a, b *int64) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
 	}
+	return *a == *b
+}
+
+func (c *core) Select(pid int64) (matrices OrderMatrices, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "order-matrices", cacheTTL, &matrices, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
+	return
+}
+
+func (c *core) selectFromDB(pid int64) (matrices OrderMatrices, err error) {
+	query := `
+		SELECT
+			id,
+			venue_type_id,
+			capacity,
+			aging_id,
+			device_id,
+			room_id,
+			product_id,
+			installation_id,
+			status,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_order_matrix
+		WHERE
+			project_id = ? AND
+			status = 1
+	`
+
+	err = c.db.Select(&matrices, query, pid)
+
+	return
+}
+
+func (c *core) Get(id int64, pid int64) (matrix OrderMatrix, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("order-matrix:%d", id), cacheTTL, &matrix, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
 	return
 }
 
@@ -335,16 +407,9 @@ func (c *core) getFromDB(id int64, pid int64) (matrix OrderMatrix, err error) {
 }
 
 func (c *core) GetDetails(id int64, pid int64) (matrix OrderMatrixDetail, err error) {
-	redisKey := fmt.Sprintf("%s:%d:order-matrix-details:%d", redisPrefix, pid, id)
-
-	matrix, err = c.getMatrixDetailFromCache(redisKey)
-	if err != nil {
-		matrix, err = c.getDetailsFromDB(id, pid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(matrix)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("order-matrix-details:%d", id), cacheTTL, &matrix, func() (interface{}, error) {
+		return c.getDetailsFromDB(id, pid)
+	})
 	return
 }
 
@@ -398,15 +463,9 @@ func (c *core) getDetailsFromDB(id int64, pid int64) (matrix OrderMatrixDetail,
 }
 
 func (c *core) SelectDetails(pid int64) (matrices OrderMatrixDetails, err error) {
-	redisKey := fmt.Sprintf("%s:%d:order-matrix-details", redisPrefix, pid)
-
-	matrices, err = c.selectMatrixDetailsFromCache()
-	if err != nil {
-		matrices, err = c.selectDetailsFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(matrices)
-		_ = c.setToCache(redisKey, 300, byt)
-
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "order-matrix-details", cacheTTL, &matrices, func() (interface{}, error) {
+		return c.selectDetailsFromDB(pid)
+	})
 	return
 }
 
@@ -459,15 +518,9 @@ func (c *core) selectDetailsFromDB(pid int64) (matrices OrderMatrixDetails, err
 }
 
 func (c *core) SelectVenueTypes(pid int64) (sumVenueTypes SummaryVenueTypes, err error) {
-	redisKey := fmt.Sprintf("%s:%d:order-matrix-venue-types", redisPrefix, pid)
-
-	sumVenueTypes, err = c.selectVenueTypesFromCache()
-	if err != nil {
-		sumVenueTypes, err = c.selectVenueTypesFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumVenueTypes)
-		_ = c.setToCache(redisKey, 300, byt)
-
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "order-matrix-venue-types", cacheTTL, &sumVenueTypes, func() (interface{}, error) {
+		return c.selectVenueTypesFromDB(pid)
+	})
 	return
 }
 
@@ -491,16 +544,18 @@ func (c *core) selectVenueTypesFromDB(pid int64) (sumVenueTypes SummaryVenueType
 	return
 }
 
-func (c *core) SelectCapacities(pid, venueTypeID int64) (sumCapacities SummaryCapacities, err error) {
-	redisKey := fmt.Sprintf("%s:%d:order-matrix-capacities", redisPrefix, pid)
-
-	sumCapacities, err = c.selectCapacitiesFromCache()
-	if err != nil {
-		sumCapacities, err = c.selectCapacitiesFromDB(pid, venueTypeID)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumCapacities)
-		_ = c.setToCache(redisKey, 300, byt)
-
+// capacityKey is the optional capacity filter in cache keys
+func capacityKey(capacity *int64) string {
+	if capacity == nil {
+		return "all"
 	}
+	return fmt.Sprint(*capacity)
+}
+
+func (c *core) SelectCapacities(pid, venueTypeID int64) (sumCapacities SummaryCapacities, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("order-matrix-capacities:%d", venueTypeID), cacheTTL, &sumCapacities, func() (interface{}, error) {
+		return c.selectCapacitiesFromDB(pid, venueTypeID)
+	})
 	return
 }
 
@@ -524,15 +579,9 @@ func (c *core) selectCapacitiesFromDB(pid, venueTypeID int64) (sumCapacities Sum
 }
 
 func (c *core) SelectAgings(pid, venueTypeID int64, capacity *int64) (sumAgings SummaryAgings, err error) {
-	redisKey := fmt.Sprintf("%s:%d:order-matrix-agings", redisPrefix, pid)
-
-	sumAgings, err = c.selectAgingsFromCache()
-	if err != nil {
-		sumAgings, err = c.selectAgingsFromDB(pid, venueTypeID, capacity)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumAgings)
-		_ = c.setToCache(redisKey, 300, byt)
-
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("order-matrix-agings:%d:%s", venueTypeID, capacityKey(capacity)), cacheTTL, &sumAgings, func() (interface{}, error) {
+		return c.selectAgingsFromDB(pid, venueTypeID, capacity)
+	})
 	return
 }
 
@@ -568,15 +617,9 @@ func (c *core) selectAgingsFromDB(pid, venueTypeID int64, capacity *int64) (sumA
 }
 
 func (c *core) SelectDevices(pid, venueTypeID int64, capacity *int64, agingID int64) (sumDevices SummaryDevices, err error) {
-	redisKey := fmt.Sprintf("%s:%d:order-matrix-devices", redisPrefix, pid)
-
-	sumDevices, err = c.selectDevicesFromCache()
-	if err != nil {
-		sumDevices, err = c.selectDevicesFromDB(pid, venueTypeID, capacity, agingID)
-		byt, _ := jsoniter.ConfigFastest.Marshal(sumDevices)
-		_ = c.setToCache(redisKey, 300, byt)
-
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("order-matrix-devices:%d:%s:%d", venueTypeID, capacityKey(capacity), agingID), cacheTTL, &sumDevices, func() (interface{}, error) {
+		return c.selectDevicesFromDB(pid, venueTypeID, capacity, agingID)
+	})
 	return
 }
 
@@ -612,113 +655,3 @@ func (c *core) selectDevicesFromDB(pid, venueTypeID int64, capacity *int64, agin
 
 	return
 }
-
-func (c *core) getMatrixFromCache(key string) (matrix OrderMatrix, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &matrix)
-	return
-}
-
-func (c *core) getMatrixDetailFromCache(key string) (matrix OrderMatrixDetail, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &matrix)
-	return
-}
-
-func (c *core) selectMatricesFromCache() (matrices OrderMatrices, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &matrices)
-	return
-}
-
-func (c *core) selectMatrixDetailsFromCache() (matrices OrderMatrixDetails, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &matrices)
-	return
-}
-
-func (c *core) selectVenueTypesFromCache() (sumVenueType SummaryVenueTypes, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &sumVenueType)
-	return
-}
-
-func (c *core) selectCapacitiesFromCache() (sumCapacities SummaryCapacities, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &sumCapacities)
-	return
-}
-
-func (c *core) selectAgingsFromCache() (sumAgings SummaryAgings, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &sumAgings)
-	return
-}
-
-func (c *core) selectDevicesFromCache() (sumDevices SummaryDevices, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET"))
-	err = json.Unmarshal(b, &sumDevices)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
-
-func (c *core) clearRedis(projectID, matrixID int64) {
-	redisKeys := []string{
-		fmt.Sprintf("%s:%d:order-matrix-details", redisPrefix, projectID),
-		fmt.Sprintf("%s:%d:order-matrix-venue-types", redisPrefix, projectID),
-		fmt.Sprintf("%s:%d:order-matrix-capacities", redisPrefix, projectID),
-		fmt.Sprintf("%s:%d:order-matrix-agings", redisPrefix, projectID),
-		fmt.Sprintf("%s:%d:order-matrix-devices", redisPrefix, projectID),
-	}
-
-	if matrixID != 0 {
-		redisKeys = append(redisKeys,
-			fmt.Sprintf("%s:%d:order-matrix:%d", redisPrefix, projectID, matrixID),
-			fmt.Sprintf("%s:%d:order-matrix-details:%d", redisPrefix, projectID, matrixID),
-		)
-	}
-
-	for _, redisKey := range redisKeys {
-		_ = c.deleteCache(redisKey)
-	}
-}
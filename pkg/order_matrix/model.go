@@ -58,6 +58,13 @@ type OrderMatrixChecker struct {
 	IsExists int16 `db:"is_exists"`
 }
 
+//OrderMatrixValidator is result of validating an order against order matrix,
+//UnmatchedField holds the first dimension that has no matching matrix
+type OrderMatrixValidator struct {
+	IsValid        bool
+	UnmatchedField string
+}
+
 type SummaryVenueType struct {
 	VenueTypeID   int64  `db:"venue_type_id"`
 	VenueTypeName string `db:"venue_type_name"`
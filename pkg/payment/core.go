@@ -2,61 +2,178 @@ package payment
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	neturl "net/url"
 	"time"
 )
 
 // ICore is the interface
 type ICore interface {
 	Pay(id string, paymentMethodID int64) (payment *Payment, err error)
+	GetStatus(id string) (status *PaymentStatus, err error)
+	Cancel(id string) (err error)
+	Refund(id string, amount float64, reason string) (refund *Refund, err error)
+	GetRefundStatus(refundID string) (refund *Refund, err error)
+	VerifyCallback(body []byte, signature string) (callback *Callback, err error)
 }
 
 // core contains db client
 type core struct {
 	apiBaseURL     string
+	callbackSecret string
 	tokenGenerator TokenGenerator
 }
 
+var (
+	// ErrInvalidSignature is returned when callback signature does not match its body
+	ErrInvalidSignature = errors.New("Invalid callback signature")
+	// ErrPaymentNotFound is returned when the gateway does not know the payment
+	ErrPaymentNotFound = errors.New("Payment not found")
+)
+
 var httpClient = http.Client{
 	Timeout: time.Second * 10,
 }
 
 // this is the example to create http request
 func (c *core) Pay(id string, paymentMethodID int64) (payment *Payment, err error) {
-	accessToken, err := c.tokenGenerator.GetAccessToken(10)
+	var url = c.apiBaseURL + "/api/v1/dopay_molanobar?app_id=molalivearena"
+
+	err = c.do("POST", url, map[string]interface{}{
+		"payment_method_id": paymentMethodID,
+		"id":                id,
+	}, &payment)
 	if err != nil {
 		return nil, err
 	}
 
-	body, err := json.Marshal(map[string]interface{}{
-		"payment_method_id": paymentMethodID,
-		"id":                id,
-	})
+	return payment, nil
+}
 
-	var url = c.apiBaseURL + "/api/v1/dopay_molanobar?app_id=molalivearena"
+// GetStatus asks the gateway for the payment status of id, the same id the order was paid with
+func (c *core) GetStatus(id string) (status *PaymentStatus, err error) {
+	var url = c.apiBaseURL + "/api/v1/status_molanobar?app_id=molalivearena&id=" + neturl.QueryEscape(id)
+
+	err = c.do("GET", url, nil, &status)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// Cancel cancels the unpaid payment of id at the gateway
+func (c *core) Cancel(id string) (err error) {
+	var url = c.apiBaseURL + "/api/v1/cancel_molanobar?app_id=molalivearena"
+
+	return c.do("POST", url, map[string]interface{}{
+		"id": id,
+	}, nil)
+}
+
+// Refund refunds amount of the paid payment of id, the amount may be less than paid
+func (c *core) Refund(id string, amount float64, reason string) (refund *Refund, err error) {
+	var url = c.apiBaseURL + "/api/v1/refund_molanobar?app_id=molalivearena"
+
+	err = c.do("POST", url, map[string]interface{}{
+		"id":     id,
+		"amount": amount,
+		"reason": reason,
+	}, &refund)
+	if err != nil {
+		return nil, err
+	}
+
+	return refund, nil
+}
+
+// GetRefundStatus asks the gateway for the status of refundID, the id it
+// answered the refund with
+func (c *core) GetRefundStatus(refundID string) (refund *Refund, err error) {
+	var url = c.apiBaseURL + "/api/v1/refund_status_molanobar?app_id=molalivearena&refund_id=" + neturl.QueryEscape(refundID)
 
-	request, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	err = c.do("GET", url, nil, &refund)
 	if err != nil {
 		return nil, err
 	}
+
+	return refund, nil
+}
+
+// do sends authorized request to the gateway and decodes the response into result
+func (c *core) do(method, url string, params interface{}, result interface{}) (err error) {
+	accessToken, err := c.tokenGenerator.GetAccessToken(10)
+	if err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if params != nil {
+		byt, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(byt)
+	}
+
+	request, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return err
+	}
 	request.Header.Add("Content-Type", "application/json")
 	request.Header.Add("Authorization", "Bearer "+accessToken)
 
 	response, err := httpClient.Do(request)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer response.Body.Close()
 
-	if response.StatusCode != 200 {
-		return nil, err
+	if response.StatusCode == http.StatusNotFound {
+		return ErrPaymentNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("payment gateway responded with status %d", response.StatusCode)
 	}
 
-	err = json.NewDecoder(response.Body).Decode(&payment)
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// VerifyCallback checks the signature of the gateway notification and decodes it
+func (c *core) VerifyCallback(body []byte, signature string) (callback *Callback, err error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || c.callbackSecret == "" {
+		return nil, ErrInvalidSignature
+	}
+	if !hmac.Equal(expected, sign(c.callbackSecret, body)) {
+		return nil, ErrInvalidSignature
+	}
+
+	err = json.Unmarshal(body, &callback)
 	if err != nil {
 		return nil, err
 	}
 
-	return payment, nil
+	return callback, nil
+}
+
+// Sign returns hex encoded HMAC-SHA256 of body, as sent by the gateway in SignatureHeader
+func Sign(secret string, body []byte) string {
+	return hex.EncodeToString(sign(secret, body))
+}
+
+func sign(secret string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return mac.Sum(nil)
 }
@@ -0,0 +1,261 @@
+package payment
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// FakeGateway is a local stand in for the payment gateway. It answers the
+// pay, status and cancel endpoints used by core and sends signed callbacks
+// to CallbackURL, so the payment flow can be exercised without the real gateway
+type FakeGateway struct {
+	Secret      string
+	CallbackURL string
+
+	mux      sync.Mutex
+	sequence int64
+	payments map[string]*PaymentStatus
+	refunds  map[string]*Refund
+}
+
+// NewFakeGateway returns fake gateway signing its callbacks with secret
+func NewFakeGateway(secret, callbackURL string) *FakeGateway {
+	return &FakeGateway{
+		Secret:      secret,
+		CallbackURL: callbackURL,
+		payments:    make(map[string]*PaymentStatus),
+		refunds:     make(map[string]*Refund),
+	}
+}
+
+// ServeHTTP serves POST /api/v1/dopay_molanobar, GET /api/v1/status_molanobar,
+// POST /api/v1/cancel_molanobar, POST /api/v1/refund_molanobar and
+// GET /api/v1/refund_status_molanobar like the gateway does, and
+// POST /notify?reference=&status=&amount= to send a callback for a paid
+// reference, amount being the total price and payment fee of the order.
+// POST /notify?reference=&status=&amount=&silent=1 only changes the status,
+// to simulate a callback that never arrived.
+// Refunds requested with reason pending stay pending until
+// POST /refund?refund_id=&status= sets their status
+func (g *FakeGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/dopay_molanobar":
+		var params struct {
+			ID              string `json:"id"`
+			PaymentMethodID int64  `json:"payment_method_id"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil || params.ID == "" {
+			http.Error(w, "invalid parameter", http.StatusBadRequest)
+			return
+		}
+
+		g.mux.Lock()
+		g.sequence++
+		g.payments[params.ID] = &PaymentStatus{
+			Reference:     params.ID,
+			TransactionID: fmt.Sprintf("FAKE-%d", g.sequence),
+			Status:        StatusPending,
+		}
+		g.mux.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(Payment{
+			ResponseType: "url",
+			PaymentData: PaymentAttributes{
+				URL: fmt.Sprintf("http://%s/pay/%s", r.Host, params.ID),
+			},
+		})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/status_molanobar":
+		status, ok := g.status(r.FormValue("id"))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(status)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/cancel_molanobar":
+		var params struct {
+			ID string `json:"id"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil || params.ID == "" {
+			http.Error(w, "invalid parameter", http.StatusBadRequest)
+			return
+		}
+
+		_, ok := g.setStatus(params.ID, StatusCancelled, 0)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v1/refund_molanobar":
+		var params struct {
+			ID     string  `json:"id"`
+			Amount float64 `json:"amount"`
+			Reason string  `json:"reason"`
+		}
+		err := json.NewDecoder(r.Body).Decode(&params)
+		if err != nil || params.ID == "" || params.Amount <= 0 {
+			http.Error(w, "invalid parameter", http.StatusBadRequest)
+			return
+		}
+
+		status, ok := g.status(params.ID)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if status.Status != StatusPaid {
+			http.Error(w, "payment is not paid", http.StatusBadRequest)
+			return
+		}
+
+		refund := Refund{
+			Status: RefundStatusCompleted,
+			Amount: params.Amount,
+		}
+		if params.Reason == RefundStatusPending {
+			refund.Status = RefundStatusPending
+		}
+
+		g.mux.Lock()
+		g.sequence++
+		refund.RefundID = fmt.Sprintf("FAKE-REFUND-%d", g.sequence)
+		g.refunds[refund.RefundID] = &refund
+		g.mux.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(refund)
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v1/refund_status_molanobar":
+		refund, ok := g.refund(r.FormValue("refund_id"), "")
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(refund)
+	case r.Method == http.MethodPost && r.URL.Path == "/refund":
+		_, ok := g.refund(r.FormValue("refund_id"), strings.ToLower(r.FormValue("status")))
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPost && r.URL.Path == "/notify":
+		var (
+			amount float64
+			err    error
+		)
+		if amountVal := r.FormValue("amount"); amountVal != "" {
+			amount, err = strconv.ParseFloat(amountVal, 64)
+			if err != nil {
+				http.Error(w, "invalid amount", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if r.FormValue("silent") != "" {
+			_, ok := g.setStatus(r.FormValue("reference"), strings.ToLower(r.FormValue("status")), amount)
+			if !ok {
+				err = fmt.Errorf("reference %s has not been paid", r.FormValue("reference"))
+			}
+		} else {
+			err = g.Notify(r.FormValue("reference"), r.FormValue("status"), amount)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Notify sets the status and amount paid of reference and sends signed
+// callback for it to CallbackURL
+func (g *FakeGateway) Notify(reference, status string, amount float64) error {
+	payment, ok := g.setStatus(reference, strings.ToLower(status), amount)
+	if !ok {
+		return fmt.Errorf("reference %s has not been paid", reference)
+	}
+
+	body, err := json.Marshal(Callback{
+		Reference:     payment.Reference,
+		TransactionID: payment.TransactionID,
+		Status:        payment.Status,
+		Amount:        payment.Amount,
+	})
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", g.CallbackURL, bytes.NewBuffer(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	request.Header.Add(SignatureHeader, Sign(g.Secret, body))
+
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("callback answered with status %d", response.StatusCode)
+	}
+	return nil
+}
+
+func (g *FakeGateway) status(reference string) (status PaymentStatus, ok bool) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	payment, ok := g.payments[reference]
+	if !ok {
+		return status, false
+	}
+	return *payment, true
+}
+
+// setStatus sets the status of reference, and its amount paid unless amount is 0
+func (g *FakeGateway) setStatus(reference, status string, amount float64) (payment PaymentStatus, ok bool) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	current, ok := g.payments[reference]
+	if !ok {
+		return payment, false
+	}
+	current.Status = status
+	if amount != 0 {
+		current.Amount = amount
+	}
+	return *current, true
+}
+
+// refund returns the refund of refundID, setting its status when status is given
+func (g *FakeGateway) refund(refundID, status string) (refund Refund, ok bool) {
+	g.mux.Lock()
+	defer g.mux.Unlock()
+
+	current, ok := g.refunds[refundID]
+	if !ok {
+		return refund, false
+	}
+	if status != "" {
+		current.Status = status
+	}
+	return *current, true
+}
@@ -4,10 +4,11 @@ type TokenGenerator interface {
 	GetAccessToken(pid int64) (string, error)
 }
 
-// Init is used to initialize room package
-func Init(apiBaseURL string, tokenGenerator TokenGenerator) ICore {
+// Init is used to initialize payment package
+func Init(apiBaseURL string, callbackSecret string, tokenGenerator TokenGenerator) ICore {
 	return &core{
 		apiBaseURL:     apiBaseURL,
+		callbackSecret: callbackSecret,
 		tokenGenerator: tokenGenerator,
 	}
 }
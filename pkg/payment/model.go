@@ -1,5 +1,7 @@
 package payment
 
+import "math"
+
 type Payment struct {
 	ResponseType    string            `json:"responseType"`
 	HTMLRedirection string            `json:"htmlRedirection"`
@@ -9,3 +11,53 @@ type Payment struct {
 type PaymentAttributes struct {
 	URL string `json:"url"`
 }
+
+// SignatureHeader is the header carrying the callback signature
+const SignatureHeader = "X-Signature"
+
+// Payment statuses sent by the gateway in callbacks and status responses
+const (
+	StatusPending   = "pending"
+	StatusPaid      = "paid"
+	StatusFailed    = "failed"
+	StatusExpired   = "expired"
+	StatusCancelled = "cancelled"
+)
+
+// Callback is asynchronous payment notification sent by the gateway,
+// Reference is the id the order was paid with
+type Callback struct {
+	Reference     string  `json:"reference"`
+	TransactionID string  `json:"transactionId"`
+	Status        string  `json:"status"`
+	Amount        float64 `json:"amount"`
+}
+
+// AmountMatches reports whether the gateway amount paid is the amount due,
+// compared in cents
+func AmountMatches(paid, due float64) bool {
+	return math.Round(paid*100) == math.Round(due*100)
+}
+
+// PaymentStatus is the gateway answer for status of a payment
+type PaymentStatus struct {
+	Reference     string  `json:"reference"`
+	TransactionID string  `json:"transactionId"`
+	Status        string  `json:"status"`
+	Amount        float64 `json:"amount"`
+}
+
+// Refund statuses returned by the gateway, a pending refund is completed
+// or failed by the gateway later
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusCompleted = "completed"
+	RefundStatusFailed    = "failed"
+)
+
+// Refund is the gateway answer for a refund request
+type Refund struct {
+	RefundID string  `json:"refundId"`
+	Status   string  `json:"status"`
+	Amount   float64 `json:"amount"`
+}
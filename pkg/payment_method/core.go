@@ -0,0 +1,326 @@
+package payment_method
+
+import (
+	"fmt"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
+)
+
+// ICore is the interface
+type ICore interface {
+	Insert(method *PaymentMethod, requestID string) (err error)
+	Update(method *PaymentMethod, requestID string) (err error)
+	Delete(method *PaymentMethod, requestID string) (err error)
+
+	Get(id int64, pid int64) (method PaymentMethod, err error)
+	Select(pid int64) (methods PaymentMethods, err error)
+	SelectAvailable(pid int64, amount float64) (methods PaymentMethods, err error)
+
+	Choose(pid, id int64, amount float64) (method PaymentMethod, fee float64, err error)
+}
+
+// core contains db client
+type core struct {
+	db              *sqlx.DB
+	cache           cache.ICore
+	defaultMethodID int64
+	auditTrail      auditTrail.ICore
+}
+
+const (
+	cacheNamespace = "payment_method"
+	cacheTTL       = 5 * time.Minute
+)
+
+func (c *core) Insert(method *PaymentMethod, requestID string) (err error) {
+	method.CreatedAt = time.Now()
+	method.UpdatedAt = method.CreatedAt
+	method.Status = 1
+
+	query := `
+	INSERT INTO mla_payment_methods (
+		name,
+		category,
+		gateway_method_id,
+		fixed_fee,
+		percentage_fee,
+		min_amount,
+		max_amount,
+		status,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		project_id
+	) VALUES (
+		?,?,?,?,?,?,?,?,?,?,?,?,?
+	)`
+
+	args := []interface{}{
+		method.Name,
+		method.Category,
+		method.GatewayMethodID,
+		method.FixedFee,
+		method.PercentageFee,
+		method.MinAmount,
+		method.MaxAmount,
+		method.Status,
+		method.CreatedAt,
+		method.CreatedBy,
+		method.UpdatedAt,
+		method.LastUpdateBy,
+		method.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_payment_methods",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    method.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	method.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, method.ProjectID))
+
+	return
+}
+
+func (c *core) Update(method *PaymentMethod, requestID string) (err error) {
+	method.UpdatedAt = time.Now()
+
+	query := `
+	UPDATE
+		mla_payment_methods
+	SET
+		name = ?,
+		category = ?,
+		gateway_method_id = ?,
+		fixed_fee = ?,
+		percentage_fee = ?,
+		min_amount = ?,
+		max_amount = ?,
+		updated_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		method.Name,
+		method.Category,
+		method.GatewayMethodID,
+		method.FixedFee,
+		method.PercentageFee,
+		method.MinAmount,
+		method.MaxAmount,
+		method.UpdatedAt,
+		method.LastUpdateBy,
+		method.ID,
+		method.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_payment_methods",
+		EntityID:   method.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    method.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, method.ProjectID))
+
+	return
+}
+
+func (c *core) Delete(method *PaymentMethod, requestID string) (err error) {
+	query := `
+	UPDATE
+		mla_payment_methods
+	SET
+		status = ?,
+		deleted_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		0,
+		time.Now(),
+		method.LastUpdateBy,
+		method.ID,
+		method.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_payment_methods",
+		EntityID:   method.ID,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    method.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, method.ProjectID))
+
+	return
+}
+
+func (c *core) Get(id int64, pid int64) (method PaymentMethod, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("payment-method:%d", id), cacheTTL, &method, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
+	return
+}
+
+func (c *core) getFromDB(id int64, pid int64) (method PaymentMethod, err error) {
+	query := `
+		SELECT
+			id,
+			name,
+			category,
+			gateway_method_id,
+			fixed_fee,
+			percentage_fee,
+			min_amount,
+			max_amount,
+			status,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_payment_methods
+		WHERE
+			id = ? AND
+			project_id = ? AND
+			status = 1
+	`
+
+	err = c.db.Get(&method, query, id, pid)
+
+	return
+}
+
+func (c *core) Select(pid int64) (methods PaymentMethods, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "payment-methods", cacheTTL, &methods, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
+	return
+}
+
+func (c *core) selectFromDB(pid int64) (methods PaymentMethods, err error) {
+	query := `
+		SELECT
+			id,
+			name,
+			category,
+			gateway_method_id,
+			fixed_fee,
+			percentage_fee,
+			min_amount,
+			max_amount,
+			status,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_payment_methods
+		WHERE
+			project_id = ? AND
+			status = 1
+		ORDER BY id
+	`
+
+	err = c.db.Select(&methods, query, pid)
+
+	return
+}
+
+// SelectAvailable returns the methods which can be used to pay amount
+func (c *core) SelectAvailable(pid int64, amount float64) (methods PaymentMethods, err error) {
+	all, err := c.Select(pid)
+	if err != nil {
+		return
+	}
+
+	for _, method := range all {
+		if method.IsAvailable(amount) {
+			methods = append(methods, method)
+		}
+	}
+	return
+}
+
+// Choose returns the method with id and its fee for paying amount. id 0 chooses
+// the default method. It returns sql.ErrNoRows when the method does not exist,
+// ErrMethodNotConfigured when id is 0 without a default method and
+// ErrMethodNotAvailable when it can not be used for amount
+func (c *core) Choose(pid, id int64, amount float64) (method PaymentMethod, fee float64, err error) {
+	if id == 0 {
+		id = c.defaultMethodID
+	}
+	if id == 0 {
+		return method, 0, ErrMethodNotConfigured
+	}
+
+	method, err = c.Get(id, pid)
+	if err != nil {
+		return method, 0, err
+	}
+	if !method.IsAvailable(amount) {
+		return method, 0, ErrMethodNotAvailable
+	}
+
+	return method, method.Fee(amount), nil
+}
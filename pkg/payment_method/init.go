@@ -0,0 +1,37 @@
+package payment_method
+
+import (
+	"context"
+	"log"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
+)
+
+// Init is used to initialize payment method package, defaultMethodID is
+// used for orders which do not choose a payment method
+func Init(db *sqlx.DB, cache cache.ICore, defaultMethodID int64, auditTrail auditTrail.ICore) ICore {
+	examineDBHealth(db)
+	return &core{
+		db:              db,
+		cache:           cache,
+		defaultMethodID: defaultMethodID,
+		auditTrail:      auditTrail,
+	}
+}
+
+func examineDBHealth(db *sqlx.DB) {
+	if db == nil {
+		log.Fatalf("Failed to initialize payment methods. db object cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize payment methods. cannot pinging to db. err: %s", err)
+	}
+}
@@ -0,0 +1,90 @@
+package payment_method
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// Categories of payment method
+const (
+	CategoryBankTransfer   = "bank_transfer"
+	CategoryVirtualAccount = "virtual_account"
+	CategoryEWallet        = "ewallet"
+	CategoryCreditCard     = "credit_card"
+)
+
+// PaymentMethod is model for mla_payment_methods in db.
+// GatewayMethodID is the id of the method at the payment gateway.
+// The method is available for orders with total price between MinAmount
+// and MaxAmount, MaxAmount 0 means there is no upper limit
+type PaymentMethod struct {
+	ID              int64     `db:"id"`
+	Name            string    `db:"name"`
+	Category        string    `db:"category"`
+	GatewayMethodID int64     `db:"gateway_method_id"`
+	FixedFee        float64   `db:"fixed_fee"`
+	PercentageFee   float64   `db:"percentage_fee"`
+	MinAmount       float64   `db:"min_amount"`
+	MaxAmount       float64   `db:"max_amount"`
+	Status          int16     `db:"status"`
+	CreatedAt       time.Time `db:"created_at"`
+	CreatedBy       string    `db:"created_by"`
+	UpdatedAt       time.Time `db:"updated_at"`
+	LastUpdateBy    string    `db:"last_update_by"`
+	DeletedAt       null.Time `db:"deleted_at"`
+	ProjectID       int64     `db:"project_id"`
+}
+
+// PaymentMethods is list of payment method
+type PaymentMethods []PaymentMethod
+
+// Errors returned when a payment method is not valid or not available
+var (
+	ErrInvalidCategory     = errors.New("Category must be bank_transfer, virtual_account, ewallet or credit_card")
+	ErrInvalidFee          = errors.New("Fee can not be negative and percentage fee can not exceed 100")
+	ErrInvalidAmountRange  = errors.New("Max amount must be greater than min amount")
+	ErrInvalidGatewayID    = errors.New("Gateway method id is required")
+	ErrMethodNotAvailable  = errors.New("Payment method is not available for the order amount")
+	ErrMethodNotConfigured = errors.New("Payment method is not chosen and no default is configured")
+)
+
+// Validate checks the payment method is complete
+func (method PaymentMethod) Validate() error {
+	switch method.Category {
+	case CategoryBankTransfer, CategoryVirtualAccount, CategoryEWallet, CategoryCreditCard:
+	default:
+		return ErrInvalidCategory
+	}
+	if method.GatewayMethodID == 0 {
+		return ErrInvalidGatewayID
+	}
+	if method.FixedFee < 0 || method.PercentageFee < 0 || method.PercentageFee > 100 {
+		return ErrInvalidFee
+	}
+	if method.MinAmount < 0 || (method.MaxAmount != 0 && method.MaxAmount < method.MinAmount) {
+		return ErrInvalidAmountRange
+	}
+	return nil
+}
+
+// IsAvailable reports whether the method can be used to pay amount
+func (method PaymentMethod) IsAvailable(amount float64) bool {
+	if method.Status != 1 {
+		return false
+	}
+	if amount < method.MinAmount {
+		return false
+	}
+	if method.MaxAmount != 0 && amount > method.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// Fee returns the fee charged for paying amount, rounded up to whole rupiah
+func (method PaymentMethod) Fee(amount float64) float64 {
+	return math.Ceil(method.FixedFee + amount*method.PercentageFee/100)
+}
@@ -0,0 +1,406 @@
+package pricing
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
+)
+
+// ICore is the interface
+type ICore interface {
+	Insert(rule *PricingRule, requestID string) (err error)
+	Update(rule *PricingRule, requestID string) (err error)
+	Delete(rule *PricingRule, requestID string) (err error)
+
+	Get(id int64, pid int64) (rule PricingRule, err error)
+	Select(pid int64) (rules PricingRules, err error)
+	SelectByVenueType(pid, venueTypeID, pricingGroupID int64) (rules PricingRules, err error)
+
+	Calculate(pid, venueTypeID, pricingGroupID int64, orderType string, items Items) (breakdown Breakdown, err error)
+}
+
+// core contains db client
+type core struct {
+	db         *sqlx.DB
+	cache      cache.ICore
+	auditTrail auditTrail.ICore
+}
+
+const (
+	cacheNamespace = "pricing"
+	cacheTTL       = 5 * time.Minute
+)
+
+func (c *core) Insert(rule *PricingRule, requestID string) (err error) {
+	rule.CreatedAt = time.Now()
+	rule.UpdatedAt = rule.CreatedAt
+	rule.Status = 1
+
+	query := `
+	INSERT INTO mla_pricing_rules (
+		name,
+		venue_type_id,
+		pricing_group_id,
+		item_type,
+		order_type,
+		rule_type,
+		price,
+		occupancy_factor,
+		tiers,
+		status,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		project_id
+	) VALUES (
+		?,?,?,?,?,?,?,?,?,?,?,?,?,?,?
+	)`
+
+	args := []interface{}{
+		rule.Name,
+		rule.VenueTypeID,
+		rule.PricingGroupID,
+		rule.ItemType,
+		rule.OrderType,
+		rule.RuleType,
+		rule.Price,
+		rule.OccupancyFactor,
+		rule.Tiers,
+		rule.Status,
+		rule.CreatedAt,
+		rule.CreatedBy,
+		rule.UpdatedAt,
+		rule.LastUpdateBy,
+		rule.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_pricing_rules",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    rule.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	rule.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, rule.ProjectID))
+
+	return
+}
+
+func (c *core) Update(rule *PricingRule, requestID string) (err error) {
+	rule.UpdatedAt = time.Now()
+
+	query := `
+	UPDATE
+		mla_pricing_rules
+	SET
+		name = ?,
+		venue_type_id = ?,
+		pricing_group_id = ?,
+		item_type = ?,
+		order_type = ?,
+		rule_type = ?,
+		price = ?,
+		occupancy_factor = ?,
+		tiers = ?,
+		updated_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		rule.Name,
+		rule.VenueTypeID,
+		rule.PricingGroupID,
+		rule.ItemType,
+		rule.OrderType,
+		rule.RuleType,
+		rule.Price,
+		rule.OccupancyFactor,
+		rule.Tiers,
+		rule.UpdatedAt,
+		rule.LastUpdateBy,
+		rule.ID,
+		rule.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_pricing_rules",
+		EntityID:   rule.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    rule.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, rule.ProjectID))
+
+	return
+}
+
+func (c *core) Delete(rule *PricingRule, requestID string) (err error) {
+	query := `
+	UPDATE
+		mla_pricing_rules
+	SET
+		status = ?,
+		deleted_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		0,
+		time.Now(),
+		rule.LastUpdateBy,
+		rule.ID,
+		rule.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_pricing_rules",
+		EntityID:   rule.ID,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    rule.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, rule.ProjectID))
+
+	return
+}
+
+func (c *core) Get(id int64, pid int64) (rule PricingRule, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("pricing-rule:%d", id), cacheTTL, &rule, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
+	return
+}
+
+func (c *core) getFromDB(id int64, pid int64) (rule PricingRule, err error) {
+	query := `
+		SELECT
+			id,
+			name,
+			venue_type_id,
+			pricing_group_id,
+			item_type,
+			order_type,
+			rule_type,
+			price,
+			occupancy_factor,
+			tiers,
+			status,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_pricing_rules
+		WHERE
+			id = ? AND
+			project_id = ? AND
+			status = 1
+	`
+
+	err = c.db.Get(&rule, query, id, pid)
+
+	return
+}
+
+func (c *core) Select(pid int64) (rules PricingRules, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "pricing-rules", cacheTTL, &rules, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
+	return
+}
+
+func (c *core) selectFromDB(pid int64) (rules PricingRules, err error) {
+	query := `
+		SELECT
+			id,
+			name,
+			venue_type_id,
+			pricing_group_id,
+			item_type,
+			order_type,
+			rule_type,
+			price,
+			occupancy_factor,
+			tiers,
+			status,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_pricing_rules
+		WHERE
+			project_id = ? AND
+			status = 1
+		ORDER BY id
+	`
+
+	err = c.db.Select(&rules, query, pid)
+
+	return
+}
+
+// SelectByVenueType returns the rules of the venue type, falling back to the
+// rules of its pricing group when the venue type has none of its own
+func (c *core) SelectByVenueType(pid, venueTypeID, pricingGroupID int64) (rules PricingRules, err error) {
+	all, err := c.Select(pid)
+	if err != nil {
+		return
+	}
+
+	var groupRules PricingRules
+	for _, rule := range all {
+		if rule.VenueTypeID != nil && *rule.VenueTypeID == venueTypeID {
+			rules = append(rules, rule)
+		} else if rule.PricingGroupID != nil && *rule.PricingGroupID == pricingGroupID {
+			groupRules = append(groupRules, rule)
+		}
+	}
+
+	if len(rules) == 0 {
+		rules = groupRules
+	}
+	return
+}
+
+// Calculate prices the items of an order of orderType. Rules for the order type
+// take precedence over rules without order type. Every item type needs a rule,
+// otherwise ErrRuleNotFound is returned
+func (c *core) Calculate(pid, venueTypeID, pricingGroupID int64, orderType string, items Items) (breakdown Breakdown, err error) {
+	rules, err := c.SelectByVenueType(pid, venueTypeID, pricingGroupID)
+	if err != nil {
+		return
+	}
+	if len(rules) == 0 {
+		err = ErrRuleNotFound
+		return
+	}
+
+	for _, item := range items {
+		line := Line{
+			ItemType:    item.ItemType,
+			ItemID:      item.ItemID,
+			Description: item.Description,
+			Quantity:    item.Quantity,
+		}
+
+		// an item type without rule would be priced free
+		rule, ok := findRule(rules, item.ItemType, orderType)
+		if !ok {
+			return Breakdown{}, ErrRuleNotFound
+		}
+		line.RuleID = rule.ID
+		line.RuleType = rule.RuleType
+		line.UnitPrice, line.Amount = applyRule(rule, item)
+
+		breakdown.TotalPrice += line.Amount
+		breakdown.Lines = append(breakdown.Lines, line)
+	}
+
+	return
+}
+
+// findRule returns the rule of the item type for the order type, falling back
+// to the rule without order type
+func findRule(rules PricingRules, itemType, orderType string) (rule PricingRule, ok bool) {
+	for _, rule = range rules {
+		if rule.ItemType == itemType && rule.OrderType != "" && rule.OrderType == orderType {
+			return rule, true
+		}
+	}
+	for _, rule = range rules {
+		if rule.ItemType == itemType && rule.OrderType == "" {
+			return rule, true
+		}
+	}
+	return PricingRule{}, false
+}
+
+// applyRule returns unit price and amount charged by the rule for the item
+func applyRule(rule PricingRule, item Item) (unitPrice, amount float64) {
+	unitPrice = item.Price
+	if rule.Price.Valid {
+		unitPrice = rule.Price.Float64
+	}
+
+	switch rule.RuleType {
+	case RuleTypeFlat:
+		amount = unitPrice
+	case RuleTypePerRoom:
+		amount = math.Ceil(float64(item.Quantity)*rule.OccupancyFactor) * unitPrice
+	case RuleTypeTiered:
+		for _, tier := range rule.Tiers {
+			upper := item.Quantity
+			if tier.MaxQuantity != 0 && tier.MaxQuantity < upper {
+				upper = tier.MaxQuantity
+			}
+			if upper >= tier.MinQuantity {
+				amount += float64(upper-tier.MinQuantity+1) * tier.UnitPrice
+			}
+		}
+		unitPrice = 0
+		if item.Quantity != 0 {
+			unitPrice = amount / float64(item.Quantity)
+		}
+	}
+	return
+}
@@ -0,0 +1,35 @@
+package pricing
+
+import (
+	"context"
+	"log"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
+)
+
+// Init is used to initialize pricing package
+func Init(db *sqlx.DB, cache cache.ICore, auditTrail auditTrail.ICore) ICore {
+	examineDBHealth(db)
+	return &core{
+		db:         db,
+		cache:      cache,
+		auditTrail: auditTrail,
+	}
+}
+
+func examineDBHealth(db *sqlx.DB) {
+	if db == nil {
+		log.Fatalf("Failed to initialize pricing. db object cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize pricing. cannot pinging to db. err: %s", err)
+	}
+}
@@ -0,0 +1,177 @@
+package pricing
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Rule types supported by the pricing engine
+const (
+	RuleTypeFlat    = "flat"
+	RuleTypePerRoom = "per_room"
+	RuleTypeTiered  = "tiered"
+)
+
+// PricingRule is model for mla_pricing_rules in db.
+// A rule belongs either to a venue type or to a pricing group, rules of a
+// venue type take precedence over the rules of its pricing group.
+// OrderType limits the rule to new or renewal orders, a rule without order
+// type applies to every order
+type PricingRule struct {
+	ID              int64      `db:"id"`
+	Name            string     `db:"name"`
+	VenueTypeID     *int64     `db:"venue_type_id"`
+	PricingGroupID  *int64     `db:"pricing_group_id"`
+	ItemType        string     `db:"item_type"`
+	OrderType       string     `db:"order_type"`
+	RuleType        string     `db:"rule_type"`
+	Price           null.Float `db:"price"`
+	OccupancyFactor float64    `db:"occupancy_factor"`
+	Tiers           Tiers      `db:"tiers"`
+	Status          int16      `db:"status"`
+	CreatedAt       time.Time  `db:"created_at"`
+	CreatedBy       string     `db:"created_by"`
+	UpdatedAt       time.Time  `db:"updated_at"`
+	LastUpdateBy    string     `db:"last_update_by"`
+	DeletedAt       null.Time  `db:"deleted_at"`
+	ProjectID       int64      `db:"project_id"`
+}
+
+// PricingRules is list of pricing rule
+type PricingRules []PricingRule
+
+// Tier is a quantity range of tiered rule, every unit inside the range is
+// charged UnitPrice. MaxQuantity 0 means the range has no upper bound
+type Tier struct {
+	MinQuantity int64   `json:"minQuantity"`
+	MaxQuantity int64   `json:"maxQuantity"`
+	UnitPrice   float64 `json:"unitPrice"`
+}
+
+// Tiers is list of tier, stored as json in db
+type Tiers []Tier
+
+// Scan implements sql.Scanner
+func (t *Tiers) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, t)
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	}
+	return fmt.Errorf("unsupported type for tiers: %T", src)
+}
+
+// Value implements driver.Valuer
+func (t Tiers) Value() (driver.Value, error) {
+	if len(t) == 0 {
+		return nil, nil
+	}
+	byt, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return string(byt), nil
+}
+
+// Errors returned when a pricing rule is not valid
+var (
+	ErrRuleNotFound        = errors.New("Pricing rule is not found")
+	ErrInvalidRuleType     = errors.New("Rule type must be flat, per_room or tiered")
+	ErrInvalidRuleOwner    = errors.New("Rule must belong to either a venue type or a pricing group")
+	ErrInvalidOccupancy    = errors.New("Per room rule must have occupancy factor greater than zero")
+	ErrInvalidTiers        = errors.New("Tiered rule must have ordered, non overlapping tiers")
+	ErrInvalidRuleItemType = errors.New("Rule item type is required")
+	ErrInvalidOrderType    = errors.New("Rule order type must be empty, new or renewal")
+)
+
+// Validate checks the rule is complete for its rule type
+func (rule PricingRule) Validate() error {
+	if rule.ItemType == "" {
+		return ErrInvalidRuleItemType
+	}
+	if (rule.VenueTypeID == nil) == (rule.PricingGroupID == nil) {
+		return ErrInvalidRuleOwner
+	}
+	if rule.OrderType != "" && rule.OrderType != order.OrderTypeNew && rule.OrderType != order.OrderTypeRenewal {
+		return ErrInvalidOrderType
+	}
+
+	switch rule.RuleType {
+	case RuleTypeFlat:
+	case RuleTypePerRoom:
+		if rule.OccupancyFactor <= 0 {
+			return ErrInvalidOccupancy
+		}
+	case RuleTypeTiered:
+		if len(rule.Tiers) == 0 {
+			return ErrInvalidTiers
+		}
+		var last int64
+		for i, tier := range rule.Tiers {
+			if tier.MinQuantity <= last {
+				return ErrInvalidTiers
+			}
+			if tier.MaxQuantity != 0 && tier.MaxQuantity < tier.MinQuantity {
+				return ErrInvalidTiers
+			}
+			if tier.MaxQuantity == 0 && i != len(rule.Tiers)-1 {
+				return ErrInvalidTiers
+			}
+			last = tier.MaxQuantity
+		}
+	default:
+		return ErrInvalidRuleType
+	}
+	return nil
+}
+
+// Item is a catalogue item to be priced, e.g. the product or room of an order
+type Item struct {
+	ItemType    string
+	ItemID      int64
+	Description string
+	Price       float64
+	Quantity    int64
+}
+
+// Items is list of item
+type Items []Item
+
+// Line is a priced item, RuleID is 0 when no rule charges the item.
+// TaxRateID is 0 when the line is not taxed, otherwise TaxBase (DPP) and
+// TaxAmount (PPN) are the split of Amount by the rate
+type Line struct {
+	ItemType    string
+	ItemID      int64
+	Description string
+	RuleID      int64
+	RuleType    string
+	UnitPrice   float64
+	Quantity    int64
+	Amount      float64
+	TaxRateID   int64
+	TaxRate     float64
+	TaxBase     float64
+	TaxAmount   float64
+}
+
+// Lines is list of line
+type Lines []Line
+
+// Breakdown is itemized price of an order, TotalPrice includes the tax
+type Breakdown struct {
+	TotalPrice float64
+	TaxBase    float64
+	TaxAmount  float64
+	Lines      Lines
+}
@@ -1,15 +1,12 @@
 package product
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
@@ -18,31 +15,30 @@ type ICore interface {
 	Select(pid int64) (products Products, err error)
 	SelectByIDs(ids []int64, pid int64, limit int) (product Product, err error)
 	Get(pid int64, id int64) (product Product, err error)
-	Insert(product *Product) (err error)
-	Update(product *Product, venueTypeID int64, isAdmin bool) (err error)
-	Delete(pid int64, id int64, venueTypeID int64, isAdmin bool, userID string) (err error)
+	Insert(product *Product, requestID string) (err error)
+	Update(product *Product, venueTypeID int64, isAdmin bool, requestID string) (err error)
+	Delete(pid int64, id int64, venueTypeID int64, isAdmin bool, userID string, requestID string) (err error)
 }
 
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "product"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) SelectByVenueType(pid int64, venue_type int64) (products Products, err error) {
 	if venue_type == 0 {
 		return nil, nil
 	}
-	redisKey := fmt.Sprintf("%s:products-venuetype:%d", redisPrefix, venue_type)
-	products, err = c.getFromCacheByVenue(redisKey)
-	if err != nil {
-		products, err = c.selectByVenueTypeFromDB(pid, venue_type)
-		byt, _ := jsoniter.ConfigFastest.Marshal(products)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("products-venuetype:%d", venue_type), cacheTTL, &products, func() (interface{}, error) {
+		return c.selectByVenueTypeFromDB(pid, venue_type)
+	})
 	return
 }
 
@@ -76,27 +72,16 @@ func (c *core) selectByVenueTypeFromDB(pid int64, venue_type int64) (products Pr
 }
 
 func (c *core) Select(pid int64) (products Products, err error) {
-	redisKey := fmt.Sprintf("%s:products", redisPrefix)
-	products, err = c.selectFromCache(redisKey)
-	if err != nil {
-		products, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(products)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "products", cacheTTL, &products, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
 func (c *core) Get(pid int64, id int64) (product Product, err error) {
-	redisKey := fmt.Sprintf("%s:%d:products:%d", redisPrefix, pid, id)
-
-	product, err = c.getFromCache(redisKey)
-	if err != nil {
-		product, err = c.getFromDB(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(product)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("products:%d", id), cacheTTL, &product, func() (interface{}, error) {
+		return c.getFromDB(pid, id)
+	})
 	return
 }
 
@@ -194,7 +179,7 @@ func (c *core) getFromDB(pid int64, id int64) (product Product, err error) {
 	return
 }
 
-func (c *core) Insert(product *Product) (err error) {
+func (c *core) Insert(product *Product, requestID string) (err error) {
 	product.CreatedAt = time.Now()
 	product.UpdatedAt = product.CreatedAt
 	product.Status = 1
@@ -251,13 +236,17 @@ func (c *core) Insert(product *Product) (err error) {
 		product.CreatedBy,
 		product.LastUpdateBy,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_productlist",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    product.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -265,28 +254,17 @@ func (c *core) Insert(product *Product) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    product.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_productlist",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:products", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:products-venuetype:%d", redisPrefix, product.VenueTypeID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, product.ProjectID))
 
 	return
 }
 
-func (c *core) Update(product *Product, venueTypeID int64, isAdmin bool) (err error) {
+func (c *core) Update(product *Product, venueTypeID int64, isAdmin bool, requestID string) (err error) {
 	product.UpdatedAt = time.Now()
 	product.Status = 1
 
@@ -330,41 +308,32 @@ func (c *core) Update(product *Product, venueTypeID int64, isAdmin bool) (err er
 		args = append(args, product.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_productlist",
+		EntityID:   product.ProductID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    product.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    product.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_productlist",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:products:%d", redisPrefix, product.ProjectID, product.ProductID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:products", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:products-venuetype:%d", redisPrefix, venueTypeID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, product.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(pid int64, id int64, venueTypeID int64, isAdmin bool, userID string) (err error) {
+func (c *core) Delete(pid int64, id int64, venueTypeID int64, isAdmin bool, userID string, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -386,7 +355,6 @@ func (c *core) Delete(pid int64, id int64, venueTypeID int64, isAdmin bool, user
 		args = append(args, userID)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 
 	if err != nil {
@@ -394,77 +362,25 @@ func (c *core) Delete(pid int64, id int64, venueTypeID int64, isAdmin bool, user
 	}
 
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_productlist",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    userID,
+		RequestID:  requestID,
+	}, query, args...)
 
 	if err != nil {
 		return err
 	}
 
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    "uid",
-		Query:     queryTrail,
-		TableName: "mla_productlist",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:products:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:products", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:products-venuetype:%d", redisPrefix, venueTypeID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 
 	return
 }
-
-func (c *core) selectFromCache(redisKey string) (products Products, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", redisKey))
-	err = json.Unmarshal(b, &products)
-	return
-}
-
-func (c *core) getFromCache(key string) (product Product, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &product)
-	return
-}
-
-func (c *core) getFromCacheByVenue(key string) (products Products, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &products)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
@@ -0,0 +1,490 @@
+package promotion
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"github.com/jmoiron/sqlx"
+)
+
+// ICore is the interface
+type ICore interface {
+	Insert(promotion *Promotion, requestID string) (err error)
+	Update(promotion *Promotion, requestID string) (err error)
+	Delete(promotion *Promotion, requestID string) (err error)
+
+	Get(id int64, pid int64) (promotion Promotion, err error)
+	GetByCode(pid int64, code string) (promotion Promotion, err error)
+	Select(pid int64) (promotions Promotions, err error)
+
+	Count(pid, promotionID int64, buyerID string, excludeOrderID int64) (count Count, err error)
+	Redeem(pid, orderID int64, buyerID string, usages Usages) (err error)
+	Report(pid int64, from, to time.Time) (reports CampaignReports, err error)
+}
+
+// core contains db client
+type core struct {
+	db         *sqlx.DB
+	cache      cache.ICore
+	auditTrail auditTrail.ICore
+}
+
+const (
+	cacheNamespace = "promotion"
+	cacheTTL       = 5 * time.Minute
+)
+
+// liveOrder is the condition on mla_orders o for orders whose usages count
+// against the limits, usages of orders that are deleted, cancelled, expired
+// or refunded are given back
+var liveOrder = fmt.Sprintf(
+	"o.deleted_at IS NULL AND o.status NOT IN (%d, %d, %d)",
+	order.StatusCancelled, order.StatusExpired, order.StatusRefunded,
+)
+
+func (c *core) Insert(promotion *Promotion, requestID string) (err error) {
+	promotion.CreatedAt = time.Now()
+	promotion.UpdatedAt = promotion.CreatedAt
+	promotion.Status = 1
+
+	query := `
+	INSERT INTO mla_promotions (
+		name,
+		campaign,
+		code,
+		discount_type,
+		discount_value,
+		max_discount,
+		item_type,
+		order_type,
+		venue_type_ids,
+		commercial_type_ids,
+		cities,
+		product_ids,
+		usage_limit,
+		per_buyer_limit,
+		start_at,
+		end_at,
+		status,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		project_id
+	) VALUES (
+		?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?
+	)`
+
+	args := []interface{}{
+		promotion.Name,
+		promotion.Campaign,
+		promotion.Code,
+		promotion.DiscountType,
+		promotion.DiscountValue,
+		promotion.MaxDiscount,
+		promotion.ItemType,
+		promotion.OrderType,
+		promotion.VenueTypeIDs,
+		promotion.CommercialTypeIDs,
+		promotion.Cities,
+		promotion.ProductIDs,
+		promotion.UsageLimit,
+		promotion.PerBuyerLimit,
+		promotion.StartAt,
+		promotion.EndAt,
+		promotion.Status,
+		promotion.CreatedAt,
+		promotion.CreatedBy,
+		promotion.UpdatedAt,
+		promotion.LastUpdateBy,
+		promotion.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_promotions",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    promotion.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	promotion.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, promotion.ProjectID))
+	return
+}
+
+func (c *core) Update(promotion *Promotion, requestID string) (err error) {
+	promotion.UpdatedAt = time.Now()
+
+	query := `
+	UPDATE
+		mla_promotions
+	SET
+		name = ?,
+		campaign = ?,
+		code = ?,
+		discount_type = ?,
+		discount_value = ?,
+		max_discount = ?,
+		item_type = ?,
+		order_type = ?,
+		venue_type_ids = ?,
+		commercial_type_ids = ?,
+		cities = ?,
+		product_ids = ?,
+		usage_limit = ?,
+		per_buyer_limit = ?,
+		start_at = ?,
+		end_at = ?,
+		updated_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		promotion.Name,
+		promotion.Campaign,
+		promotion.Code,
+		promotion.DiscountType,
+		promotion.DiscountValue,
+		promotion.MaxDiscount,
+		promotion.ItemType,
+		promotion.OrderType,
+		promotion.VenueTypeIDs,
+		promotion.CommercialTypeIDs,
+		promotion.Cities,
+		promotion.ProductIDs,
+		promotion.UsageLimit,
+		promotion.PerBuyerLimit,
+		promotion.StartAt,
+		promotion.EndAt,
+		promotion.UpdatedAt,
+		promotion.LastUpdateBy,
+		promotion.ID,
+		promotion.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_promotions",
+		EntityID:   promotion.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    promotion.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, promotion.ProjectID))
+	return
+}
+
+func (c *core) Delete(promotion *Promotion, requestID string) (err error) {
+	query := `
+	UPDATE
+		mla_promotions
+	SET
+		status = ?,
+		deleted_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		0,
+		time.Now(),
+		promotion.LastUpdateBy,
+		promotion.ID,
+		promotion.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_promotions",
+		EntityID:   promotion.ID,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    promotion.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, promotion.ProjectID))
+	return
+}
+
+const selectPromotion = `
+	SELECT
+		id,
+		name,
+		campaign,
+		code,
+		discount_type,
+		discount_value,
+		max_discount,
+		item_type,
+		order_type,
+		venue_type_ids,
+		commercial_type_ids,
+		cities,
+		product_ids,
+		usage_limit,
+		per_buyer_limit,
+		start_at,
+		end_at,
+		status,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		deleted_at,
+		project_id
+	FROM
+		mla_promotions
+`
+
+func (c *core) Get(id int64, pid int64) (promotion Promotion, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("promotion:%d", id), cacheTTL, &promotion, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
+	return
+}
+
+func (c *core) getFromDB(id int64, pid int64) (promotion Promotion, err error) {
+	query := selectPromotion + `
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+	err = c.db.Get(&promotion, query, id, pid)
+	return
+}
+
+// GetByCode returns the promotion of a voucher code, sql.ErrNoRows when no
+// live promotion has the code
+func (c *core) GetByCode(pid int64, code string) (promotion Promotion, err error) {
+	promotions, err := c.Select(pid)
+	if err != nil {
+		return
+	}
+
+	code = NormalizeCode(code)
+	for _, p := range promotions {
+		if p.Code.Valid && p.Code.String == code {
+			return p, nil
+		}
+	}
+	return promotion, sql.ErrNoRows
+}
+
+// Select returns every live promotion, including those outside their window
+func (c *core) Select(pid int64) (promotions Promotions, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "promotions", cacheTTL, &promotions, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
+	return
+}
+
+func (c *core) selectFromDB(pid int64) (promotions Promotions, err error) {
+	query := selectPromotion + `
+	WHERE
+		project_id = ? AND
+		status = 1
+	ORDER BY
+		id
+	`
+	err = c.db.Select(&promotions, query, pid)
+	return
+}
+
+// Count returns on how many live orders the promotion is used, usages of
+// excludeOrderID are left out so an order priced again does not count itself
+func (c *core) Count(pid, promotionID int64, buyerID string, excludeOrderID int64) (count Count, err error) {
+	err = c.db.Get(&count, countUsages, buyerID, promotionID, pid, excludeOrderID)
+	return
+}
+
+var countUsages = `
+	SELECT
+		COUNT(DISTINCT u.order_id) AS total,
+		COUNT(DISTINCT CASE WHEN u.buyer_id = ? THEN u.order_id END) AS by_buyer
+	FROM
+		mla_promotion_usages u
+		JOIN mla_orders o ON o.order_id = u.order_id
+	WHERE
+		u.promotion_id = ? AND
+		u.project_id = ? AND
+		u.order_id <> ? AND
+		` + liveOrder
+
+// Redeem replaces the usages recorded for the order with usages. Each
+// promotion is locked while its limits are checked so concurrent orders
+// cannot both take its last use, ErrUsageLimit is returned when one of them
+// is used up and nothing is recorded
+func (c *core) Redeem(pid, orderID int64, buyerID string, usages Usages) (err error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM mla_promotion_usages WHERE order_id = ? AND project_id = ?`, orderID, pid)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, usage := range usages {
+		var promotion Promotion
+		err = tx.Get(&promotion, `
+			SELECT
+				id,
+				usage_limit,
+				per_buyer_limit
+			FROM
+				mla_promotions
+			WHERE
+				id = ? AND
+				project_id = ?
+			FOR UPDATE
+		`, usage.PromotionID, pid)
+		if err == sql.ErrNoRows {
+			return ErrPromotionNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		var count Count
+		err = tx.Get(&count, countUsages, buyerID, usage.PromotionID, pid, orderID)
+		if err != nil {
+			return err
+		}
+		if !promotion.Allows(count) {
+			return ErrUsageLimit
+		}
+
+		_, err = tx.Exec(`
+			INSERT INTO mla_promotion_usages (
+				promotion_id,
+				order_id,
+				buyer_id,
+				amount,
+				created_at,
+				project_id
+			) VALUES (
+				?,?,?,?,?,?
+			)`,
+			usage.PromotionID,
+			orderID,
+			buyerID,
+			usage.Amount,
+			now,
+			pid,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Report sums the usages recorded between from and to per campaign, paid
+// figures only count orders that are paid
+func (c *core) Report(pid int64, from, to time.Time) (reports CampaignReports, err error) {
+	query := `
+	SELECT
+		p.campaign,
+		COUNT(DISTINCT u.promotion_id) AS promotions,
+		COUNT(DISTINCT u.order_id) AS orders,
+		COALESCE(SUM(u.amount), 0) AS discount,
+		COUNT(DISTINCT CASE WHEN o.status = ? THEN u.order_id END) AS paid_orders,
+		COALESCE(SUM(CASE WHEN o.status = ? THEN u.amount END), 0) AS paid_discount,
+		COALESCE((
+			SELECT
+				SUM(po.total_price)
+			FROM
+				mla_orders po
+			WHERE
+				po.status = ? AND
+				po.deleted_at IS NULL AND
+				po.order_id IN (
+					SELECT
+						pu.order_id
+					FROM
+						mla_promotion_usages pu
+						JOIN mla_promotions pp ON pp.id = pu.promotion_id
+					WHERE
+						pp.campaign = p.campaign AND
+						pu.project_id = ? AND
+						pu.created_at >= ? AND
+						pu.created_at < ?
+				)
+		), 0) AS paid_revenue
+	FROM
+		mla_promotion_usages u
+		JOIN mla_promotions p ON p.id = u.promotion_id
+		JOIN mla_orders o ON o.order_id = u.order_id
+	WHERE
+		u.project_id = ? AND
+		u.created_at >= ? AND
+		u.created_at < ? AND
+		` + liveOrder + `
+	GROUP BY
+		p.campaign
+	ORDER BY
+		p.campaign
+	`
+	err = c.db.Select(&reports, query,
+		order.StatusPaid,
+		order.StatusPaid,
+		order.StatusPaid,
+		pid, from, to,
+		pid, from, to,
+	)
+	return
+}
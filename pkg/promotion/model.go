@@ -0,0 +1,318 @@
+package promotion
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/pricing"
+	"gopkg.in/guregu/null.v3"
+)
+
+// Discount types, a percentage discount takes DiscountValue percent of the
+// discounted amount and a fixed discount takes DiscountValue
+const (
+	DiscountPercentage = "percentage"
+	DiscountFixed      = "fixed"
+)
+
+// ItemTypeDiscount is the item type of order detail lines given by
+// promotions, their ItemID is the promotion and their amount is negative
+const ItemTypeDiscount = "discount"
+
+// RuleTypePromotion is the rule type of discount lines
+const RuleTypePromotion = "promotion"
+
+// Promotion is model for mla_promotions in db. A promotion with Code is a
+// voucher applied when the buyer enters the code, one without Code applies
+// automatically to every eligible order. Empty eligibility lists match every
+// order, ItemType limits the discount to the lines of that item type
+type Promotion struct {
+	ID                int64       `db:"id"`
+	Name              string      `db:"name"`
+	Campaign          string      `db:"campaign"`
+	Code              null.String `db:"code"`
+	DiscountType      string      `db:"discount_type"`
+	DiscountValue     float64     `db:"discount_value"`
+	MaxDiscount       null.Float  `db:"max_discount"`
+	ItemType          string      `db:"item_type"`
+	OrderType         string      `db:"order_type"`
+	VenueTypeIDs      IDs         `db:"venue_type_ids"`
+	CommercialTypeIDs IDs         `db:"commercial_type_ids"`
+	Cities            Names       `db:"cities"`
+	ProductIDs        IDs         `db:"product_ids"`
+	UsageLimit        int64       `db:"usage_limit"`
+	PerBuyerLimit     int64       `db:"per_buyer_limit"`
+	StartAt           time.Time   `db:"start_at"`
+	EndAt             time.Time   `db:"end_at"`
+	Status            int16       `db:"status"`
+	CreatedAt         time.Time   `db:"created_at"`
+	CreatedBy         string      `db:"created_by"`
+	UpdatedAt         time.Time   `db:"updated_at"`
+	LastUpdateBy      string      `db:"last_update_by"`
+	DeletedAt         null.Time   `db:"deleted_at"`
+	ProjectID         int64       `db:"project_id"`
+}
+
+// Promotions is list of promotion
+type Promotions []Promotion
+
+// IDs is list of id, stored as json in db
+type IDs []int64
+
+// Scan implements sql.Scanner
+func (ids *IDs) Scan(src interface{}) error {
+	return scanJSON(src, ids)
+}
+
+// Value implements driver.Valuer
+func (ids IDs) Value() (driver.Value, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return valueJSON(ids)
+}
+
+// Names is list of name, stored as json in db
+type Names []string
+
+// Scan implements sql.Scanner
+func (names *Names) Scan(src interface{}) error {
+	return scanJSON(src, names)
+}
+
+// Value implements driver.Valuer
+func (names Names) Value() (driver.Value, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	return valueJSON(names)
+}
+
+func scanJSON(src interface{}, dest interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, dest)
+	case string:
+		return json.Unmarshal([]byte(v), dest)
+	}
+	return fmt.Errorf("unsupported type for json list: %T", src)
+}
+
+func valueJSON(v interface{}) (driver.Value, error) {
+	byt, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(byt), nil
+}
+
+// Errors returned when a promotion is not valid or a voucher cannot be used
+var (
+	ErrPromotionNotFound    = errors.New("Promotion is not found")
+	ErrInvalidDiscountType  = errors.New("Discount type must be percentage or fixed")
+	ErrInvalidDiscountValue = errors.New("Discount value must be greater than zero and a percentage at most 100")
+	ErrInvalidWindow        = errors.New("Promotion must end after it starts")
+	ErrInvalidOrderType     = errors.New("Promotion order type must be empty, new or renewal")
+	ErrInvalidLimit         = errors.New("Usage limits cannot be negative")
+	ErrCodeExists           = errors.New("Voucher code is already used by another promotion")
+	ErrVoucherNotFound      = errors.New("Voucher code is not valid")
+	ErrVoucherNotEligible   = errors.New("Voucher code is not valid for this order")
+	ErrVoucherUsedUp        = errors.New("Voucher code has reached its usage limit")
+	ErrUsageLimit           = errors.New("Promotion has reached its usage limit")
+)
+
+// IsVoucherError reports whether err is about the voucher code entered by the
+// buyer rather than a failure
+func IsVoucherError(err error) bool {
+	return err == ErrVoucherNotFound || err == ErrVoucherNotEligible || err == ErrVoucherUsedUp
+}
+
+// Validate checks the promotion is complete
+func (p Promotion) Validate() error {
+	if p.DiscountType != DiscountPercentage && p.DiscountType != DiscountFixed {
+		return ErrInvalidDiscountType
+	}
+	if p.DiscountValue <= 0 || (p.DiscountType == DiscountPercentage && p.DiscountValue > 100) {
+		return ErrInvalidDiscountValue
+	}
+	if p.StartAt.IsZero() || !p.EndAt.After(p.StartAt) {
+		return ErrInvalidWindow
+	}
+	if p.OrderType != "" && p.OrderType != order.OrderTypeNew && p.OrderType != order.OrderTypeRenewal {
+		return ErrInvalidOrderType
+	}
+	if p.UsageLimit < 0 || p.PerBuyerLimit < 0 {
+		return ErrInvalidLimit
+	}
+	return nil
+}
+
+// NormalizeCode returns the form voucher codes are stored and matched in
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Target is the order a promotion is checked against
+type Target struct {
+	VenueTypeID      int64
+	CommercialTypeID int64
+	City             string
+	ProductID        int64
+	OrderType        string
+	At               time.Time
+}
+
+// Eligible reports whether the promotion applies to the order, usage limits
+// are not checked
+func (p Promotion) Eligible(t Target) bool {
+	if t.At.Before(p.StartAt) || !t.At.Before(p.EndAt) {
+		return false
+	}
+	if p.OrderType != "" && p.OrderType != t.OrderType {
+		return false
+	}
+	if len(p.VenueTypeIDs) > 0 && !p.VenueTypeIDs.contains(t.VenueTypeID) {
+		return false
+	}
+	if len(p.CommercialTypeIDs) > 0 && !p.CommercialTypeIDs.contains(t.CommercialTypeID) {
+		return false
+	}
+	if len(p.ProductIDs) > 0 && !p.ProductIDs.contains(t.ProductID) {
+		return false
+	}
+	if len(p.Cities) > 0 && !p.Cities.contains(t.City) {
+		return false
+	}
+	return true
+}
+
+func (ids IDs) contains(id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (names Names) contains(name string) bool {
+	for _, v := range names {
+		if strings.EqualFold(strings.TrimSpace(v), strings.TrimSpace(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns the discount lines of promotions for lines, in the order of
+// promotions. A discount never exceeds what is left of the amount it is taken
+// from after the discounts before it, promotions left with nothing to
+// discount give no line
+func Apply(promotions Promotions, lines pricing.Lines) pricing.Lines {
+	var (
+		charged    = make(map[string]float64)
+		discounted = make(map[string]float64)
+		total      float64
+		totalOff   float64
+		discounts  pricing.Lines
+	)
+	for _, line := range lines {
+		if line.ItemType == ItemTypeDiscount {
+			continue
+		}
+		charged[line.ItemType] += line.Amount
+		total += line.Amount
+	}
+
+	for _, p := range promotions {
+		left := total - totalOff
+		if p.ItemType != "" {
+			left = math.Min(left, charged[p.ItemType]-discounted[p.ItemType])
+		}
+		if left <= 0 {
+			continue
+		}
+
+		amount := p.DiscountValue
+		if p.DiscountType == DiscountPercentage {
+			amount = left * p.DiscountValue / 100
+			if p.MaxDiscount.Valid && amount > p.MaxDiscount.Float64 {
+				amount = p.MaxDiscount.Float64
+			}
+		}
+		amount = math.Round(math.Min(amount, left)*100) / 100
+		if amount <= 0 {
+			continue
+		}
+
+		totalOff += amount
+		if p.ItemType != "" {
+			discounted[p.ItemType] += amount
+		}
+		discounts = append(discounts, pricing.Line{
+			ItemType:    ItemTypeDiscount,
+			ItemID:      p.ID,
+			Description: p.Name,
+			RuleType:    RuleTypePromotion,
+			UnitPrice:   -amount,
+			Quantity:    1,
+			Amount:      -amount,
+		})
+	}
+	return discounts
+}
+
+// Usage is model for mla_promotion_usages in db, a promotion given on an
+// order. Usages count against the limits while their order is neither
+// deleted, cancelled nor expired
+type Usage struct {
+	ID          int64     `db:"id"`
+	PromotionID int64     `db:"promotion_id"`
+	OrderID     int64     `db:"order_id"`
+	BuyerID     string    `db:"buyer_id"`
+	Amount      float64   `db:"amount"`
+	CreatedAt   time.Time `db:"created_at"`
+	ProjectID   int64     `db:"project_id"`
+}
+
+// Usages is list of usage
+type Usages []Usage
+
+// Count is the number of orders a promotion is used on, in total and by a buyer
+type Count struct {
+	Total   int64 `db:"total"`
+	ByBuyer int64 `db:"by_buyer"`
+}
+
+// Allows reports whether the promotion can be used once more given count
+func (p Promotion) Allows(count Count) bool {
+	if p.UsageLimit > 0 && count.Total >= p.UsageLimit {
+		return false
+	}
+	if p.PerBuyerLimit > 0 && count.ByBuyer >= p.PerBuyerLimit {
+		return false
+	}
+	return true
+}
+
+// CampaignReport is the use of the promotions of a campaign
+type CampaignReport struct {
+	Campaign     string  `db:"campaign"`
+	Promotions   int64   `db:"promotions"`
+	Orders       int64   `db:"orders"`
+	Discount     float64 `db:"discount"`
+	PaidOrders   int64   `db:"paid_orders"`
+	PaidDiscount float64 `db:"paid_discount"`
+	PaidRevenue  float64 `db:"paid_revenue"`
+}
+
+// CampaignReports is list of campaign report
+type CampaignReports []CampaignReport
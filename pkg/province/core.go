@@ -1,13 +1,11 @@
 package province
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
+	"time"
 
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
@@ -19,19 +17,18 @@ type ICore interface {
 // core contains db client
 type core struct {
 	db    *sqlx.DB
-	redis *redis.Pool
+	cache cache.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "province"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (provinces Provinces, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:province", redisPrefix, pid)
-	provinces, err = c.selectFromCache(redisKey)
-	if err != nil {
-		provinces, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(provinces)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "provinces", cacheTTL, &provinces, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -53,16 +50,9 @@ func (c *core) selectFromDB(pid int64) (provinces Provinces, err error) {
 }
 
 func (c *core) Get(id int64, pid int64) (province Province, err error) {
-	redisKey := fmt.Sprintf("%s:%d:province:%d", redisPrefix, pid, id)
-
-	province, err = c.getFromCache(redisKey)
-	if err != nil {
-		province, err = c.getFromDB(id, pid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(province)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("province:%d", id), cacheTTL, &province, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
 	return
 }
 func (c *core) getFromDB(id int64, pid int64) (province Province, err error) {
@@ -83,38 +73,3 @@ func (c *core) getFromDB(id int64, pid int64) (province Province, err error) {
 
 	return
 }
-
-func (c *core) selectFromCache(redisKey string) (provinces Provinces, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", redisKey))
-	err = json.Unmarshal(b, &provinces)
-	return
-}
-
-func (c *core) getFromCache(key string) (province Province, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &province)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
@@ -0,0 +1,379 @@
+package quotation
+
+import (
+	"fmt"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
+)
+
+// ICore is the interface
+type ICore interface {
+	Insert(quotation *Quotation, requestID string) (err error)
+	Convert(quotation *Quotation, orderID int64, requestID string) (err error)
+
+	Get(id int64, pid int64, uid string) (quotation Quotation, err error)
+	Select(pid int64, uid string) (quotations Quotations, err error)
+}
+
+// core contains db client
+type core struct {
+	db         *sqlx.DB
+	cache      cache.ICore
+	auditTrail auditTrail.ICore
+	validity   time.Duration
+}
+
+const (
+	cacheNamespace = "quotation"
+	cacheTTL       = 5 * time.Minute
+)
+
+// Insert saves the quotation with its items, it expires after the default
+// validity when ValidUntil is not set
+func (c *core) Insert(quotation *Quotation, requestID string) (err error) {
+	quotation.CreatedAt = time.Now()
+	quotation.UpdatedAt = quotation.CreatedAt
+	quotation.Status = StatusOpen
+	if quotation.ValidUntil.IsZero() {
+		quotation.ValidUntil = quotation.CreatedAt.Add(c.validity)
+	}
+
+	query := `
+	INSERT INTO mla_quotations (
+		quotation_number,
+		buyer_id,
+		venue_id,
+		device_id,
+		product_id,
+		installation_id,
+		aging_id,
+		room_id,
+		room_quantity,
+		total_price,
+		tax_base,
+		tax_amount,
+		email,
+		valid_until,
+		status,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		project_id
+	) VALUES (
+		?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?
+	)`
+
+	args := []interface{}{
+		quotation.QuotationNumber,
+		quotation.BuyerID,
+		quotation.VenueID,
+		quotation.DeviceID,
+		quotation.ProductID,
+		quotation.InstallationID,
+		quotation.AgingID,
+		quotation.RoomID,
+		quotation.RoomQuantity,
+		quotation.TotalPrice,
+		quotation.TaxBase,
+		quotation.TaxAmount,
+		quotation.Email,
+		quotation.ValidUntil,
+		quotation.Status,
+		quotation.CreatedAt,
+		quotation.CreatedBy,
+		quotation.UpdatedAt,
+		quotation.LastUpdateBy,
+		quotation.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_quotations",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    quotation.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	quotation.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for i := range quotation.Items {
+		item := &quotation.Items[i]
+		item.QuotationID = quotation.ID
+		item.ProjectID = quotation.ProjectID
+
+		res, err = tx.Exec(`
+			INSERT INTO mla_quotation_items (
+				quotation_id,
+				item_type,
+				item_id,
+				description,
+				rule_id,
+				rule_type,
+				unit_price,
+				quantity,
+				amount,
+				tax_rate_id,
+				tax_rate,
+				tax_base,
+				tax_amount,
+				project_id
+			) VALUES (
+				?,?,?,?,?,?,?,?,?,?,?,?,?,?
+			)`,
+			item.QuotationID,
+			item.ItemType,
+			item.ItemID,
+			item.Description,
+			item.RuleID,
+			item.RuleType,
+			item.UnitPrice,
+			item.Quantity,
+			item.Amount,
+			item.TaxRateID,
+			item.TaxRate,
+			item.TaxBase,
+			item.TaxAmount,
+			item.ProjectID,
+		)
+		if err != nil {
+			return err
+		}
+		item.ID, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, quotation.ProjectID))
+
+	return
+}
+
+// Convert marks the quotation as converted into the order. Only one of
+// concurrent conversions succeeds, the others get ErrNotOpen, and a quotation
+// that expired meanwhile gets ErrExpired
+func (c *core) Convert(quotation *Quotation, orderID int64, requestID string) (err error) {
+	now := time.Now()
+
+	query := `
+	UPDATE
+		mla_quotations
+	SET
+		status = ?,
+		order_id = ?,
+		converted_at = ?,
+		updated_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = ? AND
+		valid_until >= ? AND
+		deleted_at IS NULL
+	`
+
+	args := []interface{}{
+		StatusConverted,
+		orderID,
+		now,
+		now,
+		quotation.LastUpdateBy,
+		quotation.ID,
+		quotation.ProjectID,
+		StatusOpen,
+		now,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_quotations",
+		EntityID:   quotation.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    quotation.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		if quotation.IsExpired(now) {
+			return ErrExpired
+		}
+		return ErrNotOpen
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	quotation.Status = StatusConverted
+	quotation.OrderID.SetValid(orderID)
+	quotation.ConvertedAt.SetValid(now)
+	quotation.UpdatedAt = now
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, quotation.ProjectID))
+
+	return
+}
+
+// Get returns the quotation with its items, uid limits it to quotations
+// created by the user
+func (c *core) Get(id int64, pid int64, uid string) (quotation Quotation, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("quotation:%d:%s", id, uid), cacheTTL, &quotation, func() (interface{}, error) {
+		return c.getFromDB(id, pid, uid)
+	})
+	return
+}
+
+func (c *core) getFromDB(id int64, pid int64, uid string) (quotation Quotation, err error) {
+	query := `
+		SELECT
+			id,
+			quotation_number,
+			buyer_id,
+			venue_id,
+			device_id,
+			product_id,
+			installation_id,
+			aging_id,
+			room_id,
+			room_quantity,
+			total_price,
+			tax_base,
+			tax_amount,
+			email,
+			valid_until,
+			status,
+			order_id,
+			converted_at,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_quotations
+		WHERE
+			id = ? AND
+			project_id = ? AND
+			deleted_at IS NULL
+	`
+	args := []interface{}{id, pid}
+	if uid != "" {
+		query += ` AND created_by = ? `
+		args = append(args, uid)
+	}
+
+	err = c.db.Get(&quotation, query, args...)
+	if err != nil {
+		return
+	}
+
+	err = c.db.Select(&quotation.Items, `
+		SELECT
+			id,
+			quotation_id,
+			item_type,
+			item_id,
+			description,
+			rule_id,
+			rule_type,
+			unit_price,
+			quantity,
+			amount,
+			tax_rate_id,
+			tax_rate,
+			tax_base,
+			tax_amount,
+			project_id
+		FROM
+			mla_quotation_items
+		WHERE
+			quotation_id = ? AND
+			project_id = ?
+		ORDER BY id
+	`, id, pid)
+
+	return
+}
+
+// Select returns the quotations without their items, newest first. uid limits
+// them to quotations created by the user
+func (c *core) Select(pid int64, uid string) (quotations Quotations, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("quotations:%s", uid), cacheTTL, &quotations, func() (interface{}, error) {
+		return c.selectFromDB(pid, uid)
+	})
+	return
+}
+
+func (c *core) selectFromDB(pid int64, uid string) (quotations Quotations, err error) {
+	query := `
+		SELECT
+			id,
+			quotation_number,
+			buyer_id,
+			venue_id,
+			device_id,
+			product_id,
+			installation_id,
+			aging_id,
+			room_id,
+			room_quantity,
+			total_price,
+			tax_base,
+			tax_amount,
+			email,
+			valid_until,
+			status,
+			order_id,
+			converted_at,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_quotations
+		WHERE
+			project_id = ? AND
+			deleted_at IS NULL
+	`
+	args := []interface{}{pid}
+	if uid != "" {
+		query += ` AND created_by = ? `
+		args = append(args, uid)
+	}
+	query += ` ORDER BY created_at DESC, id DESC `
+
+	err = c.db.Select(&quotations, query, args...)
+
+	return
+}
@@ -0,0 +1,40 @@
+package quotation
+
+import (
+	"context"
+	"log"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
+)
+
+// Init is used to initialize quotation package, quotations are valid for
+// validity unless created with their own expiry
+func Init(db *sqlx.DB, cache cache.ICore, auditTrail auditTrail.ICore, validity time.Duration) ICore {
+	examineDBHealth(db)
+	if validity <= 0 {
+		log.Fatalf("Failed to initialize quotation. validity must be positive")
+	}
+	return &core{
+		db:         db,
+		cache:      cache,
+		auditTrail: auditTrail,
+		validity:   validity,
+	}
+}
+
+func examineDBHealth(db *sqlx.DB) {
+	if db == nil {
+		log.Fatalf("Failed to initialize quotation. db object cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize quotation. cannot pinging to db. err: %s", err)
+	}
+}
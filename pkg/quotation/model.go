@@ -0,0 +1,105 @@
+package quotation
+
+import (
+	"errors"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// Statuses of a quotation, an open quotation can be converted into an order
+// until it expires
+const (
+	StatusOpen      int16 = 1
+	StatusConverted int16 = 2
+)
+
+// Quotation is model for mla_quotations in db. Its items are a snapshot of
+// the catalogue prices when it was created, the order it is converted into
+// keeps those prices
+type Quotation struct {
+	ID              int64     `db:"id"`
+	QuotationNumber string    `db:"quotation_number"`
+	BuyerID         string    `db:"buyer_id"`
+	VenueID         int64     `db:"venue_id"`
+	DeviceID        int64     `db:"device_id"`
+	ProductID       int64     `db:"product_id"`
+	InstallationID  int64     `db:"installation_id"`
+	AgingID         int64     `db:"aging_id"`
+	RoomID          int64     `db:"room_id"`
+	RoomQuantity    int64     `db:"room_quantity"`
+	TotalPrice      float64   `db:"total_price"`
+	TaxBase         float64   `db:"tax_base"`
+	TaxAmount       float64   `db:"tax_amount"`
+	Email           string    `db:"email"`
+	ValidUntil      time.Time `db:"valid_until"`
+	Status          int16     `db:"status"`
+	OrderID         null.Int  `db:"order_id"`
+	ConvertedAt     null.Time `db:"converted_at"`
+	CreatedAt       time.Time `db:"created_at"`
+	CreatedBy       string    `db:"created_by"`
+	UpdatedAt       time.Time `db:"updated_at"`
+	LastUpdateBy    string    `db:"last_update_by"`
+	DeletedAt       null.Time `db:"deleted_at"`
+	ProjectID       int64     `db:"project_id"`
+	Items           Items     `db:"-"`
+}
+
+// Quotations is list of quotation
+type Quotations []Quotation
+
+// Item is model for mla_quotation_items in db, a priced line of a quotation
+type Item struct {
+	ID          int64    `db:"id"`
+	QuotationID int64    `db:"quotation_id"`
+	ItemType    string   `db:"item_type"`
+	ItemID      int64    `db:"item_id"`
+	Description string   `db:"description"`
+	RuleID      int64    `db:"rule_id"`
+	RuleType    string   `db:"rule_type"`
+	UnitPrice   float64  `db:"unit_price"`
+	Quantity    int64    `db:"quantity"`
+	Amount      float64  `db:"amount"`
+	TaxRateID   null.Int `db:"tax_rate_id"`
+	TaxRate     float64  `db:"tax_rate"`
+	TaxBase     float64  `db:"tax_base"`
+	TaxAmount   float64  `db:"tax_amount"`
+	ProjectID   int64    `db:"project_id"`
+}
+
+// Items is list of item
+type Items []Item
+
+// Errors returned when a quotation cannot be converted
+var (
+	ErrExpired = errors.New("Quotation has expired")
+	ErrNotOpen = errors.New("Quotation has been converted")
+)
+
+// IsExpired reports whether the quotation is no longer valid at t
+func (q Quotation) IsExpired(t time.Time) bool {
+	return t.After(q.ValidUntil)
+}
+
+// Convertible returns why the quotation cannot be converted at t, or nil
+func (q Quotation) Convertible(t time.Time) error {
+	if q.Status != StatusOpen {
+		return ErrNotOpen
+	}
+	if q.IsExpired(t) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// StatusName returns the name of a quotation status, an open quotation past
+// its validity is expired
+func (q Quotation) StatusName(t time.Time) string {
+	switch {
+	case q.Status == StatusConverted:
+		return "converted"
+	case q.IsExpired(t):
+		return "expired"
+	}
+	return "open"
+}
@@ -0,0 +1,429 @@
+package refund
+
+import (
+	"fmt"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	orderJob "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v3"
+)
+
+// ICore is the interface
+type ICore interface {
+	Insert(refund *Refund, ordered Refundables, lines map[int64]float64, requestID string) (err error)
+	UpdateStatus(refund *Refund, requestID string) (err error)
+
+	SelectByOrderID(orderID int64, pid int64) (refunds Refunds, err error)
+	SelectRefundedByOrderID(orderID int64, pid int64) (refunded map[int64]float64, err error)
+	SelectPendingBefore(pid int64, before time.Time) (refunds Refunds, err error)
+	GetCompletedAmountByOrderID(orderID int64, pid int64) (amount float64, err error)
+}
+
+// core contains db client
+type core struct {
+	db         *sqlx.DB
+	cache      cache.ICore
+	auditTrail auditTrail.ICore
+	orderJob   orderJob.ICore
+}
+
+const (
+	cacheNamespace = "refund"
+	cacheTTL       = 5 * time.Minute
+
+	// orderCacheNamespace is invalidated since order summaries carry the
+	// refunded amount
+	orderCacheNamespace = "order"
+)
+
+// Insert records the refund as pending. ordered is the amount of each order
+// detail line, the refund is built by BuildDetails from what is left of it
+// after the refunds not failed, with refund.Amount as the requested amount.
+// The order row is locked meanwhile, so concurrent refunds of the same order
+// can not exceed it
+func (c *core) Insert(refund *Refund, ordered Refundables, lines map[int64]float64, requestID string) (err error) {
+	refund.CreatedAt = time.Now()
+	refund.UpdatedAt = refund.CreatedAt
+	refund.Status = StatusPending
+
+	query := `
+	INSERT INTO mla_refunds (
+		order_id,
+		amount,
+		reason,
+		status,
+		gateway_refund_id,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		project_id
+	) VALUES (
+		?,?,?,?,?,?,?,?,?,?
+	)`
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var orderID int64
+	err = tx.Get(&orderID, `
+		SELECT
+			order_id
+		FROM
+			mla_orders
+		WHERE
+			order_id = ? AND
+			project_id = ?
+		FOR UPDATE
+	`, refund.OrderID, refund.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	refunded, err := selectRefunded(tx, refund.OrderID, refund.ProjectID)
+	if err != nil {
+		return err
+	}
+	refundables := make(Refundables, 0, len(ordered))
+	for _, line := range ordered {
+		refundables = append(refundables, Refundable{
+			OrderDetailID: line.OrderDetailID,
+			Amount:        line.Amount - refunded[line.OrderDetailID],
+		})
+	}
+	refund.Details, refund.Amount, err = BuildDetails(refundables, lines, refund.Amount)
+	if err != nil {
+		return err
+	}
+
+	args := []interface{}{
+		refund.OrderID,
+		refund.Amount,
+		refund.Reason,
+		refund.Status,
+		refund.GatewayRefundID,
+		refund.CreatedAt,
+		refund.CreatedBy,
+		refund.UpdatedAt,
+		refund.LastUpdateBy,
+		refund.ProjectID,
+	}
+
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_refunds",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    refund.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	refund.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for i := range refund.Details {
+		detail := &refund.Details[i]
+		detail.RefundID = refund.ID
+		detail.ProjectID = refund.ProjectID
+
+		query := `
+		INSERT INTO mla_refund_details (
+			refund_id,
+			order_detail_id,
+			amount,
+			project_id
+		) VALUES (
+			?,?,?,?
+		)`
+
+		args := []interface{}{
+			detail.RefundID,
+			detail.OrderDetailID,
+			detail.Amount,
+			detail.ProjectID,
+		}
+
+		res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+			EntityType: "mla_refund_details",
+			Action:     auditTrail.ActionCreate,
+			ActorID:    refund.CreatedBy,
+			RequestID:  requestID,
+		}, query, args...)
+		if err != nil {
+			return err
+		}
+		detail.ID, err = res.LastInsertId()
+		if err != nil {
+			return err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, refund.ProjectID), cache.Namespace(orderCacheNamespace, refund.ProjectID))
+
+	return
+}
+
+// UpdateStatus sets the status and gateway refund id of the refund. A
+// completed refund is final, completing it queues the job applying it to the
+// order, licenses and commissions in the same tx
+func (c *core) UpdateStatus(refund *Refund, requestID string) (err error) {
+	refund.UpdatedAt = time.Now()
+	if refund.Status == StatusCompleted {
+		refund.CompletedAt = null.TimeFrom(refund.UpdatedAt)
+	}
+
+	query := `
+	UPDATE
+		mla_refunds
+	SET
+		status = ?,
+		gateway_refund_id = ?,
+		updated_at = ?,
+		last_update_by = ?,
+		completed_at = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status <> ?
+	`
+
+	args := []interface{}{
+		refund.Status,
+		refund.GatewayRefundID,
+		refund.UpdatedAt,
+		refund.LastUpdateBy,
+		refund.CompletedAt,
+		refund.ID,
+		refund.ProjectID,
+		StatusCompleted,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_refunds",
+		EntityID:   refund.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    refund.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 && refund.Status == StatusCompleted {
+		err = c.orderJob.Enqueue(tx, &orderJob.Job{
+			Type:      orderJob.TypeCompleteRefund,
+			OrderID:   refund.OrderID,
+			RefundID:  null.IntFrom(refund.ID),
+			ProjectID: refund.ProjectID,
+			CreatedBy: refund.LastUpdateBy,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, refund.ProjectID), cache.Namespace(orderCacheNamespace, refund.ProjectID))
+
+	return
+}
+
+func (c *core) SelectByOrderID(orderID int64, pid int64) (refunds Refunds, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("refunds-order:%d", orderID), cacheTTL, &refunds, func() (interface{}, error) {
+		return c.selectFromDBByOrderID(orderID, pid)
+	})
+	return
+}
+
+func (c *core) selectFromDBByOrderID(orderID int64, pid int64) (refunds Refunds, err error) {
+	query := `
+		SELECT
+			id,
+			order_id,
+			amount,
+			reason,
+			status,
+			gateway_refund_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			completed_at,
+			project_id
+		FROM
+			mla_refunds
+		WHERE
+			order_id = ? AND
+			project_id = ?
+		ORDER BY id
+	`
+
+	err = c.db.Select(&refunds, query, orderID, pid)
+	if err != nil || len(refunds) == 0 {
+		return
+	}
+
+	var details RefundDetails
+	err = c.db.Select(&details, `
+		SELECT
+			details.id,
+			details.refund_id,
+			details.order_detail_id,
+			details.amount,
+			details.project_id
+		FROM
+			mla_refund_details details
+		JOIN
+			mla_refunds refunds ON refunds.id = details.refund_id
+		WHERE
+			refunds.order_id = ? AND
+			details.project_id = ?
+		ORDER BY details.id
+	`, orderID, pid)
+	if err != nil {
+		return
+	}
+
+	for i := range refunds {
+		for _, detail := range details {
+			if detail.RefundID == refunds[i].ID {
+				refunds[i].Details = append(refunds[i].Details, detail)
+			}
+		}
+	}
+
+	return
+}
+
+// SelectRefundedByOrderID returns the amount refunded or being refunded from
+// each order detail of the order, keyed by order detail id. It is read from db
+// since it is used to validate new refunds
+func (c *core) SelectRefundedByOrderID(orderID int64, pid int64) (refunded map[int64]float64, err error) {
+	return selectRefunded(c.db, orderID, pid)
+}
+
+func selectRefunded(q sqlx.Queryer, orderID int64, pid int64) (refunded map[int64]float64, err error) {
+	var rows []struct {
+		OrderDetailID int64   `db:"order_detail_id"`
+		Amount        float64 `db:"amount"`
+	}
+
+	err = sqlx.Select(q, &rows, `
+		SELECT
+			details.order_detail_id,
+			SUM(details.amount) AS amount
+		FROM
+			mla_refund_details details
+		JOIN
+			mla_refunds refunds ON refunds.id = details.refund_id
+		WHERE
+			refunds.order_id = ? AND
+			refunds.project_id = ? AND
+			refunds.status != ?
+		GROUP BY details.order_detail_id
+	`, orderID, pid, StatusFailed)
+	if err != nil {
+		return nil, err
+	}
+
+	refunded = make(map[int64]float64, len(rows))
+	for _, row := range rows {
+		refunded[row.OrderDetailID] = row.Amount
+	}
+	return
+}
+
+// SelectPendingBefore returns refunds of the project still pending at the
+// gateway which were requested before the given time
+func (c *core) SelectPendingBefore(pid int64, before time.Time) (refunds Refunds, err error) {
+	query := `
+		SELECT
+			id,
+			order_id,
+			amount,
+			reason,
+			status,
+			gateway_refund_id,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			completed_at,
+			project_id
+		FROM
+			mla_refunds
+		WHERE
+			project_id = ? AND
+			status = ? AND
+			gateway_refund_id != '' AND
+			created_at < ?
+		ORDER BY id
+	`
+
+	err = c.db.Select(&refunds, query, pid, StatusPending, before)
+	if err != nil {
+		return
+	}
+
+	for i := range refunds {
+		err = c.db.Select(&refunds[i].Details, `
+			SELECT
+				id,
+				refund_id,
+				order_detail_id,
+				amount,
+				project_id
+			FROM
+				mla_refund_details
+			WHERE
+				refund_id = ? AND
+				project_id = ?
+			ORDER BY id
+		`, refunds[i].ID, pid)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// GetCompletedAmountByOrderID returns the amount of the order which has been
+// refunded by the gateway. It is read from db since it decides whether the
+// order is fully refunded
+func (c *core) GetCompletedAmountByOrderID(orderID int64, pid int64) (amount float64, err error) {
+	err = c.db.Get(&amount, `
+		SELECT
+			COALESCE(SUM(amount), 0)
+		FROM
+			mla_refunds
+		WHERE
+			order_id = ? AND
+			project_id = ? AND
+			status = ?
+	`, orderID, pid, StatusCompleted)
+	return
+}
@@ -0,0 +1,37 @@
+package refund
+
+import (
+	"context"
+	"log"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	orderJob "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order_job"
+	"github.com/jmoiron/sqlx"
+)
+
+// Init is used to initialize refund package
+func Init(db *sqlx.DB, cache cache.ICore, auditTrail auditTrail.ICore, orderJob orderJob.ICore) ICore {
+	examineDBHealth(db)
+	return &core{
+		db:         db,
+		cache:      cache,
+		auditTrail: auditTrail,
+		orderJob:   orderJob,
+	}
+}
+
+func examineDBHealth(db *sqlx.DB) {
+	if db == nil {
+		log.Fatalf("Failed to initialize refunds. db object cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize refunds. cannot pinging to db. err: %s", err)
+	}
+}
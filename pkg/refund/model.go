@@ -0,0 +1,141 @@
+package refund
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// Refund statuses
+const (
+	StatusPending   = "pending"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// Refund is model for mla_refunds in db, Details are the order detail lines
+// the amount is refunded from
+type Refund struct {
+	ID              int64         `db:"id"`
+	OrderID         int64         `db:"order_id"`
+	Amount          float64       `db:"amount"`
+	Reason          string        `db:"reason"`
+	Status          string        `db:"status"`
+	GatewayRefundID string        `db:"gateway_refund_id"`
+	CreatedAt       time.Time     `db:"created_at"`
+	CreatedBy       string        `db:"created_by"`
+	UpdatedAt       time.Time     `db:"updated_at"`
+	LastUpdateBy    string        `db:"last_update_by"`
+	CompletedAt     null.Time     `db:"completed_at"`
+	ProjectID       int64         `db:"project_id"`
+	Details         RefundDetails `db:"-"`
+}
+
+// Refunds is list of refund
+type Refunds []Refund
+
+// RefundDetail is model for mla_refund_details in db
+type RefundDetail struct {
+	ID            int64   `db:"id"`
+	RefundID      int64   `db:"refund_id"`
+	OrderDetailID int64   `db:"order_detail_id"`
+	Amount        float64 `db:"amount"`
+	ProjectID     int64   `db:"project_id"`
+}
+
+// RefundDetails is list of refund detail
+type RefundDetails []RefundDetail
+
+// Refundable is the amount of an order detail line which is not refunded yet
+type Refundable struct {
+	OrderDetailID int64
+	Amount        float64
+}
+
+// Refundables is list of refundable
+type Refundables []Refundable
+
+// Errors returned when a refund is not valid
+var (
+	ErrInvalidAmount     = errors.New("Refund amount must be greater than zero")
+	ErrAmountExceeded    = errors.New("Refund amount exceeds the refundable amount")
+	ErrInvalidDetailLine = errors.New("Refund line does not belong to the order")
+	ErrNothingRefundable = errors.New("Order has been fully refunded")
+)
+
+// Total returns the refundable amount of all lines
+func (refundables Refundables) Total() (total float64) {
+	for _, refundable := range refundables {
+		total += refundable.Amount
+	}
+	return
+}
+
+// BuildDetails splits refund into detail lines. When lines is given, keyed by
+// order detail id, each line is refunded as requested, at most the refundable
+// total. Otherwise amount is taken from the refundable lines in order, and
+// amount 0 refunds everything left
+func BuildDetails(refundables Refundables, lines map[int64]float64, amount float64) (details RefundDetails, total float64, err error) {
+	if refundables.Total() <= 0 {
+		return nil, 0, ErrNothingRefundable
+	}
+
+	if len(lines) > 0 {
+		for _, refundable := range refundables {
+			lineAmount, ok := lines[refundable.OrderDetailID]
+			if !ok {
+				continue
+			}
+			if lineAmount <= 0 {
+				return nil, 0, ErrInvalidAmount
+			}
+			if lineAmount > refundable.Amount {
+				return nil, 0, ErrAmountExceeded
+			}
+			details = append(details, RefundDetail{
+				OrderDetailID: refundable.OrderDetailID,
+				Amount:        lineAmount,
+			})
+			total += lineAmount
+		}
+		if len(details) != len(lines) {
+			return nil, 0, ErrInvalidDetailLine
+		}
+		// discount lines are negative, the lines they discount can not be
+		// refunded in full beyond what was paid for the order
+		if math.Round(total*100) > math.Round(refundables.Total()*100) {
+			return nil, 0, ErrAmountExceeded
+		}
+		return details, total, nil
+	}
+
+	if amount < 0 {
+		return nil, 0, ErrInvalidAmount
+	}
+	if amount == 0 {
+		amount = refundables.Total()
+	}
+	if amount > refundables.Total() {
+		return nil, 0, ErrAmountExceeded
+	}
+
+	left := amount
+	for _, refundable := range refundables {
+		if left <= 0 {
+			break
+		}
+		if refundable.Amount <= 0 {
+			continue
+		}
+		lineAmount := math.Min(left, refundable.Amount)
+		details = append(details, RefundDetail{
+			OrderDetailID: refundable.OrderDetailID,
+			Amount:        lineAmount,
+		})
+		left -= lineAmount
+	}
+
+	return details, amount, nil
+}
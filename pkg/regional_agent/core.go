@@ -1,57 +1,46 @@
 package regional_agent
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
 type ICore interface {
 	Select(pid int64) (regionalAgents RegionalAgents, err error)
 	Get(pid int64, id int64) (regionalAgent RegionalAgent, err error)
-	Insert(regionalAgent *RegionalAgent) (err error)
-	Update(regionalAgent *RegionalAgent, isAdmin bool) (err error)
-	Delete(pid int64, id int64, isAdmin bool, userID string) (err error)
+	Insert(regionalAgent *RegionalAgent, requestID string) (err error)
+	Update(regionalAgent *RegionalAgent, isAdmin bool, requestID string) (err error)
+	Delete(pid int64, id int64, isAdmin bool, userID string, requestID string) (err error)
 }
 
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "regional_agent"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (regionalAgents RegionalAgents, err error) {
-	redisKey := fmt.Sprintf("%s:regional_agents", redisPrefix)
-	regionalAgents, err = c.selectFromCache(redisKey)
-	if err != nil {
-		regionalAgents, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(regionalAgents)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "regional_agents", cacheTTL, &regionalAgents, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
 func (c *core) Get(pid int64, id int64) (regionalAgent RegionalAgent, err error) {
-	redisKey := fmt.Sprintf("%s:%d:regional_agents:%d", redisPrefix, pid, id)
-
-	regionalAgent, err = c.getFromCache(redisKey)
-	if err != nil {
-		regionalAgent, err = c.getFromDB(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(regionalAgent)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("regional_agents:%d", id), cacheTTL, &regionalAgent, func() (interface{}, error) {
+		return c.getFromDB(pid, id)
+	})
 	return
 }
 
@@ -108,7 +97,7 @@ func (c *core) getFromDB(pid int64, id int64) (regionalAgent RegionalAgent, err
 	return
 }
 
-func (c *core) Insert(regionalAgent *RegionalAgent) (err error) {
+func (c *core) Insert(regionalAgent *RegionalAgent, requestID string) (err error) {
 	regionalAgent.CreatedAt = time.Now()
 	regionalAgent.UpdatedAt = regionalAgent.CreatedAt
 	regionalAgent.Status = 1
@@ -157,13 +146,17 @@ func (c *core) Insert(regionalAgent *RegionalAgent) (err error) {
 		regionalAgent.CreatedBy,
 		regionalAgent.LastUpdateBy,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_regional_agent",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    regionalAgent.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -171,24 +164,16 @@ func (c *core) Insert(regionalAgent *RegionalAgent) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    regionalAgent.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_regional_agent",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:regional_agents", redisPrefix)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, regionalAgent.ProjectID))
 
 	return
 }
 
-func (c *core) Update(regionalAgent *RegionalAgent, isAdmin bool) (err error) {
+func (c *core) Update(regionalAgent *RegionalAgent, isAdmin bool, requestID string) (err error) {
 	regionalAgent.UpdatedAt = time.Now()
 	regionalAgent.Status = 1
 
@@ -226,38 +211,32 @@ func (c *core) Update(regionalAgent *RegionalAgent, isAdmin bool) (err error) {
 		args = append(args, regionalAgent.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_regional_agent",
+		EntityID:   regionalAgent.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    regionalAgent.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    regionalAgent.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_regional_agent",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:regional_agents:%d", redisPrefix, regionalAgent.ProjectID, regionalAgent.ID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:regional_agents", redisPrefix)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, regionalAgent.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err error) {
+func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string, requestID string) (err error) {
 	now := time.Now()
 	query := `
 		UPDATE
@@ -278,7 +257,6 @@ func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err err
 		args = append(args, userID)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 
 	if err != nil {
@@ -286,64 +264,24 @@ func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err err
 	}
 
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_regional_agent",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    userID,
+		RequestID:  requestID,
+	}, query, args...)
 
 	if err != nil {
 		return err
 	}
 
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    "uid",
-		Query:     queryTrail,
-		TableName: "mla_regional_agent",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:%d:regional_agents:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:regional_agents", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	return
-}
-
-func (c *core) selectFromCache(key string) (regionalAgents RegionalAgents, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &regionalAgents)
 	return
 }
-
-func (c *core) getFromCache(key string) (regionalAgent RegionalAgent, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &regionalAgent)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
@@ -1,57 +1,46 @@
 package room
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
 type ICore interface {
 	Select(pid int64) (rooms Rooms, err error)
 	Get(pid int64, id int64) (room Room, err error)
-	Insert(room *Room) (err error)
-	Update(room *Room, isAdmin bool) (err error)
-	Delete(pid int64, id int64, isAdmin bool, userID string) (err error)
+	Insert(room *Room, requestID string) (err error)
+	Update(room *Room, isAdmin bool, requestID string) (err error)
+	Delete(pid int64, id int64, isAdmin bool, userID string, requestID string) (err error)
 }
 
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "room"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (rooms Rooms, err error) {
-	redisKey := fmt.Sprintf("%s:rooms", redisPrefix)
-	rooms, err = c.selectFromCache(redisKey)
-	if err != nil {
-		rooms, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(rooms)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "rooms", cacheTTL, &rooms, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
 func (c *core) Get(pid int64, id int64) (room Room, err error) {
-	redisKey := fmt.Sprintf("%s:%d:rooms:%d", redisPrefix, pid, id)
-
-	room, err = c.getFromCache(redisKey)
-	if err != nil {
-		room, err = c.getFromDB(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(room)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("rooms:%d", id), cacheTTL, &room, func() (interface{}, error) {
+		return c.getFromDB(pid, id)
+	})
 	return
 }
 
@@ -102,7 +91,7 @@ func (c *core) getFromDB(pid int64, id int64) (room Room, err error) {
 	return
 }
 
-func (c *core) Insert(room *Room) (err error) {
+func (c *core) Insert(room *Room, requestID string) (err error) {
 	room.CreatedAt = time.Now()
 	room.UpdatedAt = room.CreatedAt
 	room.Status = 1
@@ -144,13 +133,17 @@ func (c *core) Insert(room *Room) (err error) {
 		room.CreatedBy,
 		room.LastUpdateBy,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_room",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    room.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -158,24 +151,16 @@ func (c *core) Insert(room *Room) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    room.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_room",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:rooms", redisPrefix)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, room.ProjectID))
 
 	return
 }
 
-func (c *core) Update(room *Room, isAdmin bool) (err error) {
+func (c *core) Update(room *Room, isAdmin bool, requestID string) (err error) {
 	room.UpdatedAt = time.Now()
 	room.Status = 1
 
@@ -209,38 +194,32 @@ func (c *core) Update(room *Room, isAdmin bool) (err error) {
 		args = append(args, room.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_room",
+		EntityID:   room.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    room.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    room.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_room",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:rooms:%d", redisPrefix, room.ProjectID, room.ID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:rooms", redisPrefix)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, room.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err error) {
+func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string, requestID string) (err error) {
 	now := time.Now()
 	query := `
 		UPDATE
@@ -261,7 +240,6 @@ func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err err
 		args = append(args, userID)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 
 	if err != nil {
@@ -269,64 +247,24 @@ func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string) (err err
 	}
 
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_room",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    userID,
+		RequestID:  requestID,
+	}, query, args...)
 
 	if err != nil {
 		return err
 	}
 
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    "uid",
-		Query:     queryTrail,
-		TableName: "mla_room",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:%d:rooms:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:rooms", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	return
-}
-
-func (c *core) selectFromCache(key string) (rooms Rooms, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &rooms)
 	return
 }
-
-func (c *core) getFromCache(key string) (room Room, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &room)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
@@ -0,0 +1,97 @@
+package sequence
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ICore is the interface
+type ICore interface {
+	Next(pid int64, name string) (number string, err error)
+}
+
+// core contains db client
+type core struct {
+	db        *sqlx.DB
+	sequences map[string]definition
+}
+
+type definition struct {
+	Sequence
+	location *time.Location
+}
+
+// Next returns the next number of the sequence, counted in mla_sequences with
+// one row per project, sequence and period. The counter row is locked by
+// the update until the transaction commits, so concurrent callers never get
+// the same number
+func (c *core) Next(pid int64, name string) (number string, err error) {
+	seq, ok := c.sequences[name]
+	if !ok {
+		return "", ErrUnknownSequence
+	}
+
+	now := time.Now().In(seq.location)
+	period, datePart := seq.period(now)
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO mla_sequences (
+			project_id,
+			name,
+			period,
+			value,
+			updated_at
+		) VALUES (
+			?,?,?,0,?
+		) ON DUPLICATE KEY UPDATE
+			project_id = project_id
+	`, pid, name, period, now)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE
+			mla_sequences
+		SET
+			value = value + 1,
+			updated_at = ?
+		WHERE
+			project_id = ? AND
+			name = ? AND
+			period = ?
+	`, now, pid, name, period)
+	if err != nil {
+		return "", err
+	}
+
+	var value int64
+	err = tx.Get(&value, `
+		SELECT
+			value
+		FROM
+			mla_sequences
+		WHERE
+			project_id = ? AND
+			name = ? AND
+			period = ?
+	`, pid, name, period)
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s%s%0*d", seq.prefix(pid), datePart, seq.Padding, value), nil
+}
@@ -0,0 +1,45 @@
+package sequence
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Init is used to initialize sequence package with the sequences it can generate
+func Init(db *sqlx.DB, sequences ...Sequence) ICore {
+	examineDBHealth(db)
+
+	c := &core{
+		db:        db,
+		sequences: make(map[string]definition, len(sequences)),
+	}
+	for _, seq := range sequences {
+		if seq.Reset != ResetDaily && seq.Reset != ResetMonthly && seq.Reset != ResetNever {
+			log.Fatalf("Failed to initialize sequence %s. err: %s", seq.Name, ErrInvalidReset)
+		}
+		location, err := time.LoadLocation(seq.Timezone)
+		if err != nil {
+			log.Fatalf("Failed to initialize sequence %s. invalid timezone %s. err: %s", seq.Name, seq.Timezone, err)
+		}
+		c.sequences[seq.Name] = definition{Sequence: seq, location: location}
+	}
+
+	return c
+}
+
+func examineDBHealth(db *sqlx.DB) {
+	if db == nil {
+		log.Fatalf("Failed to initialize sequence. db object cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize sequence. cannot pinging to db. err: %s", err)
+	}
+}
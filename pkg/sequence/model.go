@@ -0,0 +1,57 @@
+package sequence
+
+import (
+	"errors"
+	"time"
+)
+
+// Names of the sequences used by the service
+const (
+	OrderNumber     = "order_number"
+	QuotationNumber = "quotation_number"
+)
+
+// Reset periods of a sequence, the counter restarts from 1 every period
+const (
+	ResetDaily   = "daily"
+	ResetMonthly = "monthly"
+	ResetNever   = "never"
+)
+
+// Sequence defines how numbers of a sequence are formatted, e.g. prefix MN,
+// daily reset and padding 7 give MN<yymmdd><7 digits>. ProjectPrefixes
+// overrides Prefix by project id. The period is taken in Timezone, not in the
+// local time of the server
+type Sequence struct {
+	Name            string
+	Prefix          string
+	ProjectPrefixes map[int64]string
+	Reset           string
+	Padding         int
+	Timezone        string
+}
+
+// Errors returned by sequence
+var (
+	ErrUnknownSequence = errors.New("Sequence is not defined")
+	ErrInvalidReset    = errors.New("Sequence reset must be daily, monthly or never")
+)
+
+// prefix returns the prefix of the numbers of the project
+func (seq Sequence) prefix(pid int64) string {
+	if prefix, ok := seq.ProjectPrefixes[pid]; ok {
+		return prefix
+	}
+	return seq.Prefix
+}
+
+// period returns the key of the counter of now and the date part of the number
+func (seq Sequence) period(now time.Time) (key, datePart string) {
+	switch seq.Reset {
+	case ResetDaily:
+		return now.Format("20060102"), now.Format("060102")
+	case ResetMonthly:
+		return now.Format("200601"), now.Format("0601")
+	}
+	return "", ""
+}
@@ -1,42 +1,38 @@
 package subscription
 
 import (
-	"database/sql"
-	"encoding/json"
 	"fmt"
 	"time"
 
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 type ICore interface {
 	Select(pid int64) (subscriptions Subscriptions, err error)
 	Get(pid int64, id int64) (subscription Subscription, err error)
-	Insert(subscription *Subscription) (err error)
-	Update(subscription *Subscription, isAdmin bool, orderID string) (err error)
-	Delete(pid int64, id int64, isAdmin bool, userID string, orderID string) (err error)
+	Insert(subscription *Subscription, requestID string) (err error)
+	Update(subscription *Subscription, isAdmin bool, orderID string, requestID string) (err error)
+	Delete(pid int64, id int64, isAdmin bool, userID string, orderID string, requestID string) (err error)
 	GetByOrderNumber(pid int64, id string) (subscriptions Subscriptions, err error)
 }
 
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "subscription"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (subscriptions Subscriptions, err error) {
-	redisKey := fmt.Sprintf("%s:subscriptions", redisPrefix)
-	subscriptions, err = c.selectFromCache(redisKey)
-	if err != nil {
-		subscriptions, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(subscriptions)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "subscriptions", cacheTTL, &subscriptions, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -66,16 +62,9 @@ func (c *core) selectFromDB(pid int64) (subscription Subscriptions, err error) {
 }
 
 func (c *core) Get(pid int64, id int64) (subscription Subscription, err error) {
-	redisKey := fmt.Sprintf("%s:%d:subscription:%d", redisPrefix, pid, id)
-
-	subscription, err = c.getFromCache(redisKey)
-	if err != nil {
-		subscription, err = c.getFromDB(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(subscription)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("subscription:%d", id), cacheTTL, &subscription, func() (interface{}, error) {
+		return c.getFromDB(pid, id)
+	})
 	return
 }
 
@@ -105,7 +94,7 @@ func (c *core) getFromDB(pid int64, id int64) (subscription Subscription, err er
 	return
 }
 
-func (c *core) Insert(subscription *Subscription) (err error) {
+func (c *core) Insert(subscription *Subscription, requestID string) (err error) {
 	subscription.CreatedAt = time.Now()
 	subscription.UpdatedAt = subscription.CreatedAt
 	subscription.Status = 1
@@ -149,13 +138,17 @@ func (c *core) Insert(subscription *Subscription) (err error) {
 		subscription.CreatedBy,
 		subscription.LastUpdateBy,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_subscription",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    subscription.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -163,27 +156,16 @@ func (c *core) Insert(subscription *Subscription) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    subscription.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_subscription",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:subscriptions", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:subscription-by-order-id:%s", redisPrefix, subscription.OrderID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, subscription.ProjectID))
 
 	return
 }
 
-func (c *core) Update(subscription *Subscription, isAdmin bool, orderID string) (err error) {
+func (c *core) Update(subscription *Subscription, isAdmin bool, orderID string, requestID string) (err error) {
 	subscription.UpdatedAt = time.Now()
 	subscription.Status = 1
 
@@ -220,41 +202,32 @@ func (c *core) Update(subscription *Subscription, isAdmin bool, orderID string)
 		args = append(args, subscription.CreatedBy)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_subscription",
+		EntityID:   subscription.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    subscription.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    subscription.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_subscription",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:subscription:%d", redisPrefix, subscription.ProjectID, subscription.ID)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:subscriptions", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:subscription-by-order-id:%s", redisPrefix, orderID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, subscription.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string, orderID string) (err error) {
+func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string, orderID string, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -276,7 +249,6 @@ func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string, orderID
 		args = append(args, userID)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 
 	if err != nil {
@@ -284,33 +256,25 @@ func (c *core) Delete(pid int64, id int64, isAdmin bool, userID string, orderID
 	}
 
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_subscription",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    userID,
+		RequestID:  requestID,
+	}, query, args...)
 
 	if err != nil {
 		return err
 	}
 
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    "uid",
-		Query:     queryTrail,
-		TableName: "mla_subscription",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:subscription:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:subscriptions", redisPrefix)
-	_ = c.deleteCache(redisKey)
-
-	redisKey = fmt.Sprintf("%s:subscription-by-order-id:%s", redisPrefix, orderID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 	return
 }
 
@@ -340,47 +304,8 @@ func (c *core) getByOrderNumberFromDB(pid int64, orderNumber string) (subscripti
 }
 
 func (c *core) GetByOrderNumber(pid int64, id string) (subscriptions Subscriptions, err error) {
-	redisKey := fmt.Sprintf("%s:subscription-by-order-id:%s", redisPrefix, id)
-	subscriptions, err = c.selectFromCache(redisKey)
-
-	if err != nil {
-		subscriptions, err = c.getByOrderNumberFromDB(pid, id)
-		byt, _ := jsoniter.ConfigFastest.Marshal(subscriptions)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
-	return
-}
-func (c *core) selectFromCache(key string) (subscriptions Subscriptions, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &subscriptions)
-	return
-}
-
-func (c *core) getFromCache(key string) (subscription Subscription, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &subscription)
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("subscription-by-order-id:%s", id), cacheTTL, &subscriptions, func() (interface{}, error) {
+		return c.getByOrderNumberFromDB(pid, id)
+	})
 	return
 }
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
@@ -0,0 +1,362 @@
+package tax
+
+import (
+	"fmt"
+	"time"
+
+	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/order"
+	"github.com/jmoiron/sqlx"
+)
+
+// ICore is the interface
+type ICore interface {
+	Insert(rate *Rate, requestID string) (err error)
+	Update(rate *Rate, requestID string) (err error)
+	Delete(rate *Rate, requestID string) (err error)
+
+	Get(id int64, pid int64) (rate Rate, err error)
+	Select(pid int64) (rates Rates, err error)
+	GetEffective(pid int64, at time.Time) (rate Rate, err error)
+
+	SelectInvoices(pid int64, from, to time.Time) (invoices Invoices, err error)
+}
+
+// core contains db client
+type core struct {
+	db         *sqlx.DB
+	cache      cache.ICore
+	auditTrail auditTrail.ICore
+}
+
+const (
+	cacheNamespace = "tax"
+	cacheTTL       = 5 * time.Minute
+)
+
+func (c *core) Insert(rate *Rate, requestID string) (err error) {
+	rate.CreatedAt = time.Now()
+	rate.UpdatedAt = rate.CreatedAt
+	rate.Status = 1
+
+	query := `
+	INSERT INTO mla_tax_rates (
+		name,
+		rate,
+		price_mode,
+		effective_from,
+		status,
+		created_at,
+		created_by,
+		updated_at,
+		last_update_by,
+		project_id
+	) VALUES (
+		?,?,?,?,?,?,?,?,?,?
+	)`
+
+	args := []interface{}{
+		rate.Name,
+		rate.Rate,
+		rate.PriceMode,
+		rate.EffectiveFrom,
+		rate.Status,
+		rate.CreatedAt,
+		rate.CreatedBy,
+		rate.UpdatedAt,
+		rate.LastUpdateBy,
+		rate.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_tax_rates",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    rate.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	rate.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, rate.ProjectID))
+
+	return
+}
+
+func (c *core) Update(rate *Rate, requestID string) (err error) {
+	rate.UpdatedAt = time.Now()
+
+	query := `
+	UPDATE
+		mla_tax_rates
+	SET
+		name = ?,
+		rate = ?,
+		price_mode = ?,
+		effective_from = ?,
+		updated_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		rate.Name,
+		rate.Rate,
+		rate.PriceMode,
+		rate.EffectiveFrom,
+		rate.UpdatedAt,
+		rate.LastUpdateBy,
+		rate.ID,
+		rate.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_tax_rates",
+		EntityID:   rate.ID,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    rate.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, rate.ProjectID))
+
+	return
+}
+
+func (c *core) Delete(rate *Rate, requestID string) (err error) {
+	query := `
+	UPDATE
+		mla_tax_rates
+	SET
+		status = ?,
+		deleted_at = ?,
+		last_update_by = ?
+	WHERE
+		id = ? AND
+		project_id = ? AND
+		status = 1
+	`
+
+	args := []interface{}{
+		0,
+		time.Now(),
+		rate.LastUpdateBy,
+		rate.ID,
+		rate.ProjectID,
+	}
+
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_tax_rates",
+		EntityID:   rate.ID,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    rate.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, rate.ProjectID))
+
+	return
+}
+
+func (c *core) Get(id int64, pid int64) (rate Rate, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("tax-rate:%d", id), cacheTTL, &rate, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
+	return
+}
+
+func (c *core) getFromDB(id int64, pid int64) (rate Rate, err error) {
+	query := `
+		SELECT
+			id,
+			name,
+			rate,
+			price_mode,
+			effective_from,
+			status,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_tax_rates
+		WHERE
+			id = ? AND
+			project_id = ? AND
+			status = 1
+	`
+
+	err = c.db.Get(&rate, query, id, pid)
+
+	return
+}
+
+func (c *core) Select(pid int64) (rates Rates, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "tax-rates", cacheTTL, &rates, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
+	return
+}
+
+func (c *core) selectFromDB(pid int64) (rates Rates, err error) {
+	query := `
+		SELECT
+			id,
+			name,
+			rate,
+			price_mode,
+			effective_from,
+			status,
+			created_at,
+			created_by,
+			updated_at,
+			last_update_by,
+			deleted_at,
+			project_id
+		FROM
+			mla_tax_rates
+		WHERE
+			project_id = ? AND
+			status = 1
+		ORDER BY effective_from, id
+	`
+
+	err = c.db.Select(&rates, query, pid)
+
+	return
+}
+
+// GetEffective returns the rate in effect at the given time, it returns
+// ErrRateNotFound when no rate is effective yet
+func (c *core) GetEffective(pid int64, at time.Time) (rate Rate, err error) {
+	rates, err := c.Select(pid)
+	if err != nil {
+		return
+	}
+
+	found := false
+	for _, r := range rates {
+		if r.EffectiveFrom.After(at) {
+			continue
+		}
+		if !found || !r.EffectiveFrom.Before(rate.EffectiveFrom) {
+			rate, found = r, true
+		}
+	}
+	if !found {
+		err = ErrRateNotFound
+	}
+	return
+}
+
+// SelectInvoices returns the tax invoices of orders paid in [from, to), only
+// taxed order details are included
+func (c *core) SelectInvoices(pid int64, from, to time.Time) (invoices Invoices, err error) {
+	query := `
+		SELECT
+			orders.order_id,
+			orders.order_number,
+			orders.paid_at,
+			IFNULL(comp.name, '') AS company_name,
+			IFNULL(comp.npwp, '') AS company_npwp,
+			IFNULL(comp.address, '') AS company_address,
+			IFNULL(comp.city, '') AS company_city,
+			IFNULL(comp.province, '') AS company_province,
+			IFNULL(comp.zip, '') AS company_zip,
+			detail.item_type,
+			detail.description,
+			detail.quantity,
+			detail.tax_rate,
+			detail.tax_base,
+			detail.tax_amount
+		FROM
+			mla_orders orders
+			JOIN mla_order_details detail ON detail.order_id = orders.order_id
+			LEFT JOIN mla_venues venue ON detail.venue_id = venue.id
+			LEFT JOIN mla_company comp ON venue.pt_id = comp.id
+		WHERE
+			orders.project_id = ? AND
+			orders.status = ? AND
+			orders.paid_at >= ? AND
+			orders.paid_at < ? AND
+			orders.deleted_at IS NULL AND
+			detail.status = 1 AND
+			detail.tax_rate_id IS NOT NULL
+		ORDER BY orders.paid_at, orders.order_id, detail.id
+	`
+
+	var rows []invoiceRow
+	err = c.db.Select(&rows, query, pid, order.StatusPaid, from, to)
+	if err != nil {
+		return
+	}
+
+	for _, row := range rows {
+		if len(invoices) == 0 || invoices[len(invoices)-1].OrderID != row.OrderID {
+			invoices = append(invoices, Invoice{
+				OrderID:         row.OrderID,
+				OrderNumber:     row.OrderNumber,
+				PaidAt:          row.PaidAt,
+				CompanyName:     row.CompanyName,
+				CompanyNpwp:     row.CompanyNpwp,
+				CompanyAddress:  row.CompanyAddress,
+				CompanyCity:     row.CompanyCity,
+				CompanyProvince: row.CompanyProvince,
+				CompanyZip:      row.CompanyZip,
+			})
+		}
+		invoice := &invoices[len(invoices)-1]
+		invoice.Lines = append(invoice.Lines, InvoiceLine{
+			ItemType:    row.ItemType,
+			Description: row.Description,
+			Quantity:    row.Quantity,
+			TaxRate:     row.TaxRate,
+			TaxBase:     row.TaxBase,
+			TaxAmount:   row.TaxAmount,
+		})
+	}
+	return
+}
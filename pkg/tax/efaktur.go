@@ -0,0 +1,122 @@
+package tax
+
+import (
+	"encoding/csv"
+	"io"
+	"math"
+	"strconv"
+)
+
+// e-Faktur import rows, FK is a tax invoice, LT its buyer and OF its items
+var (
+	eFakturHeaderFK = []string{"FK", "KD_JENIS_TRANSAKSI", "FG_PENGGANTI", "NOMOR_FAKTUR", "MASA_PAJAK", "TAHUN_PAJAK", "TANGGAL_FAKTUR", "NPWP", "NAMA", "ALAMAT_LENGKAP", "JUMLAH_DPP", "JUMLAH_PPN", "JUMLAH_PPNBM", "ID_KETERANGAN_TAMBAHAN", "FG_UANG_MUKA", "UANG_MUKA_DPP", "UANG_MUKA_PPN", "UANG_MUKA_PPNBM", "REFERENSI", "KODE_DOKUMEN_PENDUKUNG"}
+	eFakturHeaderLT = []string{"LT", "NPWP", "NAMA", "JALAN", "BLOK", "NOMOR", "RT", "RW", "KECAMATAN", "KELURAHAN", "KABUPATEN", "PROPINSI", "KODE_POS", "NOMOR_TELEPON"}
+	eFakturHeaderOF = []string{"OF", "KODE_OBJEK", "NAMA", "HARGA_SATUAN", "JUMLAH_BARANG", "HARGA_TOTAL", "DISKON", "DPP", "PPN", "TARIF_PPNBM", "PPNBM"}
+)
+
+// eFakturTransactionCode is KD_JENIS_TRANSAKSI of deliveries to buyers who
+// are not tax collectors
+const eFakturTransactionCode = "01"
+
+// WriteEFaktur writes invoices as e-Faktur import csv. NOMOR_FAKTUR is left
+// empty to be assigned by the tax reporting tool, REFERENSI is the order
+// number. Amounts are whole rupiah as e-Faktur requires. Lines with a negative
+// tax base are discounts, e-Faktur has no negative items so they are spread
+// over the other items by their tax base as DISKON
+func WriteEFaktur(w io.Writer, invoices Invoices) error {
+	cw := csv.NewWriter(w)
+
+	for _, header := range [][]string{eFakturHeaderFK, eFakturHeaderLT, eFakturHeaderOF} {
+		err := cw.Write(header)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, invoice := range invoices {
+		var charged, discountBase, discountTax float64
+		for _, line := range invoice.Lines {
+			if line.TaxBase < 0 {
+				discountBase -= line.TaxBase
+				discountTax -= line.TaxAmount
+				continue
+			}
+			charged += line.TaxBase
+		}
+
+		var base, tax float64
+		items := make([][]string, 0, len(invoice.Lines))
+		for _, line := range invoice.Lines {
+			if line.TaxBase < 0 {
+				continue
+			}
+
+			var share float64
+			if charged > 0 {
+				share = line.TaxBase / charged
+			}
+			gross := math.Floor(line.TaxBase)
+			lineBase := math.Floor(line.TaxBase - discountBase*share)
+			lineTax := math.Floor(line.TaxAmount - discountTax*share)
+			base += lineBase
+			tax += lineTax
+
+			quantity := line.Quantity
+			if quantity <= 0 {
+				quantity = 1
+			}
+			items = append(items, []string{
+				"OF",
+				line.ItemType,
+				line.Description,
+				formatRupiah(line.TaxBase / float64(quantity)),
+				strconv.FormatInt(quantity, 10),
+				formatRupiah(gross),
+				formatRupiah(gross - lineBase),
+				formatRupiah(lineBase),
+				formatRupiah(lineTax),
+				"0",
+				"0",
+			})
+		}
+
+		err := cw.Write([]string{
+			"FK",
+			eFakturTransactionCode,
+			"0",
+			"",
+			strconv.Itoa(int(invoice.PaidAt.Month())),
+			strconv.Itoa(invoice.PaidAt.Year()),
+			invoice.PaidAt.Format("02/01/2006"),
+			NpwpDigits(invoice.CompanyNpwp),
+			invoice.CompanyName,
+			invoice.Address(),
+			formatRupiah(base),
+			formatRupiah(tax),
+			"0",
+			"",
+			"0",
+			"0",
+			"0",
+			"0",
+			invoice.OrderNumber,
+			"",
+		})
+		if err != nil {
+			return err
+		}
+		for _, item := range items {
+			err = cw.Write(item)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func formatRupiah(amount float64) string {
+	return strconv.FormatFloat(math.Floor(amount), 'f', 0, 64)
+}
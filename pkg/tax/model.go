@@ -0,0 +1,161 @@
+package tax
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+)
+
+// Price modes of a rate, inclusive prices already contain the tax while
+// exclusive prices get the tax added on top
+const (
+	PriceModeInclusive = "inclusive"
+	PriceModeExclusive = "exclusive"
+)
+
+// Rate is model for mla_tax_rates in db. The rate of an order is the one with
+// the latest EffectiveFrom not after the order is priced
+type Rate struct {
+	ID            int64     `db:"id"`
+	Name          string    `db:"name"`
+	Rate          float64   `db:"rate"`
+	PriceMode     string    `db:"price_mode"`
+	EffectiveFrom time.Time `db:"effective_from"`
+	Status        int16     `db:"status"`
+	CreatedAt     time.Time `db:"created_at"`
+	CreatedBy     string    `db:"created_by"`
+	UpdatedAt     time.Time `db:"updated_at"`
+	LastUpdateBy  string    `db:"last_update_by"`
+	DeletedAt     null.Time `db:"deleted_at"`
+	ProjectID     int64     `db:"project_id"`
+}
+
+// Rates is list of rate
+type Rates []Rate
+
+// Errors returned when a rate is not valid or not found
+var (
+	ErrRateNotFound     = errors.New("Tax rate is not found")
+	ErrInvalidRate      = errors.New("Tax rate must be between 0 and 100 percent")
+	ErrInvalidPriceMode = errors.New("Price mode must be inclusive or exclusive")
+	ErrInvalidEffective = errors.New("Effective from is required")
+)
+
+// Validate checks the rate is complete
+func (rate Rate) Validate() error {
+	if rate.Rate < 0 || rate.Rate > 100 {
+		return ErrInvalidRate
+	}
+	if rate.PriceMode != PriceModeInclusive && rate.PriceMode != PriceModeExclusive {
+		return ErrInvalidPriceMode
+	}
+	if rate.EffectiveFrom.IsZero() {
+		return ErrInvalidEffective
+	}
+	return nil
+}
+
+// Apply splits amount charged for an item into the tax base (DPP) and the
+// tax (PPN), rounded to cents
+func (rate Rate) Apply(amount float64) (base, tax float64) {
+	factor := rate.Rate / 100
+	if rate.PriceMode == PriceModeInclusive {
+		base = round(amount / (1 + factor))
+		return base, round(amount - base)
+	}
+	return amount, round(amount * factor)
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// npwpDigits is the number of digits of a NPWP
+const npwpDigits = 15
+
+// NpwpDigits returns the digits of npwp, a buyer without NPWP gets zeros
+func NpwpDigits(npwp string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r < '0' || r > '9' {
+			return -1
+		}
+		return r
+	}, npwp)
+	if digits == "" {
+		return strings.Repeat("0", npwpDigits)
+	}
+	return digits
+}
+
+// FormatNpwp formats npwp as 00.000.000.0-000.000, it is returned as is
+// when it does not have 15 digits
+func FormatNpwp(npwp string) string {
+	d := NpwpDigits(npwp)
+	if len(d) != npwpDigits {
+		return npwp
+	}
+	return d[0:2] + "." + d[2:5] + "." + d[5:8] + "." + d[8:9] + "-" + d[9:12] + "." + d[12:15]
+}
+
+// Invoice is tax invoice data of a paid order
+type Invoice struct {
+	OrderID         int64
+	OrderNumber     string
+	PaidAt          time.Time
+	CompanyName     string
+	CompanyNpwp     string
+	CompanyAddress  string
+	CompanyCity     string
+	CompanyProvince string
+	CompanyZip      string
+	Lines           InvoiceLines
+}
+
+// Address returns the full address of the buyer company
+func (invoice Invoice) Address() string {
+	parts := make([]string, 0, 4)
+	for _, part := range []string{invoice.CompanyAddress, invoice.CompanyCity, invoice.CompanyProvince, invoice.CompanyZip} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Invoices is list of invoice
+type Invoices []Invoice
+
+// InvoiceLine is taxed order detail of an invoice
+type InvoiceLine struct {
+	ItemType    string
+	Description string
+	Quantity    int64
+	TaxRate     float64
+	TaxBase     float64
+	TaxAmount   float64
+}
+
+// InvoiceLines is list of invoice line
+type InvoiceLines []InvoiceLine
+
+// invoiceRow is an order detail joined with its order and buyer company
+type invoiceRow struct {
+	OrderID         int64     `db:"order_id"`
+	OrderNumber     string    `db:"order_number"`
+	PaidAt          time.Time `db:"paid_at"`
+	CompanyName     string    `db:"company_name"`
+	CompanyNpwp     string    `db:"company_npwp"`
+	CompanyAddress  string    `db:"company_address"`
+	CompanyCity     string    `db:"company_city"`
+	CompanyProvince string    `db:"company_province"`
+	CompanyZip      string    `db:"company_zip"`
+	ItemType        string    `db:"item_type"`
+	Description     string    `db:"description"`
+	Quantity        int64     `db:"quantity"`
+	TaxRate         float64   `db:"tax_rate"`
+	TaxBase         float64   `db:"tax_base"`
+	TaxAmount       float64   `db:"tax_amount"`
+}
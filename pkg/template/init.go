@@ -0,0 +1,79 @@
+package template
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
+)
+
+// Init is used to initialize template package. Templates of the project are
+// resolved from db, .tmpl files in paths are used when db has none
+func Init(db *sqlx.DB, cache cache.ICore, pid int64, paths ...string) ICore {
+	examineDBHealth(db)
+	return &core{
+		db:        db,
+		cache:     cache,
+		projectID: pid,
+		t:         loadFiles(paths...),
+	}
+}
+
+// loadFiles parses .tmpl files in paths by their file name
+func loadFiles(paths ...string) map[string]*template.Template {
+	var ts = make(map[string]*template.Template, 0)
+	for _, path := range paths {
+		f, err := os.Stat(path)
+		if err != nil {
+			panic(err)
+		}
+
+		if !f.IsDir() {
+			panic(errors.New("You must pass directory path"))
+		}
+
+		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+			if !isTemplate(path) {
+				return nil
+			}
+
+			t, err := template.ParseFiles(path)
+			if err != nil {
+				return err
+			}
+
+			ts[t.Name()] = t
+			return nil
+		})
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	return ts
+}
+
+func isTemplate(path string) bool {
+	return filepath.Ext(path) == ".tmpl"
+}
+
+func examineDBHealth(db *sqlx.DB) {
+	if db == nil {
+		log.Fatalf("Failed to initialize template. db object cannot be nil")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := db.PingContext(ctx)
+	if err != nil {
+		log.Fatalf("Failed to initialize template. cannot pinging to db. err: %s", err)
+	}
+}
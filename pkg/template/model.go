@@ -0,0 +1,40 @@
+package template
+
+import (
+	"errors"
+	"time"
+)
+
+// Locales of templates
+const (
+	LocaleID = "id"
+	LocaleEN = "en"
+
+	DefaultLocale = LocaleID
+)
+
+// ErrInvalidLocale is returned for locale other than LocaleID and LocaleEN
+var ErrInvalidLocale = errors.New("locale must be id or en")
+
+// Template is model for mla_templates in db, a version of the template name
+// in locale. Versions are never changed, the active one is pointed by
+// mla_template_actives
+type Template struct {
+	ID        int64     `db:"id"`
+	Name      string    `db:"name"`
+	Locale    string    `db:"locale"`
+	Version   int64     `db:"version"`
+	Content   string    `db:"content"`
+	Active    bool      `db:"active"`
+	ProjectID int64     `db:"project_id"`
+	CreatedAt time.Time `db:"created_at"`
+	CreatedBy string    `db:"created_by"`
+}
+
+// Templates is list of template
+type Templates []Template
+
+// IsValidLocale reports whether templates can be stored in locale
+func IsValidLocale(locale string) bool {
+	return locale == LocaleID || locale == LocaleEN
+}
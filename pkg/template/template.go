@@ -1,73 +1,308 @@
 package template
 
 import (
+	"database/sql"
 	"errors"
-	"os"
-	"path/filepath"
-	"sync"
+	"fmt"
 	"text/template"
+	"time"
+
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
+	"github.com/jmoiron/sqlx"
 )
 
 type ICore interface {
 	Get(name string) (*template.Template, error)
+	GetLocale(name string, locale string) (*template.Template, error)
+	GetVersion(name string, locale string, version int64) (tmpl Template, err error)
+	SelectVersions(name string) (tmpls Templates, err error)
+	Upload(tmpl *Template, activate bool) (err error)
+	Activate(name string, locale string, version int64, userID string) (err error)
 	//GetBase64Png(licenseNum string) string
 }
 
 type core struct {
-	t         map[string]*template.Template
-	mux       sync.RWMutex
-	urlQrCode string
+	db        *sqlx.DB
+	cache     cache.ICore
+	projectID int64
+
+	// t holds the templates of disk, used when db has no active version
+	t map[string]*template.Template
 }
 
 // ErrTemplateNotFound ...
 var ErrTemplateNotFound = errors.New("Template is not found")
 
-// New ...
-func New(paths ...string) ICore {
-	var ts = core{t: make(map[string]*template.Template, 0)}
-	for _, path := range paths {
-		f, err := os.Stat(path)
+const (
+	cacheNamespace = "template"
+	cacheTTL       = 5 * time.Minute
+)
+
+// Get returns the active template name in the default locale
+func (c *core) Get(name string) (*template.Template, error) {
+	return c.GetLocale(name, DefaultLocale)
+}
+
+// GetLocale returns the active template name in locale, then in the default
+// locale, then the one of disk
+func (c *core) GetLocale(name string, locale string) (*template.Template, error) {
+	locales := []string{locale}
+	if locale != DefaultLocale {
+		locales = append(locales, DefaultLocale)
+	}
+
+	for _, l := range locales {
+		tmpl, err := c.getActive(name, l)
 		if err != nil {
-			panic(err)
+			return nil, err
+		}
+		if tmpl.Content != "" {
+			return Parse(tmpl.Name, tmpl.Content)
 		}
+	}
+
+	t, ok := c.t[name]
+	if ok {
+		return t.Clone()
+	}
+	return nil, ErrTemplateNotFound
+}
 
-		if !f.IsDir() {
-			panic(errors.New("You must pass directory path"))
+// getActive returns the active version of name in locale, with empty content
+// when there is none so that misses are cached too
+func (c *core) getActive(name string, locale string) (tmpl Template, err error) {
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, c.projectID), fmt.Sprintf("active:%s:%s", locale, name), cacheTTL, &tmpl, func() (interface{}, error) {
+		tmpl, err := c.getActiveFromDB(name, locale)
+		if err == sql.ErrNoRows {
+			return Template{}, nil
 		}
+		return tmpl, err
+	})
+	return
+}
 
-		err = filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-			if !isTemplate(path) {
-				return nil
-			}
+func (c *core) getActiveFromDB(name string, locale string) (tmpl Template, err error) {
+	err = c.db.Get(&tmpl, `
+		SELECT
+			t.id,
+			t.name,
+			t.locale,
+			t.version,
+			t.content,
+			TRUE AS active,
+			t.project_id,
+			t.created_at,
+			t.created_by
+		FROM
+			mla_template_actives a
+			JOIN mla_templates t ON
+				t.project_id = a.project_id AND
+				t.name = a.name AND
+				t.locale = a.locale AND
+				t.version = a.version
+		WHERE
+			a.project_id = ? AND
+			a.name = ? AND
+			a.locale = ?
+	`, c.projectID, name, locale)
+	return
+}
 
-			t, err := template.ParseFiles(path)
-			if err != nil {
-				return err
-			}
+func (c *core) GetVersion(name string, locale string, version int64) (tmpl Template, err error) {
+	err = c.db.Get(&tmpl, `
+		SELECT
+			t.id,
+			t.name,
+			t.locale,
+			t.version,
+			t.content,
+			a.version IS NOT NULL AS active,
+			t.project_id,
+			t.created_at,
+			t.created_by
+		FROM
+			mla_templates t
+			LEFT JOIN mla_template_actives a ON
+				a.project_id = t.project_id AND
+				a.name = t.name AND
+				a.locale = t.locale AND
+				a.version = t.version
+		WHERE
+			t.project_id = ? AND
+			t.name = ? AND
+			t.locale = ? AND
+			t.version = ?
+	`, c.projectID, name, locale, version)
+	return
+}
+
+// SelectVersions returns versions of name in all locales, newest first
+func (c *core) SelectVersions(name string) (tmpls Templates, err error) {
+	err = c.db.Select(&tmpls, `
+		SELECT
+			t.id,
+			t.name,
+			t.locale,
+			t.version,
+			t.content,
+			a.version IS NOT NULL AS active,
+			t.project_id,
+			t.created_at,
+			t.created_by
+		FROM
+			mla_templates t
+			LEFT JOIN mla_template_actives a ON
+				a.project_id = t.project_id AND
+				a.name = t.name AND
+				a.locale = t.locale AND
+				a.version = t.version
+		WHERE
+			t.project_id = ? AND
+			t.name = ?
+		ORDER BY t.locale, t.version DESC
+	`, c.projectID, name)
+	return
+}
+
+// Upload stores tmpl as the next version of its name and locale, it becomes
+// the active version when activate is set. The content must parse
+func (c *core) Upload(tmpl *Template, activate bool) (err error) {
+	if !IsValidLocale(tmpl.Locale) {
+		return ErrInvalidLocale
+	}
+	_, err = Parse(tmpl.Name, tmpl.Content)
+	if err != nil {
+		return err
+	}
 
-			ts.t[t.Name()] = t
-			return nil
-		})
+	tmpl.ProjectID = c.projectID
+	tmpl.CreatedAt = time.Now()
 
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.Get(&tmpl.Version, `
+		SELECT
+			COALESCE(MAX(version), 0) + 1
+		FROM
+			mla_templates
+		WHERE
+			project_id = ? AND
+			name = ? AND
+			locale = ?
+		FOR UPDATE
+	`, tmpl.ProjectID, tmpl.Name, tmpl.Locale)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.NamedExec(`
+		INSERT INTO mla_templates (
+			name,
+			locale,
+			version,
+			content,
+			project_id,
+			created_at,
+			created_by
+		) VALUES (
+			:name,
+			:locale,
+			:version,
+			:content,
+			:project_id,
+			:created_at,
+			:created_by
+		)
+	`, tmpl)
+	if err != nil {
+		return err
+	}
+	tmpl.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if activate {
+		err = c.activate(tx, tmpl.Name, tmpl.Locale, tmpl.Version, tmpl.CreatedBy)
 		if err != nil {
-			panic(err)
+			return err
 		}
+		tmpl.Active = true
 	}
 
-	return &ts
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, c.projectID))
+
+	return
 }
 
-// Get ...
-func (c *core) Get(name string) (*template.Template, error) {
-	c.mux.RLock()
-	t, ok := c.t[name]
-	c.mux.RUnlock()
-	if ok {
-		return t.Clone()
+// Activate points the active version of name in locale to version
+func (c *core) Activate(name string, locale string, version int64, userID string) (err error) {
+	tx, err := c.db.Beginx()
+	if err != nil {
+		return err
 	}
-	return nil, ErrTemplateNotFound
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.Get(&id, `
+		SELECT
+			id
+		FROM
+			mla_templates
+		WHERE
+			project_id = ? AND
+			name = ? AND
+			locale = ? AND
+			version = ?
+	`, c.projectID, name, locale, version)
+	if err != nil {
+		return err
+	}
+
+	err = c.activate(tx, name, locale, version, userID)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, c.projectID))
+
+	return
+}
+
+func (c *core) activate(tx *sqlx.Tx, name string, locale string, version int64, userID string) (err error) {
+	_, err = tx.Exec(`
+		INSERT INTO mla_template_actives (
+			project_id,
+			name,
+			locale,
+			version,
+			updated_at,
+			last_update_by
+		) VALUES (
+			?, ?, ?, ?, ?, ?
+		) ON DUPLICATE KEY UPDATE
+			version = VALUES(version),
+			updated_at = VALUES(updated_at),
+			last_update_by = VALUES(last_update_by)
+	`, c.projectID, name, locale, version, time.Now(), userID)
+	return
 }
 
-func isTemplate(path string) bool {
-	return filepath.Ext(path) == ".tmpl"
+// Parse parses content as template name
+func Parse(name string, content string) (*template.Template, error) {
+	return template.New(name).Parse(content)
 }
@@ -1,16 +1,12 @@
 package venue
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
 
-	"encoding/json"
-
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
@@ -25,30 +21,32 @@ type ICore interface {
 	GetCity(cityName string) (venues VenueAvailables, err error)
 	GetStatus(pid int64, id int64) (venue Venue, err error)
 	Get(pid int64, id int64, uid string) (venue Venue, err error)
-	Insert(venue *Venue) (err error)
+	Insert(venue *Venue, requestID string) (err error)
 	InsertVenueAvailable(cityName string, status int64) (err error)
-	Update(venue *Venue, uid string, isAdmin bool) (err error)
+	Update(venue *Venue, uid string, isAdmin bool, requestID string) (err error)
 	UpdateStatusVenueAvailable(cityName string, status int64) (err error)
-	Delete(pid int64, id int64, uid string, created_by string, isAdmin bool) (err error)
+	Delete(pid int64, id int64, uid string, created_by string, isAdmin bool, requestID string) (err error)
 }
 
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "venue"
+	cacheTTL       = 5 * time.Minute
+
+	// orderCacheNamespace holds the order summaries, they show venue data
+	orderCacheNamespace = "order"
+)
 
 func (c *core) Select(pid int64, uid string) (venues Venues, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:venue", redisPrefix, pid, uid)
-	venues, err = c.selectFromCache(redisKey)
-	if err != nil {
-		venues, err = c.selectFromDB(pid, uid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(venues)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:venue", uid), cacheTTL, &venues, func() (interface{}, error) {
+		return c.selectFromDB(pid, uid)
+	})
 	return
 }
 
@@ -188,16 +186,9 @@ func (c *core) getStatusFromDB(id int64, pid int64) (venue Venue, err error) {
 }
 
 func (c *core) Get(pid int64, id int64, uid string) (venue Venue, err error) {
-	redisKey := fmt.Sprintf("%s:%d:%s:venue:%d", redisPrefix, pid, uid, id)
-
-	venue, err = c.getFromCache(redisKey)
-	if err != nil {
-		venue, err = c.getFromDB(id, pid, uid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(venue)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("%s:venue:%d", uid, id), cacheTTL, &venue, func() (interface{}, error) {
+		return c.getFromDB(id, pid, uid)
+	})
 	return
 }
 func (c *core) getFromDB(id int64, pid int64, uid string) (venue Venue, err error) {
@@ -460,7 +451,7 @@ func (c *core) getFromDBCity(cityName string) (venue VenueAvailables, err error)
 	return
 }
 
-func (c *core) Insert(venue *Venue) (err error) {
+func (c *core) Insert(venue *Venue, requestID string) (err error) {
 	query := `
 		INSERT INTO mla_venues (
 			venue_type,
@@ -530,13 +521,17 @@ func (c *core) Insert(venue *Venue) (err error) {
 		venue.PtID,
 		venue.ShowStatus,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_venues",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    venue.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -545,22 +540,12 @@ func (c *core) Insert(venue *Venue) (err error) {
 		return err
 	}
 
-	//Add Logs
-	dataTrail := auditTrail.AuditTrail{
-		UserID:    venue.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_venue",
-	}
-	c.auditTrail.Insert(tx, &dataTrail)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:%s:venue", redisPrefix, venue.ProjectID, venue.CreatedBy)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::venue", redisPrefix, venue.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, venue.ProjectID))
 
 	return
 }
@@ -593,7 +578,7 @@ func (c *core) InsertVenueAvailable(cityName string, status int64) (err error) {
 	return
 }
 
-func (c *core) Update(venue *Venue, uid string, isAdmin bool) (err error) {
+func (c *core) Update(venue *Venue, uid string, isAdmin bool, requestID string) (err error) {
 
 	query := `
 		UPDATE
@@ -646,47 +631,32 @@ func (c *core) Update(venue *Venue, uid string, isAdmin bool) (err error) {
 		query = query + ` AND created_by = ?`
 		args = append(args, venue.CreatedBy)
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_venues",
+		EntityID:   venue.Id,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    venue.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataTrail := auditTrail.AuditTrail{
-		UserID:    venue.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_venues",
-	}
-	c.auditTrail.Insert(tx, &dataTrail)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:%s:venue:%d", redisPrefix, venue.ProjectID, venue.CreatedBy, venue.Id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::venue:%d", redisPrefix, venue.ProjectID, venue.Id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:venue", redisPrefix, venue.ProjectID, venue.CreatedBy)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::venue", redisPrefix, venue.ProjectID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:sumvenue-id:%d", redisPrefix, venue.ProjectID, venue.CreatedBy, venue.Id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:sumvenue", redisPrefix, venue.ProjectID, venue.CreatedBy)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:sumvenue-licnumber:*", redisPrefix, venue.ProjectID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, venue.ProjectID), cache.Namespace(orderCacheNamespace, venue.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(pid int64, id int64, uid string, created_by string, isAdmin bool) (err error) {
+func (c *core) Delete(pid int64, id int64, uid string, created_by string, isAdmin bool, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -711,42 +681,27 @@ func (c *core) Delete(pid int64, id int64, uid string, created_by string, isAdmi
 		query = query + ` AND created_by = ?`
 		args = append(args, created_by)
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_venues",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    uid,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataTrail := auditTrail.AuditTrail{
-		UserID:    uid,
-		Query:     queryTrail,
-		TableName: "mla_venues",
-	}
-	c.auditTrail.Insert(tx, &dataTrail)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:%s:venue:%d", redisPrefix, pid, created_by, id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::venue:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:venue", redisPrefix, pid, created_by)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d::venue", redisPrefix, pid)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:sumvenue-id:%d", redisPrefix, pid, created_by, id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:%s:sumvenue", redisPrefix, pid, created_by)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:sumvenue-licnumber:*", redisPrefix, pid)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid), cache.Namespace(orderCacheNamespace, pid))
 	return
 }
 
@@ -769,38 +724,3 @@ func (c *core) SelectVenueByLisenceID(pid int64, lid int64) (venueAddress VenueA
 	`, pid, lid)
 	return
 }
-
-func (c *core) selectFromCache(redisKey string) (venues Venues, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", redisKey))
-	err = json.Unmarshal(b, &venues)
-	return
-}
-
-func (c *core) getFromCache(key string) (venue Venue, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &venue)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}
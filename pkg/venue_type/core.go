@@ -1,16 +1,12 @@
 package venue_type
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
 
-	"encoding/json"
-
 	auditTrail "git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/audit_trail"
-	"github.com/gomodule/redigo/redis"
+	"git.sstv.io/apps/molanobar/api/molanobar-core.git/pkg/cache"
 	"github.com/jmoiron/sqlx"
-	jsoniter "github.com/json-iterator/go"
 )
 
 // ICore is the interface
@@ -18,28 +14,27 @@ type ICore interface {
 	Select(pid int64) (venueTypes VenueTypes, err error)
 	Get(pid int64, id int64) (venueType VenueType, err error)
 	GetByCommercialType(pid int64, id int64) (venueTypes VenueTypes, err error)
-	Insert(venueType *VenueType) (err error)
-	Update(venueType *VenueType, comId int64, isAdmin bool) (err error)
-	Delete(pid int64, id int64, comId int64, uid string, isAdmin bool) (err error)
+	Insert(venueType *VenueType, requestID string) (err error)
+	Update(venueType *VenueType, comId int64, isAdmin bool, requestID string) (err error)
+	Delete(pid int64, id int64, comId int64, uid string, isAdmin bool, requestID string) (err error)
 }
 
 // core contains db client
 type core struct {
 	db         *sqlx.DB
-	redis      *redis.Pool
+	cache      cache.ICore
 	auditTrail auditTrail.ICore
 }
 
-const redisPrefix = "molanobar-v1"
+const (
+	cacheNamespace = "venue_type"
+	cacheTTL       = 5 * time.Minute
+)
 
 func (c *core) Select(pid int64) (venueTypes VenueTypes, err error) {
-	redisKey := fmt.Sprintf("%s:%d:venueType", redisPrefix, pid)
-	venueTypes, err = c.selectFromCache(redisKey)
-	if err != nil {
-		venueTypes, err = c.selectFromDB(pid)
-		byt, _ := jsoniter.ConfigFastest.Marshal(venueTypes)
-		_ = c.setToCache(redisKey, 300, byt)
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), "venueType", cacheTTL, &venueTypes, func() (interface{}, error) {
+		return c.selectFromDB(pid)
+	})
 	return
 }
 
@@ -70,16 +65,9 @@ func (c *core) selectFromDB(pid int64) (venueType VenueTypes, err error) {
 }
 
 func (c *core) Get(pid int64, id int64) (venueType VenueType, err error) {
-	redisKey := fmt.Sprintf("%s:%d:venueType:%d", redisPrefix, pid, id)
-
-	venueType, err = c.getFromCache(redisKey)
-	if err != nil {
-		venueType, err = c.getFromDB(id, pid)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(venueType)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("venueType:%d", id), cacheTTL, &venueType, func() (interface{}, error) {
+		return c.getFromDB(id, pid)
+	})
 	return
 }
 func (c *core) getFromDB(id int64, pid int64) (venueType VenueType, err error) {
@@ -110,15 +98,9 @@ func (c *core) getFromDB(id int64, pid int64) (venueType VenueType, err error) {
 }
 
 func (c *core) GetByCommercialType(pid int64, id int64) (venueTypes VenueTypes, err error) {
-	redisKey := fmt.Sprintf("%s:%d:venueType-by-commercial-type:%d", redisPrefix, pid, id)
-	venueTypes, err = c.selectFromCache(redisKey)
-	if err != nil {
-		venueTypes, err = c.GetByCommercialTypeID(pid, id)
-		if err != sql.ErrNoRows {
-			byt, _ := jsoniter.ConfigFastest.Marshal(venueTypes)
-			_ = c.setToCache(redisKey, 300, byt)
-		}
-	}
+	err = c.cache.GetOrLoad(cache.Namespace(cacheNamespace, pid), fmt.Sprintf("venueType-by-commercial-type:%d", id), cacheTTL, &venueTypes, func() (interface{}, error) {
+		return c.GetByCommercialTypeID(pid, id)
+	})
 	return
 }
 
@@ -149,7 +131,7 @@ func (c *core) GetByCommercialTypeID(pid int64, commercialTypeId int64) (venueTy
 	return
 }
 
-func (c *core) Insert(venueType *VenueType) (err error) {
+func (c *core) Insert(venueType *VenueType, requestID string) (err error) {
 	query := `
 	INSERT INTO mla_venue_types (
 		name,
@@ -189,13 +171,17 @@ func (c *core) Insert(venueType *VenueType) (err error) {
 		venueType.CreatedBy,
 		venueType.LastUpdateBy,
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	res, err := tx.Exec(query, args...)
+	res, err := c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_venue_types",
+		Action:     auditTrail.ActionCreate,
+		ActorID:    venueType.CreatedBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
@@ -203,27 +189,17 @@ func (c *core) Insert(venueType *VenueType) (err error) {
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    venueType.CreatedBy,
-		Query:     queryTrail,
-		TableName: "mla_venue_types",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
 
-	redisKey := fmt.Sprintf("%s:%d:venueType", redisPrefix, venueType.ProjectID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:venueType-by-commercial-type:%d", redisPrefix, venueType.ProjectID, venueType.CommercialTypeID)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, venueType.ProjectID))
 
 	return
 }
 
-func (c *core) Update(venueType *VenueType, comId int64, isAdmin bool) (err error) {
+func (c *core) Update(venueType *VenueType, comId int64, isAdmin bool, requestID string) (err error) {
 	query := `
 		UPDATE
 			mla_venue_types
@@ -254,38 +230,31 @@ func (c *core) Update(venueType *VenueType, comId int64, isAdmin bool) (err erro
 		query += ` AND created_by = ? `
 		args = append(args, venueType.CreatedBy)
 	}
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_venue_types",
+		EntityID:   venueType.Id,
+		Action:     auditTrail.ActionUpdate,
+		ActorID:    venueType.LastUpdateBy,
+		RequestID:  requestID,
+	}, query, args...)
 	if err != nil {
 		return err
 	}
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    venueType.LastUpdateBy,
-		Query:     queryTrail,
-		TableName: "mla_venue_types",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:%d:venueType:%d", redisPrefix, venueType.ProjectID, venueType.Id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:venueType", redisPrefix, venueType.ProjectID)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:venueType-by-commercial-type:%d", redisPrefix, venueType.ProjectID, comId)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, venueType.ProjectID))
 
 	return
 }
 
-func (c *core) Delete(pid int64, id int64, comId int64, uid string, isAdmin bool) (err error) {
+func (c *core) Delete(pid int64, id int64, comId int64, uid string, isAdmin bool, requestID string) (err error) {
 	now := time.Now()
 
 	query := `
@@ -307,7 +276,6 @@ func (c *core) Delete(pid int64, id int64, comId int64, uid string, isAdmin bool
 		args = append(args, uid)
 	}
 
-	queryTrail := auditTrail.ConstructLogQuery(query, args...)
 	tx, err := c.db.Beginx()
 
 	if err != nil {
@@ -315,64 +283,23 @@ func (c *core) Delete(pid int64, id int64, comId int64, uid string, isAdmin bool
 	}
 
 	defer tx.Rollback()
-	_, err = tx.Exec(query, args...)
+	_, err = c.auditTrail.Exec(tx, &auditTrail.AuditTrail{
+		EntityType: "mla_venue_types",
+		EntityID:   id,
+		Action:     auditTrail.ActionDelete,
+		ActorID:    uid,
+		RequestID:  requestID,
+	}, query, args...)
 
 	if err != nil {
 		return err
 	}
 
-	//Add Logs
-	dataAudit := auditTrail.AuditTrail{
-		UserID:    "uid",
-		Query:     queryTrail,
-		TableName: "mla_venue_types",
-	}
-	c.auditTrail.Insert(tx, &dataAudit)
 	err = tx.Commit()
 
 	if err != nil {
 		return err
 	}
-	redisKey := fmt.Sprintf("%s:%d:venueType:%d", redisPrefix, pid, id)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:venueType", redisPrefix, pid)
-	_ = c.deleteCache(redisKey)
-	redisKey = fmt.Sprintf("%s:%d:venueType-by-commercial-type:%d", redisPrefix, pid, comId)
-	_ = c.deleteCache(redisKey)
+	_ = c.cache.Invalidate(cache.Namespace(cacheNamespace, pid))
 	return
 }
-
-func (c *core) selectFromCache(redisKey string) (venueTypes VenueTypes, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", redisKey))
-	err = json.Unmarshal(b, &venueTypes)
-	return
-}
-
-func (c *core) getFromCache(key string) (venueType VenueType, err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	b, err := redis.Bytes(conn.Do("GET", key))
-	err = json.Unmarshal(b, &venueType)
-	return
-}
-
-func (c *core) setToCache(key string, expired int, data []byte) (err error) {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err = conn.Do("SET", key, data)
-	_, err = conn.Do("EXPIRE", key, expired)
-	return
-}
-
-func (c *core) deleteCache(key string) error {
-	conn := c.redis.Get()
-	defer conn.Close()
-
-	_, err := conn.Do("DEL", key)
-	return err
-}